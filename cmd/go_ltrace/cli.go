@@ -0,0 +1,519 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/yomaytk/go_ltrace/pkg/commands"
+	"github.com/yomaytk/go_ltrace/pkg/config"
+	"github.com/yomaytk/go_ltrace/pkg/image"
+	"github.com/yomaytk/go_ltrace/pkg/osrelease"
+	"github.com/yomaytk/go_ltrace/pkg/report"
+	vtypes "github.com/yomaytk/go_ltrace/vulndb"
+	"github.com/yomaytk/go_ltrace/vulndb/debian"
+	"github.com/yomaytk/go_ltrace/vulndb/ubuntu"
+	"golang.org/x/xerrors"
+)
+
+// command is the node of the subcommand tree. the leaf command has Run.
+type command struct {
+	Name        string
+	Short       string
+	Subcommands []*command
+	// run the command with the arguments after the command name
+	Run func(path string, args []string) error
+}
+
+var root_command = &command{
+	Name: "go_ltrace",
+	Subcommands: []*command{
+		{Name: "db", Short: "manage the vulnerability database", Subcommands: []*command{
+			{Name: "build", Short: "build the vulnerability database from ubuntu-cve-tracker or the Debian Security Tracker", Run: runDBBuild},
+			{Name: "update", Short: "pull the tracker and update the vulnerability database", Run: runDBUpdate},
+			{Name: "info", Short: "show the status of the vulnerability database", Run: runDBInfo},
+		}},
+		{Name: "trace", Short: "trace the command at executed time", Subcommands: []*command{
+			{Name: "strace", Short: "find the shared libraries opened by the command", Run: runTraceStrace},
+			{Name: "ltrace", Short: "find the library functions called by the command", Run: runTraceLtrace},
+		}},
+		{Name: "scan", Short: "analyze the binary without executing it", Subcommands: []*command{
+			{Name: "static", Short: "resolve the shared libraries and imported functions of the ELF", Run: runScanStatic},
+			{Name: "snapshot", Short: "collect the shared libraries mapped by the running processes from /proc", Run: runScanSnapshot},
+			{Name: "image", Short: "resolve the shared libraries of the entrypoint of the OCI or docker save image", Run: runScanImage},
+		}},
+		{Name: "report", Short: "convert the json report to another format", Run: runReport},
+	},
+}
+
+// the settings of the config file overridden by the global flags
+var conf = config.Default()
+
+// loadConfig reads the config file and the global flags before the command, and returns the rest arguments.
+func loadConfig(args []string) ([]string, error) {
+
+	flags := flag.NewFlagSet(root_command.Name, flag.ExitOnError)
+	config_path := flags.String("config", "", "config file (default: "+config.DefaultPath()+" and ./"+config.PROJECT_CONFIG_FILE+")")
+	db_path := flags.String("db", "", "Ubuntu vulnerability database path")
+	tracker_path := flags.String("tracker", "", "ubuntu-cve-tracker checkout path")
+	debian_db_path := flags.String("debian-db", "", "Debian vulnerability database path")
+	debian_tracker_path := flags.String("debian-tracker", "", "security-tracker checkout path or its JSON export")
+	log_path := flags.String("log", "", "log file path (-log= disables the log)")
+	cache_dir := flags.String("cache-dir", "", "cache directory")
+	git_mirror := flags.String("git-mirror", "", "local mirror directory of the upstream repositories")
+	osv_path := flags.String("osv", "", "OSV records (directory or zip dump) to scan the language packages")
+	flags.Usage = func() {
+		printCommandUsage(root_command, root_command.Name)
+		fmt.Fprintf(flags.Output(), "\nglobal flags:\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	loaded, err := config.Load(*config_path)
+	if err != nil {
+		return nil, err
+	}
+	conf = loaded
+
+	// the flags set explicitly override the config file
+	overrides := map[string]*string{"db": &conf.DBPath, "tracker": &conf.TrackerPath, "debian-db": &conf.DebianDBPath, "debian-tracker": &conf.DebianTrackerPath,
+		"log": &conf.LogPath, "cache-dir": &conf.CacheDir, "git-mirror": &conf.GitMirrorDir, "osv": &conf.OSVPath}
+	values := map[string]*string{"db": db_path, "tracker": tracker_path, "debian-db": debian_db_path, "debian-tracker": debian_tracker_path,
+		"log": log_path, "cache-dir": cache_dir, "git-mirror": git_mirror, "osv": osv_path}
+	flags.Visit(func(f *flag.Flag) {
+		if item, ok := overrides[f.Name]; ok {
+			*item = *values[f.Name]
+		}
+	})
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return nil, xerrors.Errorf("no command is specified.\n")
+	}
+
+	return flags.Args(), nil
+}
+
+// runCommand dispatches the arguments to the subcommand
+func runCommand(cmd *command, path string, args []string) error {
+
+	if cmd.Run != nil {
+		return cmd.Run(path, args)
+	}
+
+	if len(args) == 0 {
+		printCommandUsage(cmd, path)
+		return xerrors.Errorf("'%v' requires a subcommand.\n", path)
+	}
+	switch args[0] {
+	case "-h", "-help", "--help", "help":
+		printCommandUsage(cmd, path)
+		return nil
+	}
+	for _, subcommand := range cmd.Subcommands {
+		if strings.Compare(subcommand.Name, args[0]) == 0 {
+			return runCommand(subcommand, path+" "+subcommand.Name, args[1:])
+		}
+	}
+	printCommandUsage(cmd, path)
+	return xerrors.Errorf("unknown command '%v %v'.\n", path, args[0])
+}
+
+func printCommandUsage(cmd *command, path string) {
+	global_flags := ""
+	if cmd == root_command {
+		global_flags = "[global flags] "
+	}
+	fmt.Fprintf(os.Stderr, "usage: %v %v<command> [flags] [args]\n\ncommands:\n", path, global_flags)
+	w := tabwriter.NewWriter(os.Stderr, 0, 8, 2, ' ', 0)
+	for _, subcommand := range cmd.Subcommands {
+		fmt.Fprintf(w, "  %v\t%v\n", subcommand.Name, subcommand.Short)
+	}
+	w.Flush()
+	fmt.Fprintf(os.Stderr, "\nrun '%v <command> --help' for the flags of the command.\n", path)
+}
+
+// the flag set of the leaf command. --help prints the usage and exits.
+func newFlagSet(path string, args_usage string) *flag.FlagSet {
+	flags := flag.NewFlagSet(path, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %v [flags] %v\n\nflags:\n", path, args_usage)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+type reportFlags struct {
+	Format *string
+	Output *string
+}
+
+// check the flags before the scan
+func (report_flags reportFlags) validate() error {
+	if !report.SupportedFormat(*report_flags.Format) {
+		return xerrors.Errorf("unknown report format: %v\n", *report_flags.Format)
+	}
+	return nil
+}
+
+func addReportFlags(flags *flag.FlagSet) reportFlags {
+	return reportFlags{
+		Format: flags.String("format", conf.Format, "report format (text, json, sarif, cyclonedx, spdx, openvex)"),
+		Output: flags.String("output", "", "report output path (default: stdout)"),
+	}
+}
+
+// the database operation of the vulnerability source
+type dbOperation interface {
+	NewDB() ([]vtypes.Failure, error)
+	UpdateSource() error
+	GetDBInfo() (ubuntu.DBInfo, error)
+}
+
+// the name of the tracker for every distro
+var tracker_names = map[string]string{osrelease.ID_UBUNTU: "ubuntu-cve-tracker", osrelease.ID_DEBIAN: "security-tracker"}
+
+// the default distro is the host's, which the scans without -root detect by os-release
+func addDistroFlag(flags *flag.FlagSet) *string {
+	return flags.String("distro", hostDistro(), "the distro of the vulnerability source (ubuntu, debian)")
+}
+
+// the distro of the host, or ubuntu if the host has no vulnerability source
+func hostDistro() string {
+	os_release, err := osrelease.Read("")
+	if err != nil {
+		return osrelease.ID_UBUNTU
+	}
+	distro, _ := os_release.Distro()
+	if _, ok := tracker_names[distro]; !ok {
+		return osrelease.ID_UBUNTU
+	}
+	return distro
+}
+
+// the database operation and the database path of the distro
+func newDBOperation(distro string) (dbOperation, string, error) {
+	switch distro {
+	case osrelease.ID_UBUNTU:
+		return ubuntu.NewDBOperation(conf.VulnDBPath(), conf.TrackerPath), conf.VulnDBPath(), nil
+	case osrelease.ID_DEBIAN:
+		return debian.NewDBOperation(conf.DebianVulnDBPath(), conf.DebianTrackerPath), conf.DebianVulnDBPath(), nil
+	default:
+		return nil, "", xerrors.Errorf("unknown distro: %v (supported: %v, %v)\n", distro, osrelease.ID_UBUNTU, osrelease.ID_DEBIAN)
+	}
+}
+
+func runDBBuild(path string, args []string) error {
+
+	flags := newFlagSet(path, "")
+	distro := addDistroFlag(flags)
+	flags.Parse(args)
+
+	dop, db_path, err := newDBOperation(*distro)
+	if err != nil {
+		return err
+	}
+	// build from scratch
+	if err := os.Remove(db_path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return xerrors.Errorf("cannot remove %v: %w", db_path, err)
+	}
+
+	return buildDB(dop)
+}
+
+// build VulnDB and print the CVE entries which are skipped
+func buildDB(dop dbOperation) error {
+	failures, err := dop.NewDB()
+	if err != nil {
+		return err
+	}
+	for _, failure := range failures {
+		fmt.Fprintf(os.Stderr, "skipped %v: %v\n", failure.CVE, failure.Error)
+	}
+	return nil
+}
+
+func runDBUpdate(path string, args []string) error {
+
+	flags := newFlagSet(path, "")
+	distro := addDistroFlag(flags)
+	flags.Parse(args)
+
+	dop, _, err := newDBOperation(*distro)
+	if err != nil {
+		return err
+	}
+	if err := dop.UpdateSource(); err != nil {
+		return err
+	}
+
+	return buildDB(dop)
+}
+
+func runDBInfo(path string, args []string) error {
+
+	flags := newFlagSet(path, "")
+	distro := addDistroFlag(flags)
+	flags.Parse(args)
+
+	dop, _, err := newDBOperation(*distro)
+	if err != nil {
+		return err
+	}
+	info, err := dop.GetDBInfo()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "path:\t%v\n", info.Path)
+	fmt.Fprintf(w, "size:\t%v bytes\n", info.Size)
+	fmt.Fprintf(w, "updated:\t%v\n", info.ModTime.Format(time.RFC3339))
+	fmt.Fprintf(w, "cves:\t%v\n", info.CVEs)
+	fmt.Fprintf(w, "packages:\t%v\n", info.Packages)
+	if strings.Compare(info.TrackerRev, "") != 0 {
+		fmt.Fprintf(w, "%v:\t%v\n", tracker_names[*distro], info.TrackerRev)
+	}
+
+	return w.Flush()
+}
+
+// trace the command or the running process (-pid) by the mode. the command is statically analyzed too if -static is set.
+func runTrace(path string, args []string, mode string) error {
+
+	flags := newFlagSet(path, "-- <command> [args...] | -pid <pid>")
+	report_flags := addReportFlags(flags)
+	static := flags.Bool("static", false, "analyze the command statically too and print the difference of the libraries")
+	pid := flags.Int("pid", 0, "attach to the running process and its descendants instead of executing the command")
+	duration := flags.Duration("duration", 0, "stop tracing the process after the duration (default: until SIGINT or SIGTERM)")
+	root := flags.String("root", "", "run the command in the chroot of the directory, and use its os-release and dpkg database")
+	flags.Parse(args)
+
+	target_args := flags.Args()
+	if *pid > 0 && len(target_args) > 0 {
+		flags.Usage()
+		return xerrors.Errorf("'%v' accepts either -pid or the command.\n", path)
+	}
+	if *pid <= 0 && len(target_args) == 0 {
+		flags.Usage()
+		return xerrors.Errorf("'%v' requires the command to trace.\n", path)
+	}
+	if *duration > 0 && *pid <= 0 {
+		return xerrors.Errorf("-duration is only for -pid.\n")
+	}
+	if strings.Compare(*root, "") != 0 && *pid > 0 {
+		return xerrors.Errorf("-root is not for -pid.\n")
+	}
+	if err := report_flags.validate(); err != nil {
+		return err
+	}
+
+	if *pid > 0 {
+		process_args, err := commands.ProcessCommand(*pid)
+		if err != nil {
+			return err
+		}
+		target_args = process_args
+	}
+
+	var runner *Runner
+	var err error
+	if strings.Compare(*root, "") != 0 {
+		runner, err = NewRootRunner(conf, *root)
+	} else {
+		runner, err = NewRunner(conf)
+	}
+	if err != nil {
+		return err
+	}
+	dynamically_linked, err := runner.Cmds.DynamicallyLinked(target_args[:1])
+	if err != nil {
+		return err
+	}
+	if !dynamically_linked {
+		return xerrors.Errorf("%v is not dynamically linked.\n", target_args[0])
+	}
+
+	scan_report := report.NewReport(target_args, runner.Cmds.Distro, runner.Cmds.OsVersion)
+	var static_scan report.Scan
+	if *static {
+		static_scan, err = runner.Static(target_args)
+		if err != nil {
+			return err
+		}
+		scan_report.AddScan(static_scan)
+	}
+
+	var scan report.Scan
+	switch {
+	case strings.Compare(mode, report.MODE_STRACE) == 0 && *pid > 0:
+		scan, err = runner.StraceAttach(*pid, *duration)
+	case strings.Compare(mode, report.MODE_STRACE) == 0:
+		scan, err = runner.Strace(target_args)
+	case *pid > 0:
+		scan, err = runner.LtraceAttach(*pid, *duration)
+	default:
+		scan, err = runner.Ltrace(target_args)
+	}
+	if err != nil {
+		return err
+	}
+	if *static {
+		compareLibs(static_scan, scan, runner.Cmds.Root)
+	}
+	scan_report.AddScan(scan)
+
+	return writeReport(scan_report, *report_flags.Format, *report_flags.Output)
+}
+
+func runTraceStrace(path string, args []string) error {
+	return runTrace(path, args, report.MODE_STRACE)
+}
+
+func runTraceLtrace(path string, args []string) error {
+	return runTrace(path, args, report.MODE_LTRACE)
+}
+
+func runScanStatic(path string, args []string) error {
+
+	flags := newFlagSet(path, "<binary>")
+	report_flags := addReportFlags(flags)
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return xerrors.Errorf("'%v' requires one binary.\n", path)
+	}
+	if err := report_flags.validate(); err != nil {
+		return err
+	}
+
+	runner, err := NewRunner(conf)
+	if err != nil {
+		return err
+	}
+	scan_report := report.NewReport(flags.Args(), runner.Cmds.Distro, runner.Cmds.OsVersion)
+	scan, err := runner.Static(flags.Args())
+	if err != nil {
+		return err
+	}
+	scan_report.AddScan(scan)
+
+	return writeReport(scan_report, *report_flags.Format, *report_flags.Output)
+}
+
+func runScanSnapshot(path string, args []string) error {
+
+	flags := newFlagSet(path, "")
+	report_flags := addReportFlags(flags)
+	flags.Parse(args)
+
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return xerrors.Errorf("'%v' takes no arguments.\n", path)
+	}
+	if err := report_flags.validate(); err != nil {
+		return err
+	}
+
+	runner, err := NewRunner(conf)
+	if err != nil {
+		return err
+	}
+	// the target of the snapshot is the host
+	hostname, err := os.Hostname()
+	if err != nil {
+		return xerrors.Errorf("cannot get the hostname: %w", err)
+	}
+	scan_report := report.NewReport([]string{hostname}, runner.Cmds.Distro, runner.Cmds.OsVersion)
+	scans, err := runner.Snapshot()
+	if err != nil {
+		return err
+	}
+	for _, scan := range scans {
+		scan_report.AddScan(scan)
+	}
+
+	return writeReport(scan_report, *report_flags.Format, *report_flags.Output)
+}
+
+func runScanImage(path string, args []string) error {
+
+	flags := newFlagSet(path, "<image tarball or directory>")
+	report_flags := addReportFlags(flags)
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return xerrors.Errorf("'%v' requires one image.\n", path)
+	}
+	if err := report_flags.validate(); err != nil {
+		return err
+	}
+
+	root, err := os.MkdirTemp("", "go_ltrace-rootfs-")
+	if err != nil {
+		return xerrors.Errorf("cannot create the temporary directory: %w", err)
+	}
+	defer os.RemoveAll(root)
+
+	fmt.Fprintln(os.Stderr, "[+] Image Extract Start.")
+	img, err := image.Extract(flags.Arg(0), root)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "[-] Image Extract End.")
+
+	// the os-release and the dpkg database of the image
+	runner, err := NewRootRunner(conf, root)
+	if err != nil {
+		return err
+	}
+	exe_path, err := img.Executable()
+	if err != nil {
+		return err
+	}
+
+	scan_report := report.NewReport(img.Command(), runner.Cmds.Distro, runner.Cmds.OsVersion)
+	scan_report.Image = img.Reference
+	scan, err := runner.Static([]string{exe_path})
+	if err != nil {
+		return err
+	}
+	scan_report.AddScan(scan)
+
+	return writeReport(scan_report, *report_flags.Format, *report_flags.Output)
+}
+
+func runReport(path string, args []string) error {
+
+	flags := newFlagSet(path, "<json report>")
+	report_flags := addReportFlags(flags)
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return xerrors.Errorf("'%v' requires one report file.\n", path)
+	}
+	if err := report_flags.validate(); err != nil {
+		return err
+	}
+
+	f, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return xerrors.Errorf("cannot open %v: %w", flags.Arg(0), err)
+	}
+	defer f.Close()
+
+	scan_report, err := report.Load(f)
+	if err != nil {
+		return err
+	}
+
+	return writeReport(scan_report, *report_flags.Format, *report_flags.Output)
+}
@@ -1,100 +1,379 @@
 package main
 
 import (
-	"flag"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/yomaytk/go_ltrace/log"
 	"github.com/yomaytk/go_ltrace/pkg/commands"
+	"github.com/yomaytk/go_ltrace/pkg/config"
+	"github.com/yomaytk/go_ltrace/pkg/osrelease"
+	"github.com/yomaytk/go_ltrace/pkg/report"
+	"github.com/yomaytk/go_ltrace/pkg/snapshot"
+	ttypes "github.com/yomaytk/go_ltrace/types"
 	uutil "github.com/yomaytk/go_ltrace/util"
+	vtypes "github.com/yomaytk/go_ltrace/vulndb"
+	"github.com/yomaytk/go_ltrace/vulndb/debian"
+	git "github.com/yomaytk/go_ltrace/vulndb/gitrepo"
+	"github.com/yomaytk/go_ltrace/vulndb/osv"
 	"github.com/yomaytk/go_ltrace/vulndb/ubuntu"
+	"golang.org/x/xerrors"
 )
 
 type Runner struct {
-	Uop  *ubuntu.UbuntuOperation
-	Cmds *commands.CommandSet
+	// the vulnerability source of the distro
+	Source vtypes.Source
+	// the vulnerability source of the language packages (nil if the OSV records are not set)
+	Language vtypes.Source
+	Cmds     *commands.CommandSet
 }
 
-func NewRunner(github_author_name string) *Runner {
-	cmds := commands.NewCommandSet()
-	return &Runner{Uop: ubuntu.NewUbuntuOperation(github_author_name, cmds.OsVersion), Cmds: cmds}
+func NewRunner(conf config.Config) (*Runner, error) {
+	cmds, err := commands.NewCommandSet()
+	if err != nil {
+		return nil, err
+	}
+	return newRunner(conf, cmds)
 }
 
-func (runner Runner) Run(target_args []string) {
+// NewRootRunner analyzes the system in the root directory (ex. the rootfs of the container image) instead of the host
+func NewRootRunner(conf config.Config, root string) (*Runner, error) {
+	cmds, err := commands.NewRootCommandSet(root)
+	if err != nil {
+		return nil, err
+	}
+	return newRunner(conf, cmds)
+}
 
-	var ltrace, strace, new_db bool
-	ltrace = strings.Compare(os.Getenv("GOSCAN_LTRACE"), "on") == 0
-	strace = strings.Compare(os.Getenv("GOSCAN_STRACE"), "on") == 0
-	new_db = strings.Compare(os.Getenv("GOSCAN_NEWDB"), "on") == 0
+func newRunner(conf config.Config, cmds *commands.CommandSet) (*Runner, error) {
 
-	// construct Initial DB
-	if new_db {
-		runner.Uop.NewDB()
+	switch cmds.Distro {
+	case osrelease.ID_UBUNTU, osrelease.ID_DEBIAN:
+		if strings.Compare(cmds.OsVersion, "") == 0 {
+			return nil, xerrors.Errorf("the codename of %v is not found in os-release.\n", cmds.OSRelease)
+		}
+	default:
+		return nil, xerrors.Errorf("no vulnerability source for %v (supported: %v, %v).\n", cmds.OSRelease, osrelease.ID_UBUNTU, osrelease.ID_DEBIAN)
+	}
+	if strings.Compare(cmds.Distro, cmds.OSRelease.ID) != 0 {
+		fmt.Fprintf(os.Stderr, "%v is scanned as %v %v.\n", cmds.OSRelease, cmds.Distro, cmds.OsVersion)
 	}
 
-	// trace the target program at executed time
-	if runner.Cmds.DynamicallyLinked(target_args) {
+	github_token, err := conf.GithubToken()
+	if err != nil {
+		return nil, err
+	}
+	git_operation := git.NewGitOperation(conf.GitMirrorDir, github_token)
 
-		// using strace (trace only used shared libraries)
-		if strace {
-			// exec strace to find used shared libraries
-			lib_map := runner.Cmds.Strace(target_args)
+	// the vulnerability source of the distro
+	var source vtypes.Source
+	switch cmds.Distro {
+	case osrelease.ID_DEBIAN:
+		source = debian.NewDebianOperation(cmds.OsVersion, conf.DebianVulnDBPath(), conf.DebianTrackerPath, git_operation)
+	default:
+		source = ubuntu.NewUbuntuOperation(cmds.OsVersion, conf.VulnDBPath(), conf.TrackerPath, git_operation)
+	}
+	runner := &Runner{Source: source, Cmds: cmds}
 
-			// exec dpkg to search the binary package for every shared library
-			package_lib_map, err := runner.Cmds.Dpkg(lib_map)
-			uutil.ErrFatal(err)
+	// the OSV records evaluate only the language packages (the dpkg packages are evaluated by the tracker of the distro)
+	if strings.Compare(conf.OSVPath, "") != 0 {
+		osv_db, failures, err := osv.Load(conf.OSVPath)
+		if err != nil {
+			return nil, err
+		}
+		if len(failures) > 0 {
+			fmt.Fprintf(os.Stderr, "%v OSV records cannot be read.\n", len(failures))
+			log.Logger.Infow("broken OSV records", "failures", failures)
+		}
+		runner.Language = osv.NewOSVOperation(osv_db, "", git_operation)
+	}
+	return runner, nil
+}
 
-			// exec apt-cache show to search source package for every binary package
-			src_bin_map, err := runner.Cmds.AptShow(package_lib_map)
-			uutil.ErrFatal(err)
-			log.Logger.Infoln("Log: src_bin_map", src_bin_map)
-			for key, value := range src_bin_map {
-				log.Logger.Infoln("%v: %v", key, value)
-			}
+// Static analyzes the target ELF without executing it (superset of the traced result)
+func (runner Runner) Static(target_args []string) (report.Scan, error) {
 
-			// get target CVEs
-			exploitable_cves, err2 := runner.Uop.GetCVEs(src_bin_map)
-			uutil.ErrFatal(err2)
+	// resolve DT_NEEDED libraries and imported functions
+	lib_map, lib_funcs_map, err := runner.Cmds.ElfDeps(target_args)
+	if err != nil {
+		return report.Scan{}, err
+	}
 
-			for sourcep, cves := range exploitable_cves {
-				fmt.Printf("sourcep: %v\n", sourcep)
-				for _, cve := range cves {
-					fmt.Printf("%v ", cve.Candidate)
-				}
-				fmt.Printf("\n")
-			}
+	return runner.scan(report.MODE_STATIC, lib_map, lib_funcs_map)
+}
+
+// Strace traces only used shared libraries of the target at executed time
+func (runner Runner) Strace(target_args []string) (report.Scan, error) {
+
+	// trace the target by ptrace to find used shared libraries
+	lib_map, err := runner.Cmds.Strace(target_args)
+	if err != nil {
+		return report.Scan{}, err
+	}
+
+	return runner.scan(report.MODE_STRACE, lib_map, map[string][]string{})
+}
+
+// StraceAttach traces the shared libraries used by the running process for the duration
+func (runner Runner) StraceAttach(pid int, duration time.Duration) (report.Scan, error) {
+
+	lib_map, err := runner.Cmds.StraceAttach(pid, duration)
+	if err != nil {
+		return report.Scan{}, err
+	}
+
+	return runner.scan(report.MODE_STRACE, lib_map, map[string][]string{})
+}
+
+// Ltrace traces the coverage of shared libraries of the target at executed time
+func (runner Runner) Ltrace(target_args []string) (report.Scan, error) {
+
+	// hook the library calls to find used shared libraries and called functions
+	lib_map, lib_funcs_map, err := runner.Cmds.Ltrace(target_args)
+	if err != nil {
+		return report.Scan{}, err
+	}
+
+	return runner.scan(report.MODE_LTRACE, lib_map, lib_funcs_map)
+}
+
+// LtraceAttach traces the library calls of the running process for the duration
+func (runner Runner) LtraceAttach(pid int, duration time.Duration) (report.Scan, error) {
+
+	lib_map, lib_funcs_map, err := runner.Cmds.LtraceAttach(pid, duration)
+	if err != nil {
+		return report.Scan{}, err
+	}
+
+	return runner.scan(report.MODE_LTRACE, lib_map, lib_funcs_map)
+}
+
+// Snapshot collects the shared libraries mapped by the running processes from /proc without tracing them.
+// the processes on the host are the first scan, and the processes of every container are the scan of the container.
+func (runner Runner) Snapshot() ([]report.Scan, error) {
+
+	fmt.Fprintln(os.Stderr, "[+] Snapshot Start.")
+
+	processes, skipped, err := snapshot.Processes(snapshot.PROC_DIR)
+	if err != nil {
+		return nil, err
+	}
+	if skipped > 0 {
+		fmt.Fprintf(os.Stderr, "%v processes cannot be read (run as root to read every process).\n", skipped)
+	}
+
+	fmt.Fprintln(os.Stderr, "[-] Snapshot End.")
+
+	host_processes, container_processes := snapshot.SplitContainers(processes)
+	scan, err := runner.scan(report.MODE_SNAPSHOT, snapshot.LibMap(host_processes), map[string][]string{})
+	if err != nil {
+		return nil, err
+	}
+	scan.AddProcesses(host_processes)
+	scans := []report.Scan{scan}
+
+	containers := []string{}
+	for container := range container_processes {
+		containers = append(containers, container)
+	}
+	sort.Strings(containers)
+	for _, container := range containers {
+		scan, err := runner.containerSnapshot(container, container_processes[container])
+		if err != nil {
+			return nil, err
 		}
+		scans = append(scans, scan)
+	}
+	return scans, nil
+}
 
-		// using ltrace (trace coverage of shared libraries)
-		if ltrace {
-			// TODO
+// containerSnapshot resolves the libraries of the container processes by the dpkg database in the root of the container.
+// the libraries are not resolved if the root cannot be read or the container is not the same release as the host,
+// whose vulnerability database is used.
+func (runner Runner) containerSnapshot(container string, processes []snapshot.Process) (report.Scan, error) {
+
+	lib_map := snapshot.LibMap(processes)
+	cmds, err := commands.NewProcessRootCommandSet(snapshot.RootDir(snapshot.PROC_DIR, processes[0].Pid))
+	if err == nil && (strings.Compare(cmds.Distro, runner.Cmds.Distro) != 0 || strings.Compare(cmds.OsVersion, runner.Cmds.OsVersion) != 0) {
+		err = xerrors.Errorf("%v %v is not the release of the host %v %v.\n", cmds.Distro, cmds.OsVersion, runner.Cmds.Distro, runner.Cmds.OsVersion)
+	}
+	if err != nil {
+		log.Logger.Infoln("cannot resolve the libraries of the container", container, err)
+		scan := report.NewScan(report.MODE_SNAPSHOT, lib_map, map[string][]string{}, map[ttypes.PackageDetail][]string{}, []vtypes.Finding{})
+		scan.AddFailures([]vtypes.Failure{vtypes.NewFailure("container "+container[:12], "", xerrors.Errorf("the libraries are not resolved: %w", err))})
+		scan.Container = container
+		scan.AddProcesses(processes)
+		return scan, nil
+	}
+
+	container_runner := Runner{Source: runner.Source, Language: runner.Language, Cmds: cmds}
+	scan, err := container_runner.scan(report.MODE_SNAPSHOT, lib_map, map[string][]string{})
+	if err != nil {
+		return report.Scan{}, err
+	}
+	scan.Container = container
+	scan.AddProcesses(processes)
+	return scan, nil
+}
+
+// scan finds the installed packages of the libraries and their CVEs.
+// the CVEs are filtered by the used functions except for strace and snapshot, which know only the used libraries.
+func (runner Runner) scan(mode string, lib_map map[string]bool, lib_funcs_map map[string][]string) (report.Scan, error) {
+
+	log.Logger.Infoln("Log: lib_funcs_map", lib_funcs_map)
+
+	// search the language packages first, whose directory may be owned by the dpkg package (ex. /usr/local/lib)
+	lang_bin_map, err := runner.Cmds.LanguagePackages(lib_map)
+	if err != nil {
+		return report.Scan{}, err
+	}
+	log.Logger.Infoln("Log: lang_bin_map", lang_bin_map)
+	dpkg_lib_map := map[string]bool{}
+	for lib := range lib_map {
+		dpkg_lib_map[lib] = true
+	}
+	for _, libs := range lang_bin_map {
+		for _, lib := range libs {
+			delete(dpkg_lib_map, lib)
 		}
+	}
+
+	// exec dpkg to search the binary package for every shared library
+	package_lib_map, err := runner.Cmds.Dpkg(dpkg_lib_map)
+	if err != nil {
+		return report.Scan{}, err
+	}
+
+	// search the source package and the installed version for every binary package
+	src_bin_map, err := runner.Cmds.DpkgStatus(package_lib_map)
+	if err != nil {
+		return report.Scan{}, err
+	}
+	log.Logger.Infoln("Log: src_bin_map", src_bin_map)
+
+	// the fixed functions are compared with the called functions only if they are exported
+	lib_exports_map := map[string][]string{}
+	if reachable(mode) {
+		lib_exports_map = runner.Cmds.ExportedFuncs(lib_map)
+	}
+
+	// get target CVEs (whose fixed functions are imported or called)
+	findings, failures, err := getCVEs(runner.Source, mode, src_bin_map, lib_funcs_map, lib_exports_map)
+	if err != nil {
+		return report.Scan{}, err
+	}
+	if runner.Language != nil {
+		lang_findings, lang_failures, err := getCVEs(runner.Language, mode, lang_bin_map, lib_funcs_map, lib_exports_map)
+		if err != nil {
+			return report.Scan{}, err
+		}
+		findings = append(findings, lang_findings...)
+		failures = append(failures, lang_failures...)
+	}
+	for package_detail, libs := range lang_bin_map {
+		src_bin_map[package_detail] = libs
+	}
 
+	scan := report.NewScan(mode, lib_map, lib_funcs_map, src_bin_map, findings)
+	scan.AddFailures(failures)
+	return scan, nil
+}
+
+// the CVEs filtered by the used functions except for strace and snapshot
+func getCVEs(source vtypes.Source, mode string, src_bin_map map[ttypes.PackageDetail][]string, lib_funcs_map map[string][]string, lib_exports_map map[string][]string) ([]vtypes.Finding, []vtypes.Failure, error) {
+	if !reachable(mode) {
+		return source.GetCVEs(src_bin_map)
 	}
+	return source.GetReachableCVEs(src_bin_map, lib_funcs_map, lib_exports_map)
+}
 
+// strace and snapshot know only the used libraries
+func reachable(mode string) bool {
+	switch mode {
+	case report.MODE_STRACE, report.MODE_SNAPSHOT:
+		return false
+	default:
+		return true
+	}
+}
+
+// print the difference between the statically resolved libraries and the traced libraries (the paths in root)
+func compareLibs(static_scan report.Scan, scan report.Scan, root string) {
+	resolved := func(path string) string {
+		if strings.Compare(root, "") != 0 {
+			if host_path, err := uutil.RootPath(root, path); err == nil {
+				return host_path
+			}
+			return path
+		}
+		if real_path, err := filepath.EvalSymlinks(path); err == nil {
+			return real_path
+		}
+		return path
+	}
+	static_real_map := map[string]bool{}
+	for _, lib := range static_scan.Libraries {
+		static_real_map[resolved(lib.Path)] = true
+	}
+	real_map := map[string]bool{}
+	for _, lib := range scan.Libraries {
+		real_map[resolved(lib.Path)] = true
+		// loaded by dlopen, etc.
+		if !static_real_map[resolved(lib.Path)] {
+			fmt.Fprintf(os.Stderr, "only traced: %v\n", lib.Path)
+		}
+	}
+	for _, lib := range static_scan.Libraries {
+		if !real_map[resolved(lib.Path)] {
+			fmt.Fprintf(os.Stderr, "only static: %v\n", lib.Path)
+		}
+	}
+}
+
+// write the report to the output path or stdout
+func writeReport(scan_report *report.Report, format string, output string) error {
+	if strings.Compare(output, "") == 0 {
+		return scan_report.Write(os.Stdout, format)
+	}
+	f, err := os.Create(output)
+	if err != nil {
+		return xerrors.Errorf("cannot create %v: %w", output, err)
+	}
+	defer f.Close()
+	return scan_report.Write(f, format)
 }
 
 func main() {
 
-	// setting env var
-	err := godotenv.Load()
-	uutil.ErrFatal(err)
+	// setting env var (.env is optional)
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		fmt.Fprintf(os.Stderr, "go_ltrace: cannot load .env: %v\n", err)
+		os.Exit(2)
+	}
 
-	// read flag
-	flag.Parse()
+	// read the config file and the global flags
+	args, err := loadConfig(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "go_ltrace: %v\n", strings.TrimSpace(err.Error()))
+		os.Exit(2)
+	}
 
 	// initialize logger
-	log.InitLogger()
+	if err := log.InitLogger(conf.LogPath); err != nil {
+		fmt.Fprintf(os.Stderr, "go_ltrace: the log is disabled: %v\n", strings.TrimSpace(err.Error()))
+	}
 	defer log.Logger.Sync()
 
-	if len(os.Args) < 2 {
-		panic("too few arguments.\n")
+	// run the subcommand
+	if err := runCommand(root_command, root_command.Name, args); err != nil {
+		fmt.Fprintf(os.Stderr, "go_ltrace: %v\n", strings.TrimSpace(err.Error()))
+		os.Exit(1)
 	}
-
-	// run main process
-	runner := NewRunner("yomaytk")
-	runner.Run(os.Args[1:])
 }
@@ -1,10 +1,14 @@
 package log
 
 import (
+	"errors"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"strings"
 
-	uutil "github.com/yomaytk/go_ltrace/util"
 	"go.uber.org/zap"
+	"golang.org/x/xerrors"
 )
 
 var (
@@ -12,24 +16,28 @@ var (
 	Config zap.Config
 )
 
-const (
-	LOG_PATH = "/home/masashi/workspace/security/go_ltrace/cache/go_ltrace.log"
-)
+// InitLogger writes the log to the file. the log is discarded if the path is "".
+func InitLogger(log_path string) error {
 
-func InitLogger() error {
+	Logger = zap.NewNop().Sugar()
+	if strings.Compare(log_path, "") == 0 {
+		return nil
+	}
 
 	// remove if log file exist (for debug)
-	if _, err := os.Stat(LOG_PATH); err == nil {
-		err = os.Remove(LOG_PATH)
-		uutil.ErrFatal(err)
-	} else {
-		uutil.ErrFatal(err)
+	if err := os.Remove(log_path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return xerrors.Errorf("cannot remove %v: %w", log_path, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(log_path), 0755); err != nil {
+		return xerrors.Errorf("cannot create the log directory: %w", err)
 	}
 
 	Config = zap.NewProductionConfig()
-	Config.OutputPaths = []string{LOG_PATH}
+	Config.OutputPaths = []string{log_path}
 	logger, err := Config.Build()
+	if err != nil {
+		return xerrors.Errorf("cannot build the logger: %w", err)
+	}
 	Logger = logger.Sugar()
-	uutil.ErrFatal(err)
 	return nil
 }
@@ -1,14 +1,19 @@
 package commands
 
 import (
-	"bytes"
-	"flag"
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
+	"time"
 
 	log "github.com/yomaytk/go_ltrace/log"
+	"github.com/yomaytk/go_ltrace/pkg/dpkg"
+	"github.com/yomaytk/go_ltrace/pkg/elfdep"
+	"github.com/yomaytk/go_ltrace/pkg/langpkg"
+	"github.com/yomaytk/go_ltrace/pkg/osrelease"
+	"github.com/yomaytk/go_ltrace/pkg/tracer"
 	ttypes "github.com/yomaytk/go_ltrace/types"
 	uutil "github.com/yomaytk/go_ltrace/util"
 	"golang.org/x/xerrors"
@@ -16,297 +21,339 @@ import (
 
 // Linux command
 const (
-	CMD_LTRACE      = "ltrace"
-	CMD_STRACE      = "strace"
-	CMD_FILE        = "file"
-	CMD_DPKG        = "dpkg"
-	CMD_APTCACHE    = "apt-cache"
-	CMD_GREP        = "grep"
-	CMD_LSB_RELEASE = "lsb_release"
-	CMD_GO          = "go"
+	CMD_FILE = "file"
+	CMD_GO   = "go"
 )
 
-// cache file
-const (
-	LTARCE_OUTPUT_FILE = "lt_out"
-	STRACE_OUTPUT_FILE = "st_out"
-	CACHE_DIR          = "$HOME/.cache/"
-)
+type CommandSet struct {
+	// the os-release of the analyzed system
+	OSRelease osrelease.OSRelease
+	// the distro and the codename of the installed packages. ex.) ubuntu, jammy
+	Distro    string
+	OsVersion string
+	// the root directory of the analyzed system ("" is the host). ex.) the rootfs of the container image
+	Root   string
+	Parser Parser
+	DpkgDB *dpkg.Database
+	// profile path for go tool covdata
+	Profile string
+}
 
-// flag arguments
-var (
-	Profile = flag.String("profile", "", "profile path for go tool covdata")
-)
+func NewCommandSet() (*CommandSet, error) {
+	return newCommandSet("")
+}
 
-// command options
-var (
-	LtraceOptions           = []string{"-o", LTARCE_OUTPUT_FILE, "-f"}
-	StraceOptions           = []string{"-o", STRACE_OUTPUT_FILE, "-s", "1000", "-f", "-e", "trace=openat"}
-	DpkgOptions             = []string{"-S"}
-	AptshowGrepOptions      = []string{"-E", "Package:|Version:|Source:"}
-	AptcacheOptions         = []string{"show"}
-	LsbReleaseOptions       = []string{"-a"}
-	GoToolCovdataOptions    = []string{"tool", "covdata", "textfmt", "-i=" + os.Getenv("COVERDIR"), "-o", *Profile}
-	GoToolGetFuncCovOptions = []string{"tool", "cover", "-func=" + *Profile}
-)
+// NewRootCommandSet analyzes the system in the root directory by its own os-release and dpkg database.
+func NewRootCommandSet(root string) (*CommandSet, error) {
+	// /proc shows the real path of the root, which is compared with the traced paths
+	abs_root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot get the absolute path of %v: %w", root, err)
+	}
+	root, err = filepath.EvalSymlinks(abs_root)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot find the root %v: %w", abs_root, err)
+	}
+	return newCommandSet(root)
+}
 
-type CommandSet struct {
-	OsVersion string
-	Parser    Parser
+// NewProcessRootCommandSet analyzes the mount namespace of the running process by /proc/<pid>/root.
+// the link is not resolved, because it shows the root in the namespace of the process (ex. "/").
+func NewProcessRootCommandSet(proc_root string) (*CommandSet, error) {
+	return newCommandSet(proc_root)
 }
 
-func NewCommandSet() *CommandSet {
-	cmds := &CommandSet{Parser: Parser{}}
-	cmds.getOsVersion()
-	return cmds
+// detect the distro by os-release instead of lsb_release, which the minimal image doesn't have
+func newCommandSet(root string) (*CommandSet, error) {
+	os_release, err := osrelease.Read(root)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot detect the distro: %w", err)
+	}
+	distro, os_version := os_release.Distro()
+	return &CommandSet{OSRelease: os_release, Distro: distro, OsVersion: os_version, Root: root, Parser: Parser{}, DpkgDB: dpkg.NewDatabase(root)}, nil
 }
 
 func (cmds *CommandSet) goToolCovdata() (string, error) {
 
-	if strings.Compare(*Profile, "") == 0 {
+	if strings.Compare(cmds.Profile, "") == 0 {
 		return "", xerrors.Errorf("-profile should be set.\n")
 	}
 
-	cmd := exec.Command(CMD_GO, GoToolCovdataOptions...)
-	err := cmd.Run()
-	uutil.ErrFatal(err)
+	cmd := exec.Command(CMD_GO, "tool", "covdata", "textfmt", "-i="+os.Getenv("COVERDIR"), "-o", cmds.Profile)
+	if err := cmd.Run(); err != nil {
+		return "", xerrors.Errorf("go tool covdata failed: %w", err)
+	}
 
-	out, err2 := exec.Command(CMD_GO, GoToolGetFuncCovOptions...).Output()
-	uutil.ErrFatal(err2)
+	out, err := exec.Command(CMD_GO, "tool", "cover", "-func="+cmds.Profile).Output()
+	if err != nil {
+		return "", xerrors.Errorf("go tool cover failed: %w", err)
+	}
 
 	return string(out), nil
 }
 
-func (cmds *CommandSet) getOsVersion() {
-
-	out, err := exec.Command(CMD_LSB_RELEASE, LsbReleaseOptions...).Output()
-	uutil.ErrFatal(err)
-
-	lines := strings.Split(string(out), "\n")
-
-	for _, line := range lines {
-		if strings.HasPrefix(line, "Codename:") {
-			cmds.OsVersion = strings.Fields(line)[1]
+// the path of the executable (the path in the root if Root is set)
+func (cmds CommandSet) lookPath(name string) (string, error) {
+	if strings.Compare(cmds.Root, "") == 0 {
+		exe_path, err := exec.LookPath(name)
+		if err != nil {
+			return "", xerrors.Errorf("cannot find %v: %w", name, err)
 		}
+		return exe_path, nil
 	}
+	return uutil.LookPath(cmds.Root, name, uutil.DEFAULT_PATH, "")
 }
 
-func (cmds CommandSet) DynamicallyLinked(trace_target []string) bool {
-	res, err := exec.Command(CMD_FILE, trace_target...).Output()
-	uutil.ErrFatal(err)
+func (cmds CommandSet) DynamicallyLinked(trace_target []string) (bool, error) {
+	exe_path, err := cmds.lookPath(trace_target[0])
+	if err != nil {
+		return false, err
+	}
+	host_path, err := uutil.RootPath(cmds.Root, exe_path)
+	if err != nil {
+		return false, err
+	}
+	res, err := exec.Command(CMD_FILE, host_path).Output()
+	if err != nil {
+		return false, xerrors.Errorf("cannot check %v by %v: %w", trace_target[0], CMD_FILE, err)
+	}
 
-	return strings.Contains(string(res), DYNAMICALLY_LINKED)
+	return strings.Contains(string(res), DYNAMICALLY_LINKED), nil
 }
 
-func (cmds CommandSet) Dpkg(lib_map map[string]bool) (map[string][]string, error) {
+func (cmds CommandSet) ElfDeps(trace_target []string) (map[string]bool, map[string][]string, error) {
 
-	fmt.Println("[+] Dpkg Start.")
+	fmt.Fprintln(os.Stderr, "[+] ElfDeps Start.")
 
-	package_lib_map := map[string][]string{}
-	var used_paths []string = []string{}
-	path_cache_map := map[string][]string{}
+	binary_path, err := cmds.lookPath(trace_target[0])
+	if err != nil {
+		return nil, nil, err
+	}
 
-	for lib := range lib_map {
-		used_paths = append(used_paths, lib)
-		path_cache_map[lib] = []string{lib}
+	// resolve DT_NEEDED and the imported functions without executing the target
+	lib_map, lib_funcs_map, err := elfdep.NewResolver(cmds.Root).Analyze(binary_path)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	// exec dpkg
-	target_paths := used_paths
-
-	for {
-
-		dpkg_args := append(DpkgOptions, target_paths...)
-		cmd := exec.Command(CMD_DPKG, dpkg_args...)
-
-		// separate stdout and stderr
-		var stdout, stderr bytes.Buffer
-		cmd.Stdout = &stdout
-		cmd.Stderr = &stderr
-		err := cmd.Run()
-		uutil.ErrFatal(err)
-
-		// get only files dpkg can find the target package
-		s := stdout.String()
-		re_search_paths, err := cmds.Parser.DpkgParse(s, package_lib_map, path_cache_map)
-		uutil.ErrFatal(err)
-
-		// add re_search_paths
-		target_paths = []string{}
-		for _, re_search_path := range re_search_paths {
-			if re_search_original_paths, ok := path_cache_map[re_search_path]; ok {
-				// /lib/... -> /usr/lib/...
-				for _, original_path := range re_search_original_paths {
-					usr_original_path := "/usr" + original_path
-					target_paths = append(target_paths, usr_original_path)
-					// update path_cache_map
-					path_cache_map[usr_original_path] = []string{original_path}
-				}
-				delete(path_cache_map, re_search_path)
-			} else {
-				return map[string][]string{}, xerrors.Errorf("Bug: re_search_target_paths must not be empty.\n")
-			}
-		}
+	fmt.Fprintln(os.Stderr, "[-] ElfDeps End.")
 
-		multiple_path_map := map[string]bool{}
-		err_s := stderr.String()
-		nohit_lines := strings.Split(err_s, "\n")
-
-		for _, line := range nohit_lines {
-			if strings.Compare(line, "") == 0 {
-				continue
-			}
-			nohit_line_tokens := strings.Fields(line)
-			nohit_path := nohit_line_tokens[len(nohit_line_tokens)-1]
-			last_slash_index := strings.LastIndex(nohit_path, "/")
-			if last_slash_index == -1 {
-				continue
-			}
-			next_path := nohit_path[:last_slash_index]
-			// append path one level above
-			if len(next_path) > 0 && !multiple_path_map[next_path] {
-				target_paths = append(target_paths, next_path)
-				multiple_path_map[next_path] = true
-			}
-			// update path_cache_map
-			nohit_original_paths := path_cache_map[nohit_path]
-			if target_original_paths, ok := path_cache_map[next_path]; ok {
-				target_original_paths = append(target_original_paths, nohit_original_paths...)
-				path_cache_map[next_path] = target_original_paths
-			} else {
-				path_cache_map[next_path] = nohit_original_paths
-			}
-			delete(path_cache_map, nohit_path)
+	return lib_map, lib_funcs_map, nil
+}
+
+// ExportedFuncs returns the functions exported by every library. the library which is not ELF exports nothing.
+func (cmds CommandSet) ExportedFuncs(lib_map map[string]bool) map[string][]string {
+	lib_exports_map := map[string][]string{}
+	for lib := range lib_map {
+		funcs, err := elfdep.ExportedFuncs(cmds.Root, lib)
+		if err != nil {
+			log.Logger.Infoln("cannot read the exported functions:", err)
+			continue
 		}
+		lib_exports_map[lib] = funcs
+	}
+	return lib_exports_map
+}
+
+func (cmds CommandSet) Dpkg(lib_map map[string]bool) (map[string][]string, error) {
+
+	fmt.Fprintln(os.Stderr, "[+] Dpkg Start.")
+
+	package_lib_map := map[string][]string{}
 
-		if len(target_paths) == 0 {
-			// TODO: error for logger
-			break
+	for lib := range lib_map {
+		packages, err := cmds.DpkgDB.Search(lib)
+		if err != nil {
+			log.Logger.Infoln(err)
+			continue
+		}
+		// key: qualified package name. ex.) libc6:amd64
+		for _, package_name := range packages {
+			package_lib_map[package_name] = append(package_lib_map[package_name], lib)
 		}
 	}
 
-	fmt.Println("[-] Dpkg End.")
+	fmt.Fprintln(os.Stderr, "[-] Dpkg End.")
 
 	return package_lib_map, nil
 }
 
-func (cmds CommandSet) AptShow(package_lib_map map[string][]string) (map[ttypes.PackageDetail][]string, error) {
+// DpkgStatus gets the installed version and the source package of the binary packages from dpkg status.
+func (cmds CommandSet) DpkgStatus(package_lib_map map[string][]string) (map[ttypes.PackageDetail][]string, error) {
 
-	fmt.Println("[+] AptShow Start.")
+	fmt.Fprintln(os.Stderr, "[+] DpkgStatus Start.")
 
 	src_bin_map := map[ttypes.PackageDetail][]string{}
-	package_list := []string{}
-	for key := range package_lib_map {
-		package_list = append(package_list, key)
+
+	for package_name, libs := range package_lib_map {
+		pkg, ok := cmds.DpkgDB.Package(package_name)
+		if !ok {
+			log.Logger.Infof("%v is not found in dpkg status.", package_name)
+			continue
+		}
+		pkg_dtl := ttypes.PackageDetail{Binaryp: pkg.Name, Sourcep: pkg.Source, Version: pkg.Version, SourceVersion: pkg.SourceVersion, Arch: pkg.Architecture}
+		src_bin_map[pkg_dtl] = append(src_bin_map[pkg_dtl], libs...)
 	}
 
-	// apt-cache show ...
-	cmd_args := append(AptcacheOptions, package_list...)
-	out1, err := exec.Command(CMD_APTCACHE, cmd_args...).Output()
-	uutil.ErrFatal(err)
+	fmt.Fprintln(os.Stderr, "[-] DpkgStatus End.")
 
-	// | grep -E 'Pacakge:|Source:' ...
-	cmd2_args := AptshowGrepOptions
-	cmd2 := exec.Command(CMD_GREP, cmd2_args...)
-	cmd2.Stdin = bytes.NewBuffer(out1)
+	return src_bin_map, nil
+}
 
-	var stdout, stderr bytes.Buffer
-	cmd2.Stdout = &stdout
-	cmd2.Stderr = &stderr
-	cmd2.Run()
+// LanguagePackages searches the language packages (PyPI, npm and Go modules) of the libraries which no dpkg package lists.
+// ex.) the Python extension module installed by pip
+func (cmds CommandSet) LanguagePackages(lib_map map[string]bool) (map[ttypes.PackageDetail][]string, error) {
 
-	lines := strings.Split(stdout.String(), "\n")
+	fmt.Fprintln(os.Stderr, "[+] LanguagePackages Start.")
 
-	for lid := 0; lid < len(lines); {
-		pkg_dtl := ttypes.PackageDetail{}
-		if strings.Compare(lines[lid], "") == 0 {
-			lid++
+	src_bin_map := map[ttypes.PackageDetail][]string{}
+	resolver := langpkg.NewResolver(cmds.Root)
+	for lib := range lib_map {
+		if cmds.DpkgDB.Owned(lib) {
 			continue
 		}
-		// get package detail
-		tokens := strings.Fields(lines[lid])
-		if strings.Compare(tokens[0], "Package:") == 0 {
-			pkg_dtl.Binaryp = tokens[1]
-			pkg_dtl.Sourcep = pkg_dtl.Binaryp
-			lid++
-			tokens2 := strings.Fields(lines[lid])
-			if strings.Compare(lines[lid], "") != 0 && strings.Compare(tokens2[0], "Version:") == 0 {
-				pkg_dtl.Version = tokens2[1]
-				lid++
-			}
-			tokens3 := strings.Fields(lines[lid])
-			if strings.Compare(lines[lid], "") != 0 && strings.Compare(tokens3[0], "Source:") == 0 {
-				pkg_dtl.Sourcep = tokens3[1]
-				lid++
-			}
-			tokens4 := strings.Fields(lines[lid])
-			if strings.Compare(lines[lid], "") != 0 && strings.Compare(tokens4[0], "Version:") == 0 {
-				pkg_dtl.Version = tokens4[1]
-				lid++
-			}
-		} else {
-			return map[ttypes.PackageDetail][]string{}, xerrors.Errorf("Bug: tokens[0]('%v') must be 'Package:'\n", tokens[0])
+		packages, err := resolver.Search(lib)
+		if err != nil {
+			log.Logger.Infoln(err)
+			continue
+		}
+		for _, pkg_dtl := range packages {
+			src_bin_map[pkg_dtl] = append(src_bin_map[pkg_dtl], lib)
 		}
-		src_bin_map[pkg_dtl] = package_lib_map[pkg_dtl.Binaryp]
 	}
 
-	if len(stderr.String()) > 0 {
-		log.Logger.Infoln("AptShow Error Log: %v", stderr.String())
+	fmt.Fprintln(os.Stderr, "[-] LanguagePackages End.")
+
+	return src_bin_map, nil
+}
+
+func (cmds CommandSet) Ltrace(trace_target []string) (map[string]bool, map[string][]string, error) {
+
+	fmt.Fprintln(os.Stderr, "[+] Ltrace Start.")
+
+	target, err := cmds.rootTarget(trace_target)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// hook the library calls with breakpoints
+	call_tracer := tracer.NewCallTracer()
+	call_tracer.Root = cmds.Root
+	lib_map, err := call_tracer.Trace(target)
+	if err != nil {
+		return nil, nil, err
 	}
+	lib_funcs_map := calledFuncs(call_tracer, lib_map)
 
-	fmt.Println("[-] AptShow End.")
+	fmt.Fprintln(os.Stderr, "[-] Ltrace End.")
 
-	return src_bin_map, nil
+	return lib_map, lib_funcs_map, nil
+}
+
+// LtraceAttach hooks the library calls of the running process tree for the duration (0 is until SIGINT or SIGTERM).
+func (cmds CommandSet) LtraceAttach(pid int, duration time.Duration) (map[string]bool, map[string][]string, error) {
+
+	fmt.Fprintln(os.Stderr, "[+] Ltrace Attach Start.")
+
+	call_tracer := tracer.NewCallTracer()
+	lib_map, err := call_tracer.Attach(pid, duration)
+	if err != nil {
+		return nil, nil, err
+	}
+	lib_funcs_map := calledFuncs(call_tracer, lib_map)
+
+	fmt.Fprintln(os.Stderr, "[-] Ltrace Attach End.")
+
+	return lib_map, lib_funcs_map, nil
 }
 
-func (cmds CommandSet) Ltrace(trace_target []string) map[string]bool {
+// the command line whose executable is searched in the root (the host searches it by exec)
+func (cmds CommandSet) rootTarget(trace_target []string) ([]string, error) {
+	if strings.Compare(cmds.Root, "") == 0 {
+		return trace_target, nil
+	}
+	exe_path, err := cmds.lookPath(trace_target[0])
+	if err != nil {
+		return nil, err
+	}
+	return append([]string{exe_path}, trace_target[1:]...), nil
+}
 
-	fmt.Println("[+] Ltrace Start.")
+// the called functions for every shared library. the libraries of the called functions are added to lib_map.
+func calledFuncs(call_tracer *tracer.Tracer, lib_map map[string]bool) map[string][]string {
 
-	trace_args := append(LtraceOptions, trace_target...)
-	cmd_ltrace := exec.Command(CMD_LTRACE, trace_args...)
-	cmd_ltrace.Stdin = os.Stdin
-	cmd_ltrace.Stdout = os.Stdout
+	// key: shared library, value: called functions
+	lib_funcs_map := map[string][]string{}
+	lib_func_map := map[string]bool{}
+	for _, call_event := range call_tracer.CallEvents() {
+		log.Logger.Infow("call", "pid", call_event.Pid, "library", call_event.Library, "symbol", call_event.Symbol, "count", call_event.Count)
+		if lib_func_map[call_event.Library+"@"+call_event.Symbol] {
+			continue
+		}
+		lib_func_map[call_event.Library+"@"+call_event.Symbol] = true
+		if funcs, ok := lib_funcs_map[call_event.Library]; ok {
+			funcs = append(funcs, call_event.Symbol)
+			lib_funcs_map[call_event.Library] = funcs
+		} else {
+			lib_funcs_map[call_event.Library] = []string{call_event.Symbol}
+		}
+		// the libraries mapped by the kernel (ex. ld-linux-x86-64.so.2) are not opened
+		lib_map[call_event.Library] = true
+	}
 
-	uutil.ErrFatal(cmd_ltrace.Start())
-	uutil.ErrFatal(cmd_ltrace.Wait())
+	return lib_funcs_map
+}
 
-	// get ltrace output
-	content, err := os.ReadFile(LTARCE_OUTPUT_FILE)
-	uutil.ErrFatal(err)
+func (cmds CommandSet) Strace(trace_target []string) (map[string]bool, error) {
 
-	s := string(content)
+	fmt.Fprintln(os.Stderr, "[+] Strace Start.")
 
-	// parse
-	_, all_call_funcs_map, err := cmds.Parser.LtraceParse(s)
-	uutil.ErrFatal(err)
+	target, err := cmds.rootTarget(trace_target)
+	if err != nil {
+		return nil, err
+	}
+
+	// trace openat/open/mmap of shared libraries by ptrace
+	lib_tracer := tracer.NewTracer()
+	lib_tracer.Root = cmds.Root
+	lib_map, err := lib_tracer.Trace(target)
+	if err != nil {
+		return nil, err
+	}
 
-	fmt.Println("[-] Ltrace End.")
+	fmt.Fprintln(os.Stderr, "[-] Strace End.")
 
-	return all_call_funcs_map
+	return lib_map, nil
 }
 
-func (cmds CommandSet) Strace(trace_target []string) map[string]bool {
+// StraceAttach traces the shared libraries opened by the running process tree for the duration (0 is until SIGINT or SIGTERM).
+func (cmds CommandSet) StraceAttach(pid int, duration time.Duration) (map[string]bool, error) {
 
-	fmt.Println("[+] Starce Start.")
+	fmt.Fprintln(os.Stderr, "[+] Strace Attach Start.")
 
-	strace_args := append(StraceOptions, trace_target...)
-	cmd_strace := exec.Command(CMD_STRACE, strace_args...)
-	cmd_strace.Stdin = os.Stdin
-	cmd_strace.Stdout = os.Stdout
+	lib_map, err := tracer.NewTracer().Attach(pid, duration)
+	if err != nil {
+		return nil, err
+	}
 
-	uutil.ErrFatal(cmd_strace.Start())
-	uutil.ErrFatal(cmd_strace.Wait())
+	fmt.Fprintln(os.Stderr, "[-] Strace Attach End.")
 
-	// analyze starce result
-	bytes, err := os.ReadFile(STRACE_OUTPUT_FILE)
-	uutil.ErrFatal(err)
+	return lib_map, nil
+}
 
-	s := string(bytes)
-	// strace parse
-	lib_map, err := cmds.Parser.StraceParse(s)
+// ProcessCommand returns the command line of the running process. the first element is the path of the executable.
+func ProcessCommand(pid int) ([]string, error) {
 
-	fmt.Println("[-] Strace End.")
+	exe_path, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid))
+	if err != nil {
+		return nil, xerrors.Errorf("cannot get the executable of %v: %w", pid, err)
+	}
+
+	cmdline, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil {
+		return nil, xerrors.Errorf("cannot get the command line of %v: %w", pid, err)
+	}
+	args := strings.Split(strings.TrimRight(string(cmdline), "\x00"), "\x00")
 
-	return lib_map
+	return append([]string{exe_path}, args[1:]...), nil
 }
@@ -0,0 +1,240 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	APP_NAME    = "go_ltrace"
+	CONFIG_FILE = "config.yaml"
+	// the config file of the project in the current directory
+	PROJECT_CONFIG_FILE = ".go_ltrace.yaml"
+	// the default environment variable of the GitHub token
+	GITHUB_TOKEN_ENV = "GITHUB_ACCESS_TOKEN"
+	// the environment variable of the local mirror directory of the upstream repositories
+	GIT_MIRROR_ENV = "GOSCAN_GIT_MIRROR"
+)
+
+// Config is the settings of go_ltrace.
+// the config file is the flat YAML mapping. ex.)
+//
+//	db_path: ~/.cache/go_ltrace/VulnDB
+//	git_mirror_dir: /srv/mirrors # comment
+//	format: json
+type Config struct {
+	// <CacheDir>/VulnDB if it is ""
+	DBPath      string
+	TrackerPath string
+	// <CacheDir>/DebianVulnDB if it is ""
+	DebianDBPath string
+	// the checkout of the security-tracker repository or the JSON export (*.json)
+	DebianTrackerPath string
+	// the directory or the zip dump of the OSV records ("" doesn't scan the language packages)
+	OSVPath string
+	// "" doesn't write the log
+	LogPath      string
+	CacheDir     string
+	GitMirrorDir string
+	// the GitHub token is read from the file if it is set, otherwise from the environment variable
+	GithubTokenEnv  string
+	GithubTokenFile string
+	Format          string
+}
+
+// the directory of XDG base directory specification. ex.) $XDG_CACHE_HOME/go_ltrace, ~/.cache/go_ltrace
+func xdgDir(env string, fallback string) string {
+	if dir := os.Getenv(env); filepath.IsAbs(dir) {
+		return filepath.Join(dir, APP_NAME)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = os.TempDir()
+	}
+	return filepath.Join(home, fallback, APP_NAME)
+}
+
+// DefaultPath returns the path of the user config file. ex.) ~/.config/go_ltrace/config.yaml
+func DefaultPath() string {
+	return filepath.Join(xdgDir("XDG_CONFIG_HOME", ".config"), CONFIG_FILE)
+}
+
+func Default() Config {
+	cache_dir := xdgDir("XDG_CACHE_HOME", ".cache")
+	data_dir := xdgDir("XDG_DATA_HOME", filepath.Join(".local", "share"))
+	return Config{
+		TrackerPath:       filepath.Join(data_dir, "ubuntu-cve-tracker"),
+		DebianTrackerPath: filepath.Join(data_dir, "security-tracker"),
+		LogPath:           filepath.Join(xdgDir("XDG_STATE_HOME", filepath.Join(".local", "state")), APP_NAME+".log"),
+		CacheDir:          cache_dir,
+		GithubTokenEnv:    GITHUB_TOKEN_ENV,
+		Format:            "text",
+	}
+}
+
+// Load reads the config files over the default settings.
+// if the path is "", the user config file and the project config file (in this order) are read if they exist.
+// GOSCAN_GIT_MIRROR is applied after the config files.
+func Load(path string) (Config, error) {
+
+	config := Default()
+
+	if strings.Compare(path, "") != 0 {
+		if err := config.readFile(path); err != nil {
+			return config, err
+		}
+	} else {
+		for _, candidate := range []string{DefaultPath(), PROJECT_CONFIG_FILE} {
+			err := config.readFile(candidate)
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return config, err
+			}
+		}
+	}
+
+	if mirror_dir := os.Getenv(GIT_MIRROR_ENV); strings.Compare(mirror_dir, "") != 0 {
+		config.GitMirrorDir = mirror_dir
+	}
+
+	return config, nil
+}
+
+func (config *Config) readFile(path string) error {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return xerrors.Errorf("cannot open the config file: %w", err)
+	}
+	defer f.Close()
+
+	abs_path, err := filepath.Abs(path)
+	if err != nil {
+		return xerrors.Errorf("cannot resolve %v: %w", path, err)
+	}
+	if err := config.Parse(f, filepath.Dir(abs_path)); err != nil {
+		return xerrors.Errorf("%v: %w", path, err)
+	}
+
+	return nil
+}
+
+// Parse reads the settings of the config file. the relative paths are resolved from the base directory.
+func (config *Config) Parse(r io.Reader, base_dir string) error {
+
+	path_items := map[string]*string{"db_path": &config.DBPath, "tracker_path": &config.TrackerPath, "log_path": &config.LogPath,
+		"debian_db_path": &config.DebianDBPath, "debian_tracker_path": &config.DebianTrackerPath, "osv_path": &config.OSVPath,
+		"cache_dir": &config.CacheDir, "git_mirror_dir": &config.GitMirrorDir, "github_token_file": &config.GithubTokenFile}
+	items := map[string]*string{"github_token_env": &config.GithubTokenEnv, "format": &config.Format}
+
+	scanner := bufio.NewScanner(r)
+	line_number := 0
+	for scanner.Scan() {
+		line_number++
+		line := strings.TrimSpace(scanner.Text())
+		if strings.Compare(line, "") == 0 || strings.HasPrefix(line, "#") || strings.Compare(line, "---") == 0 {
+			continue
+		}
+
+		colon_id := strings.Index(line, ":")
+		if colon_id == -1 {
+			return xerrors.Errorf("line %v: 'key: value' is expected.\n", line_number)
+		}
+		key := strings.TrimSpace(line[:colon_id])
+		value, err := parseValue(strings.TrimSpace(line[colon_id+1:]))
+		if err != nil {
+			return xerrors.Errorf("line %v: %w", line_number, err)
+		}
+
+		if item, ok := path_items[key]; ok {
+			*item = resolvePath(value, base_dir)
+		} else if item, ok := items[key]; ok {
+			*item = value
+		} else {
+			return xerrors.Errorf("line %v: unknown key '%v'.\n", line_number, key)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// the scalar value (quoted or plain with the trailing comment)
+func parseValue(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, "\""):
+		end_id := strings.LastIndex(value, "\"")
+		if end_id == 0 {
+			return "", xerrors.Errorf("unterminated string %v\n", value)
+		}
+		return strconv.Unquote(value[:end_id+1])
+	case strings.HasPrefix(value, "'"):
+		end_id := strings.LastIndex(value, "'")
+		if end_id == 0 {
+			return "", xerrors.Errorf("unterminated string %v\n", value)
+		}
+		return strings.ReplaceAll(value[1:end_id], "''", "'"), nil
+	}
+	if comment_id := strings.Index(value, " #"); comment_id != -1 {
+		value = value[:comment_id]
+	}
+	value = strings.TrimSpace(value)
+	if strings.Compare(value, "~") == 0 || strings.Compare(value, "null") == 0 {
+		return "", nil
+	}
+	return value, nil
+}
+
+// expand ~ and the environment variables, and make the relative path absolute from the base directory
+func resolvePath(path string, base_dir string) string {
+	if strings.Compare(path, "") == 0 {
+		return path
+	}
+	path = os.ExpandEnv(path)
+	if strings.Compare(path, "~") == 0 || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, path[1:])
+		}
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(base_dir, path)
+	}
+	return path
+}
+
+// VulnDBPath returns the path of the vulnerability database
+func (config Config) VulnDBPath() string {
+	if strings.Compare(config.DBPath, "") != 0 {
+		return config.DBPath
+	}
+	return filepath.Join(config.CacheDir, "VulnDB")
+}
+
+// DebianVulnDBPath returns the path of the vulnerability database of the Debian Security Tracker
+func (config Config) DebianVulnDBPath() string {
+	if strings.Compare(config.DebianDBPath, "") != 0 {
+		return config.DebianDBPath
+	}
+	return filepath.Join(config.CacheDir, "DebianVulnDB")
+}
+
+// GithubToken reads the GitHub token from the token file or the environment variable
+func (config Config) GithubToken() (string, error) {
+	if strings.Compare(config.GithubTokenFile, "") != 0 {
+		token, err := os.ReadFile(config.GithubTokenFile)
+		if err != nil {
+			return "", xerrors.Errorf("cannot read the github token: %w", err)
+		}
+		return strings.TrimSpace(string(token)), nil
+	}
+	if strings.Compare(config.GithubTokenEnv, "") == 0 {
+		return "", nil
+	}
+	return os.Getenv(config.GithubTokenEnv), nil
+}
@@ -0,0 +1,123 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip(err)
+	}
+
+	content := `---
+# go_ltrace settings
+db_path: db/VulnDB # relative to the config file
+tracker_path: "~/src/ubuntu-cve-tracker"
+log_path: ''
+git_mirror_dir: /srv/mirrors
+debian_tracker_path: data/debian.json
+osv_path: /srv/osv/all.zip
+github_token_env: MY_TOKEN
+format: sarif
+`
+	config := Default()
+	if err := config.Parse(strings.NewReader(content), "/etc/go_ltrace"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Default()
+	expected.DBPath = "/etc/go_ltrace/db/VulnDB"
+	expected.TrackerPath = filepath.Join(home, "src/ubuntu-cve-tracker")
+	expected.LogPath = ""
+	expected.GitMirrorDir = "/srv/mirrors"
+	expected.DebianTrackerPath = "/etc/go_ltrace/data/debian.json"
+	expected.OSVPath = "/srv/osv/all.zip"
+	expected.GithubTokenEnv = "MY_TOKEN"
+	expected.Format = "sarif"
+	if config != expected {
+		t.Errorf("Parse() = %+v, expected %+v", config, expected)
+	}
+
+	for _, bad := range []string{"unknown: 1\n", "db_path\n", "db_path: \"/tmp\n"} {
+		config := Default()
+		if err := config.Parse(strings.NewReader(bad), "/"); err == nil {
+			t.Errorf("Parse(%q) is accepted", bad)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "config"))
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(dir, "cache"))
+	t.Setenv(GIT_MIRROR_ENV, "")
+
+	// the default settings without the config files
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	config, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Compare(config.VulnDBPath(), filepath.Join(dir, "cache", APP_NAME, "VulnDB")) != 0 {
+		t.Errorf("unexpected db path: %v", config.VulnDBPath())
+	}
+	if strings.Compare(config.DebianVulnDBPath(), filepath.Join(dir, "cache", APP_NAME, "DebianVulnDB")) != 0 {
+		t.Errorf("unexpected debian db path: %v", config.DebianVulnDBPath())
+	}
+
+	// the project config overrides the user config
+	if err := os.MkdirAll(filepath.Join(dir, "config", APP_NAME), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(DefaultPath(), []byte("cache_dir: /var/cache/go_ltrace\nformat: json\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(PROJECT_CONFIG_FILE, []byte("format: sarif\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(GIT_MIRROR_ENV, "/srv/mirrors")
+
+	config, err = Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Compare(config.VulnDBPath(), "/var/cache/go_ltrace/VulnDB") != 0 || strings.Compare(config.Format, "sarif") != 0 || strings.Compare(config.GitMirrorDir, "/srv/mirrors") != 0 {
+		t.Errorf("unexpected config: %+v", config)
+	}
+
+	// the explicit config file must exist
+	if _, err := Load(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Errorf("the missing config file is accepted")
+	}
+}
+
+func TestGithubToken(t *testing.T) {
+
+	t.Setenv(GITHUB_TOKEN_ENV, "env-token")
+	config := Default()
+	if token, err := config.GithubToken(); err != nil || strings.Compare(token, "env-token") != 0 {
+		t.Errorf("GithubToken() = %v, %v", token, err)
+	}
+
+	config.GithubTokenFile = filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(config.GithubTokenFile, []byte("file-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if token, err := config.GithubToken(); err != nil || strings.Compare(token, "file-token") != 0 {
+		t.Errorf("GithubToken() = %v, %v", token, err)
+	}
+}
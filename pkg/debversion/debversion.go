@@ -0,0 +1,162 @@
+// Package debversion parses and compares Debian package versions by the rules of deb-version(7).
+package debversion
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/xerrors"
+)
+
+// [epoch:]upstream_version[-debian_revision]
+type Version struct {
+	Epoch    int
+	Upstream string
+	Revision string
+}
+
+func Parse(s string) (Version, error) {
+
+	s = strings.TrimSpace(s)
+	version := Version{}
+
+	if strings.Compare(s, "") == 0 {
+		return version, xerrors.Errorf("empty version.\n")
+	}
+	if strings.ContainsAny(s, " \t") {
+		return version, xerrors.Errorf("version '%v' contains spaces.\n", s)
+	}
+
+	// the epoch is the number before the first colon
+	if colon_id := strings.Index(s, ":"); colon_id != -1 {
+		epoch, err := strconv.Atoi(s[:colon_id])
+		if err != nil || epoch < 0 {
+			return version, xerrors.Errorf("version '%v' has invalid epoch.\n", s)
+		}
+		version.Epoch = epoch
+		s = s[colon_id+1:]
+	}
+
+	// the revision is the string after the last hyphen
+	if hyphen_id := strings.LastIndex(s, "-"); hyphen_id != -1 {
+		version.Revision = s[hyphen_id+1:]
+		s = s[:hyphen_id]
+	}
+	version.Upstream = s
+
+	if strings.Compare(version.Upstream, "") == 0 || !unicode.IsDigit(rune(version.Upstream[0])) {
+		return version, xerrors.Errorf("upstream version '%v' must start with a digit.\n", version.Upstream)
+	}
+
+	return version, nil
+}
+
+func (version Version) String() string {
+	s := version.Upstream
+	if version.Epoch > 0 {
+		s = strconv.Itoa(version.Epoch) + ":" + s
+	}
+	if strings.Compare(version.Revision, "") != 0 {
+		s += "-" + version.Revision
+	}
+	return s
+}
+
+// Compare returns -1, 0, 1 if a < b, a == b, a > b.
+func (a Version) Compare(b Version) int {
+	if a.Epoch != b.Epoch {
+		if a.Epoch < b.Epoch {
+			return -1
+		}
+		return 1
+	}
+	if ret := compareString(a.Upstream, b.Upstream); ret != 0 {
+		return ret
+	}
+	return compareString(a.Revision, b.Revision)
+}
+
+// Compare parses and compares the version strings.
+func Compare(a string, b string) (int, error) {
+	va, err := Parse(a)
+	if err != nil {
+		return 0, err
+	}
+	vb, err := Parse(b)
+	if err != nil {
+		return 0, err
+	}
+	return va.Compare(vb), nil
+}
+
+// the order of the character in the non-digit part. '~' sorts before everything, even the end of the part,
+// and the letters sort before the non-letters.
+func order(c byte) int {
+	switch {
+	case c == '~':
+		return -1
+	case '0' <= c && c <= '9':
+		return 0
+	case ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z'):
+		return int(c)
+	default:
+		return int(c) + 256
+	}
+}
+
+// compare the non-digit parts and the digit parts alternately
+func compareString(a string, b string) int {
+
+	for len(a) > 0 || len(b) > 0 {
+
+		// non-digit part
+		for (len(a) > 0 && !isDigit(a[0])) || (len(b) > 0 && !isDigit(b[0])) {
+			ac, bc := 0, 0
+			if len(a) > 0 {
+				ac = order(a[0])
+			}
+			if len(b) > 0 {
+				bc = order(b[0])
+			}
+			if ac != bc {
+				if ac < bc {
+					return -1
+				}
+				return 1
+			}
+			a, b = a[1:], b[1:]
+		}
+
+		// digit part (the leading zeros are ignored)
+		for len(a) > 0 && a[0] == '0' {
+			a = a[1:]
+		}
+		for len(b) > 0 && b[0] == '0' {
+			b = b[1:]
+		}
+		a_digits, b_digits := 0, 0
+		for a_digits < len(a) && isDigit(a[a_digits]) {
+			a_digits++
+		}
+		for b_digits < len(b) && isDigit(b[b_digits]) {
+			b_digits++
+		}
+		if a_digits != b_digits {
+			if a_digits < b_digits {
+				return -1
+			}
+			return 1
+		}
+		if ret := strings.Compare(a[:a_digits], b[:b_digits]); ret != 0 {
+			return ret
+		}
+		a, b = a[a_digits:], b[b_digits:]
+	}
+
+	return 0
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
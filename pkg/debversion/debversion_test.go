@@ -0,0 +1,61 @@
+package debversion
+
+import "testing"
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a        string
+		b        string
+		expected int
+	}{
+		{"1.0", "1.0", 0},
+		{"1.0", "1.0-0", 0},
+		{"0:1.0", "1.0", 0},
+		{"1.0", "1.1", -1},
+		{"1.10", "1.9", 1},
+		{"1.001", "1.1", 0},
+		{"1:0.9", "2.0", 1},
+		{"1.0~rc1", "1.0", -1},
+		{"1.0~~", "1.0~", -1},
+		{"1.0~", "1.0", -1},
+		{"1.0", "1.0+b1", -1},
+		{"1.0a", "1.0", 1},
+		{"1.0a", "1.0+", -1},
+		{"2.35-0ubuntu3", "2.35-0ubuntu3.1", -1},
+		{"2.35-0ubuntu3.10", "2.35-0ubuntu3.9", 1},
+		{"1.2.13.dfsg-1", "1.2.13-1", 1},
+		{"1.2-3-4", "1.2-3-5", -1},
+		{"3.0.2-0ubuntu1.10", "3.0.2-0ubuntu1~esm1", 1},
+	}
+	for _, test := range tests {
+		ret, err := Compare(test.a, test.b)
+		if err != nil {
+			t.Errorf("Compare(%v, %v): %v", test.a, test.b, err)
+			continue
+		}
+		if ret != test.expected {
+			t.Errorf("Compare(%v, %v) = %v, expected %v", test.a, test.b, ret, test.expected)
+		}
+		if reverse, _ := Compare(test.b, test.a); reverse != -test.expected {
+			t.Errorf("Compare(%v, %v) = %v, expected %v", test.b, test.a, reverse, -test.expected)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	version, err := Parse("1:2.36-9+deb12u4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version.Epoch != 1 || version.Upstream != "2.36" || version.Revision != "9+deb12u4" {
+		t.Errorf("unexpected %+v", version)
+	}
+	if version.String() != "1:2.36-9+deb12u4" {
+		t.Errorf("unexpected %v", version.String())
+	}
+	for _, invalid := range []string{"", "a1.0", "x:1.0", "1.0 1"} {
+		if _, err := Parse(invalid); err == nil {
+			t.Errorf("Parse(%q) must fail", invalid)
+		}
+	}
+}
@@ -0,0 +1,289 @@
+// Package dpkg reads the dpkg database (/var/lib/dpkg) directly and answers which package owns a file.
+package dpkg
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/yomaytk/go_ltrace/log"
+	uutil "github.com/yomaytk/go_ltrace/util"
+	"golang.org/x/xerrors"
+)
+
+const (
+	ADMIN_DIR   = "/var/lib/dpkg"
+	STATUS_FILE = "status"
+	INFO_DIR    = "info"
+	LIST_SUFFIX = ".list"
+)
+
+// the directories owned by too many packages to specify the package
+var ignored_dirs = map[string]bool{"/": true, "/usr": true, "/etc": true, "/lib": true, "/usr/lib": true, "/usr/share": true}
+
+// the states whose files are on the disk
+var installed_states = map[string]bool{"installed": true, "half-configured": true, "unpacked": true,
+	"triggers-awaited": true, "triggers-pending": true}
+
+type Package struct {
+	Name         string
+	Architecture string
+	MultiArch    string
+	Status       string
+	Version      string
+	// the source package name and version. the same as the binary package if Source field is omitted.
+	Source        string
+	SourceVersion string
+}
+
+// the package name used by dpkg -S and *.list. ex.) libc6:amd64 (Multi-Arch: same), bash
+func (pkg Package) QualifiedName() string {
+	if strings.Compare(pkg.MultiArch, "same") == 0 {
+		return pkg.Name + ":" + pkg.Architecture
+	}
+	return pkg.Name
+}
+
+func (pkg Package) Installed() bool {
+	tokens := strings.Fields(pkg.Status)
+	return len(tokens) == 3 && installed_states[tokens[2]]
+}
+
+type Database struct {
+	Root string
+	// key: qualified package name
+	Packages map[string]Package
+	// key: file path, value: qualified package names
+	path_packages map[string][]string
+	loaded        bool
+}
+
+func NewDatabase(root string) *Database {
+	return &Database{Root: root, Packages: map[string]Package{}, path_packages: map[string][]string{}}
+}
+
+// Load reads status and *.list once.
+func (db *Database) Load() error {
+
+	if db.loaded {
+		return nil
+	}
+
+	admin_dir, err := uutil.RootPath(db.Root, ADMIN_DIR)
+	if err != nil {
+		return err
+	}
+
+	if err := db.loadStatus(filepath.Join(admin_dir, STATUS_FILE)); err != nil {
+		return err
+	}
+
+	for name, pkg := range db.Packages {
+		if !pkg.Installed() {
+			continue
+		}
+		if err := db.loadList(name, filepath.Join(admin_dir, INFO_DIR, name+LIST_SUFFIX)); err != nil {
+			log.Logger.Infof("cannot read the file list of %v: %v", name, err)
+		}
+	}
+
+	db.loaded = true
+	return nil
+}
+
+// read the stanzas of the status file
+func (db *Database) loadStatus(status_path string) error {
+
+	f, err := os.Open(status_path)
+	if err != nil {
+		return xerrors.Errorf("cannot open dpkg status: %w", err)
+	}
+	defer f.Close()
+
+	for _, stanza := range readStanzas(f) {
+		pkg := Package{Name: stanza["Package"], Architecture: stanza["Architecture"], MultiArch: stanza["Multi-Arch"], Status: stanza["Status"], Version: stanza["Version"]}
+		if strings.Compare(pkg.Name, "") == 0 {
+			continue
+		}
+		pkg.Source, pkg.SourceVersion = parseSource(stanza["Source"], pkg.Name, pkg.Version)
+		db.Packages[pkg.QualifiedName()] = pkg
+	}
+
+	return nil
+}
+
+// parseSource parses Source field. ex.) "openssl", "glibc (2.36-9+deb12u4)"
+func parseSource(field string, name string, version string) (string, string) {
+
+	tokens := strings.Fields(field)
+	if len(tokens) == 0 {
+		return name, version
+	}
+
+	source := tokens[0]
+	source_version := version
+	if len(tokens) > 1 {
+		source_version = strings.TrimSuffix(strings.TrimPrefix(tokens[1], "("), ")")
+	}
+
+	return source, source_version
+}
+
+// Package returns the package of the qualified name. ex.) libc6:amd64
+func (db *Database) Package(name string) (Package, bool) {
+	if err := db.Load(); err != nil {
+		return Package{}, false
+	}
+	pkg, ok := db.Packages[name]
+	return pkg, ok
+}
+
+// readStanzas parses the deb822 stanzas. the continuation lines are joined by '\n'.
+func readStanzas(f *os.File) []map[string]string {
+
+	stanzas := []map[string]string{}
+	stanza := map[string]string{}
+	last_field := ""
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.Compare(strings.TrimSpace(line), "") == 0 {
+			if len(stanza) > 0 {
+				stanzas = append(stanzas, stanza)
+				stanza = map[string]string{}
+			}
+			continue
+		}
+		// continuation line
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			if strings.Compare(last_field, "") != 0 {
+				stanza[last_field] += "\n" + strings.TrimSpace(line)
+			}
+			continue
+		}
+		colon_id := strings.Index(line, ":")
+		if colon_id == -1 {
+			continue
+		}
+		last_field = line[:colon_id]
+		stanza[last_field] = strings.TrimSpace(line[colon_id+1:])
+	}
+	if len(stanza) > 0 {
+		stanzas = append(stanzas, stanza)
+	}
+
+	return stanzas
+}
+
+func (db *Database) loadList(name string, list_path string) error {
+
+	f, err := os.Open(list_path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		path := scanner.Text()
+		// ex.) "/." for the root directory
+		path = filepath.Clean(path)
+		db.path_packages[path] = append(db.path_packages[path], name)
+	}
+
+	return scanner.Err()
+}
+
+// the path of the other side of usrmerge. ex.) /lib/libc.so.6 <-> /usr/lib/libc.so.6
+func usrMergePath(path string) string {
+	if strings.HasPrefix(path, "/usr/") {
+		return strings.TrimPrefix(path, "/usr")
+	}
+	return "/usr" + path
+}
+
+// resolve the symbolic links in the root, and return the path in the root
+func (db *Database) realPath(path string) (string, error) {
+	if strings.Compare(db.Root, "") == 0 || strings.Compare(db.Root, "/") == 0 {
+		return filepath.EvalSymlinks(path)
+	}
+	host_path, err := uutil.RootPath(db.Root, path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Clean("/" + strings.TrimPrefix(host_path, filepath.Clean(db.Root))), nil
+}
+
+// the candidate paths of the file owned by the package, considering usrmerge and the symbolic links.
+func (db *Database) candidatePaths(path string) []string {
+
+	path = filepath.Clean(path)
+	candidates := []string{path, usrMergePath(path)}
+
+	// the directory is the link (ex. /lib -> usr/lib) and the file is listed by the real path
+	if real_dir, err := db.realPath(filepath.Dir(path)); err == nil {
+		dir_resolved := filepath.Join(real_dir, filepath.Base(path))
+		candidates = append(candidates, dir_resolved, usrMergePath(dir_resolved))
+	}
+
+	// the file is the link to the file of another name (ex. libfoo.so.1 -> libfoo.so.1.2.3)
+	if real_path, err := db.realPath(path); err == nil {
+		candidates = append(candidates, real_path, usrMergePath(real_path))
+	}
+
+	return candidates
+}
+
+// Owned returns whether any package lists the file (the owner of the directory above is not searched).
+func (db *Database) Owned(path string) bool {
+	if err := db.Load(); err != nil {
+		return false
+	}
+	for _, candidate := range db.candidatePaths(path) {
+		if _, ok := db.path_packages[candidate]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Search returns the packages which own the file.
+func (db *Database) Search(path string) ([]string, error) {
+
+	// *.list has only the absolute paths
+	if !filepath.IsAbs(path) {
+		return []string{}, xerrors.Errorf("%v is not the absolute path.\n", path)
+	}
+
+	if err := db.Load(); err != nil {
+		return []string{}, err
+	}
+
+	candidates := db.candidatePaths(path)
+	for _, candidate := range candidates {
+		if packages, ok := db.path_packages[candidate]; ok {
+			return packages, nil
+		}
+	}
+
+	// the file isn't owned by any package, so search the package which owns the directory one level above
+	for _, candidate := range candidates {
+		for dir := filepath.Dir(candidate); !ignored_dirs[dir] && filepath.Dir(dir) != dir; dir = filepath.Dir(dir) {
+			packages, ok := db.path_packages[dir]
+			if !ok {
+				continue
+			}
+			// the directory shared by several packages cannot specify the package
+			if len(packages) == 1 {
+				log.Logger.Infof("%v is not owned by any package, so use the owner of %v.", path, dir)
+				return packages, nil
+			}
+			break
+		}
+	}
+
+	return []string{}, xerrors.Errorf("no package owns %v\n", path)
+}
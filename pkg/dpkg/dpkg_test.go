@@ -0,0 +1,169 @@
+package dpkg
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	log "github.com/yomaytk/go_ltrace/log"
+)
+
+const status = `Package: libc6
+Status: install ok installed
+Architecture: amd64
+Multi-Arch: same
+Source: glibc (2.36-9+deb12u4)
+Version: 2.36-9+deb12u7
+Description: GNU C Library: Shared libraries
+ Contains the standard libraries.
+
+Package: zlib1g
+Status: install ok installed
+Architecture: amd64
+Multi-Arch: same
+Source: zlib
+Version: 1:1.2.13.dfsg-1
+
+Package: bash
+Status: deinstall ok config-files
+Architecture: amd64
+Version: 5.2.15-2+b2
+`
+
+func TestLoadStatus(t *testing.T) {
+
+	status_path := filepath.Join(t.TempDir(), STATUS_FILE)
+	if err := os.WriteFile(status_path, []byte(status), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	db := NewDatabase("")
+	if err := db.loadStatus(status_path); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		source        string
+		version       string
+		sourceVersion string
+		installed     bool
+	}{
+		{"libc6:amd64", "glibc", "2.36-9+deb12u7", "2.36-9+deb12u4", true},
+		{"zlib1g:amd64", "zlib", "1:1.2.13.dfsg-1", "1:1.2.13.dfsg-1", true},
+		{"bash", "bash", "5.2.15-2+b2", "5.2.15-2+b2", false},
+	}
+	for _, test := range tests {
+		pkg, ok := db.Packages[test.name]
+		if !ok {
+			t.Errorf("%v is not loaded", test.name)
+			continue
+		}
+		if pkg.Source != test.source || pkg.Version != test.version || pkg.SourceVersion != test.sourceVersion || pkg.Installed() != test.installed {
+			t.Errorf("%v: got %+v", test.name, pkg)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+
+	db := NewDatabase(t.TempDir())
+	db.loaded = true
+	db.path_packages = map[string][]string{
+		"/usr/lib/x86_64-linux-gnu/libz.so.1.2.13": {"zlib1g:amd64"},
+	}
+
+	tests := []struct {
+		path     string
+		packages []string
+		found    bool
+	}{
+		{"/usr/lib/x86_64-linux-gnu/libz.so.1.2.13", []string{"zlib1g:amd64"}, true},
+		// the relative path (ex. $ORIGIN of ./app) must not loop over filepath.Dir(".")
+		{"lib/libfoo.so", []string{}, false},
+		{"./lib/libfoo.so", []string{}, false},
+	}
+	for _, test := range tests {
+		packages, err := db.Search(test.path)
+		if (err == nil) != test.found || !reflect.DeepEqual(packages, test.packages) {
+			t.Errorf("%v: got %v, %v", test.path, packages, err)
+		}
+	}
+}
+
+// the file lists of the packages installed before usrmerge
+var lists = map[string]string{
+	"zlib1g:amd64": `/.
+/lib
+/lib/x86_64-linux-gnu
+/lib/x86_64-linux-gnu/libz.so.1.2.13
+/lib/x86_64-linux-gnu/libz.so.1
+`,
+	"libc6:amd64": `/.
+/lib
+/lib/x86_64-linux-gnu
+/lib/x86_64-linux-gnu/libc.so.6
+`,
+}
+
+func TestSearchUsrMerge(t *testing.T) {
+
+	log.InitLogger("")
+
+	// /lib -> usr/lib, and libz.so.1, libz.so -> libz.so.1.2.13
+	root := t.TempDir()
+	info_dir := filepath.Join(root, ADMIN_DIR, INFO_DIR)
+	lib_dir := filepath.Join(root, "usr/lib/x86_64-linux-gnu")
+	for _, dir := range []string{info_dir, lib_dir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, ADMIN_DIR, STATUS_FILE), []byte(status), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for name, list := range lists {
+		if err := os.WriteFile(filepath.Join(info_dir, name+LIST_SUFFIX), []byte(list), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{"libz.so.1.2.13", "libc.so.6", "libfoo.so.1"} {
+		if err := os.WriteFile(filepath.Join(lib_dir, file), []byte{}, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		filepath.Join(root, "lib"):          "usr/lib",
+		filepath.Join(lib_dir, "libz.so.1"): "libz.so.1.2.13",
+		// the development link of zlib1g-dev, which is not installed
+		filepath.Join(lib_dir, "libz.so"): "libz.so.1.2.13",
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, link); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db := NewDatabase(root)
+	tests := []struct {
+		path     string
+		packages []string
+		found    bool
+	}{
+		{"/lib/x86_64-linux-gnu/libz.so.1", []string{"zlib1g:amd64"}, true},
+		// the other side of usrmerge
+		{"/usr/lib/x86_64-linux-gnu/libz.so.1", []string{"zlib1g:amd64"}, true},
+		{"/usr/lib/x86_64-linux-gnu/libc.so.6", []string{"libc6:amd64"}, true},
+		// the symbolic link which is not listed
+		{"/usr/lib/x86_64-linux-gnu/libz.so", []string{"zlib1g:amd64"}, true},
+		// the directory shared by several packages cannot specify the package
+		{"/usr/lib/x86_64-linux-gnu/libfoo.so.1", []string{}, false},
+	}
+	for _, test := range tests {
+		packages, err := db.Search(test.path)
+		if (err == nil) != test.found || !reflect.DeepEqual(packages, test.packages) {
+			t.Errorf("%v: got %v, %v", test.path, packages, err)
+		}
+	}
+}
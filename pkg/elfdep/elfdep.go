@@ -0,0 +1,382 @@
+// Package elfdep resolves the shared library dependencies and the imported functions of the ELF
+// executable without running it, following the search rules of ld.so(8).
+package elfdep
+
+import (
+	"debug/elf"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/yomaytk/go_ltrace/log"
+	uutil "github.com/yomaytk/go_ltrace/util"
+	"golang.org/x/xerrors"
+)
+
+// elf symbol type of GNU indirect function (e.g. memcpy, strlen of glibc)
+const STT_GNU_IFUNC = elf.SymType(10)
+
+// multiarch directory of Debian/Ubuntu
+var multiarch_triplets = map[elf.Machine]string{
+	elf.EM_X86_64:  "x86_64-linux-gnu",
+	elf.EM_AARCH64: "aarch64-linux-gnu",
+	elf.EM_386:     "i386-linux-gnu",
+	elf.EM_ARM:     "arm-linux-gnueabihf",
+	elf.EM_RISCV:   "riscv64-linux-gnu",
+	elf.EM_PPC64:   "powerpc64le-linux-gnu",
+	elf.EM_S390:    "s390x-linux-gnu",
+}
+
+type ElfObject struct {
+	// the path in the root directory
+	Path    string
+	Soname  string
+	Needed  []string
+	RPath   []string
+	RunPath []string
+	// the object which loads this object by DT_NEEDED
+	loader         *ElfObject
+	defined_funcs  map[string]bool
+	imported_funcs map[string]bool
+}
+
+type Resolver struct {
+	Root        string
+	DefaultDirs []string
+	// key: soname, value: library paths
+	LdCache map[string][]string
+	machine elf.Machine
+	class   elf.Class
+}
+
+func NewResolver(root string) *Resolver {
+	resolver := &Resolver{Root: root, LdCache: map[string][]string{}}
+	cache_path, err := uutil.RootPath(root, LD_SO_CACHE)
+	if err == nil {
+		resolver.LdCache, err = loadLdCache(cache_path)
+	}
+	if err != nil {
+		log.Logger.Infoln("cannot load ld.so.cache:", err)
+	}
+	return resolver
+}
+
+// Analyze returns the shared libraries loaded by the executable, and the functions imported from
+// every shared library.
+func (resolver *Resolver) Analyze(binary_path string) (map[string]bool, map[string][]string, error) {
+
+	lib_map := map[string]bool{}
+	lib_funcs_map := map[string][]string{}
+
+	// $ORIGIN is the absolute directory of the executable
+	if !filepath.IsAbs(binary_path) {
+		if strings.Compare(resolver.Root, "") != 0 && strings.Compare(resolver.Root, "/") != 0 {
+			return lib_map, lib_funcs_map, xerrors.Errorf("%v is not the absolute path in %v.\n", binary_path, resolver.Root)
+		}
+		abs_path, err := filepath.Abs(binary_path)
+		if err != nil {
+			return lib_map, lib_funcs_map, xerrors.Errorf("cannot get the absolute path of %v: %w", binary_path, err)
+		}
+		binary_path = abs_path
+	}
+
+	exe, interp, err := resolver.loadExecutable(binary_path)
+	if err != nil {
+		return lib_map, lib_funcs_map, err
+	}
+
+	// breadth first order is the symbol search order of the dynamic loader
+	elf_objects := []*ElfObject{exe}
+	// key: soname or path
+	loaded_map := map[string]bool{}
+
+	// the dynamic loader is loaded by the kernel, and the libraries which need it don't load it again.
+	var interp_object *ElfObject
+	if strings.Compare(interp, "") != 0 {
+		if interp_object, err = resolver.loadObject(interp, exe); err == nil {
+			loaded_map[interp] = true
+			loaded_map[interp_object.Soname] = true
+		} else {
+			log.Logger.Infof("cannot load the dynamic loader %v: %v", interp, err)
+		}
+	}
+
+	for id := 0; id < len(elf_objects); id++ {
+		elf_object := elf_objects[id]
+		for _, needed := range elf_object.Needed {
+			if loaded_map[needed] {
+				continue
+			}
+			lib, err := resolver.search(needed, elf_object)
+			if err != nil {
+				log.Logger.Infof("cannot find %v needed by %v: %v", needed, elf_object.Path, err)
+				continue
+			}
+			loaded_map[needed] = true
+			if loaded_map[lib.Path] {
+				continue
+			}
+			loaded_map[lib.Path] = true
+			elf_objects = append(elf_objects, lib)
+			lib_map[lib.Path] = true
+		}
+	}
+
+	// the dynamic loader is the last in the search order
+	if interp_object != nil {
+		elf_objects = append(elf_objects, interp_object)
+		lib_map[interp_object.Path] = true
+	}
+
+	// the first object in the search order defines the imported function
+	for _, importer := range elf_objects {
+		for func_name := range importer.imported_funcs {
+			for _, definer := range elf_objects {
+				if !definer.defined_funcs[func_name] {
+					continue
+				}
+				if definer != exe {
+					lib_funcs_map[definer.Path] = append(lib_funcs_map[definer.Path], func_name)
+				}
+				break
+			}
+		}
+	}
+
+	// one function may be imported by several objects
+	for lib_path, funcs := range lib_funcs_map {
+		lib_funcs_map[lib_path] = uniqueStrings(funcs)
+	}
+
+	return lib_map, lib_funcs_map, nil
+}
+
+func (resolver *Resolver) loadExecutable(binary_path string) (*ElfObject, string, error) {
+
+	host_path, err := uutil.RootPath(resolver.Root, binary_path)
+	if err != nil {
+		return nil, "", err
+	}
+	f, err := elf.Open(host_path)
+	if err != nil {
+		return nil, "", xerrors.Errorf("%v is not ELF: %w", binary_path, err)
+	}
+	defer f.Close()
+
+	resolver.machine = f.Machine
+	resolver.class = f.Class
+	triplet := multiarch_triplets[f.Machine]
+	resolver.DefaultDirs = []string{"/lib/" + triplet, "/usr/lib/" + triplet}
+	if f.Class == elf.ELFCLASS64 {
+		resolver.DefaultDirs = append(resolver.DefaultDirs, "/lib64", "/usr/lib64")
+	}
+	resolver.DefaultDirs = append(resolver.DefaultDirs, "/lib", "/usr/lib")
+
+	interp := ""
+	for _, prog := range f.Progs {
+		if prog.Type == elf.PT_INTERP {
+			data, err := io.ReadAll(prog.Open())
+			if err == nil {
+				interp = strings.TrimRight(string(data), "\x00")
+			}
+		}
+	}
+
+	exe, err := newElfObject(binary_path, f)
+	return exe, interp, err
+}
+
+func newElfObject(path string, f *elf.File) (*ElfObject, error) {
+
+	elf_object := &ElfObject{Path: path, defined_funcs: map[string]bool{}, imported_funcs: map[string]bool{}}
+
+	// statically linked executable doesn't have .dynamic
+	if f.Section(".dynamic") == nil {
+		return elf_object, nil
+	}
+
+	needed, err := f.DynString(elf.DT_NEEDED)
+	if err != nil {
+		return elf_object, err
+	}
+	elf_object.Needed = needed
+	if sonames := mustDynString(f, elf.DT_SONAME); len(sonames) > 0 {
+		elf_object.Soname = sonames[0]
+	}
+	for _, rpath := range mustDynString(f, elf.DT_RPATH) {
+		elf_object.RPath = append(elf_object.RPath, filepath.SplitList(rpath)...)
+	}
+	for _, runpath := range mustDynString(f, elf.DT_RUNPATH) {
+		elf_object.RunPath = append(elf_object.RunPath, filepath.SplitList(runpath)...)
+	}
+
+	syms, err := f.DynamicSymbols()
+	if err != nil && err != elf.ErrNoSymbols {
+		return elf_object, err
+	}
+	for _, sym := range syms {
+		sym_type := elf.ST_TYPE(sym.Info)
+		if sym.Section == elf.SHN_UNDEF {
+			if strings.Compare(sym.Name, "") != 0 && (sym_type == elf.STT_FUNC || sym_type == elf.STT_NOTYPE) {
+				elf_object.imported_funcs[sym.Name] = true
+			}
+			continue
+		}
+		if sym_type == elf.STT_FUNC || sym_type == STT_GNU_IFUNC {
+			elf_object.defined_funcs[sym.Name] = true
+		}
+	}
+
+	return elf_object, nil
+}
+
+// ExportedFuncs returns the functions defined in the dynamic symbol table of the shared object in the root
+func ExportedFuncs(root string, path string) ([]string, error) {
+
+	host_path, err := uutil.RootPath(root, path)
+	if err != nil {
+		return []string{}, err
+	}
+	f, err := elf.Open(host_path)
+	if err != nil {
+		return []string{}, xerrors.Errorf("%v is not ELF: %w", path, err)
+	}
+	defer f.Close()
+
+	elf_object, err := newElfObject(path, f)
+	if err != nil {
+		return []string{}, err
+	}
+	funcs := []string{}
+	for func_name := range elf_object.defined_funcs {
+		funcs = append(funcs, func_name)
+	}
+	return funcs, nil
+}
+
+func mustDynString(f *elf.File, tag elf.DynTag) []string {
+	values, err := f.DynString(tag)
+	if err != nil {
+		return []string{}
+	}
+	return values
+}
+
+// load the ELF object if it is a shared object for the same architecture as the executable
+func (resolver *Resolver) loadObject(path string, loader *ElfObject) (*ElfObject, error) {
+
+	host_path, err := uutil.RootPath(resolver.Root, path)
+	if err != nil {
+		return nil, err
+	}
+	if fi, err := os.Stat(host_path); err != nil || !fi.Mode().IsRegular() {
+		return nil, xerrors.Errorf("%v is not a regular file.\n", path)
+	}
+	f, err := elf.Open(host_path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if f.Machine != resolver.machine || f.Class != resolver.class {
+		return nil, xerrors.Errorf("%v is for the different architecture.\n", path)
+	}
+
+	elf_object, err := newElfObject(path, f)
+	if err != nil {
+		return nil, err
+	}
+	elf_object.loader = loader
+	return elf_object, nil
+}
+
+// expand the dynamic string tokens. ex.) $ORIGIN/../lib
+// $LIB and $PLATFORM depend on the build of ld.so (ex. lib/x86_64-linux-gnu on Debian multiarch),
+// so the path which contains them is not expanded and reported as false.
+func expandOrigin(dir string, elf_object *ElfObject) (string, bool) {
+	origin := filepath.Dir(elf_object.Path)
+	dir = strings.ReplaceAll(dir, "${ORIGIN}", origin)
+	dir = strings.ReplaceAll(dir, "$ORIGIN", origin)
+	for _, token := range []string{"$LIB", "${LIB}", "$PLATFORM", "${PLATFORM}"} {
+		if strings.Contains(dir, token) {
+			return dir, false
+		}
+	}
+	return dir, true
+}
+
+// search the needed library by the order of ld.so(8)
+func (resolver *Resolver) search(needed string, elf_object *ElfObject) (*ElfObject, error) {
+
+	// the soname which contains slash is the path
+	if strings.Contains(needed, "/") {
+		path, ok := expandOrigin(needed, elf_object)
+		if !ok {
+			return nil, xerrors.Errorf("cannot expand %v.\n", needed)
+		}
+		return resolver.loadObject(path, elf_object)
+	}
+
+	search_dirs := []string{}
+
+	// DT_RPATH of the object and its loaders, only if the object doesn't have DT_RUNPATH
+	if len(elf_object.RunPath) == 0 {
+		for loader := elf_object; loader != nil; loader = loader.loader {
+			for _, dir := range loader.RPath {
+				if dir, ok := expandOrigin(dir, loader); ok {
+					search_dirs = append(search_dirs, dir)
+				}
+			}
+		}
+	}
+
+	// LD_LIBRARY_PATH of the host
+	if strings.Compare(resolver.Root, "") == 0 || strings.Compare(resolver.Root, "/") == 0 {
+		search_dirs = append(search_dirs, filepath.SplitList(os.Getenv("LD_LIBRARY_PATH"))...)
+	}
+
+	// DT_RUNPATH of the object
+	for _, dir := range elf_object.RunPath {
+		if dir, ok := expandOrigin(dir, elf_object); ok {
+			search_dirs = append(search_dirs, dir)
+		}
+	}
+
+	for _, dir := range search_dirs {
+		if strings.Compare(dir, "") == 0 {
+			continue
+		}
+		if lib, err := resolver.loadObject(filepath.Join(dir, needed), elf_object); err == nil {
+			return lib, nil
+		}
+	}
+
+	// ld.so.cache
+	for _, path := range resolver.LdCache[needed] {
+		if lib, err := resolver.loadObject(path, elf_object); err == nil {
+			return lib, nil
+		}
+	}
+
+	// default directories
+	for _, dir := range resolver.DefaultDirs {
+		if lib, err := resolver.loadObject(filepath.Join(dir, needed), elf_object); err == nil {
+			return lib, nil
+		}
+	}
+
+	return nil, xerrors.Errorf("%v is not found.\n", needed)
+}
+
+func uniqueStrings(values []string) []string {
+	unique_values := []string{}
+	value_map := map[string]bool{}
+	for _, value := range values {
+		if !value_map[value] {
+			value_map[value] = true
+			unique_values = append(unique_values, value)
+		}
+	}
+	return unique_values
+}
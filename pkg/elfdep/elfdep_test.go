@@ -0,0 +1,123 @@
+package elfdep
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	log "github.com/yomaytk/go_ltrace/log"
+)
+
+func TestExpandOrigin(t *testing.T) {
+
+	elf_object := &ElfObject{Path: "/opt/app/bin/app"}
+
+	tests := []struct {
+		dir     string
+		ans_dir string
+		ans_ok  bool
+	}{
+		{"$ORIGIN/../lib", "/opt/app/bin/../lib", true},
+		{"${ORIGIN}/lib", "/opt/app/bin/lib", true},
+		{"/usr/$LIB/app", "/usr/$LIB/app", false},
+		{"/usr/${PLATFORM}/app", "/usr/${PLATFORM}/app", false},
+	}
+
+	for _, test := range tests {
+		dir, ok := expandOrigin(test.dir, elf_object)
+		if dir != test.ans_dir || ok != test.ans_ok {
+			t.Fatalf("Test Error: Content: %v %v, Answer: %v %v\n", dir, ok, test.ans_dir, test.ans_ok)
+		}
+	}
+}
+
+func TestAnalyzeRelativePath(t *testing.T) {
+
+	// the relative path in the root directory is ambiguous
+	if _, _, err := (&Resolver{Root: t.TempDir()}).Analyze("app"); err == nil {
+		t.Fatalf("Test Error: the relative path in the root is accepted.\n")
+	}
+}
+
+const (
+	DEP_LIB_SRC = `#include <stdio.h>
+void dep_func(void) { puts("dep"); }
+static void dep_static(void) {}
+`
+	DEP_PROG_SRC = `void dep_func(void);
+int main(void) { dep_func(); return 0; }
+`
+)
+
+func TestAnalyze(t *testing.T) {
+
+	log.InitLogger("")
+
+	cc, err := exec.LookPath("gcc")
+	if err != nil {
+		t.Skip(err)
+	}
+	// bin/app -> lib/libdep.so (DT_RUNPATH $ORIGIN/../lib) -> libc.so.6 (ld.so.cache)
+	dir := t.TempDir()
+	for _, sub_dir := range []string{"bin", "lib", "src"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub_dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "src/dep.c"), []byte(DEP_LIB_SRC), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "src/app.c"), []byte(DEP_PROG_SRC), 0644); err != nil {
+		t.Fatal(err)
+	}
+	lib_path, app_path := filepath.Join(dir, "lib/libdep.so"), filepath.Join(dir, "bin/app")
+	if out, err := exec.Command(cc, "-shared", "-fPIC", "-o", lib_path, filepath.Join(dir, "src/dep.c")).CombinedOutput(); err != nil {
+		t.Fatalf("failed to build libdep.so: %v\n%s", err, out)
+	}
+	if out, err := exec.Command(cc, "-o", app_path, filepath.Join(dir, "src/app.c"), "-L"+filepath.Join(dir, "lib"), "-ldep",
+		"-Wl,--enable-new-dtags,-rpath,$ORIGIN/../lib").CombinedOutput(); err != nil {
+		t.Fatalf("failed to build app: %v\n%s", err, out)
+	}
+	t.Setenv("LD_LIBRARY_PATH", "")
+
+	lib_map, lib_funcs_map, err := NewResolver("").Analyze(app_path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// DT_RUNPATH is expanded by $ORIGIN
+	if !lib_map[filepath.Join(dir, "bin/../lib/libdep.so")] {
+		t.Errorf("unexpected libraries: %v", lib_map)
+	}
+	if funcs := lib_funcs_map[filepath.Join(dir, "bin/../lib/libdep.so")]; len(funcs) != 1 || strings.Compare(funcs[0], "dep_func") != 0 {
+		t.Errorf("unexpected functions of libdep.so: %v", funcs)
+	}
+	// DT_NEEDED of libdep.so is resolved recursively
+	libc_path := ""
+	for lib := range lib_map {
+		if strings.Compare(filepath.Base(lib), "libc.so.6") == 0 {
+			libc_path = lib
+		}
+	}
+	if !filepath.IsAbs(libc_path) {
+		t.Errorf("libc.so.6 is not resolved to the absolute path: %v", lib_map)
+	}
+	if funcs := lib_funcs_map[libc_path]; len(funcs) == 0 {
+		t.Errorf("unexpected functions of libc.so.6: %v", lib_funcs_map)
+	}
+
+	// the static function is not exported
+	funcs, err := ExportedFuncs("", lib_path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exported := map[string]bool{}
+	for _, func_name := range funcs {
+		exported[func_name] = true
+	}
+	if !exported["dep_func"] || exported["dep_static"] {
+		t.Errorf("unexpected exported functions: %v", funcs)
+	}
+}
@@ -0,0 +1,80 @@
+package elfdep
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	LD_SO_CACHE = "/etc/ld.so.cache"
+	// old format (libc5 and glibc < 2.32 in compatible mode) and new format
+	CACHE_MAGIC_OLD = "ld.so-1.7.0"
+	CACHE_MAGIC_NEW = "glibc-ld.so.cache1.1"
+	// struct file_entry { int32 flags; uint32 key, value; }
+	OLD_ENTRY_SIZE  = 12
+	OLD_HEADER_SIZE = 16
+	// struct file_entry_new { int32 flags; uint32 key, value; uint32 osversion; uint64 hwcap; }
+	NEW_ENTRY_SIZE  = 24
+	NEW_HEADER_SIZE = 48
+)
+
+// parseLdCache returns the library paths for every soname in ld.so.cache.
+// one soname may have several paths for the different architectures (ex. i386 and x86_64).
+func parseLdCache(data []byte) (map[string][]string, error) {
+
+	soname_paths := map[string][]string{}
+	new_header := 0
+
+	if bytes.HasPrefix(data, []byte(CACHE_MAGIC_OLD)) {
+		if len(data) < OLD_HEADER_SIZE {
+			return soname_paths, xerrors.Errorf("broken ld.so.cache.\n")
+		}
+		nlibs := int(binary.LittleEndian.Uint32(data[12:]))
+		// the new format follows the old format entries (aligned by 8 bytes)
+		new_header = (OLD_HEADER_SIZE + nlibs*OLD_ENTRY_SIZE + 7) &^ 7
+	}
+
+	if new_header+NEW_HEADER_SIZE > len(data) || !bytes.HasPrefix(data[new_header:], []byte(CACHE_MAGIC_NEW)) {
+		return soname_paths, xerrors.Errorf("unsupported ld.so.cache format.\n")
+	}
+
+	// the string offsets are relative to the new format header
+	cstring := func(offset uint32) (string, bool) {
+		start := new_header + int(offset)
+		if start >= len(data) {
+			return "", false
+		}
+		end := bytes.IndexByte(data[start:], 0)
+		if end == -1 {
+			return "", false
+		}
+		return string(data[start : start+end]), true
+	}
+
+	nlibs := int(binary.LittleEndian.Uint32(data[new_header+20:]))
+	for i := 0; i < nlibs; i++ {
+		entry := new_header + NEW_HEADER_SIZE + i*NEW_ENTRY_SIZE
+		if entry+NEW_ENTRY_SIZE > len(data) {
+			return soname_paths, xerrors.Errorf("broken ld.so.cache entry %v.\n", i)
+		}
+		soname, ok1 := cstring(binary.LittleEndian.Uint32(data[entry+4:]))
+		path, ok2 := cstring(binary.LittleEndian.Uint32(data[entry+8:]))
+		if !ok1 || !ok2 {
+			continue
+		}
+		soname_paths[soname] = append(soname_paths[soname], path)
+	}
+
+	return soname_paths, nil
+}
+
+func loadLdCache(cache_path string) (map[string][]string, error) {
+	data, err := os.ReadFile(cache_path)
+	if err != nil {
+		return map[string][]string{}, err
+	}
+	return parseLdCache(data)
+}
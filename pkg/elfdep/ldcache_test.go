@@ -0,0 +1,58 @@
+package elfdep
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// build ld.so.cache of the new format
+func newLdCache(entries [][2]string) []byte {
+	var header, table, strs bytes.Buffer
+	string_offset := NEW_HEADER_SIZE + len(entries)*NEW_ENTRY_SIZE
+	for _, entry := range entries {
+		binary.Write(&table, binary.LittleEndian, int32(0x0303))
+		binary.Write(&table, binary.LittleEndian, uint32(string_offset+strs.Len()))
+		strs.WriteString(entry[0] + "\x00")
+		binary.Write(&table, binary.LittleEndian, uint32(string_offset+strs.Len()))
+		strs.WriteString(entry[1] + "\x00")
+		binary.Write(&table, binary.LittleEndian, uint32(0))
+		binary.Write(&table, binary.LittleEndian, uint64(0))
+	}
+	header.WriteString(CACHE_MAGIC_NEW)
+	binary.Write(&header, binary.LittleEndian, uint32(len(entries)))
+	binary.Write(&header, binary.LittleEndian, uint32(strs.Len()))
+	header.Write(make([]byte, NEW_HEADER_SIZE-header.Len()))
+	return append(append(header.Bytes(), table.Bytes()...), strs.Bytes()...)
+}
+
+func TestParseLdCache(t *testing.T) {
+
+	data := newLdCache([][2]string{
+		{"libc.so.6", "/lib/x86_64-linux-gnu/libc.so.6"},
+		{"libc.so.6", "/lib/i386-linux-gnu/libc.so.6"},
+		{"libz.so.1", "/lib/x86_64-linux-gnu/libz.so.1"},
+	})
+
+	ans_soname_paths := map[string][]string{
+		"libc.so.6": {"/lib/x86_64-linux-gnu/libc.so.6", "/lib/i386-linux-gnu/libc.so.6"},
+		"libz.so.1": {"/lib/x86_64-linux-gnu/libz.so.1"},
+	}
+
+	t.Run("New Format Test", func(t *testing.T) {
+		soname_paths, err := parseLdCache(data)
+		if err != nil {
+			t.Fatalf("Test Error: %v\n", err)
+		}
+		if !reflect.DeepEqual(soname_paths, ans_soname_paths) {
+			t.Fatalf("Test Error: Content: %v, Answer: %v\n", soname_paths, ans_soname_paths)
+		}
+	})
+
+	t.Run("Unknown Format Test", func(t *testing.T) {
+		if _, err := parseLdCache([]byte("broken")); err == nil {
+			t.Fatalf("Test Error: broken ld.so.cache must be error.\n")
+		}
+	})
+}
@@ -0,0 +1,363 @@
+// Package image unpacks the container image of OCI layout or `docker save` into the rootfs directory,
+// and reads the entrypoint and the environment of the image config.
+package image
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	uutil "github.com/yomaytk/go_ltrace/util"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// docker save
+	DOCKER_MANIFEST_FILE = "manifest.json"
+	// OCI image layout
+	OCI_INDEX_FILE = "index.json"
+	OCI_BLOBS_DIR  = "blobs"
+	// the max depth of the nested image indexes
+	MAX_INDEX_DEPTH = 8
+)
+
+// media types of the OCI index and the docker manifest list
+var index_media_types = map[string]bool{
+	"application/vnd.oci.image.index.v1+json":                   true,
+	"application/vnd.docker.distribution.manifest.list.v2+json": true,
+}
+
+// the annotation of index.json which has the tag. ex.) ubuntu:22.04, 22.04
+const OCI_REF_NAME_ANNOTATION = "org.opencontainers.image.ref.name"
+
+type Image struct {
+	// ex.) nginx:1.25 (the path of the image if it has no tag)
+	Reference string
+	// the directory which the layers are unpacked to
+	Root       string
+	Entrypoint []string
+	Cmd        []string
+	Env        []string
+	WorkingDir string
+}
+
+// the entry of manifest.json of docker save
+type dockerManifest struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Annotations map[string]string `json:"annotations"`
+	Platform    *struct {
+		Architecture string `json:"architecture"`
+		OS           string `json:"os"`
+	} `json:"platform"`
+}
+
+// index.json and the image index
+type ociIndex struct {
+	MediaType string          `json:"mediaType"`
+	Manifests []ociDescriptor `json:"manifests"`
+}
+
+type ociManifest struct {
+	Config ociDescriptor   `json:"config"`
+	Layers []ociDescriptor `json:"layers"`
+}
+
+type imageConfig struct {
+	Config struct {
+		Entrypoint []string
+		Cmd        []string
+		Env        []string
+		WorkingDir string
+	} `json:"config"`
+}
+
+// Extract unpacks the image (the tarball or the directory of OCI layout or docker save) into root.
+func Extract(image_path string, root string) (*Image, error) {
+
+	fi, err := os.Stat(image_path)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot find the image %v: %w", image_path, err)
+	}
+
+	layout_dir := image_path
+	if !fi.IsDir() {
+		// unpack the archive to read manifest.json or index.json
+		layout_dir, err = os.MkdirTemp("", "go_ltrace-image-")
+		if err != nil {
+			return nil, xerrors.Errorf("cannot create the temporary directory: %w", err)
+		}
+		defer os.RemoveAll(layout_dir)
+		if err := unpackFile(image_path, layout_dir, false); err != nil {
+			return nil, xerrors.Errorf("cannot unpack %v: %w", image_path, err)
+		}
+	}
+
+	var config_path string
+	var layer_paths []string
+	var reference string
+	if _, err := os.Stat(filepath.Join(layout_dir, DOCKER_MANIFEST_FILE)); err == nil {
+		config_path, layer_paths, reference, err = readDockerManifest(layout_dir)
+		if err != nil {
+			return nil, err
+		}
+	} else if _, err := os.Stat(filepath.Join(layout_dir, OCI_INDEX_FILE)); err == nil {
+		config_path, layer_paths, reference, err = readOCIIndex(layout_dir)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, xerrors.Errorf("%v is neither OCI layout nor docker save (no %v or %v).\n", image_path, DOCKER_MANIFEST_FILE, OCI_INDEX_FILE)
+	}
+	if strings.Compare(reference, "") == 0 {
+		reference = image_path
+	}
+
+	img := &Image{Reference: reference, Root: root}
+	if err := img.readConfig(config_path); err != nil {
+		return nil, err
+	}
+
+	// the upper layer overwrites and removes the files of the lower layers
+	for _, layer_path := range layer_paths {
+		if err := unpackFile(layer_path, root, true); err != nil {
+			return nil, xerrors.Errorf("cannot unpack the layer %v: %w", filepath.Base(layer_path), err)
+		}
+	}
+
+	return img, nil
+}
+
+func readDockerManifest(layout_dir string) (string, []string, string, error) {
+
+	data, err := os.ReadFile(filepath.Join(layout_dir, DOCKER_MANIFEST_FILE))
+	if err != nil {
+		return "", nil, "", xerrors.Errorf("cannot read %v: %w", DOCKER_MANIFEST_FILE, err)
+	}
+	manifests := []dockerManifest{}
+	if err := json.Unmarshal(data, &manifests); err != nil {
+		return "", nil, "", xerrors.Errorf("cannot decode %v: %w", DOCKER_MANIFEST_FILE, err)
+	}
+	if len(manifests) == 0 {
+		return "", nil, "", xerrors.Errorf("%v has no image.\n", DOCKER_MANIFEST_FILE)
+	}
+	// docker save of several images has several entries, and the first one is scanned
+	manifest := manifests[0]
+
+	config_path, err := layoutPath(layout_dir, manifest.Config)
+	if err != nil {
+		return "", nil, "", err
+	}
+	layer_paths := []string{}
+	for _, layer := range manifest.Layers {
+		layer_path, err := layoutPath(layout_dir, layer)
+		if err != nil {
+			return "", nil, "", err
+		}
+		layer_paths = append(layer_paths, layer_path)
+	}
+	reference := ""
+	if len(manifest.RepoTags) > 0 {
+		reference = manifest.RepoTags[0]
+	}
+
+	return config_path, layer_paths, reference, nil
+}
+
+func readOCIIndex(layout_dir string) (string, []string, string, error) {
+
+	index := ociIndex{}
+	if err := readJSON(filepath.Join(layout_dir, OCI_INDEX_FILE), &index); err != nil {
+		return "", nil, "", err
+	}
+
+	reference := ""
+	// descend the nested indexes (ex. the multi-platform image) to the manifest
+	for depth := 0; depth < MAX_INDEX_DEPTH; depth++ {
+		descriptor, err := selectManifest(index.Manifests)
+		if err != nil {
+			return "", nil, "", err
+		}
+		if strings.Compare(reference, "") == 0 {
+			reference = descriptor.Annotations[OCI_REF_NAME_ANNOTATION]
+		}
+		blob_path, err := blobPath(layout_dir, descriptor.Digest)
+		if err != nil {
+			return "", nil, "", err
+		}
+		if index_media_types[descriptor.MediaType] {
+			index = ociIndex{}
+			if err := readJSON(blob_path, &index); err != nil {
+				return "", nil, "", err
+			}
+			continue
+		}
+
+		manifest := ociManifest{}
+		if err := readJSON(blob_path, &manifest); err != nil {
+			return "", nil, "", err
+		}
+		config_path, err := blobPath(layout_dir, manifest.Config.Digest)
+		if err != nil {
+			return "", nil, "", err
+		}
+		layer_paths := []string{}
+		for _, layer := range manifest.Layers {
+			if strings.HasSuffix(layer.MediaType, "+zstd") {
+				return "", nil, "", xerrors.Errorf("the zstd layer is not supported: %v\n", layer.Digest)
+			}
+			layer_path, err := blobPath(layout_dir, layer.Digest)
+			if err != nil {
+				return "", nil, "", err
+			}
+			layer_paths = append(layer_paths, layer_path)
+		}
+		return config_path, layer_paths, reference, nil
+	}
+
+	return "", nil, "", xerrors.Errorf("the image indexes are nested too deeply.\n")
+}
+
+// the manifest for the platform of go_ltrace, or the first one
+func selectManifest(descriptors []ociDescriptor) (ociDescriptor, error) {
+	if len(descriptors) == 0 {
+		return ociDescriptor{}, xerrors.Errorf("the image index has no manifest.\n")
+	}
+	for _, descriptor := range descriptors {
+		if descriptor.Platform != nil && strings.Compare(descriptor.Platform.OS, "linux") == 0 && strings.Compare(descriptor.Platform.Architecture, runtime.GOARCH) == 0 {
+			return descriptor, nil
+		}
+	}
+	return descriptors[0], nil
+}
+
+// ex.) sha256:abcd... -> <layout>/blobs/sha256/abcd...
+func blobPath(layout_dir string, digest string) (string, error) {
+	tokens := strings.SplitN(digest, ":", 2)
+	if len(tokens) != 2 || strings.Contains(tokens[0], "/") || strings.Contains(tokens[1], "/") || strings.Compare(tokens[1], "") == 0 {
+		return "", xerrors.Errorf("invalid digest: %v\n", digest)
+	}
+	return filepath.Join(layout_dir, OCI_BLOBS_DIR, tokens[0], tokens[1]), nil
+}
+
+// the path of manifest.json must not escape the layout directory
+func layoutPath(layout_dir string, path string) (string, error) {
+	if strings.Compare(path, "") == 0 {
+		return "", xerrors.Errorf("%v has an empty path.\n", DOCKER_MANIFEST_FILE)
+	}
+	return uutil.RootPath(layout_dir, path)
+}
+
+func readJSON(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return xerrors.Errorf("cannot read %v: %w", filepath.Base(path), err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return xerrors.Errorf("cannot decode %v: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+func (img *Image) readConfig(config_path string) error {
+	config := imageConfig{}
+	if err := readJSON(config_path, &config); err != nil {
+		return err
+	}
+	img.Entrypoint = config.Config.Entrypoint
+	img.Cmd = config.Config.Cmd
+	img.Env = config.Config.Env
+	img.WorkingDir = config.Config.WorkingDir
+	return nil
+}
+
+// Command is the command executed by `docker run` without arguments
+func (img *Image) Command() []string {
+	return append(append([]string{}, img.Entrypoint...), img.Cmd...)
+}
+
+// Executable returns the path of the executable of the command in the image. the interpreter of the
+// script (ex. #!/bin/sh, #!/usr/bin/env python3) is returned instead of the script.
+func (img *Image) Executable() (string, error) {
+
+	command := img.Command()
+	if len(command) == 0 {
+		return "", xerrors.Errorf("%v has neither Entrypoint nor Cmd.\n", img.Reference)
+	}
+
+	exe_path, err := img.lookPath(command[0])
+	if err != nil {
+		return "", err
+	}
+
+	interp, err := img.interpreter(exe_path)
+	if err != nil {
+		return "", err
+	}
+	if strings.Compare(interp, "") == 0 {
+		return exe_path, nil
+	}
+	return img.lookPath(interp)
+}
+
+// search the command in PATH of the image
+func (img *Image) lookPath(name string) (string, error) {
+	path_env := uutil.DEFAULT_PATH
+	for _, env := range img.Env {
+		if strings.HasPrefix(env, "PATH=") {
+			path_env = strings.TrimPrefix(env, "PATH=")
+		}
+	}
+	exe_path, err := uutil.LookPath(img.Root, name, path_env, img.WorkingDir)
+	if err != nil {
+		return "", xerrors.Errorf("%v of %v: %w", name, img.Reference, err)
+	}
+	return exe_path, nil
+}
+
+// the interpreter of the shebang ("" if the file is not the script)
+func (img *Image) interpreter(path string) (string, error) {
+
+	host_path, err := uutil.RootPath(img.Root, path)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Open(host_path)
+	if err != nil {
+		return "", xerrors.Errorf("cannot open %v: %w", path, err)
+	}
+	defer f.Close()
+
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", xerrors.Errorf("cannot read %v: %w", path, err)
+	}
+	if !strings.HasPrefix(line, "#!") {
+		return "", nil
+	}
+	fields := strings.Fields(strings.TrimPrefix(line, "#!"))
+	if len(fields) == 0 {
+		return "", xerrors.Errorf("%v has an empty shebang.\n", path)
+	}
+
+	// ex.) #!/usr/bin/env python3, #!/usr/bin/env -S python3 -u
+	if strings.Compare(filepath.Base(fields[0]), "env") == 0 {
+		for _, field := range fields[1:] {
+			if !strings.HasPrefix(field, "-") && !strings.Contains(field, "=") {
+				return field, nil
+			}
+		}
+	}
+	return fields[0], nil
+}
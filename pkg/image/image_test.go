@@ -0,0 +1,233 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/yomaytk/go_ltrace/log"
+)
+
+type tarEntry struct {
+	Name     string
+	Type     byte
+	Body     string
+	Linkname string
+	Mode     int64
+}
+
+func newTar(t *testing.T, entries []tarEntry, compressed bool) []byte {
+	var buf bytes.Buffer
+	var gzip_writer *gzip.Writer
+	tar_writer := tar.NewWriter(&buf)
+	if compressed {
+		gzip_writer = gzip.NewWriter(&buf)
+		tar_writer = tar.NewWriter(gzip_writer)
+	}
+	for _, entry := range entries {
+		mode := entry.Mode
+		if mode == 0 {
+			mode = 0644
+		}
+		hdr := &tar.Header{Name: entry.Name, Typeflag: entry.Type, Linkname: entry.Linkname, Mode: mode, Size: int64(len(entry.Body))}
+		if entry.Type != tar.TypeReg {
+			hdr.Size = 0
+		}
+		if err := tar_writer.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tar_writer.Write([]byte(entry.Body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tar_writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if compressed {
+		if err := gzip_writer.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+// the lower layer: the usrmerge links, the libraries and the interpreters
+var base_layer = []tarEntry{
+	{Name: "usr/", Type: tar.TypeDir, Mode: 0755},
+	{Name: "usr/lib/", Type: tar.TypeDir, Mode: 0755},
+	{Name: "usr/bin/", Type: tar.TypeDir, Mode: 0755},
+	{Name: "lib", Type: tar.TypeSymlink, Linkname: "usr/lib"},
+	{Name: "bin", Type: tar.TypeSymlink, Linkname: "/usr/bin"},
+	{Name: "usr/lib/libfoo.so.1", Type: tar.TypeReg, Body: "foo"},
+	{Name: "usr/lib/libbar.so.1", Type: tar.TypeReg, Body: "bar"},
+	{Name: "usr/bin/sh", Type: tar.TypeReg, Body: "\x7fELF", Mode: 0755},
+	{Name: "usr/bin/python3", Type: tar.TypeReg, Body: "\x7fELF", Mode: 04755},
+	{Name: "etc/", Type: tar.TypeDir, Mode: 0755},
+	{Name: "etc/conf.d/", Type: tar.TypeDir, Mode: 0755},
+	{Name: "etc/conf.d/old.conf", Type: tar.TypeReg, Body: "old"},
+}
+
+// the upper layer: the whiteouts, the opaque directory, the file through the link and the escaping entries
+var app_layer = []tarEntry{
+	{Name: "usr/lib/.wh.libbar.so.1", Type: tar.TypeReg},
+	{Name: "etc/conf.d/", Type: tar.TypeDir, Mode: 0755},
+	{Name: "etc/conf.d/.wh..wh..opq", Type: tar.TypeReg},
+	{Name: "etc/conf.d/new.conf", Type: tar.TypeReg, Body: "new"},
+	{Name: "lib/libapp.so", Type: tar.TypeReg, Body: "app"},
+	{Name: "lib/libapp.so.1", Type: tar.TypeLink, Linkname: "usr/lib/libapp.so"},
+	{Name: "../../escape", Type: tar.TypeReg, Body: "escape"},
+	{Name: "outside", Type: tar.TypeSymlink, Linkname: "/"},
+	{Name: "outside/escape", Type: tar.TypeReg, Body: "escape"},
+	{Name: "app/", Type: tar.TypeDir, Mode: 0555},
+	{Name: "app/run.py", Type: tar.TypeReg, Body: "#!/usr/bin/env -S python3 -u\nprint()\n", Mode: 0755},
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func marshal(t *testing.T, v interface{}) []byte {
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+var image_config = map[string]interface{}{
+	"architecture": "amd64",
+	"os":           "linux",
+	"config": map[string]interface{}{
+		"Entrypoint": []string{"./run.py"},
+		"Cmd":        []string{"--port", "80"},
+		"Env":        []string{"PATH=/usr/local/bin:/usr/bin"},
+		"WorkingDir": "/app",
+	},
+}
+
+func checkRootfs(t *testing.T, img *Image, root string) {
+
+	for name, expected := range map[string]string{"usr/lib/libfoo.so.1": "foo", "usr/lib/libapp.so": "app", "usr/lib/libapp.so.1": "app", "etc/conf.d/new.conf": "new", "escape": "escape"} {
+		data, err := os.ReadFile(filepath.Join(root, name))
+		if err != nil || strings.Compare(string(data), expected) != 0 {
+			t.Errorf("unexpected %v: %q, %v", name, data, err)
+		}
+	}
+	for _, name := range []string{"usr/lib/libbar.so.1", "etc/conf.d/old.conf"} {
+		if _, err := os.Lstat(filepath.Join(root, name)); err == nil {
+			t.Errorf("%v is not removed", name)
+		}
+	}
+	// ../../escape and outside/escape (outside -> /) are unpacked to /escape of the root
+	if _, err := os.Lstat(filepath.Join(filepath.Dir(root), "escape")); err == nil {
+		t.Errorf("the layer escapes the root")
+	}
+	if fi, err := os.Stat(filepath.Join(root, "usr/bin/python3")); err != nil || fi.Mode()&os.ModeSetuid != 0 {
+		t.Errorf("the setuid bit is not dropped: %v", err)
+	}
+
+	if !reflect.DeepEqual(img.Command(), []string{"./run.py", "--port", "80"}) {
+		t.Errorf("unexpected command: %v", img.Command())
+	}
+	exe_path, err := img.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Compare(exe_path, "/usr/bin/python3") != 0 {
+		t.Errorf("Executable() = %v, expected /usr/bin/python3", exe_path)
+	}
+}
+
+func TestExtractDockerSave(t *testing.T) {
+
+	log.InitLogger("")
+
+	// docker save: manifest.json, the config and the layers as the files of the archive
+	manifest := []map[string]interface{}{{
+		"Config":   "config.json",
+		"RepoTags": []string{"example/app:1.0"},
+		"Layers":   []string{"base/layer.tar", "app/layer.tar"},
+	}}
+	archive := newTar(t, []tarEntry{
+		{Name: "manifest.json", Type: tar.TypeReg, Body: string(marshal(t, manifest))},
+		{Name: "config.json", Type: tar.TypeReg, Body: string(marshal(t, image_config))},
+		{Name: "base/layer.tar", Type: tar.TypeReg, Body: string(newTar(t, base_layer, false))},
+		{Name: "app/layer.tar", Type: tar.TypeReg, Body: string(newTar(t, app_layer, true))},
+	}, false)
+	archive_path := filepath.Join(t.TempDir(), "app.tar")
+	writeFile(t, archive_path, archive)
+
+	root := filepath.Join(t.TempDir(), "rootfs")
+	img, err := Extract(archive_path, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Compare(img.Reference, "example/app:1.0") != 0 {
+		t.Errorf("unexpected reference: %v", img.Reference)
+	}
+	checkRootfs(t, img, root)
+}
+
+func TestExtractOCILayout(t *testing.T) {
+
+	log.InitLogger("")
+
+	layout_dir := t.TempDir()
+	blob := func(data []byte) string {
+		sum := sha256.Sum256(data)
+		digest := hex.EncodeToString(sum[:])
+		writeFile(t, filepath.Join(layout_dir, "blobs", "sha256", digest), data)
+		return "sha256:" + digest
+	}
+	config_digest := blob(marshal(t, image_config))
+	manifest_digest := blob(marshal(t, map[string]interface{}{
+		"config": map[string]string{"digest": config_digest},
+		"layers": []map[string]string{
+			{"mediaType": "application/vnd.oci.image.layer.v1.tar", "digest": blob(newTar(t, base_layer, false))},
+			{"mediaType": "application/vnd.oci.image.layer.v1.tar+gzip", "digest": blob(newTar(t, app_layer, true))},
+		},
+	}))
+	// the multi-platform image index in index.json
+	index_digest := blob(marshal(t, map[string]interface{}{
+		"manifests": []map[string]interface{}{
+			{"mediaType": "application/vnd.oci.image.manifest.v1+json", "digest": "sha256:0000", "platform": map[string]string{"architecture": "unknown", "os": "linux"}},
+			{"mediaType": "application/vnd.oci.image.manifest.v1+json", "digest": manifest_digest, "platform": map[string]string{"architecture": runtime.GOARCH, "os": "linux"}},
+		},
+	}))
+	writeFile(t, filepath.Join(layout_dir, OCI_INDEX_FILE), marshal(t, map[string]interface{}{
+		"manifests": []map[string]interface{}{
+			{"mediaType": "application/vnd.oci.image.index.v1+json", "digest": index_digest, "annotations": map[string]string{OCI_REF_NAME_ANNOTATION: "1.0"}},
+		},
+	}))
+
+	root := filepath.Join(t.TempDir(), "rootfs")
+	img, err := Extract(layout_dir, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Compare(img.Reference, "1.0") != 0 {
+		t.Errorf("unexpected reference: %v", img.Reference)
+	}
+	checkRootfs(t, img, root)
+
+	if _, err := Extract(t.TempDir(), filepath.Join(t.TempDir(), "rootfs")); err == nil {
+		t.Errorf("the directory which is not the image is extracted")
+	}
+	if _, err := blobPath(layout_dir, "sha256:../../etc/passwd"); err == nil {
+		t.Errorf("the digest escapes the layout")
+	}
+}
@@ -0,0 +1,200 @@
+package image
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	log "github.com/yomaytk/go_ltrace/log"
+	uutil "github.com/yomaytk/go_ltrace/util"
+	"golang.org/x/xerrors"
+)
+
+// the whiteout files of the layer (the files of the lower layers are removed)
+const (
+	WHITEOUT_PREFIX = ".wh."
+	WHITEOUT_OPAQUE = ".wh..wh..opq"
+)
+
+var gzip_magic = []byte{0x1f, 0x8b}
+
+// unpack the tar (or tar.gz) file into root. the whiteout files are applied if whiteouts is true.
+func unpackFile(tar_path string, root string, whiteouts bool) error {
+
+	f, err := os.Open(tar_path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var tar_reader io.Reader = r
+	if magic, err := r.Peek(len(gzip_magic)); err == nil && bytes.Equal(magic, gzip_magic) {
+		gzip_reader, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer gzip_reader.Close()
+		tar_reader = gzip_reader
+	}
+
+	return unpack(tar.NewReader(tar_reader), root, whiteouts)
+}
+
+// the host path of the file in root. the links of the parent directories are resolved in root, so
+// that the file of the layer (ex. /lib/libc.so.6 of /lib -> /usr/lib) never escapes it.
+func hostPath(root string, name string) (string, error) {
+	parent, err := uutil.RootPath(root, path.Dir(name))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(parent, path.Base(name)), nil
+}
+
+func unpack(tar_reader *tar.Reader, root string, whiteouts bool) error {
+
+	if strings.Compare(root, "") == 0 || strings.Compare(filepath.Clean(root), "/") == 0 {
+		return xerrors.Errorf("the image cannot be unpacked to the host root.\n")
+	}
+
+	// the files of this layer are not removed by the opaque whiteout of this layer
+	unpacked := map[string]bool{}
+
+	for {
+		hdr, err := tar_reader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		name := path.Clean("/" + hdr.Name)
+		if strings.Compare(name, "/") == 0 {
+			continue
+		}
+		base := path.Base(name)
+
+		if whiteouts && strings.Compare(base, WHITEOUT_OPAQUE) == 0 {
+			if err := removeLower(root, path.Dir(name), unpacked); err != nil {
+				return err
+			}
+			continue
+		}
+		if whiteouts && strings.HasPrefix(base, WHITEOUT_PREFIX) {
+			removed, err := hostPath(root, path.Join(path.Dir(name), strings.TrimPrefix(base, WHITEOUT_PREFIX)))
+			if err != nil {
+				return err
+			}
+			if err := os.RemoveAll(removed); err != nil {
+				return err
+			}
+			continue
+		}
+
+		host_path, err := hostPath(root, name)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(host_path), 0755); err != nil {
+			return err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = unpackDir(host_path, hdr)
+		case tar.TypeReg, tar.TypeRegA:
+			err = unpackRegular(host_path, hdr, tar_reader)
+		case tar.TypeSymlink:
+			if err = removeExisting(host_path); err == nil {
+				err = os.Symlink(hdr.Linkname, host_path)
+			}
+		case tar.TypeLink:
+			var link_path string
+			link_path, err = hostPath(root, path.Clean("/"+hdr.Linkname))
+			if err == nil {
+				if err = removeExisting(host_path); err == nil {
+					err = os.Link(link_path, host_path)
+				}
+			}
+		default:
+			// the devices and the fifos are not needed to find the libraries
+			log.Logger.Infof("skip %v (type %c)", name, hdr.Typeflag)
+			continue
+		}
+		if err != nil {
+			return xerrors.Errorf("cannot unpack %v: %w", name, err)
+		}
+		unpacked[name] = true
+	}
+}
+
+// the owner can always write the directory, so that the upper layers and the cleanup can modify it
+func unpackDir(host_path string, hdr *tar.Header) error {
+	mode := os.FileMode(hdr.Mode)&os.ModePerm | 0700
+	if fi, err := os.Lstat(host_path); err == nil {
+		if fi.IsDir() {
+			return os.Chmod(host_path, mode)
+		}
+		if err := os.Remove(host_path); err != nil {
+			return err
+		}
+	}
+	return os.Mkdir(host_path, mode)
+}
+
+// the setuid and setgid bits are dropped
+func unpackRegular(host_path string, hdr *tar.Header, r io.Reader) error {
+	if err := removeExisting(host_path); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(host_path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, os.FileMode(hdr.Mode)&os.ModePerm|0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// remove the file of the lower layer which is replaced
+func removeExisting(host_path string) error {
+	if err := os.RemoveAll(host_path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// remove the children of the directory which come from the lower layers
+func removeLower(root string, dir string, unpacked map[string]bool) error {
+	host_dir, err := uutil.RootPath(root, dir)
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(host_dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if unpacked[path.Join(dir, entry.Name())] {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(host_dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,254 @@
+// Package langpkg finds the language packages (PyPI, npm and Go modules) which own the files not installed by dpkg.
+// ex.) the Python extension module loaded by python3, the native addon of Node.js, the Go shared library
+package langpkg
+
+import (
+	"bufio"
+	"debug/buildinfo"
+	"encoding/csv"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+
+	log "github.com/yomaytk/go_ltrace/log"
+	ttypes "github.com/yomaytk/go_ltrace/types"
+	uutil "github.com/yomaytk/go_ltrace/util"
+	"golang.org/x/xerrors"
+)
+
+// the ecosystem of OSV
+const (
+	ECOSYSTEM_PYPI = "PyPI"
+	ECOSYSTEM_NPM  = "npm"
+	ECOSYSTEM_GO   = "Go"
+)
+
+// the package name of the Go toolchain in OSV
+const GO_STDLIB = "stdlib"
+
+// the directories of the installed Python packages
+var site_dirs = map[string]bool{"site-packages": true, "dist-packages": true}
+
+const NODE_MODULES = "node_modules"
+
+type Resolver struct {
+	// the root directory of the analyzed system ("" is the host)
+	Root string
+	// key: site-packages directory, value: key: the file in RECORD, value: the package
+	site_indexes map[string]map[string]ttypes.PackageDetail
+}
+
+func NewResolver(root string) *Resolver {
+	return &Resolver{Root: root, site_indexes: map[string]map[string]ttypes.PackageDetail{}}
+}
+
+func newPackage(ecosystem string, name string, version string) ttypes.PackageDetail {
+	return ttypes.PackageDetail{Binaryp: name, Sourcep: name, Version: version, SourceVersion: version, Ecosystem: ecosystem}
+}
+
+// Search returns the language packages which own the file (the path in the root).
+func (resolver *Resolver) Search(path string) ([]ttypes.PackageDetail, error) {
+
+	path = filepath.Clean(path)
+	for dir := filepath.Dir(path); strings.Compare(dir, "/") != 0 && strings.Compare(dir, ".") != 0; dir = filepath.Dir(dir) {
+		switch {
+		case site_dirs[filepath.Base(dir)]:
+			return resolver.pythonPackage(dir, path)
+		case strings.Compare(filepath.Base(dir), NODE_MODULES) == 0:
+			return resolver.npmPackage(dir, path)
+		}
+	}
+
+	// the Go library built with -buildmode=c-shared has the build information
+	return resolver.goModules(path)
+}
+
+// the package whose RECORD of *.dist-info lists the file
+func (resolver *Resolver) pythonPackage(site_dir string, path string) ([]ttypes.PackageDetail, error) {
+
+	index, ok := resolver.site_indexes[site_dir]
+	if !ok {
+		var err error
+		if index, err = resolver.siteIndex(site_dir); err != nil {
+			return []ttypes.PackageDetail{}, err
+		}
+		resolver.site_indexes[site_dir] = index
+	}
+	if pkg, ok := index[path]; ok {
+		return []ttypes.PackageDetail{pkg}, nil
+	}
+
+	return []ttypes.PackageDetail{}, xerrors.Errorf("no Python package in %v owns %v\n", site_dir, path)
+}
+
+// read RECORD and METADATA of every *.dist-info in the site-packages directory
+func (resolver *Resolver) siteIndex(site_dir string) (map[string]ttypes.PackageDetail, error) {
+
+	index := map[string]ttypes.PackageDetail{}
+	host_dir, err := uutil.RootPath(resolver.Root, site_dir)
+	if err != nil {
+		return index, err
+	}
+	entries, err := os.ReadDir(host_dir)
+	if err != nil {
+		return index, xerrors.Errorf("cannot read %v: %w", site_dir, err)
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasSuffix(entry.Name(), ".dist-info") {
+			continue
+		}
+		dist_info := filepath.Join(host_dir, entry.Name())
+		name, version, err := readMetadata(filepath.Join(dist_info, "METADATA"))
+		if err != nil {
+			log.Logger.Infof("cannot read the metadata of %v: %v", entry.Name(), err)
+			continue
+		}
+		files, err := readRecord(filepath.Join(dist_info, "RECORD"))
+		if err != nil {
+			log.Logger.Infof("cannot read the files of %v: %v", entry.Name(), err)
+			continue
+		}
+		for _, file := range files {
+			// the path is relative to the site-packages directory. ex.) markupsafe/_speedups.cpython-311-x86_64-linux-gnu.so
+			index[filepath.Join(site_dir, file)] = newPackage(ECOSYSTEM_PYPI, name, version)
+		}
+	}
+
+	return index, nil
+}
+
+// the name and the version in the header of METADATA (the email header format)
+func readMetadata(metadata_path string) (string, string, error) {
+
+	f, err := os.Open(metadata_path)
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+
+	name, version := "", ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		// the description follows the blank line
+		if strings.Compare(line, "") == 0 {
+			break
+		}
+		if value, ok := strings.CutPrefix(line, "Name:"); ok {
+			name = strings.TrimSpace(value)
+		} else if value, ok := strings.CutPrefix(line, "Version:"); ok {
+			version = strings.TrimSpace(value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", "", err
+	}
+	if strings.Compare(name, "") == 0 || strings.Compare(version, "") == 0 {
+		return "", "", xerrors.Errorf("Name or Version is not found in %v\n", metadata_path)
+	}
+
+	return name, version, nil
+}
+
+// the files of RECORD (the csv of path, hash and size)
+func readRecord(record_path string) ([]string, error) {
+
+	f, err := os.Open(record_path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	files := []string{}
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	for {
+		fields, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(fields) > 0 && strings.Compare(fields[0], "") != 0 {
+			files = append(files, fields[0])
+		}
+	}
+
+	return files, nil
+}
+
+// the package of package.json in node_modules. ex.) node_modules/@scope/name/build/Release/addon.node
+func (resolver *Resolver) npmPackage(modules_dir string, path string) ([]ttypes.PackageDetail, error) {
+
+	rel, err := filepath.Rel(modules_dir, path)
+	if err != nil {
+		return []ttypes.PackageDetail{}, err
+	}
+	components := strings.Split(rel, string(filepath.Separator))
+	package_dir := components[0]
+	if strings.HasPrefix(package_dir, "@") && len(components) > 2 {
+		package_dir = filepath.Join(components[0], components[1])
+	}
+
+	host_path, err := uutil.RootPath(resolver.Root, filepath.Join(modules_dir, package_dir, "package.json"))
+	if err != nil {
+		return []ttypes.PackageDetail{}, err
+	}
+	data, err := os.ReadFile(host_path)
+	if err != nil {
+		return []ttypes.PackageDetail{}, xerrors.Errorf("cannot read package.json of %v: %w", path, err)
+	}
+	var package_json struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+	json := jsoniter.ConfigCompatibleWithStandardLibrary
+	if err := json.Unmarshal(data, &package_json); err != nil {
+		return []ttypes.PackageDetail{}, xerrors.Errorf("cannot decode package.json of %v: %w", path, err)
+	}
+	if strings.Compare(package_json.Name, "") == 0 || strings.Compare(package_json.Version, "") == 0 {
+		return []ttypes.PackageDetail{}, xerrors.Errorf("name or version is not found in package.json of %v\n", path)
+	}
+
+	return []ttypes.PackageDetail{newPackage(ECOSYSTEM_NPM, package_json.Name, package_json.Version)}, nil
+}
+
+// the modules and the standard library in the build information of the Go binary
+func (resolver *Resolver) goModules(path string) ([]ttypes.PackageDetail, error) {
+
+	host_path, err := uutil.RootPath(resolver.Root, path)
+	if err != nil {
+		return []ttypes.PackageDetail{}, err
+	}
+	info, err := buildinfo.ReadFile(host_path)
+	if err != nil {
+		return []ttypes.PackageDetail{}, xerrors.Errorf("no language package owns %v: %w", path, err)
+	}
+
+	packages := []ttypes.PackageDetail{}
+	// ex.) go1.21.5, go1.22.0 X:loopvar
+	if fields := strings.Fields(info.GoVersion); len(fields) > 0 {
+		packages = append(packages, newPackage(ECOSYSTEM_GO, GO_STDLIB, strings.TrimPrefix(fields[0], "go")))
+	}
+	// the main module built in the working tree is (devel)
+	if strings.Compare(info.Main.Path, "") != 0 && strings.Compare(info.Main.Version, "(devel)") != 0 && strings.Compare(info.Main.Version, "") != 0 {
+		packages = append(packages, newPackage(ECOSYSTEM_GO, info.Main.Path, info.Main.Version))
+	}
+	for _, dep := range info.Deps {
+		if dep.Replace != nil {
+			dep = dep.Replace
+		}
+		// the module replaced by the local directory has no version
+		if strings.Compare(dep.Version, "") == 0 {
+			continue
+		}
+		packages = append(packages, newPackage(ECOSYSTEM_GO, dep.Path, dep.Version))
+	}
+
+	return packages, nil
+}
@@ -0,0 +1,101 @@
+package langpkg
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	log "github.com/yomaytk/go_ltrace/log"
+	ttypes "github.com/yomaytk/go_ltrace/types"
+)
+
+const SITE_DIR = "/usr/local/lib/python3.11/dist-packages"
+
+const SAMPLE_METADATA = `Metadata-Version: 2.1
+Name: MarkupSafe
+Version: 2.1.3
+Summary: Safely add untrusted strings to HTML/XML markup.
+
+Version: 0.0.0 in the description
+`
+
+const SAMPLE_RECORD = `MarkupSafe-2.1.3.dist-info/METADATA,sha256=abc,3000
+markupsafe/__init__.py,sha256=def,9000
+"markupsafe/_speedups.cpython-311-x86_64-linux-gnu.so",sha256=ghi,45000
+markupsafe-2.1.3.dist-info/RECORD,,
+`
+
+func writeFile(t *testing.T, path string, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSearch(t *testing.T) {
+
+	log.InitLogger("")
+
+	root := t.TempDir()
+	dist_info := filepath.Join(root, SITE_DIR, "MarkupSafe-2.1.3.dist-info")
+	writeFile(t, filepath.Join(dist_info, "METADATA"), SAMPLE_METADATA)
+	writeFile(t, filepath.Join(dist_info, "RECORD"), SAMPLE_RECORD)
+	// the broken dist-info is skipped
+	writeFile(t, filepath.Join(root, SITE_DIR, "broken-1.0.dist-info", "METADATA"), "Name: broken\n")
+	writeFile(t, filepath.Join(root, "/usr/lib/node_modules/@scope/addon/package.json"), `{"name": "@scope/addon", "version": "1.0.0"}`)
+	writeFile(t, filepath.Join(root, "/usr/lib/node_modules/@scope/addon/node_modules/nested/package.json"), `{"name": "nested", "version": "0.1.0"}`)
+
+	tests := []struct {
+		path     string
+		expected ttypes.PackageDetail
+	}{
+		{SITE_DIR + "/markupsafe/_speedups.cpython-311-x86_64-linux-gnu.so",
+			ttypes.PackageDetail{Binaryp: "MarkupSafe", Sourcep: "MarkupSafe", Version: "2.1.3", SourceVersion: "2.1.3", Ecosystem: ECOSYSTEM_PYPI}},
+		{"/usr/lib/node_modules/@scope/addon/build/Release/addon.node",
+			ttypes.PackageDetail{Binaryp: "@scope/addon", Sourcep: "@scope/addon", Version: "1.0.0", SourceVersion: "1.0.0", Ecosystem: ECOSYSTEM_NPM}},
+		// the nearest node_modules
+		{"/usr/lib/node_modules/@scope/addon/node_modules/nested/lib.node",
+			ttypes.PackageDetail{Binaryp: "nested", Sourcep: "nested", Version: "0.1.0", SourceVersion: "0.1.0", Ecosystem: ECOSYSTEM_NPM}},
+	}
+	resolver := NewResolver(root)
+	for _, test := range tests {
+		packages, err := resolver.Search(test.path)
+		if err != nil {
+			t.Errorf("Search(%v): %v", test.path, err)
+			continue
+		}
+		if len(packages) != 1 || packages[0] != test.expected {
+			t.Errorf("Search(%v) = %+v, expected %+v", test.path, packages, test.expected)
+		}
+	}
+
+	for _, path := range []string{SITE_DIR + "/unknown/_c.so", "/usr/lib/x86_64-linux-gnu/libfoo.so.1"} {
+		if packages, err := resolver.Search(path); err == nil {
+			t.Errorf("Search(%v) = %v", path, packages)
+		}
+	}
+}
+
+func TestGoModules(t *testing.T) {
+
+	// the test binary has the build information of this module
+	exe_path, err := os.Executable()
+	if err != nil {
+		t.Skip(err)
+	}
+	packages, err := NewResolver("").Search(exe_path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packages) == 0 || strings.Compare(packages[0].Sourcep, GO_STDLIB) != 0 || strings.HasPrefix(packages[0].Version, "go") {
+		t.Errorf("unexpected modules: %+v", packages)
+	}
+	for _, pkg := range packages {
+		if strings.Compare(pkg.Ecosystem, ECOSYSTEM_GO) != 0 || strings.Compare(pkg.Version, "") == 0 {
+			t.Errorf("unexpected module: %+v", pkg)
+		}
+	}
+}
@@ -0,0 +1,459 @@
+// Package cscan extracts the function locations from C/C++ source without compiling it.
+// The scanner only understands the braces, the parentheses and the preprocessor conditionals, so that it works on
+// the source which cannot be preprocessed (missing headers, macros defined by the build system, etc.).
+package cscan
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	gity "github.com/yomaytk/go_ltrace/vulndb/gitrepo/types"
+)
+
+var (
+	// the name before '(' of the function. ex.) foo, Foo::bar, ~Foo, ns::Foo<T>::operator==, operator()
+	func_name_re = regexp.MustCompile(`((?:[A-Za-z_]\w*\s*(?:<[^<>(){};]*>)?\s*::\s*)*(?:operator\s*(?:\(\s*\)|\[\s*\]|[^\s\w(]+|\w+)|~?\s*[A-Za-z_]\w*))\s*$`)
+	// C++ access specifier before the member function
+	access_label_re = regexp.MustCompile(`^\s*(?:(?:public|private|protected)\s*:(?:[^:]|$)\s*)+`)
+	// the parameter and its name. ex.) const char *name, int buf[16]
+	param_name_re = regexp.MustCompile(`^(.*[\s\*&])([A-Za-z_]\w*)((?:\s*\[[^\]]*\])*)$`)
+	// the template arguments of the class. ex.) Foo<T>
+	template_args_re = regexp.MustCompile(`<[^<>]*>`)
+	// the identifier of macro. ex.) ZEXPORT, OPENSSL_UNUSED
+	macro_re = regexp.MustCompile(`^[A-Z_][A-Z0-9_]*$`)
+)
+
+// the names before '(' which are not the function
+var not_func_names = map[string]bool{"__attribute__": true, "__attribute": true, "__declspec": true, "alignas": true, "_Alignas": true,
+	"__asm__": true, "__asm": true, "asm": true, "decltype": true, "typeof": true, "__typeof__": true, "if": true, "for": true,
+	"while": true, "switch": true, "return": true, "sizeof": true, "catch": true, "defined": true}
+
+// the words which are not a part of the return type
+var specifiers = map[string]bool{"static": true, "inline": true, "extern": true, "__inline": true, "__inline__": true, "virtual": true,
+	"explicit": true, "constexpr": true, "friend": true, "_Noreturn": true}
+
+// the words after the parameter list of the function
+var qualifiers = map[string]bool{"const": true, "volatile": true, "noexcept": true, "override": true, "final": true, "try": true,
+	"throw": true, "__attribute__": true, "__attribute": true}
+
+// the type names which cannot be the parameter name
+var type_words = map[string]bool{"void": true, "char": true, "short": true, "int": true, "long": true, "float": true, "double": true,
+	"signed": true, "unsigned": true, "_Bool": true, "bool": true, "const": true, "volatile": true, "struct": true, "union": true, "enum": true}
+
+type scanner struct {
+	text []byte
+	// the offset of every '\n'
+	newlines       []int
+	func_locations []gity.FuncLocation
+}
+
+// GetFuncLocation returns the location of the functions defined in the C/C++ source.
+func GetFuncLocation(content string) ([]gity.FuncLocation, error) {
+
+	s := &scanner{text: stripDirectives(stripComments([]byte(content))), func_locations: []gity.FuncLocation{}}
+	for id, c := range s.text {
+		if c == '\n' {
+			s.newlines = append(s.newlines, id)
+		}
+	}
+
+	s.scanScope(0, false)
+
+	return s.func_locations, nil
+}
+
+// replace the comments and the contents of the literals by spaces, keeping newlines so that the line numbers don't change
+func stripComments(src []byte) []byte {
+
+	dst := make([]byte, len(src))
+	copy(dst, src)
+
+	for id := 0; id < len(src); id++ {
+		switch {
+		case src[id] == '/' && id+1 < len(src) && src[id+1] == '/':
+			for ; id < len(src) && src[id] != '\n'; id++ {
+				// the line comment continues to the next line by backslash
+				if src[id] == '\\' && id+1 < len(src) && src[id+1] == '\n' {
+					dst[id] = ' '
+					id++
+					continue
+				}
+				dst[id] = ' '
+			}
+		case src[id] == '/' && id+1 < len(src) && src[id+1] == '*':
+			dst[id], dst[id+1] = ' ', ' '
+			for id += 2; id < len(src) && !(src[id] == '*' && id+1 < len(src) && src[id+1] == '/'); id++ {
+				if src[id] != '\n' {
+					dst[id] = ' '
+				}
+			}
+			if id < len(src) {
+				dst[id], dst[id+1] = ' ', ' '
+				id++
+			}
+		case src[id] == '"' || src[id] == '\'':
+			quote := src[id]
+			for id++; id < len(src) && src[id] != quote && src[id] != '\n'; id++ {
+				if src[id] == '\\' && id+1 < len(src) {
+					dst[id] = ' '
+					id++
+					if src[id] == '\n' {
+						continue
+					}
+				}
+				dst[id] = ' '
+			}
+		}
+	}
+
+	return dst
+}
+
+// the state of #if ... #endif
+type conditional struct {
+	// one of the branches has been left
+	taken    bool
+	skipping bool
+}
+
+// replace the preprocessor directives by spaces. only the first branch of every conditional is left (except #if 0),
+// because the branches often open the same brace twice.
+func stripDirectives(src []byte) []byte {
+
+	dst := make([]byte, len(src))
+	copy(dst, src)
+	conditionals := []conditional{}
+
+	blank := func(start int, end int) {
+		for id := start; id < end; id++ {
+			if dst[id] != '\n' {
+				dst[id] = ' '
+			}
+		}
+	}
+	skipping := func() bool {
+		for _, cond := range conditionals {
+			if cond.skipping {
+				return true
+			}
+		}
+		return false
+	}
+
+	for line_start := 0; line_start < len(src); {
+
+		// the directive continues to the next line by backslash
+		line_end := line_start
+		for line_end < len(src) && (src[line_end] != '\n' || (line_end > line_start && src[line_end-1] == '\\')) {
+			line_end++
+		}
+		line := strings.TrimSpace(string(src[line_start:line_end]))
+
+		if strings.HasPrefix(line, "#") {
+			directive := strings.Fields(strings.TrimSpace(strings.TrimPrefix(line, "#")) + " ")
+			name, arg := "", ""
+			if len(directive) > 0 {
+				name = directive[0]
+			}
+			if len(directive) > 1 {
+				arg = directive[1]
+			}
+			switch name {
+			case "if", "ifdef", "ifndef":
+				disabled := strings.Compare(name, "if") == 0 && strings.Compare(arg, "0") == 0
+				conditionals = append(conditionals, conditional{taken: !disabled, skipping: disabled})
+			case "elif", "else":
+				if len(conditionals) > 0 {
+					cond := &conditionals[len(conditionals)-1]
+					cond.skipping = cond.taken
+					cond.taken = true
+				}
+			case "endif":
+				if len(conditionals) > 0 {
+					conditionals = conditionals[:len(conditionals)-1]
+				}
+			}
+			blank(line_start, line_end)
+		} else if skipping() {
+			blank(line_start, line_end)
+		}
+
+		line_start = line_end + 1
+	}
+
+	return dst
+}
+
+// the line number (1-origin) of the offset
+func (s *scanner) line(offset int) int {
+	return sort.SearchInts(s.newlines, offset) + 1
+}
+
+// the offset of '}' corresponding to '{' at the offset
+func (s *scanner) matchBrace(offset int) int {
+	depth := 0
+	for id := offset; id < len(s.text); id++ {
+		switch s.text[id] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return id
+			}
+		}
+	}
+	return len(s.text) - 1
+}
+
+// scan the declarations in the file, namespace, extern "C" or class, and return the offset after the scope
+func (s *scanner) scanScope(offset int, in_scope bool) int {
+
+	// the start of the declaration
+	header_start := offset
+	// the start of the declarations after the last block (for K&R style definition)
+	segment_start := offset
+
+	for id := offset; id < len(s.text); id++ {
+		switch s.text[id] {
+		case ';':
+			header_start = id + 1
+		case '}':
+			if in_scope {
+				return id + 1
+			}
+			header_start, segment_start = id+1, id+1
+		case '{':
+			header := string(s.text[header_start:id])
+			header_offset := header_start
+			// K&R style definition. ex.) int f(a, b) int a; char *b; {
+			if strings.Compare(strings.TrimSpace(header), "") == 0 && header_start > segment_start {
+				header_offset = segment_start
+				header = s.knrHeader(string(s.text[segment_start:id]))
+			}
+			if func_location, ok := s.parseHeader(header, header_offset); ok {
+				end := s.matchBrace(id)
+				func_location.EndLine = s.line(end)
+				s.func_locations = append(s.func_locations, func_location)
+				id = end
+			} else if isScope(header) {
+				id = s.scanScope(id+1, true) - 1
+			} else {
+				id = s.matchBrace(id)
+			}
+			header_start, segment_start = id+1, id+1
+		}
+	}
+
+	return len(s.text)
+}
+
+// the header of K&R style definition, which is followed by the parameter declarations.
+// the other declarations are blanked so that the offsets don't change.
+func (s *scanner) knrHeader(segment string) string {
+	decl_start := 0
+	for _, decl := range strings.Split(segment, ";") {
+		paren_start := strings.Index(decl, "(")
+		paren_end := -1
+		if paren_start != -1 {
+			paren_end = matchParen(decl, paren_start)
+		}
+		if paren_end != -1 && !strings.Contains(decl, "=") {
+			// the declaration of the first parameter follows the parameter list
+			rest := strings.TrimSpace(decl[paren_end+1:])
+			if strings.Compare(rest, "") != 0 && !strings.HasPrefix(rest, "(") {
+				return strings.Repeat(" ", decl_start) + decl[:paren_end+1]
+			}
+		}
+		decl_start += len(decl) + 1
+	}
+	return ""
+}
+
+// namespace, extern "C", class, struct and union contain the function definitions
+func isScope(header string) bool {
+	header = access_label_re.ReplaceAllString(header, "")
+	if strings.Contains(header, "(") || strings.Contains(header, "=") {
+		return false
+	}
+	tokens := strings.Fields(header)
+	for _, token := range tokens {
+		switch token {
+		case "namespace", "extern", "class", "struct", "union":
+			return true
+		case "enum":
+			return false
+		}
+	}
+	return false
+}
+
+// the offset of ')' corresponding to '(' at the offset
+func matchParen(s string, offset int) int {
+	depth := 0
+	for id := offset; id < len(s); id++ {
+		switch s[id] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return id
+			}
+		}
+	}
+	return -1
+}
+
+// whether the words after the parameter list are the qualifiers of the function
+func validSuffix(suffix string) bool {
+	for {
+		suffix = strings.TrimSpace(suffix)
+		switch {
+		case strings.Compare(suffix, "") == 0:
+			return true
+		// trailing return type or constructor initializer list
+		case strings.HasPrefix(suffix, "->"), strings.HasPrefix(suffix, ":") && !strings.HasPrefix(suffix, "::"):
+			return true
+		case strings.HasPrefix(suffix, "&"):
+			suffix = strings.TrimLeft(suffix, "&")
+			continue
+		}
+		word_end := strings.IndexFunc(suffix, func(r rune) bool {
+			return !(r == '_' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9'))
+		})
+		if word_end == -1 {
+			word_end = len(suffix)
+		}
+		word := suffix[:word_end]
+		if !qualifiers[word] && !macro_re.MatchString(word) {
+			return false
+		}
+		suffix = strings.TrimSpace(suffix[word_end:])
+		// ex.) throw(), noexcept(true), __attribute__((unused))
+		if strings.HasPrefix(suffix, "(") {
+			paren_end := matchParen(suffix, 0)
+			if paren_end == -1 {
+				return false
+			}
+			suffix = suffix[paren_end+1:]
+		}
+	}
+}
+
+// parse the header of the function definition
+func (s *scanner) parseHeader(header string, header_offset int) (gity.FuncLocation, bool) {
+
+	for paren_start := 0; paren_start < len(header); paren_start++ {
+
+		if header[paren_start] != '(' {
+			continue
+		}
+		paren_end := matchParen(header, paren_start)
+		if paren_end == -1 {
+			return gity.FuncLocation{}, false
+		}
+
+		prefix := header[:paren_start]
+		matches := func_name_re.FindStringSubmatchIndex(prefix)
+		// the initializer is not the function. ex.) int x = f(1) {
+		if matches == nil || strings.Contains(prefix[:matches[2]], "=") || !validSuffix(header[paren_end+1:]) {
+			// the next parenthesis may be the parameter list. ex.) MACRO(x) int f(void), operator()(int a)
+			if !strings.HasSuffix(strings.TrimSpace(prefix), "operator") {
+				paren_start = paren_end
+			}
+			continue
+		}
+
+		name_path := strings.Join(strings.Fields(prefix[matches[2]:matches[3]]), "")
+		names := strings.Split(name_path, "::")
+		func_name := names[len(names)-1]
+		if not_func_names[func_name] {
+			paren_start = paren_end
+			continue
+		}
+		struct_type := template_args_re.ReplaceAllString(strings.Join(names[:len(names)-1], "::"), "")
+
+		// the definition starts at the first word of the header after the access specifier
+		start := 0
+		if label := access_label_re.FindStringIndex(header); label != nil {
+			start = label[1]
+		}
+		start += strings.IndexFunc(header[start:], func(r rune) bool { return !strings.ContainsRune(" \t\r\n", r) })
+		start_line := s.line(header_offset + start)
+
+		return gity.NewFuncLocation(func_name, struct_type, paramTypes(header[paren_start+1:paren_end]), returnTypes(prefix[:matches[2]]), start_line, start_line), true
+	}
+
+	return gity.FuncLocation{}, false
+}
+
+// the types of the parameters without the names. ex.) "const char *name, int n" -> ["const char *", "int"]
+func paramTypes(params string) []string {
+
+	param_types := []string{}
+	if strings.Compare(strings.TrimSpace(params), "void") == 0 {
+		return param_types
+	}
+
+	depth := 0
+	param_start := 0
+	for id := 0; id <= len(params); id++ {
+		if id < len(params) {
+			switch params[id] {
+			case '(', '<', '[':
+				depth++
+				continue
+			case ')', '>', ']':
+				depth--
+				continue
+			case ',':
+				if depth > 0 {
+					continue
+				}
+			default:
+				continue
+			}
+		}
+		param := strings.Join(strings.Fields(params[param_start:id]), " ")
+		param_start = id + 1
+		if strings.Compare(param, "") == 0 {
+			continue
+		}
+		// the default argument
+		if eq_id := strings.Index(param, "="); eq_id != -1 {
+			param = strings.TrimSpace(param[:eq_id])
+		}
+		if matches := param_name_re.FindStringSubmatch(param); matches != nil && !type_words[matches[2]] && strings.Compare(strings.TrimSpace(matches[1]), "") != 0 {
+			param = strings.TrimSpace(matches[1]) + matches[3]
+		}
+		param_types = append(param_types, param)
+	}
+
+	return param_types
+}
+
+// the return type without the specifiers. ex.) "static inline const char *" -> ["const char *"]
+func returnTypes(prefix string) []string {
+
+	// the template parameters and the access specifier
+	prefix = access_label_re.ReplaceAllString(prefix, "")
+	if template_id := strings.Index(prefix, "template"); template_id != -1 {
+		if close_id := strings.LastIndex(prefix, ">"); close_id > template_id {
+			prefix = prefix[close_id+1:]
+		}
+	}
+
+	words := []string{}
+	for _, word := range strings.Fields(prefix) {
+		if !specifiers[word] {
+			words = append(words, word)
+		}
+	}
+	if len(words) == 0 {
+		return []string{}
+	}
+
+	return []string{strings.Join(words, " ")}
+}
@@ -0,0 +1,139 @@
+package cscan
+
+import (
+	"reflect"
+	"testing"
+
+	gity "github.com/yomaytk/go_ltrace/vulndb/gitrepo/types"
+)
+
+const c_source = `#include <stdio.h>
+#include "zlib.h"
+
+/* prototype { */
+static int helper(int a);
+
+#define MAX(a, b) \
+	((a) > (b) ? (a) : (b))
+
+static const char *names[] = {
+	"a{", "b}",
+};
+
+struct state {
+	int x;
+	int (*cb)(int);
+};
+
+int ZEXPORT deflate (strm, flush)
+    z_streamp strm;
+    int flush;
+{
+    return helper(flush);
+}
+
+static inline const char *
+get_name(const struct state *s, int id)
+{
+    if (id < 0) {
+        return "}";
+    }
+    return names[id];
+}
+
+#ifdef USE_FAST
+int fast(void) {
+#else
+int fast(void) {
+    int slow = 1;
+#endif
+    return 0;
+}
+
+#if 0
+int disabled(void) {
+}
+#endif
+
+__attribute__((unused)) static int
+helper(int a) // comment {
+{
+    return a;
+}
+`
+
+const cpp_source = `#include <string>
+
+namespace ns {
+
+template <typename T>
+class Buffer : public Base {
+public:
+    Buffer(size_t n) : size_(n), data_(new T[n]) {
+    }
+    ~Buffer() {
+        delete[] data_;
+    }
+    size_t size() const { return size_; }
+private:
+    size_t size_;
+    T *data_;
+};
+
+template <typename T>
+T Buffer<T>::at(size_t i) const noexcept
+{
+    return data_[i];
+}
+
+bool Key::operator==(const Key &other) const
+{
+    return id == other.id;
+}
+
+extern "C" {
+int c_api(const std::string &name, int flags = 0) {
+    return 0;
+}
+}
+
+}  // namespace ns
+`
+
+func TestGetFuncLocationC(t *testing.T) {
+
+	func_locations, err := GetFuncLocation(c_source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []gity.FuncLocation{
+		gity.NewFuncLocation("deflate", "", []string{"strm", "flush"}, []string{"int ZEXPORT"}, 19, 24),
+		gity.NewFuncLocation("get_name", "", []string{"const struct state *", "int"}, []string{"const char *"}, 26, 33),
+		gity.NewFuncLocation("fast", "", []string{}, []string{"int"}, 36, 42),
+		gity.NewFuncLocation("helper", "", []string{"int"}, []string{"__attribute__((unused)) int"}, 49, 53),
+	}
+	if !reflect.DeepEqual(func_locations, expected) {
+		t.Errorf("got:\n%+v\nexpected:\n%+v", func_locations, expected)
+	}
+}
+
+func TestGetFuncLocationCpp(t *testing.T) {
+
+	func_locations, err := GetFuncLocation(cpp_source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []gity.FuncLocation{
+		gity.NewFuncLocation("Buffer", "", []string{"size_t"}, []string{}, 8, 9),
+		gity.NewFuncLocation("~Buffer", "", []string{}, []string{}, 10, 12),
+		gity.NewFuncLocation("size", "", []string{}, []string{"size_t"}, 13, 13),
+		gity.NewFuncLocation("at", "Buffer", []string{"size_t"}, []string{"T"}, 19, 23),
+		gity.NewFuncLocation("operator==", "Key", []string{"const Key &"}, []string{"bool"}, 25, 28),
+		gity.NewFuncLocation("c_api", "", []string{"const std::string &", "int"}, []string{"int"}, 31, 33),
+	}
+	if !reflect.DeepEqual(func_locations, expected) {
+		t.Errorf("got:\n%+v\nexpected:\n%+v", func_locations, expected)
+	}
+}
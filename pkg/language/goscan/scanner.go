@@ -7,7 +7,6 @@ import (
 	"go/token"
 	"reflect"
 
-	uutil "github.com/yomaytk/go_ltrace/util"
 	gity "github.com/yomaytk/go_ltrace/vulndb/gitrepo/types"
 	"golang.org/x/xerrors"
 )
@@ -18,18 +17,24 @@ func getParamTypes(expr ast.Expr) (string, error) {
 		return e_ty.Name, nil
 	case *ast.SelectorExpr:
 		ttype, err := getParamTypes(e_ty.X)
-		uutil.ErrFatal(err)
+		if err != nil {
+			return "", err
+		}
 		return ttype + "." + e_ty.Sel.Name, nil
 	case *ast.StarExpr:
 		ttype, err := getParamTypes(e_ty.X)
-		uutil.ErrFatal(err)
+		if err != nil {
+			return "", err
+		}
 		return "*" + ttype, nil
 	case *ast.InterfaceType:
 		methods := ""
 		method_list := e_ty.Methods.List
 		for i := 0; i < len(method_list); i++ {
 			ttype, err := getParamTypes(method_list[i].Type)
-			uutil.ErrFatal(err)
+			if err != nil {
+				return "", err
+			}
 			methods += ttype
 			if i < len(method_list)-1 {
 				methods += ", "
@@ -42,7 +47,9 @@ func getParamTypes(expr ast.Expr) (string, error) {
 		param_list := e_ty.Params.List
 		for i := 0; i < len(param_list); i++ {
 			ttype, err := getParamTypes(param_list[i].Type)
-			uutil.ErrFatal(err)
+			if err != nil {
+				return "", err
+			}
 			params += ttype
 			if i < len(param_list)-1 {
 				params += ", "
@@ -53,7 +60,9 @@ func getParamTypes(expr ast.Expr) (string, error) {
 		result_list := e_ty.Results.List
 		for i := 0; i < len(result_list); i++ {
 			ttype, err := getParamTypes(result_list[i].Type)
-			uutil.ErrFatal(err)
+			if err != nil {
+				return "", err
+			}
 			results += ttype
 			if i < len(result_list)-1 {
 				results += ", "
@@ -63,9 +72,13 @@ func getParamTypes(expr ast.Expr) (string, error) {
 	case *ast.MapType:
 		// get key
 		key, err := getParamTypes(e_ty.Key)
-		uutil.ErrFatal(err)
+		if err != nil {
+			return "", err
+		}
 		value, err := getParamTypes(e_ty.Value)
-		uutil.ErrFatal(err)
+		if err != nil {
+			return "", err
+		}
 		return fmt.Sprintf("map[%v]%v", key, value), nil
 	case *ast.StructType:
 		// get field
@@ -73,7 +86,9 @@ func getParamTypes(expr ast.Expr) (string, error) {
 		field_lists := e_ty.Fields.List
 		for i := 0; i < len(field_lists); i++ {
 			field_ttype, err := getParamTypes(field_lists[i].Type)
-			uutil.ErrFatal(err)
+			if err != nil {
+				return "", err
+			}
 			fields += field_ttype
 			if i < len(field_lists)-1 {
 				fields += ", "
@@ -82,11 +97,15 @@ func getParamTypes(expr ast.Expr) (string, error) {
 		return fmt.Sprintf("struct {%v}", fields), nil
 	case *ast.ArrayType:
 		elem_ttype, err := getParamTypes(e_ty.Elt)
-		uutil.ErrFatal(err)
+		if err != nil {
+			return "", err
+		}
 		return fmt.Sprintf("[]%v", elem_ttype), nil
 	case *ast.Ellipsis:
 		elem_ttype, err := getParamTypes(e_ty.Elt)
-		uutil.ErrFatal(err)
+		if err != nil {
+			return "", err
+		}
 		return fmt.Sprintf("...%v", elem_ttype), nil
 	default:
 		return "", xerrors.Errorf("Bug unknown expression Type at getParamTypes.: '%v'\n", reflect.TypeOf(e_ty))
@@ -100,7 +119,9 @@ func GetFuncLocation(content string) ([]gity.FuncLocation, error) {
 	// parse the file content and get function location
 	fset := token.NewFileSet()
 	f, err := parser.ParseFile(fset, "", content, 0)
-	uutil.ErrFatal(err)
+	if err != nil {
+		return func_locations, xerrors.Errorf("cannot parse the go source: %w", err)
+	}
 
 	// get all func location
 	for _, decl := range f.Decls {
@@ -115,7 +136,9 @@ func GetFuncLocation(content string) ([]gity.FuncLocation, error) {
 			if params := fn.Type.Params; params != nil {
 				for _, param_type := range params.List {
 					param_type_name, err := getParamTypes(param_type.Type)
-					uutil.ErrFatal(err)
+					if err != nil {
+						return func_locations, err
+					}
 					param_types = append(param_types, param_type_name)
 				}
 			}
@@ -125,7 +148,9 @@ func GetFuncLocation(content string) ([]gity.FuncLocation, error) {
 			if returns := fn.Type.Results; returns != nil {
 				for _, return_type := range returns.List {
 					return_type_name, err := getParamTypes(return_type.Type)
-					uutil.ErrFatal(err)
+					if err != nil {
+						return func_locations, err
+					}
 					return_types = append(return_types, return_type_name)
 				}
 			}
@@ -134,7 +159,9 @@ func GetFuncLocation(content string) ([]gity.FuncLocation, error) {
 			struct_type := ""
 			if fn.Recv != nil {
 				struct_type, err = getParamTypes(fn.Recv.List[0].Type)
-				uutil.ErrFatal(err)
+				if err != nil {
+					return func_locations, err
+				}
 			}
 
 			func_location := gity.NewFuncLocation(func_name, struct_type, param_types, return_types, start_line, end_line)
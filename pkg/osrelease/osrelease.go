@@ -0,0 +1,146 @@
+// Package osrelease reads os-release(5) of the root directory. ex.) the host, the rootfs of the container image
+package osrelease
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+
+	uutil "github.com/yomaytk/go_ltrace/util"
+	"golang.org/x/xerrors"
+)
+
+// /etc/os-release is preferred, and /usr/lib/os-release is the fallback
+var OS_RELEASE_PATHS = []string{"/etc/os-release", "/usr/lib/os-release"}
+
+// the distros which have the vulnerability source
+const (
+	ID_UBUNTU = "ubuntu"
+	ID_DEBIAN = "debian"
+	// the codename of Debian unstable, whose os-release has no VERSION_CODENAME
+	DEBIAN_UNSTABLE = "sid"
+)
+
+type OSRelease struct {
+	// ex.) ubuntu, debian
+	ID string
+	// ex.) [debian] for ubuntu
+	IDLike    []string
+	VersionID string
+	// ex.) jammy, bookworm ("" for the testing and unstable of Debian)
+	VersionCodename string
+	// the codename of the base Ubuntu of the derivative. ex.) jammy for Linux Mint 21
+	UbuntuCodename string
+	PrettyName     string
+}
+
+// Read reads os-release in the root directory ("" or "/" is the host)
+func Read(root string) (OSRelease, error) {
+
+	for _, path := range OS_RELEASE_PATHS {
+		host_path, err := uutil.RootPath(root, path)
+		if err != nil {
+			return OSRelease{}, err
+		}
+		f, err := os.Open(host_path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return OSRelease{}, xerrors.Errorf("cannot open %v: %w", path, err)
+		}
+		defer f.Close()
+		return Parse(f)
+	}
+
+	return OSRelease{}, xerrors.Errorf("os-release is not found in %v: %w", root, fs.ErrNotExist)
+}
+
+// Parse reads the KEY=value lines. ex.) VERSION_CODENAME=jammy, PRETTY_NAME="Ubuntu 22.04.3 LTS"
+func Parse(r io.Reader) (OSRelease, error) {
+
+	values := map[string]string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.Compare(line, "") == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		equal_id := strings.Index(line, "=")
+		if equal_id == -1 {
+			continue
+		}
+		key := line[:equal_id]
+		value := line[equal_id+1:]
+		if strings.HasPrefix(value, "\"") {
+			if unquoted, err := strconv.Unquote(value); err == nil {
+				value = unquoted
+			}
+		} else if strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'") && len(value) >= 2 {
+			value = value[1 : len(value)-1]
+		}
+		values[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return OSRelease{}, xerrors.Errorf("cannot read os-release: %w", err)
+	}
+
+	os_release := OSRelease{
+		ID:              strings.ToLower(values["ID"]),
+		IDLike:          strings.Fields(strings.ToLower(values["ID_LIKE"])),
+		VersionID:       values["VERSION_ID"],
+		VersionCodename: values["VERSION_CODENAME"],
+		UbuntuCodename:  values["UBUNTU_CODENAME"],
+		PrettyName:      values["PRETTY_NAME"],
+	}
+	// the old Ubuntu (ex. xenial) has only UBUNTU_CODENAME
+	if strings.Compare(os_release.VersionCodename, "") == 0 {
+		os_release.VersionCodename = values["UBUNTU_CODENAME"]
+	}
+	if strings.Compare(os_release.ID, "") == 0 {
+		os_release.ID = "linux"
+	}
+
+	return os_release, nil
+}
+
+// Like reports whether the distro is id or derived from id
+func (os_release OSRelease) Like(id string) bool {
+	if strings.Compare(os_release.ID, id) == 0 {
+		return true
+	}
+	for _, like := range os_release.IDLike {
+		if strings.Compare(like, id) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Distro returns the distro and the codename whose packages are installed. the Ubuntu derivative
+// (ex. Linux Mint, Pop!_OS) installs the packages of its base Ubuntu, and Debian without the codename is unstable.
+func (os_release OSRelease) Distro() (string, string) {
+	if strings.Compare(os_release.ID, ID_UBUNTU) != 0 && os_release.Like(ID_UBUNTU) && strings.Compare(os_release.UbuntuCodename, "") != 0 {
+		return ID_UBUNTU, os_release.UbuntuCodename
+	}
+	if strings.Compare(os_release.ID, ID_DEBIAN) == 0 && strings.Compare(os_release.VersionCodename, "") == 0 {
+		return ID_DEBIAN, DEBIAN_UNSTABLE
+	}
+	return os_release.ID, os_release.VersionCodename
+}
+
+func (os_release OSRelease) String() string {
+	name := os_release.PrettyName
+	if strings.Compare(name, "") == 0 {
+		name = strings.TrimSpace(os_release.ID + " " + os_release.VersionID)
+	}
+	if len(os_release.IDLike) > 0 {
+		return fmt.Sprintf("%v (ID=%v, ID_LIKE=%v)", name, os_release.ID, strings.Join(os_release.IDLike, " "))
+	}
+	return fmt.Sprintf("%v (ID=%v)", name, os_release.ID)
+}
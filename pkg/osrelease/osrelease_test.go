@@ -0,0 +1,111 @@
+package osrelease
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const ubuntu_os_release = `PRETTY_NAME="Ubuntu 22.04.3 LTS"
+NAME="Ubuntu"
+VERSION_ID="22.04"
+VERSION="22.04.3 LTS (Jammy Jellyfish)"
+VERSION_CODENAME=jammy
+ID=ubuntu
+ID_LIKE=debian
+UBUNTU_CODENAME=jammy
+`
+
+func TestParse(t *testing.T) {
+
+	os_release, err := Parse(strings.NewReader(ubuntu_os_release))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := OSRelease{ID: "ubuntu", IDLike: []string{"debian"}, VersionID: "22.04", VersionCodename: "jammy", UbuntuCodename: "jammy", PrettyName: "Ubuntu 22.04.3 LTS"}
+	if !reflect.DeepEqual(os_release, expected) {
+		t.Errorf("Parse() = %+v, expected %+v", os_release, expected)
+	}
+
+	// xenial has only UBUNTU_CODENAME, and the comment and the single quote are allowed
+	os_release, err = Parse(strings.NewReader("# comment\nID='ubuntu'\nUBUNTU_CODENAME=xenial\nbroken line\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Compare(os_release.ID, "ubuntu") != 0 || strings.Compare(os_release.VersionCodename, "xenial") != 0 {
+		t.Errorf("unexpected os-release: %+v", os_release)
+	}
+
+	os_release, err = Parse(strings.NewReader(""))
+	if err != nil || strings.Compare(os_release.ID, "linux") != 0 {
+		t.Errorf("the default ID is not linux: %+v, %v", os_release, err)
+	}
+}
+
+func TestDistro(t *testing.T) {
+
+	tests := []struct {
+		os_release string
+		distro     string
+		os_version string
+	}{
+		{ubuntu_os_release, "ubuntu", "jammy"},
+		// the Ubuntu derivative is scanned as its base Ubuntu
+		{"ID=linuxmint\nID_LIKE=\"ubuntu debian\"\nVERSION_CODENAME=victoria\nUBUNTU_CODENAME=jammy\n", "ubuntu", "jammy"},
+		{"ID=debian\nVERSION_ID=\"12\"\nVERSION_CODENAME=bookworm\n", "debian", "bookworm"},
+		{"ID=debian\nPRETTY_NAME=\"Debian GNU/Linux trixie/sid\"\n", "debian", "sid"},
+		{"ID=fedora\nVERSION_ID=39\n", "fedora", ""},
+	}
+	for _, test := range tests {
+		os_release, err := Parse(strings.NewReader(test.os_release))
+		if err != nil {
+			t.Fatal(err)
+		}
+		distro, os_version := os_release.Distro()
+		if strings.Compare(distro, test.distro) != 0 || strings.Compare(os_version, test.os_version) != 0 {
+			t.Errorf("Distro() of %v = %v %v, expected %v %v", os_release, distro, os_version, test.distro, test.os_version)
+		}
+	}
+
+	os_release, _ := Parse(strings.NewReader("ID=linuxmint\nID_LIKE=\"ubuntu debian\"\nPRETTY_NAME=\"Linux Mint 21\"\n"))
+	if !os_release.Like("debian") || os_release.Like("fedora") {
+		t.Errorf("unexpected Like() of %v", os_release)
+	}
+	if strings.Compare(os_release.String(), "Linux Mint 21 (ID=linuxmint, ID_LIKE=ubuntu debian)") != 0 {
+		t.Errorf("unexpected String(): %v", os_release.String())
+	}
+}
+
+func TestRead(t *testing.T) {
+
+	root := t.TempDir()
+	if _, err := Read(root); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Read() of the empty root: %v", err)
+	}
+
+	// /etc/os-release -> ../usr/lib/os-release is resolved in the root
+	if err := os.MkdirAll(filepath.Join(root, "usr/lib"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "usr/lib/os-release"), []byte(ubuntu_os_release), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../usr/lib/os-release", filepath.Join(root, "etc/os-release")); err != nil {
+		t.Fatal(err)
+	}
+
+	os_release, err := Read(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Compare(os_release.VersionCodename, "jammy") != 0 {
+		t.Errorf("unexpected os-release: %+v", os_release)
+	}
+}
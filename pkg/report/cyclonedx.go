@@ -0,0 +1,171 @@
+package report
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+
+	vtypes "github.com/yomaytk/go_ltrace/vulndb"
+	"golang.org/x/xerrors"
+)
+
+const CYCLONEDX_VERSION = "1.5"
+
+// the CycloneDX severity for every Ubuntu priority
+var cyclonedx_severities = map[string]string{"critical": "critical", "high": "high", "medium": "medium", "low": "low", "negligible": "info"}
+
+type cdxBOM struct {
+	BOMFormat       string             `json:"bomFormat"`
+	SpecVersion     string             `json:"specVersion"`
+	SerialNumber    string             `json:"serialNumber"`
+	Version         int                `json:"version"`
+	Metadata        cdxMetadata        `json:"metadata"`
+	Components      []cdxComponent     `json:"components"`
+	Dependencies    []cdxDependency    `json:"dependencies"`
+	Vulnerabilities []cdxVulnerability `json:"vulnerabilities"`
+}
+
+type cdxMetadata struct {
+	Timestamp string `json:"timestamp"`
+	Tools     struct {
+		Components []cdxComponent `json:"components"`
+	} `json:"tools"`
+	Component cdxComponent `json:"component"`
+}
+
+type cdxComponent struct {
+	BOMRef     string        `json:"bom-ref,omitempty"`
+	Type       string        `json:"type"`
+	Name       string        `json:"name"`
+	Version    string        `json:"version,omitempty"`
+	Purl       string        `json:"purl,omitempty"`
+	Properties []cdxProperty `json:"properties,omitempty"`
+}
+
+type cdxProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type cdxDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn"`
+}
+
+type cdxVulnerability struct {
+	BOMRef      string        `json:"bom-ref"`
+	ID          string        `json:"id"`
+	Source      cdxSource     `json:"source"`
+	Ratings     []cdxRating   `json:"ratings,omitempty"`
+	Description string        `json:"description,omitempty"`
+	Advisories  []cdxAdvisory `json:"advisories,omitempty"`
+	Analysis    cdxAnalysis   `json:"analysis"`
+	Affects     []cdxAffect   `json:"affects"`
+}
+
+type cdxSource struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+type cdxRating struct {
+	Source   cdxSource `json:"source"`
+	Severity string    `json:"severity"`
+}
+
+type cdxAdvisory struct {
+	URL string `json:"url"`
+}
+
+// the VEX of the vulnerability
+type cdxAnalysis struct {
+	State         string `json:"state"`
+	Justification string `json:"justification,omitempty"`
+	Detail        string `json:"detail,omitempty"`
+}
+
+type cdxAffect struct {
+	Ref string `json:"ref"`
+}
+
+// the CycloneDX analysis of the CVE
+func cyclonedxAnalysis(cve CVE) cdxAnalysis {
+	analysis := cdxAnalysis{Detail: cve.Reason}
+	if strings.Compare(cve.Verdict, vtypes.VERDICT_KEPT) == 0 {
+		analysis.State = "exploitable"
+		return analysis
+	}
+	switch cve.Justification {
+	case vtypes.JUSTIFICATION_FIXED:
+		analysis.State = "resolved"
+	case vtypes.JUSTIFICATION_NOT_REACHABLE:
+		analysis.State = "not_affected"
+		analysis.Justification = "code_not_reachable"
+	case vtypes.JUSTIFICATION_NOT_TRACKED:
+		analysis.State = "in_triage"
+	default:
+		analysis.State = "not_affected"
+		analysis.Justification = "code_not_present"
+	}
+	return analysis
+}
+
+// writeCycloneDX writes the observed packages as CycloneDX SBOM with the CVEs as VEX
+func (report *Report) writeCycloneDX(w io.Writer) error {
+
+	serial, err := newUUID()
+	if err != nil {
+		return err
+	}
+
+	bom := cdxBOM{BOMFormat: "CycloneDX", SpecVersion: CYCLONEDX_VERSION, SerialNumber: "urn:uuid:" + serial, Version: 1,
+		Components: []cdxComponent{}, Dependencies: []cdxDependency{}, Vulnerabilities: []cdxVulnerability{}}
+	bom.Metadata.Timestamp = report.Created.Format(time.RFC3339)
+	bom.Metadata.Tools.Components = []cdxComponent{{Type: "application", Name: TOOL_NAME}}
+	bom.Metadata.Component = cdxComponent{BOMRef: "target", Type: "application", Name: strings.Join(report.Target, " ")}
+	if strings.Compare(report.Image, "") != 0 {
+		bom.Metadata.Component = cdxComponent{BOMRef: "target", Type: "container", Name: report.Image}
+	}
+
+	target := cdxDependency{Ref: "target", DependsOn: []string{}}
+	for _, c := range report.components() {
+		properties := []cdxProperty{
+			{Name: TOOL_NAME + ":package:source_name", Value: c.Sourcep},
+			{Name: TOOL_NAME + ":package:source_version", Value: c.SourceVersion},
+			{Name: TOOL_NAME + ":mode", Value: strings.Join(c.Modes, ",")},
+		}
+		for _, lib := range c.Libraries {
+			properties = append(properties, cdxProperty{Name: TOOL_NAME + ":library", Value: lib})
+		}
+		bom.Components = append(bom.Components, cdxComponent{BOMRef: c.Purl, Type: "library", Name: strings.Split(c.Binaryp, ":")[0],
+			Version: c.Version, Purl: c.Purl, Properties: properties})
+		target.DependsOn = append(target.DependsOn, c.Purl)
+	}
+	bom.Dependencies = append(bom.Dependencies, target)
+
+	source := cdxSource{Name: "Ubuntu CVE Tracker", URL: UBUNTU_CVE_URI}
+	if strings.Compare(report.Distro, DISTRO_DEBIAN) == 0 {
+		source = cdxSource{Name: "Debian Security Tracker", URL: DEBIAN_CVE_URI}
+	}
+	for _, v := range report.vulnerabilities() {
+		// the language package is evaluated by OSV
+		vulnerability_source := source
+		if strings.Compare(v.Ecosystem, "") != 0 {
+			vulnerability_source = cdxSource{Name: "OSV", URL: OSV_URI}
+		}
+		vulnerability := cdxVulnerability{BOMRef: v.ID + "/" + v.Purl, ID: v.ID, Source: vulnerability_source, Description: strings.TrimSpace(v.Description),
+			Advisories: []cdxAdvisory{{URL: report.advisoryURI(v.ID)}}, Analysis: cyclonedxAnalysis(v.CVE), Affects: []cdxAffect{{Ref: v.Purl}}}
+		if severity, ok := cyclonedx_severities[strings.ToLower(v.Priority)]; ok {
+			vulnerability.Ratings = []cdxRating{{Source: vulnerability_source, Severity: severity}}
+		}
+		bom.Vulnerabilities = append(bom.Vulnerabilities, vulnerability)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(bom); err != nil {
+		return xerrors.Errorf("cannot encode the cyclonedx bom: %w", err)
+	}
+	return nil
+}
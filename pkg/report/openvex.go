@@ -0,0 +1,97 @@
+package report
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+
+	vtypes "github.com/yomaytk/go_ltrace/vulndb"
+	"golang.org/x/xerrors"
+)
+
+const OPENVEX_CONTEXT = "https://openvex.dev/ns/v0.2.0"
+
+type vexDocument struct {
+	Context    string         `json:"@context"`
+	ID         string         `json:"@id"`
+	Author     string         `json:"author"`
+	Timestamp  string         `json:"timestamp"`
+	Version    int            `json:"version"`
+	Tooling    string         `json:"tooling"`
+	Statements []vexStatement `json:"statements"`
+}
+
+type vexStatement struct {
+	Vulnerability   vexVulnerability `json:"vulnerability"`
+	Products        []vexProduct     `json:"products"`
+	Status          string           `json:"status"`
+	Justification   string           `json:"justification,omitempty"`
+	ImpactStatement string           `json:"impact_statement,omitempty"`
+	ActionStatement string           `json:"action_statement,omitempty"`
+	StatusNotes     string           `json:"status_notes,omitempty"`
+}
+
+type vexVulnerability struct {
+	ID   string `json:"@id,omitempty"`
+	Name string `json:"name"`
+}
+
+type vexProduct struct {
+	ID string `json:"@id"`
+}
+
+// the OpenVEX statement of the CVE
+func openvexStatement(v vulnerability, advisory_uri string) vexStatement {
+
+	statement := vexStatement{Vulnerability: vexVulnerability{ID: advisory_uri, Name: v.ID}, Products: []vexProduct{{ID: v.Purl}}}
+
+	if strings.Compare(v.Verdict, vtypes.VERDICT_KEPT) == 0 {
+		statement.Status = "affected"
+		statement.StatusNotes = v.Reason
+		statement.ActionStatement = "Update " + v.Sourcep + " when the fixed version is released."
+		return statement
+	}
+
+	switch v.Justification {
+	case vtypes.JUSTIFICATION_FIXED:
+		statement.Status = "fixed"
+		statement.StatusNotes = v.Reason
+	case vtypes.JUSTIFICATION_NOT_REACHABLE:
+		statement.Status = "not_affected"
+		statement.Justification = "vulnerable_code_not_in_execute_path"
+		statement.ImpactStatement = v.Reason
+	case vtypes.JUSTIFICATION_NOT_TRACKED:
+		// the tracker doesn't say the package is not affected
+		statement.Status = "under_investigation"
+		statement.StatusNotes = v.Reason
+	default:
+		statement.Status = "not_affected"
+		statement.Justification = "vulnerable_code_not_present"
+		statement.ImpactStatement = v.Reason
+	}
+
+	return statement
+}
+
+// writeOpenVEX writes the statement for every (CVE, package) of the report
+func (report *Report) writeOpenVEX(w io.Writer) error {
+
+	serial, err := newUUID()
+	if err != nil {
+		return err
+	}
+
+	document := vexDocument{Context: OPENVEX_CONTEXT, ID: "urn:uuid:" + serial, Author: TOOL_NAME, Timestamp: report.Created.Format(time.RFC3339),
+		Version: 1, Tooling: TOOL_NAME, Statements: []vexStatement{}}
+	for _, v := range report.vulnerabilities() {
+		document.Statements = append(document.Statements, openvexStatement(v, report.advisoryURI(v.ID)))
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(document); err != nil {
+		return xerrors.Errorf("cannot encode the openvex document: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,313 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yomaytk/go_ltrace/pkg/snapshot"
+	ttypes "github.com/yomaytk/go_ltrace/types"
+	vtypes "github.com/yomaytk/go_ltrace/vulndb"
+	"golang.org/x/xerrors"
+)
+
+// the output format of the report
+const (
+	FORMAT_TEXT      = "text"
+	FORMAT_JSON      = "json"
+	FORMAT_SARIF     = "sarif"
+	FORMAT_CYCLONEDX = "cyclonedx"
+	FORMAT_SPDX      = "spdx"
+	FORMAT_OPENVEX   = "openvex"
+)
+
+// the distro whose vulnerability source is supported
+const (
+	DISTRO_UBUNTU = "ubuntu"
+	DISTRO_DEBIAN = "debian"
+)
+
+var formats = []string{FORMAT_TEXT, FORMAT_JSON, FORMAT_SARIF, FORMAT_CYCLONEDX, FORMAT_SPDX, FORMAT_OPENVEX}
+
+// SupportedFormat returns whether the report can be written in the format
+func SupportedFormat(format string) bool {
+	for _, supported := range formats {
+		if strings.Compare(supported, format) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// the analysis mode of the scan
+const (
+	MODE_STATIC   = "static"
+	MODE_STRACE   = "strace"
+	MODE_LTRACE   = "ltrace"
+	MODE_SNAPSHOT = "snapshot"
+)
+
+// Report is the result of the scan for the target command.
+type Report struct {
+	Target []string `json:"target"`
+	// the reference of the scanned container image. ex.) nginx:1.25
+	Image     string    `json:"image,omitempty"`
+	Distro    string    `json:"distro"`
+	OsVersion string    `json:"os_version"`
+	Created   time.Time `json:"created"`
+	Scans     []Scan    `json:"scans"`
+}
+
+// Scan is the result of one analysis mode.
+type Scan struct {
+	Mode string `json:"mode"`
+	// the container id whose processes are scanned in snapshot mode ("" is the host)
+	Container string    `json:"container,omitempty"`
+	Libraries []Library `json:"libraries"`
+	Packages  []Package `json:"packages"`
+	CVEs      []CVE     `json:"cves"`
+	// the packages and the CVEs which cannot be evaluated
+	Failures []Failure `json:"failures,omitempty"`
+}
+
+type Library struct {
+	Path string `json:"path"`
+	// the binary package which owns the library ("" if not found)
+	Package string `json:"package"`
+	// the imported or called functions
+	Functions []string `json:"functions,omitempty"`
+	// the running processes which map the library (snapshot mode)
+	Processes []Process `json:"processes,omitempty"`
+}
+
+type Process struct {
+	Pid       int      `json:"pid"`
+	Command   []string `json:"command"`
+	Cgroup    string   `json:"cgroup,omitempty"`
+	Container string   `json:"container,omitempty"`
+	// the library is removed or replaced on the disk after it is mapped
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+type Package struct {
+	ttypes.PackageDetail
+	Libraries []string `json:"libraries"`
+}
+
+type CVE struct {
+	ID            string   `json:"id"`
+	Description   string   `json:"description"`
+	Priority      string   `json:"priority"`
+	CVSS          string   `json:"cvss"`
+	Binaryp       string   `json:"binaryp"`
+	Sourcep       string   `json:"sourcep"`
+	Version       string   `json:"version"`
+	SourceVersion string   `json:"source_version"`
+	Arch          string   `json:"arch"`
+	Ecosystem     string   `json:"ecosystem,omitempty"`
+	Status        string   `json:"status"`
+	Verdict       string   `json:"verdict"`
+	Reason        string   `json:"reason"`
+	Justification string   `json:"justification,omitempty"`
+	PatchURLs     []string `json:"patch_urls"`
+}
+
+type Failure struct {
+	Package string `json:"package"`
+	CVE     string `json:"cve,omitempty"`
+	Error   string `json:"error"`
+}
+
+func NewReport(target []string, distro string, os_version string) *Report {
+	return &Report{Target: target, Distro: distro, OsVersion: os_version, Created: time.Now().UTC(), Scans: []Scan{}}
+}
+
+// NewScan builds the scan from the traced libraries, the installed packages and the findings of vulndb.
+func NewScan(mode string, lib_map map[string]bool, lib_funcs_map map[string][]string, src_bin_map map[ttypes.PackageDetail][]string, findings []vtypes.Finding) Scan {
+
+	scan := Scan{Mode: mode, Libraries: []Library{}, Packages: []Package{}, CVEs: []CVE{}}
+
+	// key: library, value: binary package
+	lib_package_map := map[string]string{}
+	for package_detail, libs := range src_bin_map {
+		sorted_libs := append([]string{}, libs...)
+		sort.Strings(sorted_libs)
+		scan.Packages = append(scan.Packages, Package{PackageDetail: package_detail, Libraries: sorted_libs})
+		for _, lib := range libs {
+			lib_package_map[lib] = package_detail.Binaryp
+		}
+	}
+	sort.Slice(scan.Packages, func(i, j int) bool {
+		return strings.Compare(scan.Packages[i].Binaryp, scan.Packages[j].Binaryp) < 0
+	})
+
+	for lib := range lib_map {
+		funcs := append([]string{}, lib_funcs_map[lib]...)
+		sort.Strings(funcs)
+		scan.Libraries = append(scan.Libraries, Library{Path: lib, Package: lib_package_map[lib], Functions: funcs})
+	}
+	sort.Slice(scan.Libraries, func(i, j int) bool {
+		return strings.Compare(scan.Libraries[i].Path, scan.Libraries[j].Path) < 0
+	})
+
+	for _, finding := range findings {
+		scan.CVEs = append(scan.CVEs, CVE{
+			ID:            finding.CVE.Candidate,
+			Description:   finding.CVE.Description,
+			Priority:      finding.CVE.Priority,
+			CVSS:          finding.CVE.CVSS,
+			Binaryp:       finding.Package.Binaryp,
+			Sourcep:       finding.Package.Sourcep,
+			Version:       finding.Package.Version,
+			SourceVersion: finding.Package.SourceVersion,
+			Arch:          finding.Package.Arch,
+			Ecosystem:     finding.Package.Ecosystem,
+			Status:        finding.Status,
+			Verdict:       finding.Verdict,
+			Reason:        finding.Reason,
+			Justification: finding.Justification,
+			PatchURLs:     finding.PatchURLs,
+		})
+	}
+	sort.SliceStable(scan.CVEs, func(i, j int) bool {
+		if c := strings.Compare(scan.CVEs[i].Sourcep, scan.CVEs[j].Sourcep); c != 0 {
+			return c < 0
+		}
+		if c := strings.Compare(scan.CVEs[i].ID, scan.CVEs[j].ID); c != 0 {
+			return c < 0
+		}
+		return strings.Compare(scan.CVEs[i].Binaryp, scan.CVEs[j].Binaryp) < 0
+	})
+
+	return scan
+}
+
+// AddFailures records the packages and the CVEs which cannot be evaluated in the scan
+func (scan *Scan) AddFailures(failures []vtypes.Failure) {
+	for _, failure := range failures {
+		scan.Failures = append(scan.Failures, Failure{Package: failure.Package, CVE: failure.CVE, Error: failure.Error})
+	}
+	sort.SliceStable(scan.Failures, func(i, j int) bool {
+		if c := strings.Compare(scan.Failures[i].Package, scan.Failures[j].Package); c != 0 {
+			return c < 0
+		}
+		return strings.Compare(scan.Failures[i].CVE, scan.Failures[j].CVE) < 0
+	})
+}
+
+// AddProcesses records the running processes which map every library of the scan
+func (scan *Scan) AddProcesses(processes []snapshot.Process) {
+	for i := range scan.Libraries {
+		lib := &scan.Libraries[i]
+		for _, process := range processes {
+			if !containsString(process.Libraries, lib.Path) {
+				continue
+			}
+			lib.Processes = append(lib.Processes, Process{Pid: process.Pid, Command: process.Command, Cgroup: process.Cgroup,
+				Container: process.Container, Deleted: containsString(process.Deleted, lib.Path)})
+		}
+	}
+}
+
+// the sorted strings contain the string
+func containsString(sorted []string, s string) bool {
+	i := sort.SearchStrings(sorted, s)
+	return i < len(sorted) && strings.Compare(sorted[i], s) == 0
+}
+
+// Load reads the report written in the json format
+func Load(r io.Reader) (*Report, error) {
+	report := &Report{}
+	if err := json.NewDecoder(r).Decode(report); err != nil {
+		return nil, xerrors.Errorf("cannot decode the report: %w", err)
+	}
+	return report, nil
+}
+
+func (report *Report) AddScan(scan Scan) {
+	report.Scans = append(report.Scans, scan)
+}
+
+// Write writes the report in the format
+func (report *Report) Write(w io.Writer, format string) error {
+	switch format {
+	case FORMAT_TEXT:
+		return report.writeText(w)
+	case FORMAT_JSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return xerrors.Errorf("cannot encode the report: %w", err)
+		}
+		return nil
+	case FORMAT_SARIF:
+		return report.writeSarif(w)
+	case FORMAT_CYCLONEDX:
+		return report.writeCycloneDX(w)
+	case FORMAT_SPDX:
+		return report.writeSPDX(w)
+	case FORMAT_OPENVEX:
+		return report.writeOpenVEX(w)
+	default:
+		return xerrors.Errorf("unknown report format: %v\n", format)
+	}
+}
+
+// the advisory page of the CVE in the vulnerability source of the distro.
+// the vulnerability without the CVE id (ex. GHSA-xxxx-xxxx-xxxx of the language package) is the page of OSV.
+func (report *Report) advisoryURI(cve_id string) string {
+	if !strings.HasPrefix(cve_id, "CVE-") {
+		return OSV_URI + cve_id
+	}
+	if strings.Compare(report.Distro, DISTRO_DEBIAN) == 0 {
+		return DEBIAN_CVE_URI + cve_id
+	}
+	return UBUNTU_CVE_URI + cve_id
+}
+
+// print the kept CVEs for every source package and the items which cannot be evaluated
+func (report *Report) writeText(w io.Writer) error {
+	for _, scan := range report.Scans {
+		if strings.Compare(scan.Container, "") != 0 {
+			if _, err := fmt.Fprintf(w, "container: %v\n", scan.Container); err != nil {
+				return err
+			}
+		}
+		sourceps := []string{}
+		// key: sourcep, value: cve ids
+		src_cves_map := map[string][]string{}
+		printed := map[string]bool{}
+		for _, cve := range scan.CVEs {
+			if strings.Compare(cve.Verdict, vtypes.VERDICT_KEPT) != 0 || printed[cve.Sourcep+" "+cve.ID] {
+				continue
+			}
+			printed[cve.Sourcep+" "+cve.ID] = true
+			if _, ok := src_cves_map[cve.Sourcep]; !ok {
+				sourceps = append(sourceps, cve.Sourcep)
+			}
+			src_cves_map[cve.Sourcep] = append(src_cves_map[cve.Sourcep], cve.ID)
+		}
+		for _, sourcep := range sourceps {
+			if _, err := fmt.Fprintf(w, "sourcep: %v\n%v \n", sourcep, strings.Join(src_cves_map[sourcep], " ")); err != nil {
+				return err
+			}
+		}
+		for _, failure := range scan.Failures {
+			if _, err := fmt.Fprintf(w, "not evaluated: %v\n", failure); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (failure Failure) String() string {
+	item := failure.Package
+	if strings.Compare(failure.CVE, "") != 0 {
+		item = strings.TrimSpace(failure.Package + " " + failure.CVE)
+	}
+	return item + ": " + failure.Error
+}
@@ -0,0 +1,236 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	log "github.com/yomaytk/go_ltrace/log"
+	"github.com/yomaytk/go_ltrace/pkg/snapshot"
+	ttypes "github.com/yomaytk/go_ltrace/types"
+	vtypes "github.com/yomaytk/go_ltrace/vulndb"
+	"github.com/yomaytk/go_ltrace/vulndb/ubuntu"
+)
+
+func TestWriteReport(t *testing.T) {
+
+	libc := ttypes.PackageDetail{Binaryp: "libc6:amd64", Sourcep: "glibc", Version: "2.35-0ubuntu3.1", SourceVersion: "2.35-0ubuntu3.1", Arch: "amd64"}
+	lib_map := map[string]bool{"/lib/x86_64-linux-gnu/libc.so.6": true, "/opt/libfoo.so": true}
+	lib_funcs_map := map[string][]string{"/lib/x86_64-linux-gnu/libc.so.6": {"puts", "malloc"}}
+	src_bin_map := map[ttypes.PackageDetail][]string{libc: {"/lib/x86_64-linux-gnu/libc.so.6"}}
+	findings := []vtypes.Finding{
+		{CVE: vtypes.CVE{Candidate: "CVE-2023-0002", Priority: "medium"}, Package: libc, Status: "needed", Verdict: vtypes.VERDICT_KEPT, Reason: "needed"},
+		{CVE: vtypes.CVE{Candidate: "CVE-2023-0001", Priority: "low"}, Package: libc, Status: "released (2.35-0ubuntu3)", Verdict: vtypes.VERDICT_FILTERED, Reason: "released"},
+	}
+
+	scan_report := NewReport([]string{"/bin/ls", "-l"}, DISTRO_UBUNTU, "jammy")
+	scan_report.AddScan(NewScan(MODE_LTRACE, lib_map, lib_funcs_map, src_bin_map, findings))
+
+	var json_out bytes.Buffer
+	if err := scan_report.Write(&json_out, FORMAT_JSON); err != nil {
+		t.Fatal(err)
+	}
+	var decoded Report
+	if err := json.Unmarshal(json_out.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	scan := decoded.Scans[0]
+	if len(scan.Libraries) != 2 || strings.Compare(scan.Libraries[0].Package, "libc6:amd64") != 0 || strings.Compare(scan.Libraries[0].Functions[0], "malloc") != 0 {
+		t.Errorf("unexpected libraries: %v", scan.Libraries)
+	}
+	if strings.Compare(scan.Libraries[1].Package, "") != 0 {
+		t.Errorf("the library not owned by the package: %v", scan.Libraries[1])
+	}
+	if len(scan.CVEs) != 2 || strings.Compare(scan.CVEs[0].ID, "CVE-2023-0001") != 0 || strings.Compare(scan.CVEs[0].Verdict, vtypes.VERDICT_FILTERED) != 0 {
+		t.Errorf("unexpected cves: %v", scan.CVEs)
+	}
+	if strings.Compare(scan.CVEs[1].SourceVersion, "2.35-0ubuntu3.1") != 0 || strings.Compare(decoded.OsVersion, "jammy") != 0 {
+		t.Errorf("unexpected report: %v", decoded)
+	}
+
+	var text_out bytes.Buffer
+	if err := scan_report.Write(&text_out, FORMAT_TEXT); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Compare(text_out.String(), "sourcep: glibc\nCVE-2023-0002 \n") != 0 {
+		t.Errorf("unexpected text report: %q", text_out.String())
+	}
+
+	if err := scan_report.Write(&text_out, "xml"); err == nil {
+		t.Errorf("unknown format is accepted")
+	}
+}
+
+func TestWriteSarif(t *testing.T) {
+
+	libc := ttypes.PackageDetail{Binaryp: "libc6:amd64", Sourcep: "glibc", Version: "2.35-0ubuntu3.1", SourceVersion: "2.35-0ubuntu3.1", Arch: "amd64"}
+	libc_bin := ttypes.PackageDetail{Binaryp: "libc-bin", Sourcep: "glibc", Version: "2.35-0ubuntu3.1", SourceVersion: "2.35-0ubuntu3.1", Arch: "amd64"}
+	lib_map := map[string]bool{"/lib/x86_64-linux-gnu/libc.so.6": true, "/lib/x86_64-linux-gnu/libBrokenLocale.so.1": true}
+	src_bin_map := map[ttypes.PackageDetail][]string{libc: {"/lib/x86_64-linux-gnu/libc.so.6"}, libc_bin: {"/lib/x86_64-linux-gnu/libBrokenLocale.so.1"}}
+	findings := []vtypes.Finding{
+		{CVE: vtypes.CVE{Candidate: "CVE-2023-0002", Priority: "high"}, Package: libc, Status: "needed", Verdict: vtypes.VERDICT_KEPT},
+		{CVE: vtypes.CVE{Candidate: "CVE-2023-0002", Priority: "high"}, Package: libc_bin, Status: "needed", Verdict: vtypes.VERDICT_KEPT},
+		{CVE: vtypes.CVE{Candidate: "CVE-2023-0001", Priority: "low"}, Package: libc, Status: "released (2.35-0ubuntu3)", Verdict: vtypes.VERDICT_FILTERED},
+	}
+
+	scan_report := NewReport([]string{"/bin/ls"}, DISTRO_UBUNTU, "jammy")
+	scan_report.AddScan(NewScan(MODE_STRACE, lib_map, map[string][]string{}, src_bin_map, findings))
+
+	var out bytes.Buffer
+	if err := scan_report.Write(&out, FORMAT_SARIF); err != nil {
+		t.Fatal(err)
+	}
+	var decoded sarifLog
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Compare(decoded.Version, SARIF_VERSION) != 0 || len(decoded.Runs) != 1 {
+		t.Fatalf("unexpected sarif log: %v", decoded)
+	}
+	results := decoded.Runs[0].Results
+	if len(results) != 1 || strings.Compare(results[0].RuleID, "CVE-2023-0002") != 0 || strings.Compare(results[0].Level, "error") != 0 {
+		t.Fatalf("unexpected results: %v", results)
+	}
+	if len(results[0].Locations) != 2 || strings.Compare(results[0].Locations[0].PhysicalLocation.ArtifactLocation.URI, "file:///lib/x86_64-linux-gnu/libBrokenLocale.so.1") != 0 {
+		t.Errorf("unexpected locations: %v", results[0].Locations)
+	}
+	if strings.Compare(sarifLevel("untriaged"), "warning") != 0 || strings.Compare(sarifLevel("Medium"), "warning") != 0 || strings.Compare(sarifLevel("negligible"), "note") != 0 {
+		t.Errorf("unexpected sarif level")
+	}
+}
+
+func TestWriteSarifFromTracker(t *testing.T) {
+
+	log.InitLogger("")
+
+	// the record parsed from the Ubuntu CVE tracker
+	tracker_cve := `Candidate: CVE-2023-0003
+PublicDate: 2023-01-01
+Description:
+ sample vulnerability
+Priority: high
+CVSS:
+
+Patches_glibc:
+jammy_glibc: needed
+`
+	dop := ubuntu.NewDBOperation("", "")
+	if err := (ubuntu.CVEParser{}).Parse(tracker_cve, dop); err != nil {
+		t.Fatal(err)
+	}
+
+	libc := ttypes.PackageDetail{Binaryp: "libc6:amd64", Sourcep: "glibc", Version: "2.35-0ubuntu3.1", SourceVersion: "2.35-0ubuntu3.1", Arch: "amd64"}
+	lib_map := map[string]bool{"/lib/x86_64-linux-gnu/libc.so.6": true}
+	src_bin_map := map[ttypes.PackageDetail][]string{libc: {"/lib/x86_64-linux-gnu/libc.so.6"}}
+	findings := []vtypes.Finding{{CVE: dop.UbuntuCVEs[0].CVE, Package: libc, Status: "needed", Verdict: vtypes.VERDICT_KEPT}}
+
+	scan_report := NewReport([]string{"/bin/ls"}, DISTRO_UBUNTU, "jammy")
+	scan_report.AddScan(NewScan(MODE_STRACE, lib_map, map[string][]string{}, src_bin_map, findings))
+
+	var out bytes.Buffer
+	if err := scan_report.Write(&out, FORMAT_SARIF); err != nil {
+		t.Fatal(err)
+	}
+	var decoded sarifLog
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	results := decoded.Runs[0].Results
+	if len(results) != 1 || strings.Compare(results[0].RuleID, "CVE-2023-0003") != 0 || strings.Compare(results[0].Level, "error") != 0 {
+		t.Fatalf("unexpected results: %v", results)
+	}
+	rule := decoded.Runs[0].Tool.Driver.Rules[0]
+	if strings.Compare(rule.HelpURI, UBUNTU_CVE_URI+"CVE-2023-0003") != 0 || strings.Compare(rule.Properties["security-severity"], "8.0") != 0 {
+		t.Errorf("unexpected rule: %v", rule)
+	}
+}
+
+func TestLoadReport(t *testing.T) {
+
+	scan_report := NewReport([]string{"/bin/ls"}, DISTRO_UBUNTU, "jammy")
+	scan_report.AddScan(NewScan(MODE_STRACE, map[string]bool{"/lib/x86_64-linux-gnu/libc.so.6": true}, map[string][]string{}, map[ttypes.PackageDetail][]string{}, []vtypes.Finding{}))
+
+	var out bytes.Buffer
+	if err := scan_report.Write(&out, FORMAT_JSON); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Scans) != 1 || strings.Compare(loaded.Scans[0].Mode, MODE_STRACE) != 0 || !loaded.Created.Equal(scan_report.Created) {
+		t.Errorf("unexpected report: %v", loaded)
+	}
+
+	if _, err := Load(strings.NewReader("sourcep: glibc\n")); err == nil {
+		t.Errorf("the text report is loaded")
+	}
+}
+
+func TestWriteFailures(t *testing.T) {
+
+	scan := NewScan(MODE_STRACE, map[string]bool{}, map[string][]string{}, map[ttypes.PackageDetail][]string{}, []vtypes.Finding{})
+	scan.AddFailures([]vtypes.Failure{
+		{Package: "openssl", CVE: "CVE-2023-0002", Error: "cannot get the commit"},
+		{Package: "glibc", Error: "cannot decode the CVE ids"},
+	})
+	scan_report := NewReport([]string{"/bin/ls"}, DISTRO_UBUNTU, "jammy")
+	scan_report.AddScan(scan)
+
+	var out bytes.Buffer
+	if err := scan_report.Write(&out, FORMAT_TEXT); err != nil {
+		t.Fatal(err)
+	}
+	expected := "not evaluated: glibc: cannot decode the CVE ids\nnot evaluated: openssl CVE-2023-0002: cannot get the commit\n"
+	if strings.Compare(out.String(), expected) != 0 {
+		t.Errorf("writeText() = %q, expected %q", out.String(), expected)
+	}
+
+	out.Reset()
+	if err := scan_report.Write(&out, FORMAT_SARIF); err != nil {
+		t.Fatal(err)
+	}
+	var decoded sarifLog
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if invocations := decoded.Runs[0].Invocations; len(invocations) != 1 || len(invocations[0].ToolExecutionNotifications) != 2 {
+		t.Errorf("unexpected invocations: %v", invocations)
+	}
+}
+
+func TestAddProcesses(t *testing.T) {
+
+	libc := ttypes.PackageDetail{Binaryp: "libc6:amd64", Sourcep: "glibc", Version: "2.35-0ubuntu3.1", SourceVersion: "2.35-0ubuntu3.1", Arch: "amd64"}
+	lib_map := map[string]bool{"/lib/x86_64-linux-gnu/libc.so.6": true, "/lib/x86_64-linux-gnu/libssl.so.3": true}
+	scan := NewScan(MODE_SNAPSHOT, lib_map, map[string][]string{}, map[ttypes.PackageDetail][]string{libc: {"/lib/x86_64-linux-gnu/libc.so.6"}}, []vtypes.Finding{})
+	scan.AddProcesses([]snapshot.Process{
+		{Pid: 1, Command: []string{"/sbin/init"}, Cgroup: "/init.scope", Libraries: []string{"/lib/x86_64-linux-gnu/libc.so.6"}},
+		{Pid: 42, Command: []string{"nginx"}, Libraries: []string{"/lib/x86_64-linux-gnu/libc.so.6", "/lib/x86_64-linux-gnu/libssl.so.3"},
+			Deleted: []string{"/lib/x86_64-linux-gnu/libssl.so.3"}},
+	})
+
+	if processes := scan.Libraries[0].Processes; len(processes) != 2 || processes[0].Pid != 1 || processes[1].Deleted {
+		t.Errorf("unexpected processes of libc: %+v", processes)
+	}
+	if processes := scan.Libraries[1].Processes; len(processes) != 1 || processes[0].Pid != 42 || !processes[0].Deleted {
+		t.Errorf("unexpected processes of libssl: %+v", processes)
+	}
+	// the scan of the container whose libraries are not resolved
+	container := strings.Repeat("ab", 32)
+	container_scan := NewScan(MODE_SNAPSHOT, lib_map, map[string][]string{}, map[ttypes.PackageDetail][]string{}, []vtypes.Finding{})
+	container_scan.Container = container
+	container_scan.AddFailures([]vtypes.Failure{{Package: "container " + container[:12], Error: "the libraries are not resolved"}})
+	scan_report := NewReport([]string{"host"}, DISTRO_UBUNTU, "jammy")
+	scan_report.AddScan(container_scan)
+
+	var out bytes.Buffer
+	if err := scan_report.Write(&out, FORMAT_TEXT); err != nil {
+		t.Fatal(err)
+	}
+	expected := "container: " + container + "\nnot evaluated: container abababababab: the libraries are not resolved\n"
+	if strings.Compare(out.String(), expected) != 0 {
+		t.Errorf("writeText() = %q, expected %q", out.String(), expected)
+	}
+}
@@ -0,0 +1,193 @@
+package report
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+
+	vtypes "github.com/yomaytk/go_ltrace/vulndb"
+	"golang.org/x/xerrors"
+)
+
+const (
+	SARIF_VERSION  = "2.1.0"
+	SARIF_SCHEMA   = "https://json.schemastore.org/sarif-2.1.0.json"
+	TOOL_NAME      = "go_ltrace"
+	TOOL_URI       = "https://github.com/yomaytk/go_ltrace"
+	UBUNTU_CVE_URI = "https://ubuntu.com/security/"
+	DEBIAN_CVE_URI = "https://security-tracker.debian.org/tracker/"
+	OSV_URI        = "https://osv.dev/vulnerability/"
+)
+
+// the SARIF level and the security-severity for every Ubuntu priority
+var sarif_levels = map[string]string{"critical": "error", "high": "error", "medium": "warning", "low": "note", "negligible": "note"}
+var security_severities = map[string]string{"critical": "9.5", "high": "8.0", "medium": "5.5", "low": "2.0", "negligible": "0.0"}
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool        sarifTool         `json:"tool"`
+	Invocations []sarifInvocation `json:"invocations"`
+	Results     []sarifResult     `json:"results"`
+}
+
+// the items which cannot be evaluated are the notifications of the invocation
+type sarifInvocation struct {
+	ExecutionSuccessful        bool                `json:"executionSuccessful"`
+	ToolExecutionNotifications []sarifNotification `json:"toolExecutionNotifications,omitempty"`
+}
+
+type sarifNotification struct {
+	Level      string            `json:"level"`
+	Message    sarifMessage      `json:"message"`
+	Properties map[string]string `json:"properties"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string            `json:"id"`
+	ShortDescription sarifMessage      `json:"shortDescription"`
+	FullDescription  sarifMessage      `json:"fullDescription"`
+	HelpURI          string            `json:"helpUri"`
+	Properties       map[string]string `json:"properties"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID     string            `json:"ruleId"`
+	Level      string            `json:"level"`
+	Message    sarifMessage      `json:"message"`
+	Locations  []sarifLocation   `json:"locations"`
+	Properties map[string]string `json:"properties"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation struct {
+		ArtifactLocation struct {
+			URI string `json:"uri"`
+		} `json:"artifactLocation"`
+	} `json:"physicalLocation"`
+}
+
+// the SARIF level of the Ubuntu priority (untriaged priority is warning)
+func sarifLevel(priority string) string {
+	if level, ok := sarif_levels[strings.ToLower(priority)]; ok {
+		return level
+	}
+	return "warning"
+}
+
+func sarifFileLocation(path string) sarifLocation {
+	location := sarifLocation{}
+	location.PhysicalLocation.ArtifactLocation.URI = (&url.URL{Scheme: "file", Path: path}).String()
+	return location
+}
+
+// writeSarif writes one result for every kept (source package, CVE) over all scans.
+// the locations of the result are the traced libraries of the source package.
+func (report *Report) writeSarif(w io.Writer) error {
+
+	rules := map[string]sarifRule{}
+	results := map[string]*sarifResult{}
+	result_keys := []string{}
+	// key: result key, value: library paths
+	result_libs := map[string]map[string]bool{}
+
+	for _, scan := range report.Scans {
+		// key: sourcep, value: library paths
+		src_libs_map := map[string][]string{}
+		for _, pkg := range scan.Packages {
+			src_libs_map[pkg.Sourcep] = append(src_libs_map[pkg.Sourcep], pkg.Libraries...)
+		}
+		for _, cve := range scan.CVEs {
+			if strings.Compare(cve.Verdict, vtypes.VERDICT_KEPT) != 0 {
+				continue
+			}
+			if _, ok := rules[cve.ID]; !ok {
+				rule := sarifRule{
+					ID:               cve.ID,
+					ShortDescription: sarifMessage{Text: cve.ID},
+					FullDescription:  sarifMessage{Text: strings.TrimSpace(cve.Description)},
+					HelpURI:          report.advisoryURI(cve.ID),
+					Properties:       map[string]string{"priority": cve.Priority, "cvss": cve.CVSS},
+				}
+				if severity, ok := security_severities[strings.ToLower(cve.Priority)]; ok {
+					rule.Properties["security-severity"] = severity
+				}
+				rules[cve.ID] = rule
+			}
+			key := cve.Sourcep + " " + cve.ID
+			if _, ok := results[key]; !ok {
+				results[key] = &sarifResult{
+					RuleID:     cve.ID,
+					Level:      sarifLevel(cve.Priority),
+					Message:    sarifMessage{Text: cve.ID + " in " + cve.Sourcep + " " + cve.SourceVersion + ": " + cve.Status},
+					Properties: map[string]string{"sourcep": cve.Sourcep, "version": cve.SourceVersion, "status": cve.Status, "reason": cve.Reason, "mode": scan.Mode},
+				}
+				result_keys = append(result_keys, key)
+				result_libs[key] = map[string]bool{}
+			}
+			for _, lib := range src_libs_map[cve.Sourcep] {
+				result_libs[key][lib] = true
+			}
+		}
+	}
+
+	run := sarifRun{Tool: sarifTool{Driver: sarifDriver{Name: TOOL_NAME, InformationURI: TOOL_URI, Rules: []sarifRule{}}}, Results: []sarifResult{}}
+	invocation := sarifInvocation{ExecutionSuccessful: true}
+	for _, scan := range report.Scans {
+		for _, failure := range scan.Failures {
+			invocation.ToolExecutionNotifications = append(invocation.ToolExecutionNotifications, sarifNotification{
+				Level:      "warning",
+				Message:    sarifMessage{Text: "not evaluated: " + failure.String()},
+				Properties: map[string]string{"sourcep": failure.Package, "cve": failure.CVE, "mode": scan.Mode},
+			})
+		}
+	}
+	run.Invocations = []sarifInvocation{invocation}
+	for _, rule := range rules {
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, rule)
+	}
+	sort.Slice(run.Tool.Driver.Rules, func(i, j int) bool {
+		return strings.Compare(run.Tool.Driver.Rules[i].ID, run.Tool.Driver.Rules[j].ID) < 0
+	})
+	sort.Strings(result_keys)
+	for _, key := range result_keys {
+		libs := []string{}
+		for lib := range result_libs[key] {
+			libs = append(libs, lib)
+		}
+		sort.Strings(libs)
+		result := results[key]
+		result.Locations = []sarifLocation{}
+		for _, lib := range libs {
+			result.Locations = append(result.Locations, sarifFileLocation(lib))
+		}
+		run.Results = append(run.Results, *result)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(sarifLog{Version: SARIF_VERSION, Schema: SARIF_SCHEMA, Runs: []sarifRun{run}}); err != nil {
+		return xerrors.Errorf("cannot encode the sarif log: %w", err)
+	}
+	return nil
+}
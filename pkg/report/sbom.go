@@ -0,0 +1,192 @@
+package report
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/yomaytk/go_ltrace/pkg/debversion"
+	"github.com/yomaytk/go_ltrace/pkg/langpkg"
+	ttypes "github.com/yomaytk/go_ltrace/types"
+	vtypes "github.com/yomaytk/go_ltrace/vulndb"
+	"golang.org/x/xerrors"
+)
+
+// component is the binary package observed in any scan of the report
+type component struct {
+	Package
+	Purl string
+	// the modes which observed the package
+	Modes []string
+}
+
+// vulnerability is the CVE of the component. the CVE kept by any scan is kept.
+type vulnerability struct {
+	CVE
+	Purl string
+}
+
+// Purl returns the package url of the installed Debian package or the language package.
+// ex.) pkg:deb/ubuntu/libc6@2.35-0ubuntu3.1?arch=amd64&distro=jammy&upstream=glibc, pkg:pypi/markupsafe@2.1.3
+func Purl(distro string, os_version string, package_detail ttypes.PackageDetail) string {
+
+	if strings.Compare(package_detail.Ecosystem, "") != 0 {
+		return languagePurl(package_detail)
+	}
+
+	// the binary package name is qualified by the architecture for Multi-Arch: same
+	name := strings.Split(package_detail.Binaryp, ":")[0]
+	version := package_detail.Version
+	epoch := 0
+	if parsed, err := debversion.Parse(version); err == nil {
+		epoch = parsed.Epoch
+		parsed.Epoch = 0
+		version = parsed.String()
+	}
+
+	purl := "pkg:deb/" + url.PathEscape(distro) + "/" + url.PathEscape(name)
+	if strings.Compare(version, "") != 0 {
+		purl += "@" + url.PathEscape(version)
+	}
+
+	// the qualifiers are sorted by the key
+	qualifiers := []string{}
+	if strings.Compare(package_detail.Arch, "") != 0 {
+		qualifiers = append(qualifiers, "arch="+url.QueryEscape(package_detail.Arch))
+	}
+	if strings.Compare(os_version, "") != 0 {
+		qualifiers = append(qualifiers, "distro="+url.QueryEscape(os_version))
+	}
+	if epoch > 0 {
+		qualifiers = append(qualifiers, "epoch="+strconv.Itoa(epoch))
+	}
+	if strings.Compare(package_detail.Sourcep, "") != 0 && strings.Compare(package_detail.Sourcep, name) != 0 {
+		qualifiers = append(qualifiers, "upstream="+url.QueryEscape(package_detail.Sourcep))
+	}
+	if len(qualifiers) > 0 {
+		purl += "?" + strings.Join(qualifiers, "&")
+	}
+
+	return purl
+}
+
+// the package url of the language package. ex.) pkg:npm/%40babel/core@7.23.2, pkg:golang/golang.org/x/net@v0.17.0
+func languagePurl(package_detail ttypes.PackageDetail) string {
+
+	var purl_type string
+	name := package_detail.Binaryp
+	switch package_detail.Ecosystem {
+	case langpkg.ECOSYSTEM_PYPI:
+		// the name of PyPI is lowercased and '_' is replaced with '-'
+		purl_type, name = "pypi", strings.ReplaceAll(strings.ToLower(name), "_", "-")
+	case langpkg.ECOSYSTEM_NPM:
+		purl_type = "npm"
+	case langpkg.ECOSYSTEM_GO:
+		purl_type = "golang"
+	default:
+		purl_type = strings.ToLower(package_detail.Ecosystem)
+	}
+
+	// the namespace is escaped for every segment. ex.) @scope -> %40scope
+	segments := strings.Split(name, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+		if strings.HasPrefix(segment, "@") {
+			segments[i] = "%40" + url.PathEscape(segment[1:])
+		}
+	}
+	purl := "pkg:" + purl_type + "/" + strings.Join(segments, "/")
+	if strings.Compare(package_detail.Version, "") != 0 {
+		purl += "@" + url.PathEscape(package_detail.Version)
+	}
+
+	return purl
+}
+
+// the packages of all scans merged by the package url
+func (report *Report) components() []component {
+
+	components := map[string]*component{}
+	for _, scan := range report.Scans {
+		for _, pkg := range scan.Packages {
+			purl := Purl(report.Distro, report.OsVersion, pkg.PackageDetail)
+			c, ok := components[purl]
+			if !ok {
+				c = &component{Package: Package{PackageDetail: pkg.PackageDetail, Libraries: []string{}}, Purl: purl, Modes: []string{}}
+				components[purl] = c
+			}
+			c.Libraries = mergeStrings(c.Libraries, pkg.Libraries)
+			c.Modes = mergeStrings(c.Modes, []string{scan.Mode})
+		}
+	}
+
+	sorted := []component{}
+	for _, c := range components {
+		sorted = append(sorted, *c)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return strings.Compare(sorted[i].Purl, sorted[j].Purl) < 0
+	})
+
+	return sorted
+}
+
+// the CVEs of all scans merged by (CVE, package url)
+func (report *Report) vulnerabilities() []vulnerability {
+
+	vulnerabilities := map[string]*vulnerability{}
+	keys := []string{}
+	for _, scan := range report.Scans {
+		for _, cve := range scan.CVEs {
+			purl := Purl(report.Distro, report.OsVersion, ttypes.PackageDetail{Binaryp: cve.Binaryp, Sourcep: cve.Sourcep,
+				Version: cve.Version, SourceVersion: cve.SourceVersion, Arch: cve.Arch, Ecosystem: cve.Ecosystem})
+			key := cve.ID + " " + purl
+			v, ok := vulnerabilities[key]
+			if !ok {
+				vulnerabilities[key] = &vulnerability{CVE: cve, Purl: purl}
+				keys = append(keys, key)
+				continue
+			}
+			// the CVE kept by any scan is kept
+			if strings.Compare(v.Verdict, vtypes.VERDICT_KEPT) != 0 && strings.Compare(cve.Verdict, vtypes.VERDICT_KEPT) == 0 {
+				v.CVE = cve
+			}
+		}
+	}
+
+	sort.Strings(keys)
+	sorted := []vulnerability{}
+	for _, key := range keys {
+		sorted = append(sorted, *vulnerabilities[key])
+	}
+
+	return sorted
+}
+
+// the sorted union of the string slices
+func mergeStrings(a []string, b []string) []string {
+	set := map[string]bool{}
+	for _, s := range append(append([]string{}, a...), b...) {
+		set[s] = true
+	}
+	merged := []string{}
+	for s := range set {
+		merged = append(merged, s)
+	}
+	sort.Strings(merged)
+	return merged
+}
+
+// random UUID (version 4)
+func newUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", xerrors.Errorf("cannot generate uuid: %w", err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
@@ -0,0 +1,164 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	ttypes "github.com/yomaytk/go_ltrace/types"
+	vtypes "github.com/yomaytk/go_ltrace/vulndb"
+)
+
+func TestPurl(t *testing.T) {
+	tests := []struct {
+		package_detail ttypes.PackageDetail
+		expected       string
+	}{
+		{ttypes.PackageDetail{Binaryp: "libc6:amd64", Sourcep: "glibc", Version: "2.35-0ubuntu3.1", Arch: "amd64"},
+			"pkg:deb/ubuntu/libc6@2.35-0ubuntu3.1?arch=amd64&distro=jammy&upstream=glibc"},
+		{ttypes.PackageDetail{Binaryp: "libssl3", Sourcep: "openssl", Version: "3.0.2-0ubuntu1.10", Arch: "amd64"},
+			"pkg:deb/ubuntu/libssl3@3.0.2-0ubuntu1.10?arch=amd64&distro=jammy&upstream=openssl"},
+		{ttypes.PackageDetail{Binaryp: "zlib1g", Sourcep: "zlib", Version: "1:1.2.11.dfsg-2ubuntu9.2", Arch: "amd64"},
+			"pkg:deb/ubuntu/zlib1g@1.2.11.dfsg-2ubuntu9.2?arch=amd64&distro=jammy&epoch=1&upstream=zlib"},
+		{ttypes.PackageDetail{Binaryp: "bash", Sourcep: "bash", Version: "5.1-6ubuntu1", Arch: "amd64"},
+			"pkg:deb/ubuntu/bash@5.1-6ubuntu1?arch=amd64&distro=jammy"},
+		// the language packages are not qualified by the distro
+		{ttypes.PackageDetail{Binaryp: "MarkupSafe", Sourcep: "MarkupSafe", Version: "2.1.3", Ecosystem: "PyPI"}, "pkg:pypi/markupsafe@2.1.3"},
+		{ttypes.PackageDetail{Binaryp: "@babel/core", Sourcep: "@babel/core", Version: "7.23.2", Ecosystem: "npm"}, "pkg:npm/%40babel/core@7.23.2"},
+		{ttypes.PackageDetail{Binaryp: "golang.org/x/net", Sourcep: "golang.org/x/net", Version: "v0.17.0", Ecosystem: "Go"}, "pkg:golang/golang.org/x/net@v0.17.0"},
+	}
+	for _, test := range tests {
+		if purl := Purl(DISTRO_UBUNTU, "jammy", test.package_detail); strings.Compare(purl, test.expected) != 0 {
+			t.Errorf("Purl(%v) = %v, expected %v", test.package_detail, purl, test.expected)
+		}
+	}
+}
+
+func testSbomReport() *Report {
+	libc := ttypes.PackageDetail{Binaryp: "libc6:amd64", Sourcep: "glibc", Version: "2.35-0ubuntu3.1", SourceVersion: "2.35-0ubuntu3.1", Arch: "amd64"}
+	lib_map := map[string]bool{"/lib/x86_64-linux-gnu/libc.so.6": true}
+	src_bin_map := map[ttypes.PackageDetail][]string{libc: {"/lib/x86_64-linux-gnu/libc.so.6"}}
+	scan_report := NewReport([]string{"/bin/ls"}, DISTRO_UBUNTU, "jammy")
+	scan_report.AddScan(NewScan(MODE_STATIC, lib_map, map[string][]string{}, src_bin_map, []vtypes.Finding{
+		{CVE: vtypes.CVE{Candidate: "CVE-2023-0001", Priority: "low"}, Package: libc, Verdict: vtypes.VERDICT_FILTERED, Justification: vtypes.JUSTIFICATION_FIXED},
+		{CVE: vtypes.CVE{Candidate: "CVE-2023-0002", Priority: "high"}, Package: libc, Verdict: vtypes.VERDICT_FILTERED, Justification: vtypes.JUSTIFICATION_NOT_REACHABLE},
+	}))
+	// the CVE kept by strace is kept
+	scan_report.AddScan(NewScan(MODE_STRACE, lib_map, map[string][]string{}, src_bin_map, []vtypes.Finding{
+		{CVE: vtypes.CVE{Candidate: "CVE-2023-0001", Priority: "low"}, Package: libc, Verdict: vtypes.VERDICT_FILTERED, Justification: vtypes.JUSTIFICATION_FIXED},
+		{CVE: vtypes.CVE{Candidate: "CVE-2023-0002", Priority: "high"}, Package: libc, Verdict: vtypes.VERDICT_KEPT},
+	}))
+	return scan_report
+}
+
+func TestWriteCycloneDX(t *testing.T) {
+
+	var out bytes.Buffer
+	if err := testSbomReport().Write(&out, FORMAT_CYCLONEDX); err != nil {
+		t.Fatal(err)
+	}
+	var bom cdxBOM
+	if err := json.Unmarshal(out.Bytes(), &bom); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Compare(bom.SpecVersion, CYCLONEDX_VERSION) != 0 || !strings.HasPrefix(bom.SerialNumber, "urn:uuid:") {
+		t.Errorf("unexpected bom: %v", bom)
+	}
+	if len(bom.Components) != 1 || strings.Compare(bom.Components[0].Name, "libc6") != 0 {
+		t.Fatalf("unexpected components: %v", bom.Components)
+	}
+	if len(bom.Vulnerabilities) != 2 {
+		t.Fatalf("unexpected vulnerabilities: %v", bom.Vulnerabilities)
+	}
+	if strings.Compare(bom.Vulnerabilities[0].Analysis.State, "resolved") != 0 || strings.Compare(bom.Vulnerabilities[1].Analysis.State, "exploitable") != 0 {
+		t.Errorf("unexpected analysis: %v", bom.Vulnerabilities)
+	}
+	if strings.Compare(bom.Vulnerabilities[1].Affects[0].Ref, bom.Components[0].BOMRef) != 0 || strings.Compare(bom.Vulnerabilities[1].Ratings[0].Severity, "high") != 0 {
+		t.Errorf("unexpected vulnerability: %v", bom.Vulnerabilities[1])
+	}
+	if analysis := cyclonedxAnalysis(CVE{Verdict: vtypes.VERDICT_FILTERED, Justification: vtypes.JUSTIFICATION_NOT_REACHABLE}); strings.Compare(analysis.Justification, "code_not_reachable") != 0 {
+		t.Errorf("unexpected analysis: %v", analysis)
+	}
+	if analysis := cyclonedxAnalysis(CVE{Verdict: vtypes.VERDICT_FILTERED, Justification: vtypes.JUSTIFICATION_NOT_TRACKED}); strings.Compare(analysis.State, "in_triage") != 0 {
+		t.Errorf("unexpected analysis: %v", analysis)
+	}
+}
+
+func TestWriteSPDX(t *testing.T) {
+
+	var out bytes.Buffer
+	if err := testSbomReport().Write(&out, FORMAT_SPDX); err != nil {
+		t.Fatal(err)
+	}
+	var document spdxDocument
+	if err := json.Unmarshal(out.Bytes(), &document); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Compare(document.SPDXVersion, SPDX_VERSION) != 0 || len(document.Packages) != 2 || len(document.Relationships) != 2 {
+		t.Fatalf("unexpected document: %v", document)
+	}
+	refs := document.Packages[1].ExternalRefs
+	if len(refs) != 2 || strings.Compare(refs[0].ReferenceType, "purl") != 0 || strings.Compare(refs[1].ReferenceLocator, UBUNTU_CVE_URI+"CVE-2023-0002") != 0 {
+		t.Errorf("unexpected external refs: %v", refs)
+	}
+
+	// the advisory of Debian is the Debian Security Tracker
+	scan_report := testSbomReport()
+	scan_report.Distro = DISTRO_DEBIAN
+	out.Reset()
+	if err := scan_report.Write(&out, FORMAT_SPDX); err != nil {
+		t.Fatal(err)
+	}
+	document = spdxDocument{}
+	if err := json.Unmarshal(out.Bytes(), &document); err != nil {
+		t.Fatal(err)
+	}
+	if refs := document.Packages[1].ExternalRefs; len(refs) != 2 || strings.Compare(refs[1].ReferenceLocator, DEBIAN_CVE_URI+"CVE-2023-0002") != 0 {
+		t.Errorf("unexpected external refs of Debian: %v", refs)
+	}
+}
+
+func TestWriteOpenVEX(t *testing.T) {
+
+	scan_report := testSbomReport()
+	libc := scan_report.Scans[0].Packages[0].PackageDetail
+	scan_report.AddScan(NewScan(MODE_LTRACE, map[string]bool{}, map[string][]string{}, map[ttypes.PackageDetail][]string{}, []vtypes.Finding{
+		{CVE: vtypes.CVE{Candidate: "CVE-2023-0003"}, Package: libc, Verdict: vtypes.VERDICT_FILTERED, Justification: vtypes.JUSTIFICATION_NOT_REACHABLE, Reason: "needed; no fixed function is called"},
+		{CVE: vtypes.CVE{Candidate: "CVE-2023-0004"}, Package: libc, Verdict: vtypes.VERDICT_FILTERED, Justification: vtypes.JUSTIFICATION_NOT_PRESENT, Reason: "DNE"},
+		{CVE: vtypes.CVE{Candidate: "CVE-2023-0005"}, Package: libc, Verdict: vtypes.VERDICT_FILTERED, Justification: vtypes.JUSTIFICATION_NOT_TRACKED, Reason: "not tracked for jammy"},
+	}))
+
+	var out bytes.Buffer
+	if err := scan_report.Write(&out, FORMAT_OPENVEX); err != nil {
+		t.Fatal(err)
+	}
+	var document vexDocument
+	if err := json.Unmarshal(out.Bytes(), &document); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Compare(document.Context, OPENVEX_CONTEXT) != 0 || len(document.Statements) != 5 {
+		t.Fatalf("unexpected document: %v", document)
+	}
+	expected := []struct {
+		status        string
+		justification string
+	}{
+		{"fixed", ""},
+		{"affected", ""},
+		{"not_affected", "vulnerable_code_not_in_execute_path"},
+		{"not_affected", "vulnerable_code_not_present"},
+		{"under_investigation", ""},
+	}
+	for id, statement := range document.Statements {
+		if strings.Compare(statement.Status, expected[id].status) != 0 || strings.Compare(statement.Justification, expected[id].justification) != 0 {
+			t.Errorf("unexpected statement: %v", statement)
+		}
+		if len(statement.Products) != 1 || !strings.HasPrefix(statement.Products[0].ID, "pkg:deb/ubuntu/libc6@") {
+			t.Errorf("unexpected products: %v", statement.Products)
+		}
+	}
+	if strings.Compare(document.Statements[1].ActionStatement, "") == 0 {
+		t.Errorf("the affected statement doesn't have the action statement")
+	}
+}
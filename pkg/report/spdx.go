@@ -0,0 +1,116 @@
+package report
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	vtypes "github.com/yomaytk/go_ltrace/vulndb"
+	"golang.org/x/xerrors"
+)
+
+const (
+	SPDX_VERSION   = "SPDX-2.3"
+	SPDX_NAMESPACE = TOOL_URI + "/spdx/"
+	NOASSERTION    = "NOASSERTION"
+)
+
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	SPDXID           string            `json:"SPDXID"`
+	Name             string            `json:"name"`
+	VersionInfo      string            `json:"versionInfo,omitempty"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	SourceInfo       string            `json:"sourceInfo,omitempty"`
+	PrimaryPurpose   string            `json:"primaryPackagePurpose"`
+	Comment          string            `json:"comment,omitempty"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs,omitempty"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+	Comment           string `json:"comment,omitempty"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+// writeSPDX writes the observed packages as SPDX document.
+// SPDX 2.3 doesn't have the vulnerability section, so the kept CVEs are the security references of the package.
+func (report *Report) writeSPDX(w io.Writer) error {
+
+	serial, err := newUUID()
+	if err != nil {
+		return err
+	}
+
+	name := TOOL_NAME
+	if len(report.Target) > 0 {
+		name = report.Target[0]
+	}
+	document := spdxDocument{SPDXVersion: SPDX_VERSION, DataLicense: "CC0-1.0", SPDXID: "SPDXRef-DOCUMENT", Name: name,
+		DocumentNamespace: SPDX_NAMESPACE + serial, Packages: []spdxPackage{}, Relationships: []spdxRelationship{}}
+	document.CreationInfo = spdxCreationInfo{Created: report.Created.Format(time.RFC3339), Creators: []string{"Tool: " + TOOL_NAME}}
+
+	// the target command or the container image
+	target := spdxPackage{SPDXID: "SPDXRef-Target", Name: strings.Join(report.Target, " "), DownloadLocation: NOASSERTION, PrimaryPurpose: "APPLICATION"}
+	if strings.Compare(report.Image, "") != 0 {
+		document.Name = report.Image
+		target.Name = report.Image
+		target.PrimaryPurpose = "CONTAINER"
+	}
+	document.Packages = append(document.Packages, target)
+	document.Relationships = append(document.Relationships, spdxRelationship{SPDXElementID: "SPDXRef-DOCUMENT", RelationshipType: "DESCRIBES", RelatedSPDXElement: "SPDXRef-Target"})
+
+	// key: purl, value: kept CVEs
+	purl_cves_map := map[string][]CVE{}
+	for _, v := range report.vulnerabilities() {
+		if strings.Compare(v.Verdict, vtypes.VERDICT_KEPT) == 0 {
+			purl_cves_map[v.Purl] = append(purl_cves_map[v.Purl], v.CVE)
+		}
+	}
+
+	for id, c := range report.components() {
+		spdx_id := "SPDXRef-Package-" + strconv.Itoa(id+1)
+		pkg := spdxPackage{SPDXID: spdx_id, Name: strings.Split(c.Binaryp, ":")[0], VersionInfo: c.Version, DownloadLocation: NOASSERTION,
+			SourceInfo: "built package from: " + c.Sourcep + " " + c.SourceVersion, PrimaryPurpose: "LIBRARY",
+			Comment:      "loaded libraries: " + strings.Join(c.Libraries, " "),
+			ExternalRefs: []spdxExternalRef{{ReferenceCategory: "PACKAGE-MANAGER", ReferenceType: "purl", ReferenceLocator: c.Purl}}}
+		for _, cve := range purl_cves_map[c.Purl] {
+			pkg.ExternalRefs = append(pkg.ExternalRefs, spdxExternalRef{ReferenceCategory: "SECURITY", ReferenceType: "advisory",
+				ReferenceLocator: report.advisoryURI(cve.ID), Comment: cve.ID + ": " + cve.Reason})
+		}
+		document.Packages = append(document.Packages, pkg)
+		document.Relationships = append(document.Relationships, spdxRelationship{SPDXElementID: "SPDXRef-Target", RelationshipType: "DEPENDS_ON", RelatedSPDXElement: spdx_id})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(document); err != nil {
+		return xerrors.Errorf("cannot encode the spdx document: %w", err)
+	}
+	return nil
+}
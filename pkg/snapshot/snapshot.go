@@ -0,0 +1,187 @@
+// Package snapshot collects the shared objects mapped by the running processes from /proc/<pid>/maps
+// without ptrace. only the processes whose maps are readable by the user are collected.
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	PROC_DIR = "/proc"
+	// the suffix of the mapped file which is removed or replaced after it is mapped (ex. by the package upgrade)
+	DELETED_SUFFIX = " (deleted)"
+)
+
+// ex.) libc.so.6, libpthread-2.31.so, ld-linux-x86-64.so.2
+var shared_object_re = regexp.MustCompile(`\.so(\.[0-9]+)*$`)
+
+// ex.) docker-<id>.scope, /docker/<id>, cri-containerd-<id>.scope, /kubepods/.../<id>
+var container_id_re = regexp.MustCompile(`[0-9a-f]{64}`)
+
+type Process struct {
+	Pid     int
+	Command []string
+	// the cgroup path of the process. ex.) /system.slice/docker-<id>.scope
+	Cgroup string
+	// the container id in the cgroup path ("" if the process is not in the container)
+	Container string
+	// the shared objects mapped by the process (the path in the mount namespace of the process)
+	Libraries []string
+	// the libraries which are removed or replaced on the disk after they are mapped
+	Deleted []string
+}
+
+// Processes reads the maps of every process in the proc directory. the processes which cannot be read
+// (permission, exited, kernel threads) are skipped and the number of them is returned.
+func Processes(proc_dir string) ([]Process, int, error) {
+
+	entries, err := os.ReadDir(proc_dir)
+	if err != nil {
+		return nil, 0, xerrors.Errorf("cannot read %v: %w", proc_dir, err)
+	}
+
+	processes := []Process{}
+	skipped := 0
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		process, err := readProcess(proc_dir, pid)
+		if err != nil {
+			skipped++
+			continue
+		}
+		// kernel threads and the statically linked programs
+		if len(process.Libraries) == 0 {
+			continue
+		}
+		processes = append(processes, process)
+	}
+	sort.Slice(processes, func(i, j int) bool {
+		return processes[i].Pid < processes[j].Pid
+	})
+
+	return processes, skipped, nil
+}
+
+func readProcess(proc_dir string, pid int) (Process, error) {
+
+	process := Process{Pid: pid, Command: []string{}, Libraries: []string{}}
+	pid_dir := filepath.Join(proc_dir, strconv.Itoa(pid))
+
+	maps, err := os.ReadFile(filepath.Join(pid_dir, "maps"))
+	if err != nil {
+		return process, err
+	}
+	process.Libraries, process.Deleted = parseMaps(maps)
+
+	if cmdline, err := os.ReadFile(filepath.Join(pid_dir, "cmdline")); err == nil && len(cmdline) > 0 {
+		process.Command = strings.Split(strings.TrimRight(string(cmdline), "\x00"), "\x00")
+	}
+	if cgroup, err := os.ReadFile(filepath.Join(pid_dir, "cgroup")); err == nil {
+		process.Cgroup = parseCgroup(cgroup)
+		process.Container = container_id_re.FindString(process.Cgroup)
+	}
+
+	return process, nil
+}
+
+// get the shared objects from maps.
+// ex.) 7f0e4c828000-7f0e4c850000 r--p 00000000 08:01 1835 /usr/lib/x86_64-linux-gnu/libc.so.6
+func parseMaps(maps []byte) ([]string, []string) {
+
+	lib_map := map[string]bool{}
+	deleted_map := map[string]bool{}
+	scanner := bufio.NewScanner(bytes.NewReader(maps))
+	for scanner.Scan() {
+		line := scanner.Text()
+		// the path is the 6th field and may include ' '
+		tokens := strings.Fields(line)
+		if len(tokens) < 6 {
+			continue
+		}
+		path := line[strings.Index(line, tokens[5]):]
+		if !strings.HasPrefix(path, "/") {
+			continue
+		}
+		deleted := strings.HasSuffix(path, DELETED_SUFFIX)
+		path = strings.TrimSuffix(path, DELETED_SUFFIX)
+		if !shared_object_re.MatchString(filepath.Base(path)) {
+			continue
+		}
+		lib_map[path] = true
+		if deleted {
+			deleted_map[path] = true
+		}
+	}
+
+	return sortedKeys(lib_map), sortedKeys(deleted_map)
+}
+
+// the cgroup v2 path, or the first cgroup v1 path. ex.) 0::/system.slice/nginx.service, 12:pids:/docker/<id>
+func parseCgroup(cgroup []byte) string {
+	path := ""
+	for _, line := range strings.Split(string(cgroup), "\n") {
+		tokens := strings.SplitN(line, ":", 3)
+		if len(tokens) != 3 {
+			continue
+		}
+		if strings.Compare(tokens[0], "0") == 0 && strings.Compare(tokens[1], "") == 0 {
+			return tokens[2]
+		}
+		if strings.Compare(path, "") == 0 {
+			path = tokens[2]
+		}
+	}
+	return path
+}
+
+// SplitContainers returns the processes on the host and the processes of every container (key: container id).
+// the libraries of the container processes are the paths in the mount namespace of the container.
+func SplitContainers(processes []Process) ([]Process, map[string][]Process) {
+	host_processes := []Process{}
+	container_processes := map[string][]Process{}
+	for _, process := range processes {
+		if strings.Compare(process.Container, "") == 0 {
+			host_processes = append(host_processes, process)
+			continue
+		}
+		container_processes[process.Container] = append(container_processes[process.Container], process)
+	}
+	return host_processes, container_processes
+}
+
+// RootDir is the root directory of the mount namespace of the process. ex.) /proc/1234/root
+func RootDir(proc_dir string, pid int) string {
+	return filepath.Join(proc_dir, strconv.Itoa(pid), "root")
+}
+
+// LibMap returns the libraries mapped by any of the processes (the key of CommandSet.Dpkg)
+func LibMap(processes []Process) map[string]bool {
+	lib_map := map[string]bool{}
+	for _, process := range processes {
+		for _, lib := range process.Libraries {
+			lib_map[lib] = true
+		}
+	}
+	return lib_map
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := []string{}
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,104 @@
+package snapshot
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const sample_maps = `55d0c8a00000-55d0c8a28000 r--p 00000000 08:01 1234 /usr/sbin/nginx
+7f0e4c828000-7f0e4c850000 r--p 00000000 08:01 1835 /usr/lib/x86_64-linux-gnu/libc.so.6
+7f0e4c850000-7f0e4c9e5000 r-xp 00028000 08:01 1835 /usr/lib/x86_64-linux-gnu/libc.so.6
+7f0e4ca00000-7f0e4ca20000 r-xp 00000000 08:01 2001 /usr/lib/x86_64-linux-gnu/libssl.so.3 (deleted)
+7f0e4cb00000-7f0e4cb10000 r--p 00000000 08:01 2002 /opt/my app/libplugin.so
+7f0e4cc00000-7f0e4cc10000 r--p 00000000 08:01 2003 /usr/lib/locale/locale-archive
+7ffd2e5f0000-7ffd2e611000 rw-p 00000000 00:00 0 [stack]
+`
+
+func TestProcesses(t *testing.T) {
+
+	proc_dir := t.TempDir()
+	files := map[string]string{
+		"1/maps":      sample_maps,
+		"1/cmdline":   "nginx: master process\x00-g\x00daemon off;\x00",
+		"1/cgroup":    "0::/system.slice/docker-" + strings.Repeat("ab", 32) + ".scope\n",
+		"2/maps":      "",
+		"2/cmdline":   "",
+		"self/maps":   sample_maps,
+		"version/foo": "",
+	}
+	for name, content := range files {
+		path := filepath.Join(proc_dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the process which cannot be read
+	if err := os.MkdirAll(filepath.Join(proc_dir, "3"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	processes, skipped, err := Processes(proc_dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(processes) != 1 || skipped != 1 {
+		t.Fatalf("processes = %+v, skipped = %v", processes, skipped)
+	}
+
+	expected := Process{
+		Pid:       1,
+		Command:   []string{"nginx: master process", "-g", "daemon off;"},
+		Cgroup:    "/system.slice/docker-" + strings.Repeat("ab", 32) + ".scope",
+		Container: strings.Repeat("ab", 32),
+		Libraries: []string{"/opt/my app/libplugin.so", "/usr/lib/x86_64-linux-gnu/libc.so.6", "/usr/lib/x86_64-linux-gnu/libssl.so.3"},
+		Deleted:   []string{"/usr/lib/x86_64-linux-gnu/libssl.so.3"},
+	}
+	if !reflect.DeepEqual(processes[0], expected) {
+		t.Errorf("Processes() = %+v, expected %+v", processes[0], expected)
+	}
+	if lib_map := LibMap(processes); len(lib_map) != 3 || !lib_map["/usr/lib/x86_64-linux-gnu/libc.so.6"] {
+		t.Errorf("unexpected lib_map: %v", lib_map)
+	}
+}
+
+func TestParseCgroup(t *testing.T) {
+	tests := []struct {
+		cgroup   string
+		expected string
+	}{
+		{"0::/user.slice/user-1000.slice/session-2.scope\n", "/user.slice/user-1000.slice/session-2.scope"},
+		{"12:pids:/docker/0123\n11:memory:/docker/0123\n", "/docker/0123"},
+		{"12:pids:/docker/0123\n0::/\n", "/"},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if cgroup := parseCgroup([]byte(test.cgroup)); strings.Compare(cgroup, test.expected) != 0 {
+			t.Errorf("parseCgroup(%q) = %v, expected %v", test.cgroup, cgroup, test.expected)
+		}
+	}
+}
+
+func TestSplitContainers(t *testing.T) {
+	container := strings.Repeat("ab", 32)
+	processes := []Process{
+		{Pid: 1, Libraries: []string{"/usr/lib/x86_64-linux-gnu/libc.so.6"}},
+		{Pid: 2, Container: container, Libraries: []string{"/usr/lib/x86_64-linux-gnu/libssl.so.3"}},
+		{Pid: 3, Container: container, Libraries: []string{"/usr/lib/x86_64-linux-gnu/libc.so.6"}},
+	}
+	host_processes, container_processes := SplitContainers(processes)
+	if len(host_processes) != 1 || host_processes[0].Pid != 1 {
+		t.Errorf("unexpected host processes: %v", host_processes)
+	}
+	if len(container_processes) != 1 || len(container_processes[container]) != 2 {
+		t.Errorf("unexpected container processes: %v", container_processes)
+	}
+	if root := RootDir(PROC_DIR, 2); strings.Compare(root, "/proc/2/root") != 0 {
+		t.Errorf("RootDir() = %v", root)
+	}
+}
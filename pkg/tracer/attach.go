@@ -0,0 +1,410 @@
+package tracer
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	log "github.com/yomaytk/go_ltrace/log"
+	"golang.org/x/xerrors"
+)
+
+// the ptrace requests which are not defined in syscall
+const (
+	PTRACE_SEIZE            = 0x4206
+	PTRACE_INTERRUPT        = 0x4207
+	PTRACE_GET_SYSCALL_INFO = 0x420e
+	// the stop by PTRACE_INTERRUPT and the first stop of the new seized task
+	PTRACE_EVENT_STOP = 128
+	// ptrace_syscall_info.op
+	PTRACE_SYSCALL_INFO_EXIT = 2
+)
+
+// the live process is never killed by the exit of the tracer
+const AttachOptions = TraceOptions &^ PTRACE_O_EXITKILL
+
+// the interval to poll the tracees while no tracee stops. it starts short for the tracee resumed just now,
+// and doubles up to the max while the tracees are idle.
+const (
+	STOP_POLL_MIN_INTERVAL = time.Millisecond
+	STOP_POLL_MAX_INTERVAL = 50 * time.Millisecond
+)
+
+// the request to finish the attached trace (the duration elapsed, SIGINT or SIGTERM)
+type stopRequest struct {
+	once sync.Once
+	ch   chan struct{}
+}
+
+func (req *stopRequest) requested() bool {
+	select {
+	case <-req.ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// wait for the stop of any tracee. the attached trace polls wait4 with WNOHANG until the stop request,
+// and 0 is returned for the request.
+func waitTracees(ws *syscall.WaitStatus, stop *stopRequest) (int, error) {
+	if stop == nil {
+		return syscall.Wait4(-1, ws, syscall.WALL, nil)
+	}
+	interval := STOP_POLL_MIN_INTERVAL
+	for {
+		wpid, err := syscall.Wait4(-1, ws, syscall.WALL|syscall.WNOHANG, nil)
+		if err != nil || wpid != 0 {
+			return wpid, err
+		}
+		select {
+		case <-stop.ch:
+			return 0, nil
+		case <-time.After(interval):
+		}
+		if interval *= 2; interval > STOP_POLL_MAX_INTERVAL {
+			interval = STOP_POLL_MAX_INTERVAL
+		}
+	}
+}
+
+func ptrace(request int, pid int, addr uintptr, data uintptr) error {
+	if _, _, errno := syscall.Syscall6(syscall.SYS_PTRACE, uintptr(request), uintptr(pid), addr, data, 0, 0); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// whether the syscall-stop is syscall-exit-stop (false if it cannot be known, linux < 5.3)
+func syscallExitStop(pid int) bool {
+	// struct ptrace_syscall_info is 88 bytes, and op is the first byte
+	info := make([]byte, 88)
+	if err := ptrace(PTRACE_GET_SYSCALL_INFO, pid, uintptr(len(info)), uintptr(unsafe.Pointer(&info[0]))); err != nil {
+		return false
+	}
+	return info[0] == PTRACE_SYSCALL_INFO_EXIT
+}
+
+// the process and its descendants. ex.) the master and the workers of nginx
+func processTree(pid int) ([]int, error) {
+
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+
+	// key: ppid, value: children
+	children := map[int][]int{}
+	for _, entry := range entries {
+		child, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		// ex.) 1234 (nginx) S 1 ... (the command name may include ' ' and ')')
+		stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", child))
+		if err != nil {
+			continue
+		}
+		fields := strings.Fields(string(stat[strings.LastIndex(string(stat), ")")+1:]))
+		if len(fields) < 2 {
+			continue
+		}
+		ppid, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		children[ppid] = append(children[ppid], child)
+	}
+
+	pids := []int{}
+	queue := []int{pid}
+	for len(queue) > 0 {
+		pids = append(pids, queue[0])
+		queue = append(queue[1:], children[queue[0]]...)
+	}
+
+	return pids, nil
+}
+
+// the threads of the process
+func threads(pid int) []int {
+	entries, err := os.ReadDir(fmt.Sprintf("/proc/%d/task", pid))
+	if err != nil {
+		return []int{}
+	}
+	tids := []int{}
+	for _, entry := range entries {
+		if tid, err := strconv.Atoi(entry.Name()); err == nil {
+			tids = append(tids, tid)
+		}
+	}
+	sort.Ints(tids)
+	return tids
+}
+
+// Attach traces the running process and its descendants until the duration elapses (0 is unlimited),
+// SIGINT or SIGTERM arrives, or every traced task exits. the process keeps running after the trace.
+func (tracer *Tracer) Attach(pid int, duration time.Duration) (map[string]bool, error) {
+
+	if _, err := os.Stat(fmt.Sprintf("/proc/%d", pid)); err != nil {
+		return tracer.LibMap, xerrors.Errorf("the process %v is not found: %w", pid, err)
+	}
+
+	// every ptrace request must be issued from the thread which attached the tracee
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	// the first signal to be delivered to every task
+	start := map[int]int{}
+	// key: the thread group, value: the address space
+	procs := map[int]*process{}
+
+	// seize every thread of the process tree until no new thread appears
+	for {
+		pids, err := processTree(pid)
+		if err != nil {
+			return tracer.LibMap, xerrors.Errorf("cannot get the process tree of %v: %w", pid, err)
+		}
+		seized := false
+		for _, tgid := range pids {
+			for _, tid := range threads(tgid) {
+				if _, ok := tracer.tasks[tid]; ok {
+					continue
+				}
+				sig, err := seize(tid)
+				if err != nil {
+					if len(tracer.tasks) == 0 && tid == pid {
+						return tracer.LibMap, xerrors.Errorf("failed to attach %v: %w", tid, err)
+					}
+					// the task exited before it is seized
+					log.Logger.Infoln("failed to attach", tid, err)
+					continue
+				}
+				seized = true
+				start[tid] = sig
+				tracer.tasks[tid] = &task{attached: true}
+				if tracer.trace_calls {
+					if _, ok := procs[tgid]; !ok {
+						procs[tgid] = newProcess()
+					}
+					tracer.tasks[tid].proc = procs[tgid]
+				}
+			}
+		}
+		if !seized {
+			break
+		}
+	}
+	if len(tracer.tasks) == 0 {
+		return tracer.LibMap, xerrors.Errorf("failed to attach %v.\n", pid)
+	}
+
+	// the libraries already mapped are used by the process too
+	for tgid, proc := range procs {
+		if err := tracer.plantBreakpoints(tgid, proc); err != nil {
+			log.Logger.Infoln("failed to plant the breakpoints of", tgid, err)
+		}
+	}
+
+	// the tracer polls the tracees and notices the request without sending any signal to them
+	stop := &stopRequest{ch: make(chan struct{})}
+	request := func() {
+		stop.once.Do(func() { close(stop.ch) })
+	}
+	sig_ch := make(chan os.Signal, 1)
+	signal.Notify(sig_ch, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sig_ch)
+	go func() {
+		var timeout <-chan time.Time
+		if duration > 0 {
+			timer := time.NewTimer(duration)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		select {
+		case <-sig_ch:
+			request()
+		case <-timeout:
+			request()
+		case <-stop.ch:
+		}
+	}()
+	// the goroutine finishes when the trace ends by the exit of the tracees
+	defer stop.once.Do(func() { close(stop.ch) })
+
+	if err := tracer.loop(start, stop); err != nil {
+		return tracer.LibMap, err
+	}
+	if stop.requested() {
+		if err := tracer.detach(); err != nil {
+			return tracer.LibMap, err
+		}
+	}
+
+	return tracer.LibMap, nil
+}
+
+// seize the task and wait for its first stop. the signal which stopped the task is returned.
+func seize(tid int) (int, error) {
+	if err := ptrace(PTRACE_SEIZE, tid, 0, AttachOptions); err != nil {
+		return 0, err
+	}
+	if err := ptrace(PTRACE_INTERRUPT, tid, 0, 0); err != nil {
+		return 0, err
+	}
+	for {
+		var ws syscall.WaitStatus
+		if _, err := syscall.Wait4(tid, &ws, syscall.WALL, nil); err != nil {
+			if err == syscall.EINTR {
+				continue
+			}
+			return 0, err
+		}
+		if ws.Exited() || ws.Signaled() {
+			return 0, syscall.ESRCH
+		}
+		// the signal arrived before PTRACE_INTERRUPT is delivered at the resume
+		if ws.Stopped() && ws.StopSignal() != syscall.SIGTRAP {
+			return int(ws.StopSignal()), nil
+		}
+		return 0, nil
+	}
+}
+
+// stop every task, remove the breakpoints and detach. the signals not yet delivered are delivered by PTRACE_DETACH.
+func (tracer *Tracer) detach() error {
+
+	interrupted := map[int]bool{}
+	// key: the stopped task, value: the signal to be delivered
+	stopped := map[int]int{}
+	// the held task is already stopped and PTRACE_INTERRUPT doesn't report it again
+	for tid, t := range tracer.tasks {
+		if t.held {
+			interrupted[tid] = true
+			stopped[tid] = 0
+		}
+	}
+
+	for len(stopped) < len(tracer.tasks) {
+
+		for tid := range tracer.tasks {
+			if !interrupted[tid] {
+				interrupted[tid] = true
+				if err := ptrace(PTRACE_INTERRUPT, tid, 0, 0); err != nil && err != syscall.ESRCH {
+					log.Logger.Infoln("failed to interrupt", tid, err)
+				}
+			}
+		}
+
+		var ws syscall.WaitStatus
+		wpid, err := syscall.Wait4(-1, &ws, syscall.WALL, nil)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err == syscall.ECHILD {
+			return nil
+		}
+		if err != nil {
+			return xerrors.Errorf("failed to wait tracees: %w", err)
+		}
+		if ws.Exited() || ws.Signaled() {
+			delete(tracer.tasks, wpid)
+			delete(stopped, wpid)
+			continue
+		}
+		if !ws.Stopped() {
+			continue
+		}
+
+		t, ok := tracer.tasks[wpid]
+		if !ok {
+			t = &task{initial_stop: true}
+			tracer.tasks[wpid] = t
+		}
+		if _, ok := stopped[wpid]; ok {
+			// the stop of PTRACE_INTERRUPT after another stop. the task is already stopped.
+			continue
+		}
+
+		sig := ws.StopSignal()
+		switch {
+		case sig == syscall.SIGTRAP && ws.TrapCause() > 0:
+			// register the new task of fork/clone. the stop of PTRACE_INTERRUPT is also here.
+			if ws.TrapCause() != PTRACE_EVENT_STOP {
+				tracer.handleStop(wpid, t, ws)
+			}
+			stopped[wpid] = 0
+		case sig == SYSCALL_TRAP, sig == syscall.SIGSTOP && t.initial_stop:
+			stopped[wpid] = 0
+		case sig == syscall.SIGTRAP && tracer.trace_calls && t.proc != nil:
+			// the task hit the breakpoint, so execute the original instruction again after the detach
+			if !tracer.rewindBreakpoint(wpid, t) {
+				stopped[wpid] = int(sig)
+			} else {
+				stopped[wpid] = 0
+			}
+		default:
+			stopped[wpid] = int(sig)
+		}
+	}
+
+	// restore the original instructions once for every address space
+	restored := map[*process]bool{}
+	for tid, t := range tracer.tasks {
+		if t.proc == nil || restored[t.proc] {
+			continue
+		}
+		restored[t.proc] = true
+		if err := t.proc.restore(tid); err != nil {
+			log.Logger.Infoln("failed to remove the breakpoints of", tid, err)
+		}
+	}
+
+	for tid := range tracer.tasks {
+		if err := ptrace(syscall.PTRACE_DETACH, tid, 0, uintptr(stopped[tid])); err != nil && err != syscall.ESRCH {
+			log.Logger.Infoln("failed to detach", tid, err)
+		}
+		delete(tracer.tasks, tid)
+	}
+
+	return nil
+}
+
+// set the pc back to the breakpoint hit by the task, and return false if the trap is not caused by us
+func (tracer *Tracer) rewindBreakpoint(pid int, t *task) bool {
+	var regs syscall.PtraceRegs
+	if err := syscall.PtraceGetRegs(pid, &regs); err != nil {
+		return false
+	}
+	addr := regs.PC() - BREAKPOINT_PC_OFFSET
+	if _, ok := t.proc.breakpoints[addr]; !ok && (t.proc.entry == 0 || addr != t.proc.entry) {
+		return false
+	}
+	regs.SetPC(addr)
+	return syscall.PtraceSetRegs(pid, &regs) == nil
+}
+
+// write back the original instructions of the breakpoints
+func (proc *process) restore(pid int) error {
+	if proc.entry != 0 {
+		if _, err := syscall.PtracePokeData(pid, uintptr(proc.entry), proc.entry_insn); err != nil {
+			return err
+		}
+		proc.entry = 0
+	}
+	for addr, bp := range proc.breakpoints {
+		if _, err := syscall.PtracePokeData(pid, uintptr(addr), bp.orig_insn); err != nil {
+			return err
+		}
+		delete(proc.breakpoints, addr)
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package tracer
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+)
+
+func TestProcessTree(t *testing.T) {
+
+	cmd := exec.Command("sleep", "10")
+	if err := cmd.Start(); err != nil {
+		t.Skip(err)
+	}
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+
+	pids, err := processTree(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pids) < 2 || pids[0] != os.Getpid() {
+		t.Fatalf("unexpected process tree: %v", pids)
+	}
+	found := false
+	for _, pid := range pids {
+		found = found || pid == cmd.Process.Pid
+	}
+	if !found {
+		t.Errorf("the child %v is not in the process tree %v", cmd.Process.Pid, pids)
+	}
+
+	if tids := threads(os.Getpid()); len(tids) == 0 {
+		t.Errorf("no thread of the test process")
+	}
+}
@@ -0,0 +1,500 @@
+package tracer
+
+import (
+	"bufio"
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	log "github.com/yomaytk/go_ltrace/log"
+	"golang.org/x/xerrors"
+)
+
+const (
+	AT_ENTRY = 9
+	// elf symbol type of GNU indirect function (e.g. memcpy, strlen of glibc)
+	STT_GNU_IFUNC = elf.SymType(10)
+	PAGE_MASK     = 0xfff
+	// the dynamic loader calls it whenever the loaded objects change (ex. dlopen, dlclose)
+	DEBUG_STATE_FUNC = "_dl_debug_state"
+)
+
+type CallEvent struct {
+	Pid     int    `json:"pid"`
+	Library string `json:"library"`
+	Symbol  string `json:"symbol"`
+	Count   int    `json:"count"`
+}
+
+type callKey struct {
+	pid     int
+	library string
+	symbol  string
+}
+
+type breakpoint struct {
+	library   string
+	symbol    string
+	orig_insn []byte
+}
+
+// the address space shared by the threads
+type process struct {
+	// the breakpoint at the entry point of the program to wait for the dynamic loader
+	entry       uint64
+	entry_insn  []byte
+	breakpoints map[uint64]*breakpoint
+	// the breakpoint at _dl_debug_state of the dynamic loader to plant the breakpoints of dlopen'd objects
+	debug_state uint64
+}
+
+func newProcess() *process {
+	return &process{breakpoints: map[uint64]*breakpoint{}}
+}
+
+// the child created by fork has the same breakpoints in its copied memory
+func (proc *process) copy() *process {
+	new_proc := &process{entry: proc.entry, entry_insn: proc.entry_insn, breakpoints: map[uint64]*breakpoint{}, debug_state: proc.debug_state}
+	for addr, bp := range proc.breakpoints {
+		new_proc.breakpoints[addr] = bp
+	}
+	return new_proc
+}
+
+// the ELF object mapped in the tracee
+type elfObject struct {
+	path string
+	// the lowest address mapped from file offset 0
+	base  uint64
+	start uint64
+	end   uint64
+	bias  uint64
+	// key: function name, value: symbol
+	defined_funcs map[string]elf.Symbol
+	// key: imported function name, value: the addresses of the GOT entries
+	imported_funcs map[string][]uint64
+	// key: imported function name, value: the address of the PLT entry
+	plt_entries map[string]uint64
+}
+
+// NewCallTracer returns the tracer which also hooks the library calls with breakpoints.
+func NewCallTracer() *Tracer {
+	tracer := NewTracer()
+	tracer.trace_calls = true
+	return tracer
+}
+
+// CallEvents returns the number of calls for every (pid, library, symbol).
+func (tracer *Tracer) CallEvents() []CallEvent {
+	call_events := []CallEvent{}
+	for key, count := range tracer.call_count {
+		call_events = append(call_events, CallEvent{Pid: key.pid, Library: key.library, Symbol: key.symbol, Count: count})
+	}
+	sort.Slice(call_events, func(i, j int) bool {
+		if call_events[i].Pid != call_events[j].Pid {
+			return call_events[i].Pid < call_events[j].Pid
+		}
+		if call_events[i].Library != call_events[j].Library {
+			return call_events[i].Library < call_events[j].Library
+		}
+		return call_events[i].Symbol < call_events[j].Symbol
+	})
+	return call_events
+}
+
+// the library path as the tracee opened it, which is the key of LibMap
+func (tracer *Tracer) libraryName(path string) string {
+	if opened_path, ok := tracer.opened_map[path]; ok {
+		return opened_path
+	}
+	return tracer.guestPath(path)
+}
+
+// plant the breakpoint at the entry point. every DT_NEEDED library has been loaded when it is hit.
+func (tracer *Tracer) plantEntry(pid int, proc *process) error {
+
+	auxv, err := os.ReadFile(fmt.Sprintf("/proc/%d/auxv", pid))
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i+16 <= len(auxv); i += 16 {
+		if binary.LittleEndian.Uint64(auxv[i:]) != AT_ENTRY {
+			continue
+		}
+		entry := binary.LittleEndian.Uint64(auxv[i+8:])
+		orig_insn, err := pokeBreakpoint(pid, entry)
+		if err != nil {
+			return err
+		}
+		proc.entry = entry
+		proc.entry_insn = orig_insn
+		return nil
+	}
+
+	return xerrors.Errorf("Bug: AT_ENTRY is not found in auxv of %v.\n", pid)
+}
+
+// handle SIGTRAP by the breakpoint and return false if the trap is not caused by us
+func (tracer *Tracer) handleBreakpoint(pid int, t *task) (bool, error) {
+
+	proc := t.proc
+	var regs syscall.PtraceRegs
+	if err := syscall.PtraceGetRegs(pid, &regs); err != nil {
+		return false, err
+	}
+	addr := regs.PC() - BREAKPOINT_PC_OFFSET
+
+	// the entry point of the program
+	if proc.entry != 0 && addr == proc.entry {
+		if _, err := syscall.PtracePokeData(pid, uintptr(addr), proc.entry_insn); err != nil {
+			return true, err
+		}
+		regs.SetPC(addr)
+		if err := syscall.PtraceSetRegs(pid, &regs); err != nil {
+			return true, err
+		}
+		proc.entry = 0
+		return true, tracer.plantBreakpoints(pid, proc)
+	}
+
+	bp, ok := proc.breakpoints[addr]
+	if !ok {
+		return false, nil
+	}
+	if addr != proc.debug_state {
+		tracer.call_count[callKey{pid: pid, library: bp.library, symbol: bp.symbol}]++
+	}
+
+	// execute the original instruction by single step, and restore the breakpoint
+	if _, err := syscall.PtracePokeData(pid, uintptr(addr), bp.orig_insn); err != nil {
+		return true, err
+	}
+	regs.SetPC(addr)
+	if err := syscall.PtraceSetRegs(pid, &regs); err != nil {
+		return true, err
+	}
+	if err := syscall.PtraceSingleStep(pid); err != nil {
+		return true, err
+	}
+	for {
+		var ws syscall.WaitStatus
+		if _, err := syscall.Wait4(pid, &ws, syscall.WALL, nil); err != nil {
+			if err == syscall.EINTR {
+				continue
+			}
+			return true, err
+		}
+		if ws.Exited() || ws.Signaled() {
+			delete(tracer.tasks, pid)
+			return true, nil
+		}
+		if ws.Stopped() && ws.StopSignal() == syscall.SIGTRAP {
+			break
+		}
+		// the signal arrived before the single step is delivered after the breakpoint
+		if ws.Stopped() {
+			t.pending_sig = int(ws.StopSignal())
+		}
+		if err := syscall.PtraceSingleStep(pid); err != nil {
+			return true, err
+		}
+	}
+	if _, err := syscall.PtracePokeData(pid, uintptr(addr), breakpoint_insn); err != nil {
+		return true, err
+	}
+
+	// the objects may be loaded or unloaded
+	if addr == proc.debug_state {
+		return true, tracer.plantBreakpoints(pid, proc)
+	}
+
+	return true, nil
+}
+
+// plant the breakpoints on the functions which are imported by the loaded ELF objects. it is called again at
+// _dl_debug_state, so the breakpoints already planted are kept and those of the unloaded objects are dropped.
+func (tracer *Tracer) plantBreakpoints(pid int, proc *process) error {
+
+	elf_objects, err := loadedObjects(pid, tracer.Root)
+	if err != nil {
+		return err
+	}
+
+	for addr := range proc.breakpoints {
+		mapped := false
+		for _, elf_object := range elf_objects {
+			mapped = mapped || (elf_object.start <= addr && addr < elf_object.end)
+		}
+		if !mapped {
+			delete(proc.breakpoints, addr)
+		}
+	}
+
+	for _, importer := range elf_objects {
+		for func_name, got_addrs := range importer.imported_funcs {
+			// the first object in the search order defines the function
+			for _, definer := range elf_objects {
+				sym, ok := definer.defined_funcs[func_name]
+				if !ok {
+					continue
+				}
+				addr := definer.bias + sym.Value
+				if elf.ST_TYPE(sym.Info) == STT_GNU_IFUNC {
+					// sym.Value is the resolver of the indirect function, so use the GOT entry
+					// resolved by the dynamic loader (BIND_NOW) or the PLT entry of the importer (lazy binding) instead.
+					addr = resolvedGOTEntry(pid, got_addrs, definer)
+					if addr == 0 {
+						addr = importer.plt_entries[func_name]
+					}
+					if addr == 0 {
+						log.Logger.Infof("cannot hook the indirect function %v of %v.", func_name, definer.path)
+						break
+					}
+				}
+				if _, planted := proc.breakpoints[addr]; planted {
+					break
+				}
+				orig_insn, err := pokeBreakpoint(pid, addr)
+				if err != nil {
+					log.Logger.Infof("cannot plant the breakpoint on %v of %v: %v", func_name, definer.path, err)
+					break
+				}
+				proc.breakpoints[addr] = &breakpoint{library: tracer.libraryName(definer.path), symbol: func_name, orig_insn: orig_insn}
+				break
+			}
+		}
+	}
+
+	if proc.debug_state != 0 {
+		return nil
+	}
+	for _, elf_object := range elf_objects {
+		sym, ok := elf_object.defined_funcs[DEBUG_STATE_FUNC]
+		if !ok {
+			continue
+		}
+		addr := elf_object.bias + sym.Value
+		if _, planted := proc.breakpoints[addr]; !planted {
+			orig_insn, err := pokeBreakpoint(pid, addr)
+			if err != nil {
+				log.Logger.Infof("cannot plant the breakpoint on %v of %v: %v", DEBUG_STATE_FUNC, elf_object.path, err)
+				break
+			}
+			proc.breakpoints[addr] = &breakpoint{library: tracer.libraryName(elf_object.path), symbol: DEBUG_STATE_FUNC, orig_insn: orig_insn}
+		}
+		proc.debug_state = addr
+		break
+	}
+
+	return nil
+}
+
+// get the GOT entry which points to the function in the definer object
+func resolvedGOTEntry(pid int, got_addrs []uint64, definer *elfObject) uint64 {
+	for _, got_addr := range got_addrs {
+		data := make([]byte, 8)
+		if _, err := syscall.PtracePeekData(pid, uintptr(got_addr), data); err != nil {
+			continue
+		}
+		addr := binary.LittleEndian.Uint64(data)
+		if definer.start <= addr && addr < definer.end {
+			return addr
+		}
+	}
+	return 0
+}
+
+// write the breakpoint instruction and return the original instruction
+func pokeBreakpoint(pid int, addr uint64) ([]byte, error) {
+	orig_insn := make([]byte, len(breakpoint_insn))
+	if _, err := syscall.PtracePeekData(pid, uintptr(addr), orig_insn); err != nil {
+		return nil, err
+	}
+	if _, err := syscall.PtracePokeData(pid, uintptr(addr), breakpoint_insn); err != nil {
+		return nil, err
+	}
+	return orig_insn, nil
+}
+
+// get the ELF objects from /proc/<pid>/maps in the symbol search order. the paths are the host paths.
+// ex.) 7f0e4c828000-7f0e4c850000 r--p 00000000 08:01 1835 /usr/lib/x86_64-linux-gnu/libc.so.6
+func loadedObjects(pid int, root string) ([]*elfObject, error) {
+
+	maps, err := os.ReadFile(fmt.Sprintf("/proc/%d/maps", pid))
+	if err != nil {
+		return nil, err
+	}
+
+	object_map := map[string]*elfObject{}
+	scanner := bufio.NewScanner(bytes.NewReader(maps))
+	for scanner.Scan() {
+		tokens := strings.Fields(scanner.Text())
+		if len(tokens) < 6 || !strings.HasPrefix(tokens[5], "/") {
+			continue
+		}
+		path := tokens[5]
+		addrs := strings.Split(tokens[0], "-")
+		start, err := strconv.ParseUint(addrs[0], 16, 64)
+		if err != nil {
+			continue
+		}
+		end, err := strconv.ParseUint(addrs[1], 16, 64)
+		if err != nil {
+			continue
+		}
+		offset, err := strconv.ParseUint(tokens[2], 16, 64)
+		if err != nil {
+			continue
+		}
+		elf_object, ok := object_map[path]
+		if !ok {
+			elf_object = &elfObject{path: path, start: start, end: end}
+			object_map[path] = elf_object
+		}
+		if start < elf_object.start {
+			elf_object.start = start
+		}
+		if end > elf_object.end {
+			elf_object.end = end
+		}
+		if offset == 0 && (elf_object.base == 0 || start < elf_object.base) {
+			elf_object.base = start
+		}
+	}
+
+	exe_path, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid))
+	if err != nil {
+		return nil, err
+	}
+
+	elf_objects := []*elfObject{}
+	interp_path := ""
+	for _, elf_object := range object_map {
+		f, err := elf.Open(elf_object.path)
+		// not ELF (ex. locale-archive)
+		if err != nil {
+			continue
+		}
+		if err := elf_object.load(f); err != nil {
+			f.Close()
+			continue
+		}
+		if strings.Compare(elf_object.path, exe_path) == 0 {
+			for _, prog := range f.Progs {
+				if prog.Type == elf.PT_INTERP {
+					interp, err := io.ReadAll(prog.Open())
+					if err == nil {
+						interp_path = hostPath(root, strings.TrimRight(string(interp), "\x00"))
+					}
+				}
+			}
+		}
+		f.Close()
+		elf_objects = append(elf_objects, elf_object)
+	}
+
+	// the executable first, the dynamic loader last, and the libraries in the loaded order.
+	// the dynamic loader maps the libraries downward, so the loaded order is the descending order of address.
+	rank := func(elf_object *elfObject) int {
+		switch elf_object.path {
+		case exe_path:
+			return 0
+		case interp_path:
+			return 2
+		}
+		return 1
+	}
+	sort.Slice(elf_objects, func(i, j int) bool {
+		if rank(elf_objects[i]) != rank(elf_objects[j]) {
+			return rank(elf_objects[i]) < rank(elf_objects[j])
+		}
+		return elf_objects[i].base > elf_objects[j].base
+	})
+
+	return elf_objects, nil
+}
+
+// read the dynamic symbols and GOT entries of the ELF object
+func (elf_object *elfObject) load(f *elf.File) error {
+
+	if f.Class != elf.ELFCLASS64 {
+		return xerrors.Errorf("only 64-bit ELF is supported: %v\n", elf_object.path)
+	}
+
+	// load bias = mapped address - virtual address of the first PT_LOAD
+	for _, prog := range f.Progs {
+		if prog.Type == elf.PT_LOAD {
+			elf_object.bias = elf_object.base - (prog.Vaddr &^ PAGE_MASK)
+			break
+		}
+	}
+
+	syms, err := f.DynamicSymbols()
+	if err != nil {
+		return err
+	}
+
+	elf_object.defined_funcs = map[string]elf.Symbol{}
+	elf_object.imported_funcs = map[string][]uint64{}
+	for _, sym := range syms {
+		sym_type := elf.ST_TYPE(sym.Info)
+		if sym.Section == elf.SHN_UNDEF {
+			if sym_type == elf.STT_FUNC || sym_type == elf.STT_NOTYPE {
+				elf_object.imported_funcs[sym.Name] = []uint64{}
+			}
+			continue
+		}
+		if (sym_type == elf.STT_FUNC || sym_type == STT_GNU_IFUNC) && sym.Value != 0 {
+			elf_object.defined_funcs[sym.Name] = sym
+		}
+	}
+	delete(elf_object.imported_funcs, "")
+
+	// the PLT entries are placed in the order of .rela.plt
+	elf_object.plt_entries = map[string]uint64{}
+	plt_section := f.Section(".plt.sec")
+	plt_sec := plt_section != nil
+	if !plt_sec {
+		plt_section = f.Section(".plt")
+	}
+
+	// GOT entries of imported functions
+	for _, section := range f.Sections {
+		if section.Type != elf.SHT_RELA {
+			continue
+		}
+		data, err := section.Data()
+		if err != nil {
+			continue
+		}
+		for i := 0; i+24 <= len(data); i += 24 {
+			if strings.Compare(section.Name, ".rela.plt") == 0 && plt_section != nil {
+				sym_id := int(elf.R_SYM64(f.ByteOrder.Uint64(data[i+8:])))
+				if sym_id > 0 && sym_id <= len(syms) {
+					elf_object.plt_entries[syms[sym_id-1].Name] = elf_object.bias + pltEntryAddr(plt_section.Addr, plt_sec, i/24)
+				}
+			}
+			r_offset := f.ByteOrder.Uint64(data[i:])
+			r_info := f.ByteOrder.Uint64(data[i+8:])
+			sym_id := int(elf.R_SYM64(r_info))
+			if !gotRelocation(elf.R_TYPE64(r_info)) || sym_id == 0 || sym_id > len(syms) {
+				continue
+			}
+			// DynamicSymbols omits the null symbol of index 0
+			func_name := syms[sym_id-1].Name
+			if got_addrs, ok := elf_object.imported_funcs[func_name]; ok {
+				elf_object.imported_funcs[func_name] = append(got_addrs, elf_object.bias+r_offset)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,36 @@
+package tracer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	uutil "github.com/yomaytk/go_ltrace/util"
+)
+
+// run the target in the chroot of root. the user except root chroots in the new user namespace, where
+// the user is mapped to itself, so that the target runs with the same uid and gid.
+func chrootAttr(root string) *syscall.SysProcAttr {
+	attr := &syscall.SysProcAttr{Ptrace: true, Chroot: root}
+	if os.Geteuid() != 0 {
+		attr.Cloneflags = syscall.CLONE_NEWUSER
+		attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: os.Geteuid(), HostID: os.Geteuid(), Size: 1}}
+		attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getegid(), HostID: os.Getegid(), Size: 1}}
+		attr.GidMappingsEnableSetgroups = false
+	}
+	return attr
+}
+
+// the resolved host path of the path in the root ("" if it cannot be resolved)
+func hostPath(root string, path string) string {
+	if strings.Compare(root, "") == 0 {
+		real_path, _ := filepath.EvalSymlinks(path)
+		return real_path
+	}
+	host_path, err := uutil.RootPath(root, path)
+	if err != nil {
+		return ""
+	}
+	return host_path
+}
@@ -0,0 +1,51 @@
+package tracer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGuestPath(t *testing.T) {
+
+	tracer := NewTracer()
+	if path := tracer.guestPath("/srv/rootfs/usr/lib/libc.so.6"); strings.Compare(path, "/srv/rootfs/usr/lib/libc.so.6") != 0 {
+		t.Errorf("the host path is translated without the root: %v", path)
+	}
+
+	tracer.Root = "/srv/rootfs"
+	paths := map[string]string{
+		"/srv/rootfs/usr/lib/libc.so.6": "/usr/lib/libc.so.6",
+		"/srv/rootfs":                   "/",
+		"/srv/rootfs2/lib/libc.so.6":    "/srv/rootfs2/lib/libc.so.6",
+		"/opt/bind/libfoo.so":           "/opt/bind/libfoo.so",
+	}
+	for host_path, expected := range paths {
+		if path := tracer.guestPath(host_path); strings.Compare(path, expected) != 0 {
+			t.Errorf("guestPath(%v) = %v, expected %v", host_path, path, expected)
+		}
+	}
+}
+
+func TestHostPath(t *testing.T) {
+
+	// /lib64/ld-linux-x86-64.so.2 -> /usr/lib/ld.so in the root
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "usr/lib"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "usr/lib/ld.so"), []byte{}, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("usr/lib", filepath.Join(root, "lib64")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("/usr/lib/ld.so", filepath.Join(root, "usr/lib/ld-linux-x86-64.so.2")); err != nil {
+		t.Fatal(err)
+	}
+
+	if path := hostPath(root, "/lib64/ld-linux-x86-64.so.2"); strings.Compare(path, filepath.Join(root, "usr/lib/ld.so")) != 0 {
+		t.Errorf("hostPath() = %v, expected %v", path, filepath.Join(root, "usr/lib/ld.so"))
+	}
+}
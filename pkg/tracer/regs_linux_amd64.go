@@ -0,0 +1,49 @@
+package tracer
+
+import (
+	"debug/elf"
+	"syscall"
+)
+
+func syscallNumber(regs *syscall.PtraceRegs) uint64 {
+	return regs.Orig_rax
+}
+
+func syscallArgs(regs *syscall.PtraceRegs) [6]uint64 {
+	return [6]uint64{regs.Rdi, regs.Rsi, regs.Rdx, regs.R10, regs.R8, regs.R9}
+}
+
+func syscallReturn(regs *syscall.PtraceRegs) int64 {
+	return int64(regs.Rax)
+}
+
+// get the directory fd and the address of the file path if the system call opens a file
+func openArgs(syscall_no uint64, args [6]uint64) (int, uint64, bool) {
+	switch syscall_no {
+	case syscall.SYS_OPEN:
+		return AT_FDCWD, args[0], true
+	case syscall.SYS_OPENAT:
+		return int(int32(args[0])), args[1], true
+	}
+	return 0, 0, false
+}
+
+// int3
+var breakpoint_insn = []byte{0xcc}
+
+// the program counter points to the next of int3 after the trap
+const BREAKPOINT_PC_OFFSET = 1
+
+// relocation types of the GOT entries for functions
+func gotRelocation(r_type uint32) bool {
+	return elf.R_X86_64(r_type) == elf.R_X86_64_JMP_SLOT || elf.R_X86_64(r_type) == elf.R_X86_64_GLOB_DAT
+}
+
+// the address of the PLT entry for the index-th relocation of .rela.plt.
+// .plt.sec (IBT) doesn't have the header entry of .plt.
+func pltEntryAddr(plt_addr uint64, plt_sec bool, index int) uint64 {
+	if plt_sec {
+		return plt_addr + 16*uint64(index)
+	}
+	return plt_addr + 16*uint64(index+1)
+}
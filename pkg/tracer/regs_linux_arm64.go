@@ -0,0 +1,45 @@
+package tracer
+
+import (
+	"debug/elf"
+	"syscall"
+)
+
+func syscallNumber(regs *syscall.PtraceRegs) uint64 {
+	return regs.Regs[8]
+}
+
+// x0 is overwritten by the return value, so the arguments must be read at syscall-enter-stop
+func syscallArgs(regs *syscall.PtraceRegs) [6]uint64 {
+	return [6]uint64{regs.Regs[0], regs.Regs[1], regs.Regs[2], regs.Regs[3], regs.Regs[4], regs.Regs[5]}
+}
+
+func syscallReturn(regs *syscall.PtraceRegs) int64 {
+	return int64(regs.Regs[0])
+}
+
+// get the directory fd and the address of the file path if the system call opens a file
+// (arm64 doesn't have open system call)
+func openArgs(syscall_no uint64, args [6]uint64) (int, uint64, bool) {
+	if syscall_no == syscall.SYS_OPENAT {
+		return int(int32(args[0])), args[1], true
+	}
+	return 0, 0, false
+}
+
+// brk #0
+var breakpoint_insn = []byte{0x00, 0x00, 0x20, 0xd4}
+
+// the program counter points to brk itself after the trap
+const BREAKPOINT_PC_OFFSET = 0
+
+// relocation types of the GOT entries for functions
+func gotRelocation(r_type uint32) bool {
+	return elf.R_AARCH64(r_type) == elf.R_AARCH64_JUMP_SLOT || elf.R_AARCH64(r_type) == elf.R_AARCH64_GLOB_DAT
+}
+
+// the address of the PLT entry for the index-th relocation of .rela.plt.
+// the PLT header is 32 bytes and every entry is 16 bytes (BTI/PAC PLT is not supported).
+func pltEntryAddr(plt_addr uint64, plt_sec bool, index int) uint64 {
+	return plt_addr + 32 + 16*uint64(index)
+}
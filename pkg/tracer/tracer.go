@@ -0,0 +1,362 @@
+// Package tracer follows the target process tree with ptrace(2) and records the shared objects
+// it loads. linux/amd64 and linux/arm64 are supported.
+package tracer
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"syscall"
+
+	log "github.com/yomaytk/go_ltrace/log"
+	"golang.org/x/xerrors"
+)
+
+const (
+	AT_FDCWD          = -100
+	PTRACE_O_EXITKILL = 0x100000
+	// the stop signal of syscall-stop with PTRACE_O_TRACESYSGOOD
+	SYSCALL_TRAP = syscall.SIGTRAP | 0x80
+	// the max length of the file path read from the tracee
+	PATH_MAX = 4096
+)
+
+const TraceOptions = syscall.PTRACE_O_TRACESYSGOOD | syscall.PTRACE_O_TRACEFORK | syscall.PTRACE_O_TRACEVFORK |
+	syscall.PTRACE_O_TRACECLONE | syscall.PTRACE_O_TRACEEXEC | PTRACE_O_EXITKILL
+
+// the state of one traced thread
+type task struct {
+	in_syscall bool
+	// the new task stops by SIGSTOP at first, which must not be delivered.
+	initial_stop bool
+	syscall_no   uint64
+	args         [6]uint64
+	// the file mapped by mmap system call under execution
+	mmap_path string
+	// the address space of the task (only for tracing library calls)
+	proc *process
+	// the new task waits for its address space to be known
+	held bool
+	// the signal to be delivered at the next resume
+	pending_sig int
+	// the task attached while running may be in the system call at the first syscall-stop
+	attached bool
+}
+
+// ex.) libc.so.6, libpthread-2.31.so, ld-linux-x86-64.so.2 (not ld.so.cache)
+var shared_object_re = regexp.MustCompile(`\.so(\.[0-9]+)*$`)
+
+type Tracer struct {
+	LibMap map[string]bool
+	// the target runs in the chroot of Root ("" is the host), and LibMap has the paths in Root
+	Root  string
+	tasks map[int]*task
+	// key: the resolved path of opened file, value: the path opened by the tracee
+	opened_map  map[string]string
+	trace_calls bool
+	call_count  map[callKey]int
+}
+
+func NewTracer() *Tracer {
+	return &Tracer{LibMap: map[string]bool{}, tasks: map[int]*task{}, opened_map: map[string]string{}, call_count: map[callKey]int{}}
+}
+
+// Trace executes the target program under ptrace and returns the shared objects opened or mapped by
+// the program and all of its children.
+func (tracer *Tracer) Trace(trace_target []string) (map[string]bool, error) {
+
+	// every ptrace request must be issued from the thread which attached the tracee
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	cmd := exec.Command(trace_target[0], trace_target[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{Ptrace: true}
+	if strings.Compare(tracer.Root, "") != 0 {
+		// the path of the target is the path in the root, which is not searched in the host
+		cmd = &exec.Cmd{Path: trace_target[0], Args: trace_target, Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr, Dir: "/"}
+		cmd.SysProcAttr = chrootAttr(tracer.Root)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return tracer.LibMap, xerrors.Errorf("failed to start %v: %w", trace_target[0], err)
+	}
+	pid := cmd.Process.Pid
+
+	// the tracee stops by SIGTRAP after execve
+	var ws syscall.WaitStatus
+	if _, err := syscall.Wait4(pid, &ws, syscall.WALL, nil); err != nil {
+		return tracer.LibMap, xerrors.Errorf("failed to wait %v: %w", pid, err)
+	}
+	if !ws.Stopped() {
+		return tracer.LibMap, xerrors.Errorf("Bug: the tracee %v doesn't stop after execve.\n", pid)
+	}
+	if err := syscall.PtraceSetOptions(pid, TraceOptions); err != nil {
+		return tracer.LibMap, xerrors.Errorf("failed to set ptrace options: %w", err)
+	}
+	tracer.tasks[pid] = &task{}
+
+	if tracer.trace_calls {
+		tracer.tasks[pid].proc = newProcess()
+		if err := tracer.plantEntry(pid, tracer.tasks[pid].proc); err != nil {
+			return tracer.LibMap, xerrors.Errorf("failed to plant the entry breakpoint: %w", err)
+		}
+	}
+
+	if err := tracer.loop(map[int]int{pid: 0}, nil); err != nil {
+		return tracer.LibMap, err
+	}
+
+	return tracer.LibMap, nil
+}
+
+// resume the stopped tasks (key: task, value: the signal to be delivered) until every task exits or the stop is requested
+func (tracer *Tracer) loop(start map[int]int, stop *stopRequest) error {
+
+	for pid, sig := range start {
+		if err := syscall.PtraceSyscall(pid, sig); err != nil && err != syscall.ESRCH {
+			return xerrors.Errorf("failed to resume %v: %w", pid, err)
+		}
+	}
+
+	for len(tracer.tasks) > 0 {
+
+		if stop != nil && stop.requested() {
+			return nil
+		}
+
+		var ws syscall.WaitStatus
+		wpid, err := waitTracees(&ws, stop)
+		if err == syscall.EINTR || (err == nil && wpid == 0) {
+			continue
+		}
+		// the tasks which disappeared by execve of another thread don't report the exit
+		if err == syscall.ECHILD {
+			return nil
+		}
+		if err != nil {
+			return xerrors.Errorf("failed to wait tracees: %w", err)
+		}
+
+		if ws.Exited() || ws.Signaled() {
+			delete(tracer.tasks, wpid)
+			continue
+		}
+		if !ws.Stopped() {
+			continue
+		}
+
+		// the child created by fork/clone may report its stop before the event of its parent
+		t, ok := tracer.tasks[wpid]
+		if !ok {
+			t = &task{initial_stop: true}
+			tracer.tasks[wpid] = t
+		}
+
+		sig, resume := tracer.handleStop(wpid, t, ws)
+		if !resume {
+			continue
+		}
+		if err := syscall.PtraceSyscall(wpid, sig); err != nil && err != syscall.ESRCH {
+			return xerrors.Errorf("failed to resume %v: %w", wpid, err)
+		}
+	}
+
+	return nil
+}
+
+// handle the stopped task and return the signal to be delivered and whether the task is resumed
+func (tracer *Tracer) handleStop(pid int, t *task, ws syscall.WaitStatus) (int, bool) {
+
+	sig := ws.StopSignal()
+
+	switch {
+	case t.initial_stop && (sig == syscall.SIGSTOP || ws.TrapCause() == PTRACE_EVENT_STOP):
+		// the new task of the seized tracee stops by PTRACE_EVENT_STOP instead of SIGSTOP
+		t.initial_stop = false
+		// wait for the event of the parent to know the breakpoints in the address space
+		if tracer.trace_calls && t.proc == nil {
+			t.held = true
+			return 0, false
+		}
+		return 0, true
+	case sig == SYSCALL_TRAP:
+		tracer.handleSyscall(pid, t)
+		return 0, true
+	case sig == syscall.SIGTRAP && ws.TrapCause() > 0:
+		// ptrace event stop (fork, vfork, clone, exec, PTRACE_INTERRUPT)
+		switch event := ws.TrapCause(); event {
+		case syscall.PTRACE_EVENT_FORK, syscall.PTRACE_EVENT_VFORK, syscall.PTRACE_EVENT_CLONE:
+			new_pid, err := syscall.PtraceGetEventMsg(pid)
+			if err != nil {
+				log.Logger.Infoln("failed to get the new task of", pid, err)
+				break
+			}
+			new_t, ok := tracer.tasks[int(new_pid)]
+			if !ok {
+				new_t = &task{initial_stop: true}
+				tracer.tasks[int(new_pid)] = new_t
+			}
+			if tracer.trace_calls && t.proc != nil {
+				// the threads and the vfork child share the address space
+				if event == syscall.PTRACE_EVENT_FORK {
+					new_t.proc = t.proc.copy()
+				} else {
+					new_t.proc = t.proc
+				}
+				if new_t.held {
+					new_t.held = false
+					if err := syscall.PtraceSyscall(int(new_pid), 0); err != nil {
+						log.Logger.Infoln("failed to resume", new_pid, err)
+					}
+				}
+			}
+		case syscall.PTRACE_EVENT_EXEC:
+			if tracer.trace_calls {
+				t.proc = newProcess()
+				if err := tracer.plantEntry(pid, t.proc); err != nil {
+					log.Logger.Infoln("failed to plant the entry breakpoint of", pid, err)
+				}
+			}
+		}
+		return 0, true
+	case sig == syscall.SIGTRAP && tracer.trace_calls && t.proc != nil:
+		handled, err := tracer.handleBreakpoint(pid, t)
+		if err != nil {
+			log.Logger.Infoln("failed to handle the breakpoint of", pid, err)
+		}
+		if handled {
+			pending_sig := t.pending_sig
+			t.pending_sig = 0
+			return pending_sig, true
+		}
+		return int(sig), true
+	default:
+		// signal-delivery-stop
+		return int(sig), true
+	}
+}
+
+func (tracer *Tracer) handleSyscall(pid int, t *task) {
+
+	var regs syscall.PtraceRegs
+	if err := syscall.PtraceGetRegs(pid, &regs); err != nil {
+		log.Logger.Infoln("failed to get registers of", pid, err)
+		t.in_syscall = !t.in_syscall
+		return
+	}
+
+	// the first syscall-stop of the attached task may be syscall-exit-stop
+	if t.attached {
+		t.attached = false
+		if syscallExitStop(pid) {
+			return
+		}
+	}
+
+	// syscall-enter-stop
+	if !t.in_syscall {
+		t.in_syscall = true
+		t.syscall_no = syscallNumber(&regs)
+		t.args = syscallArgs(&regs)
+		t.mmap_path = ""
+		// the fd of mmap may be closed by another thread before the syscall-exit-stop
+		if t.syscall_no == syscall.SYS_MMAP && t.args[2]&syscall.PROT_EXEC != 0 && int32(t.args[4]) >= 0 {
+			// the host path (the key of opened_map)
+			if path, err := os.Readlink(fmt.Sprintf("/proc/%d/fd/%d", pid, int32(t.args[4]))); err == nil {
+				t.mmap_path = path
+			}
+		}
+		return
+	}
+
+	// syscall-exit-stop
+	t.in_syscall = false
+	ret := syscallReturn(&regs)
+	// -4095 ~ -1 is errno
+	if ret < 0 && ret > -4096 {
+		return
+	}
+
+	if t.syscall_no == syscall.SYS_MMAP {
+		if _, opened := tracer.opened_map[t.mmap_path]; strings.Compare(t.mmap_path, "") != 0 && !opened {
+			tracer.record(tracer.guestPath(t.mmap_path))
+		}
+		return
+	}
+
+	if dirfd, path_addr, ok := openArgs(t.syscall_no, t.args); ok {
+		path, err := readString(pid, path_addr)
+		if err != nil {
+			log.Logger.Infoln("failed to read the file path of", pid, err)
+			return
+		}
+		if !filepath.IsAbs(path) {
+			// relative path from the current directory or dirfd
+			dir_link := fmt.Sprintf("/proc/%d/cwd", pid)
+			if dirfd != AT_FDCWD {
+				dir_link = fmt.Sprintf("/proc/%d/fd/%d", pid, dirfd)
+			}
+			dir, err := os.Readlink(dir_link)
+			if err != nil {
+				return
+			}
+			path = filepath.Join(tracer.guestPath(dir), path)
+		}
+		if tracer.record(path) {
+			// the returned fd refers to the opened file
+			if opened_path, err := os.Readlink(fmt.Sprintf("/proc/%d/fd/%d", pid, ret)); err == nil {
+				tracer.opened_map[opened_path] = path
+			}
+		}
+	}
+}
+
+// the path in the root of the host path read from /proc. the tracee in the chroot opens the path in the root,
+// but /proc/<pid>/{fd,cwd,maps} show the path from the root of the tracer.
+func (tracer *Tracer) guestPath(path string) string {
+	if strings.Compare(tracer.Root, "") == 0 {
+		return path
+	}
+	if strings.Compare(path, tracer.Root) == 0 {
+		return "/"
+	}
+	if strings.HasPrefix(path, tracer.Root+"/") {
+		return strings.TrimPrefix(path, tracer.Root)
+	}
+	// outside of the root (ex. bind mount)
+	return path
+}
+
+// record only shared objects
+func (tracer *Tracer) record(path string) bool {
+	if !shared_object_re.MatchString(filepath.Base(path)) {
+		return false
+	}
+	tracer.LibMap[path] = true
+	return true
+}
+
+// read the NUL terminated string from the tracee memory
+func readString(pid int, addr uint64) (string, error) {
+	var buf bytes.Buffer
+	word := make([]byte, 8)
+	for buf.Len() < PATH_MAX {
+		if _, err := syscall.PtracePeekData(pid, uintptr(addr)+uintptr(buf.Len()), word); err != nil {
+			return "", err
+		}
+		if nul_id := bytes.IndexByte(word, 0); nul_id != -1 {
+			buf.Write(word[:nul_id])
+			return buf.String(), nil
+		}
+		buf.Write(word)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,123 @@
+package tracer
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	log "github.com/yomaytk/go_ltrace/log"
+)
+
+// the small dynamically linked program
+func dynamicTarget(t *testing.T) string {
+	path, err := exec.LookPath("true")
+	if err != nil {
+		t.Skip(err)
+	}
+	return path
+}
+
+func TestTrace(t *testing.T) {
+
+	log.InitLogger("")
+
+	lib_map, err := NewTracer().Trace([]string{dynamicTarget(t)})
+	if errors.Is(err, syscall.EPERM) {
+		t.Skip("ptrace is not permitted:", err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := false
+	for lib := range lib_map {
+		found = found || filepath.Base(lib) == "libc.so.6"
+	}
+	if !found {
+		t.Errorf("libc.so.6 is not recorded: %v", lib_map)
+	}
+}
+
+// the library loaded by dlopen calls getpid, which neither the program nor the libraries loaded at startup import
+const (
+	DLOPEN_LIB_SRC = `#include <unistd.h>
+int hook(void) { return getpid(); }
+`
+	DLOPEN_PROG_SRC = `#include <dlfcn.h>
+int main(int argc, char **argv) {
+	void *handle = dlopen(argv[1], RTLD_NOW);
+	if (!handle) return 1;
+	int (*hook)(void) = (int (*)(void))dlsym(handle, "hook");
+	if (!hook) return 1;
+	hook();
+	return 0;
+}
+`
+)
+
+func traceCalls(t *testing.T, trace_target []string) []CallEvent {
+	tracer := NewCallTracer()
+	_, err := tracer.Trace(trace_target)
+	if errors.Is(err, syscall.EPERM) {
+		t.Skip("ptrace is not permitted:", err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tracer.CallEvents()
+}
+
+func calledFunc(call_events []CallEvent, library string, symbol string) bool {
+	for _, call_event := range call_events {
+		if strings.Compare(filepath.Base(call_event.Library), library) == 0 && strings.Compare(call_event.Symbol, symbol) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func TestTraceCalls(t *testing.T) {
+
+	log.InitLogger("")
+
+	// _start of the program calls __libc_start_main of libc
+	call_events := traceCalls(t, []string{dynamicTarget(t)})
+	if !calledFunc(call_events, "libc.so.6", "__libc_start_main") {
+		t.Errorf("unexpected call events: %v", call_events)
+	}
+}
+
+func TestTraceDlopenCalls(t *testing.T) {
+
+	log.InitLogger("")
+
+	cc, err := exec.LookPath("gcc")
+	if err != nil {
+		t.Skip(err)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "hook.c"), []byte(DLOPEN_LIB_SRC), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "main.c"), []byte(DLOPEN_PROG_SRC), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command(cc, "-shared", "-fPIC", "-o", filepath.Join(dir, "libhook.so"), filepath.Join(dir, "hook.c")).CombinedOutput(); err != nil {
+		t.Fatalf("failed to build libhook.so: %v\n%s", err, out)
+	}
+	if out, err := exec.Command(cc, "-o", filepath.Join(dir, "main"), filepath.Join(dir, "main.c"), "-ldl").CombinedOutput(); err != nil {
+		t.Fatalf("failed to build main: %v\n%s", err, out)
+	}
+
+	call_events := traceCalls(t, []string{filepath.Join(dir, "main"), filepath.Join(dir, "libhook.so")})
+	if !calledFunc(call_events, "libc.so.6", "getpid") {
+		t.Errorf("the call of the dlopen'd library is not hooked: %v", call_events)
+	}
+	if calledFunc(call_events, "ld-linux-x86-64.so.2", DEBUG_STATE_FUNC) {
+		t.Errorf("unexpected call events: %v", call_events)
+	}
+}
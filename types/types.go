@@ -20,5 +20,11 @@ type NvdData struct {
 type PackageDetail struct {
 	Binaryp string `json:"binaryp"`
 	Sourcep string `json:"sourcep"`
+	// the installed version of the binary package
 	Version string `json:"version"`
+	// the version of the source package which the binary package is built from
+	SourceVersion string `json:"source_version"`
+	Arch          string `json:"arch"`
+	// the ecosystem of the language package ("" is the dpkg package of the distro). ex.) PyPI, npm, Go
+	Ecosystem string `json:"ecosystem,omitempty"`
 }
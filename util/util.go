@@ -1,9 +1,103 @@
 package util
 
-import "log"
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
 
-func ErrFatal(err error) {
+	"golang.org/x/xerrors"
+)
+
+// the max number of symbolic links followed by one lookup (same as Linux)
+const MAX_SYMLINKS = 40
+
+// the PATH of the root directory which doesn't set it (same as docker)
+const DEFAULT_PATH = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// RootPath returns the host path of the path in the root directory.
+// the symbolic links are resolved in the root, so that the absolute link (ex. /lib -> /usr/lib) doesn't escape it.
+func RootPath(root string, path string) (string, error) {
+
+	if strings.Compare(root, "") == 0 || strings.Compare(root, "/") == 0 {
+		return path, nil
+	}
+
+	resolved := "/"
+	rest := strings.Split(filepath.Clean("/"+path), "/")
+	links := 0
+
+	for len(rest) > 0 {
+		component := rest[0]
+		rest = rest[1:]
+		if strings.Compare(component, "") == 0 || strings.Compare(component, ".") == 0 {
+			continue
+		}
+		if strings.Compare(component, "..") == 0 {
+			resolved = filepath.Dir(resolved)
+			continue
+		}
+
+		next := filepath.Join(resolved, component)
+		fi, err := os.Lstat(filepath.Join(root, next))
+		if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+			// the rest of the path doesn't exist or the component is not a link
+			resolved = next
+			continue
+		}
+
+		links++
+		if links > MAX_SYMLINKS {
+			return "", xerrors.Errorf("too many levels of symbolic links: %v\n", path)
+		}
+		target, err := os.Readlink(filepath.Join(root, next))
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(target) {
+			resolved = "/"
+		}
+		rest = append(strings.Split(target, "/"), rest...)
+	}
+
+	return filepath.Join(root, resolved), nil
+}
+
+// LookPath searches the executable in path_env of the root directory, and returns the path in the root.
+// the name including '/' is relative to working_dir ("" is "/").
+func LookPath(root string, name string, path_env string, working_dir string) (string, error) {
+
+	if strings.Contains(name, "/") {
+		if !filepath.IsAbs(name) {
+			if strings.Compare(working_dir, "") == 0 {
+				working_dir = "/"
+			}
+			name = filepath.Join(working_dir, name)
+		}
+		if !executable(root, name) {
+			return "", xerrors.Errorf("%v is not found in %v: %w", name, root, fs.ErrNotExist)
+		}
+		return name, nil
+	}
+
+	for _, dir := range filepath.SplitList(path_env) {
+		if !filepath.IsAbs(dir) {
+			continue
+		}
+		if candidate := filepath.Join(dir, name); executable(root, candidate) {
+			return candidate, nil
+		}
+	}
+
+	return "", xerrors.Errorf("%v is not found in PATH of %v: %w", name, root, fs.ErrNotExist)
+}
+
+// the regular file with the executable bit in the root
+func executable(root string, path string) bool {
+	host_path, err := RootPath(root, path)
 	if err != nil {
-		log.Fatal(err)
+		return false
 	}
+	fi, err := os.Stat(host_path)
+	return err == nil && fi.Mode().IsRegular() && fi.Mode()&0111 != 0
 }
@@ -0,0 +1,220 @@
+// Package debian builds VulnDB from the Debian Security Tracker. the CVEs are stored as ubuntu.UbuntuCVE in the same
+// bbolt layout as Ubuntu, whose patches are keyed by the Debian release (ex. bookworm@), so that they are queried
+// and evaluated by ubuntu.QueryOperation.
+package debian
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	types "github.com/yomaytk/go_ltrace/vulndb"
+	git "github.com/yomaytk/go_ltrace/vulndb/gitrepo"
+	"github.com/yomaytk/go_ltrace/vulndb/ubuntu"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// the distro of the database, which is shown in the hint of 'db build -distro'
+	DISTRO             = "debian"
+	DEBIAN_TRACKER_URL = "https://salsa.debian.org/security-tracker-team/security-tracker.git"
+	// the JSON export of the Debian Security Tracker
+	DEBIAN_JSON_URL = "https://security-tracker.debian.org/tracker/data/json"
+	// the files of the checkout of the security-tracker repository
+	CVE_LIST_FILE = "data/CVE/list"
+	DSA_LIST_FILE = "data/DSA/list"
+	// the release whose status in data/CVE/list is inherited by the releases without their own status
+	RELEASE_UNSTABLE = "sid"
+	// the JSON export is tens of megabytes
+	DOWNLOAD_TIMEOUT = 10 * time.Minute
+)
+
+// the releases which inherit the status of unstable. the releases written in data/CVE/list are added.
+var inherit_releases = map[string]bool{"jessie": true, "stretch": true, "buster": true, "bullseye": true, "bookworm": true,
+	"trixie": true, "forky": true, "sid": true}
+
+type DebianOperation struct {
+	OsVersion string
+	*DBOperation
+	*ubuntu.QueryOperation
+}
+
+func NewDebianOperation(os_version string, db_path string, tracker_path string, git_operation git.GitOperation) *DebianOperation {
+	qop := ubuntu.NewQueryOperation(os_version, db_path, git_operation)
+	qop.Distro = DISTRO
+	return &DebianOperation{OsVersion: os_version, DBOperation: NewDBOperation(db_path, tracker_path), QueryOperation: qop}
+}
+
+// DBOperation collects the CVEs from the checkout of the security-tracker repository or the JSON export.
+// the CVEs are saved and described by ubuntu.DBOperation.
+type DBOperation struct {
+	*ubuntu.DBOperation
+}
+
+func NewDBOperation(db_path string, tracker_path string) *DBOperation {
+	dop := ubuntu.NewDBOperation(db_path, tracker_path)
+	dop.Distro = DISTRO
+	return &DBOperation{DBOperation: dop}
+}
+
+// the tracker path is the JSON export if it is the file or *.json, otherwise the checkout
+func (dop *DBOperation) jsonExport() bool {
+	if fi, err := os.Stat(dop.TrackerPath); err == nil {
+		return !fi.IsDir()
+	}
+	return strings.HasSuffix(dop.TrackerPath, ".json")
+}
+
+// CollectCVEs parses the Debian Security Tracker. the broken entries are skipped and returned as the failures.
+func (dop *DBOperation) CollectCVEs() ([]types.Failure, error) {
+
+	fmt.Fprintln(os.Stderr, "[+] Collect Debian CVEs Start.")
+
+	var entries map[string]*cveEntry
+	var failures []types.Failure
+	var err error
+	if dop.jsonExport() {
+		entries, failures, err = readJSON(dop.TrackerPath)
+	} else {
+		entries, failures, err = readCheckout(dop.TrackerPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// the releases written in the tracker inherit the status of unstable too
+	releases := map[string]bool{}
+	for release := range inherit_releases {
+		releases[release] = true
+	}
+	for _, entry := range entries {
+		for _, package_entry := range entry.Packages {
+			for release := range package_entry.Releases {
+				releases[release] = true
+			}
+		}
+	}
+
+	cve_ids := make([]string, 0, len(entries))
+	for cve_id := range entries {
+		cve_ids = append(cve_ids, cve_id)
+	}
+	sort.Strings(cve_ids)
+	for _, cve_id := range cve_ids {
+		debian_cve := entries[cve_id].ubuntuCVE(releases)
+		for package_name := range debian_cve.Patches {
+			dop.CVEsForPackage[package_name] = append(dop.CVEsForPackage[package_name], cve_id)
+		}
+		dop.UbuntuCVEs = append(dop.UbuntuCVEs, debian_cve)
+	}
+
+	fmt.Fprintln(os.Stderr, "[-] Collect Debian CVEs End.")
+
+	return failures, nil
+}
+
+func readJSON(path string) (map[string]*cveEntry, []types.Failure, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("cannot read the Debian Security Tracker (run 'db update -distro debian'): %w", err)
+	}
+	defer f.Close()
+	return parseJSON(f)
+}
+
+// data/CVE/list and data/DSA/list (optional) of the checkout
+func readCheckout(path string) (map[string]*cveEntry, []types.Failure, error) {
+
+	f, err := os.Open(filepath.Join(path, CVE_LIST_FILE))
+	if err != nil {
+		return nil, nil, xerrors.Errorf("cannot read the Debian Security Tracker (run 'db update -distro debian'): %w", err)
+	}
+	defer f.Close()
+	entries, failures, err := parseCVEList(f)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dsa_f, err := os.Open(filepath.Join(path, DSA_LIST_FILE))
+	if errors.Is(err, fs.ErrNotExist) {
+		return entries, failures, nil
+	}
+	if err != nil {
+		return nil, nil, xerrors.Errorf("cannot open %v: %w", DSA_LIST_FILE, err)
+	}
+	defer dsa_f.Close()
+	if err := parseDSAList(dsa_f, entries); err != nil {
+		return nil, nil, err
+	}
+
+	return entries, failures, nil
+}
+
+// NewDB builds VulnDB from the Debian Security Tracker and returns the entries which cannot be parsed.
+func (dop *DBOperation) NewDB() ([]types.Failure, error) {
+
+	fmt.Fprintln(os.Stderr, "[+] Debian NewDB Start.")
+
+	failures, err := dop.CollectCVEs()
+	if err != nil {
+		return nil, err
+	}
+	if err := dop.Save(); err != nil {
+		return failures, err
+	}
+
+	fmt.Fprintln(os.Stderr, "[-] Debian NewDB End.")
+
+	return failures, nil
+}
+
+// UpdateSource downloads the JSON export or clones (pulls) the security-tracker repository.
+func (dop *DBOperation) UpdateSource() error {
+	if dop.jsonExport() {
+		return download(DEBIAN_JSON_URL, dop.TrackerPath)
+	}
+	return ubuntu.UpdateCheckout(DEBIAN_TRACKER_URL, dop.TrackerPath)
+}
+
+// download the url to the path. the path is replaced only after the whole body is written.
+func download(target string, path string) error {
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return xerrors.Errorf("cannot create the directory of %v: %w", path, err)
+	}
+
+	client := &http.Client{Timeout: DOWNLOAD_TIMEOUT}
+	res, err := client.Get(target)
+	if err != nil {
+		return xerrors.Errorf("cannot get %v: %w", target, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return xerrors.Errorf("cannot get %v: %v\n", target, res.Status)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return xerrors.Errorf("cannot create the temporary file of %v: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, res.Body); err != nil {
+		tmp.Close()
+		return xerrors.Errorf("cannot download %v: %w", target, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return xerrors.Errorf("cannot write %v: %w", tmp.Name(), err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return xerrors.Errorf("cannot replace %v: %w", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,209 @@
+package debian
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	log "github.com/yomaytk/go_ltrace/log"
+	ttypes "github.com/yomaytk/go_ltrace/types"
+	types "github.com/yomaytk/go_ltrace/vulndb"
+	git "github.com/yomaytk/go_ltrace/vulndb/gitrepo"
+	"github.com/yomaytk/go_ltrace/vulndb/ubuntu"
+)
+
+const SAMPLE_CVE_LIST = `CVE-2023-4911 (A buffer overflow was discovered in the GNU C Library's dynamic loader ...)
+	- glibc 2.37-12 (bug #1053220)
+	[bullseye] - glibc <not-affected> (Vulnerable code introduced later)
+	NOTE: https://www.openwall.com/lists/oss-security/2023/10/03/2
+	NOTE: Fixed by: https://sourceware.org/git/?p=glibc.git;a=commit;h=1056e5b4c3f2d90ed2b4a55f96add28da2f4c8fa
+CVE-2023-4806 (A flaw was found in glibc ...)
+	- glibc <unfixed> (unimportant)
+	[bookworm] - glibc <no-dsa> (Minor issue)
+CVE-2023-5000
+	RESERVED
+CVE-2023-5001 (Not a Debian package)
+	NOT-FOR-US: Foo
+CVE-2023-5002 (broken entry)
+	[bookworm - glibc 1.0
+CVE-2024-XXXX [libfoo issue]
+	- libfoo <unfixed>
+`
+
+const SAMPLE_DSA_LIST = `[03 Oct 2023] DSA-5514-1 glibc - security update
+	{CVE-2023-4527 CVE-2023-4806 CVE-2023-4911}
+	[bookworm] - glibc 2.36-9+deb12u3
+`
+
+const SAMPLE_JSON = `{
+  "glibc": {
+    "CVE-2023-4911": {"description": "buffer overflow", "releases": {
+      "bookworm": {"status": "resolved", "fixed_version": "2.36-9+deb12u3", "urgency": "high"},
+      "bullseye": {"status": "resolved", "fixed_version": "0", "urgency": "not yet assigned"}}},
+    "CVE-2023-4806": {"description": "use after free", "releases": {
+      "bookworm": {"status": "open", "urgency": "low", "nodsa": "Minor issue", "nodsa_reason": ""},
+      "buster": {"status": "open", "urgency": "end-of-life"}}},
+    "TEMP-0000000-ABCDEF": {"releases": {}},
+    "CVE-2023-4527": "broken"
+  }
+}`
+
+func TestParseCVEList(t *testing.T) {
+
+	entries, failures, err := parseCVEList(strings.NewReader(SAMPLE_CVE_LIST))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// RESERVED, NOT-FOR-US and the unassigned CVE are skipped, and the broken entry is the failure
+	if len(entries) != 2 || len(failures) != 1 || strings.Compare(failures[0].CVE, "CVE-2023-5002") != 0 {
+		t.Fatalf("entries = %v, failures = %v", entries, failures)
+	}
+	if err := parseDSAList(strings.NewReader(SAMPLE_DSA_LIST), entries); err != nil {
+		t.Fatal(err)
+	}
+
+	releases := map[string]bool{"bullseye": true, "bookworm": true, "sid": true}
+	tests := []struct {
+		cve_id   string
+		release  string
+		expected ubuntu.SpecificPatchData
+	}{
+		// unstable is inherited by the release without its own status
+		{"CVE-2023-4911", "sid", ubuntu.SpecificPatchData{Affected: ubuntu.STATUS_RELEASED, SubInfo: "(2.37-12)"}},
+		{"CVE-2023-4911", "bullseye", ubuntu.SpecificPatchData{Affected: ubuntu.STATUS_NOT_AFFECTED, SubInfo: "(Vulnerable code introduced later)"}},
+		// the fixed version of DSA
+		{"CVE-2023-4911", "bookworm", ubuntu.SpecificPatchData{Affected: ubuntu.STATUS_RELEASED, SubInfo: "(2.36-9+deb12u3)"}},
+		// DSA doesn't override the status of data/CVE/list
+		{"CVE-2023-4806", "bookworm", ubuntu.SpecificPatchData{Affected: ubuntu.STATUS_IGNORED, SubInfo: "(no-dsa: Minor issue)"}},
+		{"CVE-2023-4806", "bullseye", ubuntu.SpecificPatchData{Affected: ubuntu.STATUS_NEEDED}},
+	}
+	for _, test := range tests {
+		debian_cve := entries[test.cve_id].ubuntuCVE(releases)
+		specific_patch_data := debian_cve.Patches["glibc"].SpecificPatchDatas[ubuntu.NewUbuntuVersion(test.release, "")]
+		if specific_patch_data != test.expected {
+			t.Errorf("%v in %v = %+v, expected %+v", test.cve_id, test.release, specific_patch_data, test.expected)
+		}
+	}
+
+	glibc_cve := entries["CVE-2023-4911"].ubuntuCVE(releases)
+	if urls := glibc_cve.Patches["glibc"].DiffURLs; len(urls) != 1 || !strings.HasSuffix(urls[0], "h=1056e5b4c3f2d90ed2b4a55f96add28da2f4c8fa") {
+		t.Errorf("unexpected patch urls: %v", urls)
+	}
+	if strings.Compare(glibc_cve.References, "DSA-5514-1") != 0 || strings.Compare(glibc_cve.Priority, "untriaged") != 0 {
+		t.Errorf("unexpected CVE: %+v", glibc_cve)
+	}
+	if priority := entries["CVE-2023-4806"].Priority; strings.Compare(priority, "negligible") != 0 {
+		t.Errorf("unexpected priority: %v", priority)
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+
+	entries, failures, err := parseJSON(strings.NewReader(SAMPLE_JSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || len(failures) != 1 || strings.Compare(failures[0].CVE, "CVE-2023-4527") != 0 {
+		t.Fatalf("entries = %v, failures = %v", entries, failures)
+	}
+
+	tests := []struct {
+		cve_id   string
+		release  string
+		expected ubuntu.SpecificPatchData
+	}{
+		{"CVE-2023-4911", "bookworm", ubuntu.SpecificPatchData{Affected: ubuntu.STATUS_RELEASED, SubInfo: "(2.36-9+deb12u3)"}},
+		{"CVE-2023-4911", "bullseye", ubuntu.SpecificPatchData{Affected: ubuntu.STATUS_NOT_AFFECTED}},
+		{"CVE-2023-4806", "bookworm", ubuntu.SpecificPatchData{Affected: ubuntu.STATUS_IGNORED, SubInfo: "(no-dsa: Minor issue)"}},
+		{"CVE-2023-4806", "buster", ubuntu.SpecificPatchData{Affected: ubuntu.STATUS_IGNORED, SubInfo: "(end-of-life)"}},
+	}
+	for _, test := range tests {
+		// the JSON export has no status of unstable to be inherited
+		debian_cve := entries[test.cve_id].ubuntuCVE(inherit_releases)
+		patch_datas := debian_cve.Patches["glibc"].SpecificPatchDatas
+		if specific_patch_data := patch_datas[ubuntu.NewUbuntuVersion(test.release, "")]; specific_patch_data != test.expected {
+			t.Errorf("%v in %v = %+v, expected %+v", test.cve_id, test.release, specific_patch_data, test.expected)
+		}
+		if _, ok := patch_datas[ubuntu.NewUbuntuVersion("trixie", "")]; ok {
+			t.Errorf("%v is tracked for trixie", test.cve_id)
+		}
+	}
+	if priority := entries["CVE-2023-4911"].Priority; strings.Compare(priority, "high") != 0 {
+		t.Errorf("unexpected priority: %v", priority)
+	}
+
+	if _, _, err := parseJSON(strings.NewReader("[]")); err == nil {
+		t.Errorf("the broken JSON export is accepted")
+	}
+}
+
+func TestNewDB(t *testing.T) {
+
+	log.InitLogger("")
+
+	// the checkout of the security-tracker repository
+	tracker_path := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tracker_path, "data/CVE"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tracker_path, CVE_LIST_FILE), []byte(SAMPLE_CVE_LIST), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	db_path := filepath.Join(t.TempDir(), "DebianVulnDB")
+	failures, err := NewDBOperation(db_path, tracker_path).NewDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failures) != 1 {
+		t.Errorf("unexpected failures: %v", failures)
+	}
+
+	// the records are evaluated by ubuntu.QueryOperation (no provider fetches the patch)
+	glibc := ttypes.PackageDetail{Binaryp: "libc6", Sourcep: "glibc", Version: "2.36-9+deb12u1", SourceVersion: "2.36-9+deb12u1"}
+	findings, failures, err := NewDebianOperation("bookworm", db_path, tracker_path, git.ProviderSet{}).GetCVEs(map[ttypes.PackageDetail][]string{glibc: {}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 2 || len(failures) != 0 {
+		t.Fatalf("findings = %v, failures = %v", findings, failures)
+	}
+	for _, finding := range findings {
+		// 2.37-12 of unstable is inherited by bookworm (DSA is not in the checkout)
+		if strings.Compare(finding.CVE.Candidate, "CVE-2023-4911") == 0 && (!finding.Kept() || !strings.Contains(finding.Reason, "fixed in 2.37-12")) {
+			t.Errorf("unexpected finding: %+v", finding)
+		}
+		if strings.Compare(finding.CVE.Candidate, "CVE-2023-4806") == 0 && !finding.Kept() {
+			t.Errorf("unexpected finding: %+v", finding)
+		}
+	}
+
+	// the JSON export is the file
+	json_path := filepath.Join(t.TempDir(), "debian.json")
+	if err := os.WriteFile(json_path, []byte(SAMPLE_JSON), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dop := NewDBOperation(filepath.Join(t.TempDir(), "DebianVulnDB"), json_path)
+	if _, err := dop.NewDB(); err != nil {
+		t.Fatal(err)
+	}
+	info, err := dop.GetDBInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.CVEs != 2 || info.Packages != 1 {
+		t.Errorf("unexpected info: %+v", info)
+	}
+
+	if _, err := NewDBOperation(db_path, t.TempDir()).CollectCVEs(); err == nil {
+		t.Errorf("the missing tracker is accepted")
+	}
+	// the hint of the missing database names the distro
+	missing_path := filepath.Join(t.TempDir(), "DebianVulnDB")
+	if _, _, err := NewDebianOperation("bookworm", missing_path, tracker_path, git.ProviderSet{}).GetCVEs(map[ttypes.PackageDetail][]string{glibc: {}}); err == nil || !strings.Contains(err.Error(), "-distro debian") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+var _ types.Source = (*DebianOperation)(nil)
@@ -0,0 +1,164 @@
+package debian
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/yomaytk/go_ltrace/vulndb/ubuntu"
+)
+
+// the urgency of the Debian Security Tracker and its Ubuntu priority (the order is the severity)
+var urgency_priorities = []struct {
+	urgency  string
+	priority string
+}{
+	{"not yet assigned", "untriaged"},
+	{"unimportant", "negligible"},
+	{"low", "low"},
+	{"medium", "medium"},
+	{"high", "high"},
+}
+
+var url_re = regexp.MustCompile(`https?://[^\s()<>]+`)
+
+// the url of the commit or the patch, which ubuntu.QueryOperation can fetch the fixed files and functions of.
+// ex.) https://github.com/madler/zlib/commit/..., https://sourceware.org/git/?p=glibc.git;a=commit;h=...
+var patch_url_re = regexp.MustCompile(`(/commit/|/commits/|/commit\?|;a=commit|\.patch$|\.diff$)`)
+
+// the CVE of the Debian Security Tracker before it is converted to ubuntu.UbuntuCVE
+type cveEntry struct {
+	ID          string
+	Description string
+	// the Ubuntu priority of the highest urgency
+	Priority string
+	// the advisories. ex.) DSA-5514-1, DLA-3600-1
+	References []string
+	DiffURLs   []string
+	// key: source package
+	Packages map[string]*packageEntry
+}
+
+type packageEntry struct {
+	// the status in unstable, which is inherited by the releases without their own status (nil for the JSON export)
+	Unstable *ubuntu.SpecificPatchData
+	// key: release. ex.) bookworm
+	Releases map[string]ubuntu.SpecificPatchData
+}
+
+func newCVEEntry(cve_id string) *cveEntry {
+	return &cveEntry{ID: cve_id, References: []string{}, DiffURLs: []string{}, Packages: map[string]*packageEntry{}}
+}
+
+func (entry *cveEntry) packageEntry(package_name string) *packageEntry {
+	package_entry, ok := entry.Packages[package_name]
+	if !ok {
+		package_entry = &packageEntry{Releases: map[string]ubuntu.SpecificPatchData{}}
+		entry.Packages[package_name] = package_entry
+	}
+	return package_entry
+}
+
+// raise the priority by the urgency. ex.) "low", "low**", "unimportant"
+func (entry *cveEntry) addUrgency(urgency string) {
+	rank := urgencyRank(urgency)
+	if rank == -1 {
+		return
+	}
+	if current := priorityRank(entry.Priority); rank > current {
+		entry.Priority = urgency_priorities[rank].priority
+	}
+}
+
+func (entry *cveEntry) addReference(reference string) {
+	for _, r := range entry.References {
+		if strings.Compare(r, reference) == 0 {
+			return
+		}
+	}
+	entry.References = append(entry.References, reference)
+}
+
+// add the patch urls in the note
+func (entry *cveEntry) addNote(note string) {
+	for _, diff_url := range url_re.FindAllString(note, -1) {
+		diff_url = strings.TrimRight(diff_url, ".,")
+		if !patch_url_re.MatchString(diff_url) {
+			continue
+		}
+		found := false
+		for _, u := range entry.DiffURLs {
+			found = found || strings.Compare(u, diff_url) == 0
+		}
+		if !found {
+			entry.DiffURLs = append(entry.DiffURLs, diff_url)
+		}
+	}
+}
+
+// ubuntuCVE converts the entry for ubuntu.QueryOperation. the releases without their own status inherit the status of unstable.
+func (entry *cveEntry) ubuntuCVE(releases map[string]bool) ubuntu.UbuntuCVE {
+
+	debian_cve := ubuntu.UbuntuCVE{Patches: map[string]ubuntu.PatchData{}}
+	debian_cve.Candidate = entry.ID
+	debian_cve.Description = entry.Description
+	debian_cve.Priority = entry.Priority
+	if strings.Compare(debian_cve.Priority, "") == 0 {
+		debian_cve.Priority = "untriaged"
+	}
+	debian_cve.References = strings.Join(entry.References, "\n")
+
+	for package_name, package_entry := range entry.Packages {
+		patch_data := ubuntu.PatchData{DiffURLs: entry.DiffURLs, SpecificPatchDatas: map[ubuntu.UbuntuVersion]ubuntu.SpecificPatchData{}}
+		if package_entry.Unstable != nil {
+			for release := range releases {
+				patch_data.SpecificPatchDatas[ubuntu.NewUbuntuVersion(release, "")] = *package_entry.Unstable
+			}
+		}
+		for release, specific_patch_data := range package_entry.Releases {
+			patch_data.SpecificPatchDatas[ubuntu.NewUbuntuVersion(release, "")] = specific_patch_data
+		}
+		debian_cve.Patches[package_name] = patch_data
+	}
+
+	return debian_cve
+}
+
+// the index of urgency_priorities (-1 if the urgency is unknown). the trailing '*' is the confidence of the urgency.
+func urgencyRank(urgency string) int {
+	urgency = strings.TrimRight(strings.TrimSpace(urgency), "*")
+	for rank, urgency_priority := range urgency_priorities {
+		if strings.Compare(urgency_priority.urgency, urgency) == 0 {
+			return rank
+		}
+	}
+	return -1
+}
+
+func priorityRank(priority string) int {
+	for rank, urgency_priority := range urgency_priorities {
+		if strings.Compare(urgency_priority.priority, priority) == 0 {
+			return rank
+		}
+	}
+	return -1
+}
+
+// the status of ubuntu-cve-tracker. ex.) released (2.36-9+deb12u3)
+func released(version string) ubuntu.SpecificPatchData {
+	return ubuntu.SpecificPatchData{Affected: ubuntu.STATUS_RELEASED, SubInfo: "(" + version + ")"}
+}
+
+func withNote(affected string, note string) ubuntu.SpecificPatchData {
+	if strings.Compare(note, "") == 0 {
+		return ubuntu.SpecificPatchData{Affected: affected}
+	}
+	return ubuntu.SpecificPatchData{Affected: affected, SubInfo: "(" + note + ")"}
+}
+
+// the note of no DSA. ex.) no-dsa: Minor issue
+func noDSA(note string) string {
+	if strings.Compare(note, "") == 0 {
+		return "no-dsa"
+	}
+	return "no-dsa: " + note
+}
@@ -0,0 +1,109 @@
+package debian
+
+import (
+	"io"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+
+	types "github.com/yomaytk/go_ltrace/vulndb"
+	"github.com/yomaytk/go_ltrace/vulndb/ubuntu"
+	"golang.org/x/xerrors"
+)
+
+// the status of the package in the release of the JSON export
+const (
+	JSON_STATUS_RESOLVED     = "resolved"
+	JSON_STATUS_OPEN         = "open"
+	JSON_STATUS_UNDETERMINED = "undetermined"
+)
+
+type jsonRelease struct {
+	Status string `json:"status"`
+	// "0" if the release is not affected
+	FixedVersion string `json:"fixed_version"`
+	Urgency      string `json:"urgency"`
+	// the reason why no DSA is issued. ex.) Minor issue
+	NoDSA string `json:"nodsa"`
+	// ex.) ignored, postponed
+	NoDSAReason string `json:"nodsa_reason"`
+}
+
+type jsonCVE struct {
+	Description string `json:"description"`
+	// key: release. ex.) bookworm
+	Releases map[string]jsonRelease `json:"releases"`
+}
+
+// the status of ubuntu-cve-tracker for the release
+func (release jsonRelease) status() ubuntu.SpecificPatchData {
+	switch release.Status {
+	case JSON_STATUS_RESOLVED:
+		if strings.Compare(release.FixedVersion, "0") == 0 {
+			return withNote(ubuntu.STATUS_NOT_AFFECTED, "")
+		}
+		return released(release.FixedVersion)
+	case JSON_STATUS_OPEN:
+		if strings.Compare(release.Urgency, "end-of-life") == 0 {
+			return withNote(ubuntu.STATUS_IGNORED, "end-of-life")
+		}
+		// the fix is postponed to the point release
+		if strings.Compare(release.NoDSAReason, "postponed") == 0 {
+			return withNote(ubuntu.STATUS_DEFERRED, release.NoDSA)
+		}
+		if strings.Compare(release.NoDSA, "") != 0 {
+			return withNote(ubuntu.STATUS_IGNORED, noDSA(release.NoDSA))
+		}
+		return withNote(ubuntu.STATUS_NEEDED, "")
+	default:
+		return withNote(ubuntu.STATUS_NEEDS_TRIAGE, release.Status)
+	}
+}
+
+// parseJSON parses the JSON export of the Debian Security Tracker. ex.)
+//
+//	{"glibc": {"CVE-2023-4911": {"description": "...", "releases": {"bookworm": {"status": "resolved",
+//		"fixed_version": "2.36-9+deb12u3", "urgency": "high"}}}}}
+//
+// the issues without the CVE id (ex. TEMP-0000000-1A2B3C) are skipped.
+func parseJSON(r io.Reader) (map[string]*cveEntry, []types.Failure, error) {
+
+	json := jsoniter.ConfigCompatibleWithStandardLibrary
+	entries := map[string]*cveEntry{}
+	failures := []types.Failure{}
+
+	// key: source package, value: the raw issues, which are decoded one by one
+	packages := map[string]map[string]jsoniter.RawMessage{}
+	if err := json.NewDecoder(r).Decode(&packages); err != nil {
+		return nil, nil, xerrors.Errorf("cannot decode the Debian Security Tracker: %w", err)
+	}
+
+	for package_name, issues := range packages {
+		for cve_id, data := range issues {
+			if !strings.HasPrefix(cve_id, "CVE-") {
+				continue
+			}
+			var cve jsonCVE
+			if err := json.Unmarshal(data, &cve); err != nil {
+				failures = append(failures, types.NewFailure(package_name, cve_id, xerrors.Errorf("cannot decode the CVE: %w", err)))
+				continue
+			}
+
+			entry, ok := entries[cve_id]
+			if !ok {
+				entry = newCVEEntry(cve_id)
+				entries[cve_id] = entry
+			}
+			if strings.Compare(entry.Description, "") == 0 {
+				entry.Description = cve.Description
+			}
+			package_entry := entry.packageEntry(package_name)
+			for release_name, release := range cve.Releases {
+				package_entry.Releases[release_name] = release.status()
+				entry.addUrgency(release.Urgency)
+			}
+		}
+	}
+
+	return entries, failures, nil
+}
@@ -0,0 +1,259 @@
+package debian
+
+import (
+	"bufio"
+	"io"
+	"strings"
+
+	types "github.com/yomaytk/go_ltrace/vulndb"
+	"github.com/yomaytk/go_ltrace/vulndb/ubuntu"
+	"golang.org/x/xerrors"
+)
+
+// the long description and note lines of the lists
+const MAX_LINE_SIZE = 1024 * 1024
+
+// the entry of the package in the lists. ex.) "[bookworm] - glibc 2.36-9+deb12u3", "- linux <unfixed> (bug #1053220; low)"
+type packageLine struct {
+	// "" is unstable
+	Release string
+	Package string
+	// the fixed version ("" if Tag is set)
+	Version string
+	// ex.) <unfixed>, <not-affected>, <no-dsa>
+	Tag  string
+	Note string
+}
+
+func parsePackageLine(line string) (packageLine, error) {
+
+	package_line := packageLine{}
+	rest := strings.TrimSpace(line)
+	if strings.HasPrefix(rest, "[") {
+		end_id := strings.Index(rest, "]")
+		if end_id == -1 {
+			return package_line, xerrors.Errorf("the release is not closed at '%v'\n", line)
+		}
+		package_line.Release = strings.TrimSpace(rest[1:end_id])
+		rest = strings.TrimSpace(rest[end_id+1:])
+	}
+	if !strings.HasPrefix(rest, "- ") {
+		return package_line, xerrors.Errorf("'- package' is expected at '%v'\n", line)
+	}
+	rest = rest[2:]
+
+	if note_id := strings.Index(rest, "("); note_id != -1 {
+		package_line.Note = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(rest[note_id+1:]), ")"))
+		rest = rest[:note_id]
+	}
+	tokens := strings.Fields(rest)
+	switch len(tokens) {
+	case 0:
+		return package_line, xerrors.Errorf("the package is empty at '%v'\n", line)
+	case 1:
+		// the package without the version is not fixed
+		package_line.Tag = "<unfixed>"
+	case 2:
+		if strings.HasPrefix(tokens[1], "<") {
+			package_line.Tag = tokens[1]
+		} else {
+			package_line.Version = tokens[1]
+		}
+	default:
+		return package_line, xerrors.Errorf("unknown package entry '%v'\n", line)
+	}
+	package_line.Package = tokens[0]
+
+	return package_line, nil
+}
+
+// the status of ubuntu-cve-tracker for the entry
+func (package_line packageLine) status() ubuntu.SpecificPatchData {
+	unstable := strings.Compare(package_line.Release, "") == 0
+	switch package_line.Tag {
+	case "":
+		return released(package_line.Version)
+	case "<unfixed>":
+		return withNote(ubuntu.STATUS_NEEDED, "")
+	case "<not-affected>":
+		return withNote(ubuntu.STATUS_NOT_AFFECTED, package_line.Note)
+	case "<no-dsa>":
+		return withNote(ubuntu.STATUS_IGNORED, noDSA(package_line.Note))
+	case "<ignored>":
+		return withNote(ubuntu.STATUS_IGNORED, package_line.Note)
+	case "<postponed>":
+		return withNote(ubuntu.STATUS_DEFERRED, package_line.Note)
+	case "<end-of-life>":
+		return withNote(ubuntu.STATUS_IGNORED, "end-of-life")
+	case "<itp>":
+		return withNote(ubuntu.STATUS_DNE, "")
+	case "<removed>":
+		// the package removed from unstable may remain in the stable releases
+		if unstable {
+			return withNote(ubuntu.STATUS_NEEDS_TRIAGE, "removed from "+RELEASE_UNSTABLE)
+		}
+		return withNote(ubuntu.STATUS_DNE, "")
+	default:
+		// ex.) <undetermined>
+		return withNote(ubuntu.STATUS_NEEDS_TRIAGE, strings.Trim(package_line.Tag, "<>"))
+	}
+}
+
+// the urgency in the note. ex.) "bug #1053220; low" -> low
+func (package_line packageLine) urgency() string {
+	for _, word := range strings.Split(package_line.Note, ";") {
+		if urgencyRank(word) != -1 {
+			return strings.TrimSpace(word)
+		}
+	}
+	return ""
+}
+
+// parseCVEList parses data/CVE/list. the entries which cannot be parsed are skipped and returned as the failures. ex.)
+//
+//	CVE-2023-4911 (A buffer overflow was discovered in the GNU C Library's dynamic loader ...)
+//		{DSA-5514-1}
+//		- glibc 2.37-12 (bug #1053220)
+//		[bullseye] - glibc <not-affected> (Vulnerable code introduced later)
+//		NOTE: https://sourceware.org/git/?p=glibc.git;a=commit;h=1056e5b4c3f2d90ed2b4a55f96add28da2f4c8fa
+func parseCVEList(r io.Reader) (map[string]*cveEntry, []types.Failure, error) {
+
+	entries := map[string]*cveEntry{}
+	failures := []types.Failure{}
+
+	// the current entry (nil if it is skipped)
+	var entry *cveEntry
+	// the entry is added after its lines are parsed
+	commit := func() {
+		if entry != nil && len(entry.Packages) > 0 {
+			entries[entry.ID] = entry
+		}
+		entry = nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), MAX_LINE_SIZE)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// the header of the entry. ex.) CVE-2023-4911 (A buffer overflow ...)
+		if strings.HasPrefix(line, "CVE-") {
+			commit()
+			fields := strings.Fields(line)
+			// the CVE id is not assigned yet. ex.) CVE-2024-XXXX [fixed bugs]
+			if strings.Contains(fields[0], "XXXX") {
+				continue
+			}
+			entry = newCVEEntry(fields[0])
+			if desc_id := strings.Index(line, "("); desc_id != -1 {
+				entry.Description = strings.TrimSuffix(strings.TrimSpace(line[desc_id+1:]), ")")
+			}
+			continue
+		}
+		if entry == nil || !strings.HasPrefix(line, "\t") && !strings.HasPrefix(line, " ") {
+			continue
+		}
+
+		content := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(content, "RESERVED"), strings.HasPrefix(content, "REJECTED"), strings.HasPrefix(content, "NOT-FOR-US:"):
+			entry = nil
+		case strings.HasPrefix(content, "{"):
+			for _, reference := range strings.Fields(strings.Trim(content, "{}")) {
+				entry.addReference(reference)
+			}
+		case strings.HasPrefix(content, "NOTE:"):
+			entry.addNote(content)
+		case strings.HasPrefix(content, "- "), strings.HasPrefix(content, "["):
+			package_line, err := parsePackageLine(content)
+			if err != nil {
+				failures = append(failures, types.NewFailure("", entry.ID, err))
+				entry = nil
+				continue
+			}
+			package_entry := entry.packageEntry(package_line.Package)
+			status := package_line.status()
+			if strings.Compare(package_line.Release, "") == 0 {
+				package_entry.Unstable = &status
+				entry.addUrgency(package_line.urgency())
+			} else {
+				package_entry.Releases[package_line.Release] = status
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, xerrors.Errorf("cannot read %v: %w", CVE_LIST_FILE, err)
+	}
+	commit()
+
+	return entries, failures, nil
+}
+
+// parseDSAList adds the advisories of data/DSA/list to the CVEs, and the fixed versions to the releases without
+// their own status in data/CVE/list. ex.)
+//
+//	[03 Oct 2023] DSA-5514-1 glibc - security update
+//		{CVE-2023-4527 CVE-2023-4806 CVE-2023-4911}
+//		[bookworm] - glibc 2.36-9+deb12u3
+func parseDSAList(r io.Reader, entries map[string]*cveEntry) error {
+
+	advisory := ""
+	cve_ids := []string{}
+	fixes := []packageLine{}
+	// apply the advisory after its lines are parsed
+	apply := func() {
+		for _, cve_id := range cve_ids {
+			entry, ok := entries[cve_id]
+			if !ok {
+				continue
+			}
+			entry.addReference(advisory)
+			for _, fix := range fixes {
+				package_entry := entry.packageEntry(fix.Package)
+				if _, ok := package_entry.Releases[fix.Release]; !ok {
+					package_entry.Releases[fix.Release] = fix.status()
+				}
+			}
+		}
+		advisory = ""
+		cve_ids = []string{}
+		fixes = []packageLine{}
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), MAX_LINE_SIZE)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// the header of the advisory. ex.) [03 Oct 2023] DSA-5514-1 glibc - security update
+		if strings.HasPrefix(line, "[") {
+			apply()
+			if end_id := strings.Index(line, "]"); end_id != -1 {
+				if fields := strings.Fields(line[end_id+1:]); len(fields) > 0 {
+					advisory = fields[0]
+				}
+			}
+			continue
+		}
+		if strings.Compare(advisory, "") == 0 {
+			continue
+		}
+
+		content := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(content, "{"):
+			cve_ids = append(cve_ids, strings.Fields(strings.Trim(content, "{}"))...)
+		case strings.HasPrefix(content, "["):
+			// the broken entry of the advisory doesn't break the CVEs
+			if fix, err := parsePackageLine(content); err == nil {
+				fixes = append(fixes, fix)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return xerrors.Errorf("cannot read %v: %w", DSA_LIST_FILE, err)
+	}
+	apply()
+
+	return nil
+}
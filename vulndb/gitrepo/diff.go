@@ -0,0 +1,281 @@
+package gitrepo
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/yomaytk/go_ltrace/pkg/language/cscan"
+	"github.com/yomaytk/go_ltrace/pkg/language/goscan"
+	gity "github.com/yomaytk/go_ltrace/vulndb/gitrepo/types"
+	"golang.org/x/xerrors"
+)
+
+// parse the start line of hunk header range. ex.) "-372,7" -> 372, "+1" -> 1
+func parseHunkRange(hunk_range string) (int, error) {
+	start := strings.Split(hunk_range, ",")[0]
+	start_l, err := strconv.Atoi(start[1:])
+	if err != nil {
+		return 0, xerrors.Errorf("Bug: Strange git hunk range '%v' at parseHunkRange.\n", hunk_range)
+	}
+	return start_l, nil
+}
+
+func getFixedLocation(file_diff *FileDiff) ([]DiffLines, error) {
+	diff_liness := []DiffLines{}
+	lines := strings.Split(file_diff.Content, "\n")
+	id := 0
+
+	if !strings.HasPrefix(lines[id], "@@") {
+		return diff_liness, xerrors.Errorf("Bug: Strange github hunk header at getFixedLocatin.\n")
+	}
+
+	before_l := 0
+	after_l := 0
+
+	for id < len(lines) {
+		if strings.HasPrefix(lines[id], "@@") {
+			// get hunk header info. ex.) @@ -372,7 +372,8 @@ func (version *Version) UnmarshalYAML
+			tokens := strings.Fields(lines[id])
+			if len(tokens) < 3 || !strings.HasPrefix(tokens[1], "-") || !strings.HasPrefix(tokens[2], "+") {
+				return diff_liness, xerrors.Errorf("Bug: Strange git hunk header '%v' at getFixedLocation.\n", lines[id])
+			}
+			before_start_l, err := parseHunkRange(tokens[1])
+			if err != nil {
+				return diff_liness, err
+			}
+			after_start_l, err := parseHunkRange(tokens[2])
+			if err != nil {
+				return diff_liness, err
+			}
+			before_l = before_start_l - 1
+			after_l = after_start_l - 1
+			id++
+		} else if strings.HasPrefix(lines[id], "-") {
+			// get deletions
+			before_l++
+			deletion_start_l := before_l
+			for id++; id < len(lines) && strings.HasPrefix(lines[id], "-"); id++ {
+				before_l++
+			}
+			diff_liness = append(diff_liness, DiffLines{Type: Deletion, Start: deletion_start_l, Length: before_l - deletion_start_l + 1})
+		} else if strings.HasPrefix(lines[id], "+") {
+			// get additions
+			after_l++
+			addition_start_l := after_l
+			for id++; id < len(lines) && strings.HasPrefix(lines[id], "+"); id++ {
+				after_l++
+			}
+			diff_liness = append(diff_liness, DiffLines{Type: Addition, Start: addition_start_l, Length: after_l - addition_start_l + 1})
+		} else if strings.HasPrefix(lines[id], "\\") {
+			// "\ No newline at end of file"
+			id++
+		} else {
+			id++
+			before_l++
+			after_l++
+		}
+	}
+
+	return diff_liness, nil
+}
+
+// getFixedFuncs returns the functions of the pre-fix files which are overlapped by the patch hunks.
+// additions are located by the line number of the fixed file, which is close enough at function granularity.
+func getFixedFuncs(file_diffs []FileDiff, file_func_locations map[string][]gity.FuncLocation) (map[string]bool, error) {
+
+	fixed_funcs := map[string]bool{}
+
+	for _, file_diff := range file_diffs {
+		// GitHub doesn't return the patch of binary files and huge diffs
+		if strings.Compare(file_diff.Content, "") == 0 {
+			continue
+		}
+		func_locations, ok := file_func_locations[file_diff.FilePath]
+		if !ok {
+			continue
+		}
+		diff_liness, err := getFixedLocation(&file_diff)
+		if err != nil {
+			return map[string]bool{}, err
+		}
+		for _, diff_lines := range diff_liness {
+			first_l := diff_lines.Start
+			last_l := diff_lines.Start + diff_lines.Length - 1
+			for _, func_location := range func_locations {
+				if first_l <= func_location.EndLine && func_location.StartLine <= last_l {
+					fixed_funcs[func_location.FuncName] = true
+				}
+			}
+		}
+	}
+
+	return fixed_funcs, nil
+}
+
+// the source file extensions and the function location extractors
+var func_location_scanners = map[string]func(string) ([]gity.FuncLocation, error){
+	".go":  goscan.GetFuncLocation,
+	".c":   cscan.GetFuncLocation,
+	".h":   cscan.GetFuncLocation,
+	".cc":  cscan.GetFuncLocation,
+	".cpp": cscan.GetFuncLocation,
+	".cxx": cscan.GetFuncLocation,
+	".c++": cscan.GetFuncLocation,
+	".hh":  cscan.GetFuncLocation,
+	".hpp": cscan.GetFuncLocation,
+	".hxx": cscan.GetFuncLocation,
+	".inc": cscan.GetFuncLocation,
+}
+
+// getFuncLocation extracts the function locations from the source by its language
+func getFuncLocation(file_path string, content string) ([]gity.FuncLocation, error) {
+	scanner, ok := func_location_scanners[strings.ToLower(filepath.Ext(file_path))]
+	if !ok {
+		return []gity.FuncLocation{}, xerrors.Errorf("unsupported source file: %v\n", file_path)
+	}
+	return scanner(content)
+}
+
+// only the source files whose function locations can be scanned.
+func scannableFileDiffs(file_diffs []FileDiff) []FileDiff {
+	scannable_file_diffs := []FileDiff{}
+	for _, file_diff := range file_diffs {
+		if _, ok := func_location_scanners[strings.ToLower(filepath.Ext(file_diff.FilePath))]; !ok {
+			continue
+		}
+		if strings.HasSuffix(file_diff.FilePath, "_test.go") {
+			continue
+		}
+		scannable_file_diffs = append(scannable_file_diffs, file_diff)
+	}
+	return scannable_file_diffs
+}
+
+// SplitUnifiedDiff splits the output of git diff (or .patch file) into the file diffs. the content of every
+// file diff starts with the first hunk header like the patch of GitHub API.
+func SplitUnifiedDiff(diff string) []FileDiff {
+
+	file_diffs := []FileDiff{}
+	var file_diff *FileDiff
+	hunks := []string{}
+	// the remaining lines of the current hunk
+	before_left, after_left := 0, 0
+
+	flush := func() {
+		if file_diff != nil {
+			file_diff.Content = strings.Join(hunks, "\n")
+			file_diffs = append(file_diffs, *file_diff)
+		}
+		file_diff = nil
+		hunks = []string{}
+	}
+
+	for _, line := range strings.Split(diff, "\n") {
+
+		if before_left > 0 || after_left > 0 {
+			switch {
+			case strings.HasPrefix(line, "-"):
+				before_left--
+			case strings.HasPrefix(line, "+"):
+				after_left--
+			case strings.HasPrefix(line, "\\"):
+			default:
+				before_left--
+				after_left--
+			}
+			hunks = append(hunks, line)
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			flush()
+			// the path is overwritten by "+++ b/..." if it exists. ex.) diff --git a/foo.c b/foo.c
+			file_diff = &FileDiff{}
+			if b_id := strings.LastIndex(line, " b/"); b_id != -1 {
+				file_diff.FilePath = line[b_id+3:]
+			}
+		case strings.HasPrefix(line, "--- "):
+			// the patch without "diff --git" header
+			if file_diff == nil || len(hunks) > 0 {
+				flush()
+				file_diff = &FileDiff{}
+			}
+			if path := diffPath(line[4:]); strings.Compare(path, "") != 0 {
+				file_diff.FilePath = path
+			}
+		case strings.HasPrefix(line, "+++ "):
+			if path := diffPath(line[4:]); strings.Compare(path, "") != 0 && file_diff != nil {
+				file_diff.FilePath = path
+			}
+		case strings.HasPrefix(line, "@@"):
+			if file_diff == nil {
+				continue
+			}
+			// ex.) @@ -372,7 +372,8 @@
+			tokens := strings.Fields(line)
+			if len(tokens) < 3 {
+				continue
+			}
+			before_left, after_left = hunkLength(tokens[1]), hunkLength(tokens[2])
+			hunks = append(hunks, line)
+		case strings.HasPrefix(line, "\\") && len(hunks) > 0:
+			// "\ No newline at end of file" after the last line of the hunk
+			hunks = append(hunks, line)
+		}
+	}
+	flush()
+
+	return file_diffs
+}
+
+// the length of hunk header range. ex.) "-372,7" -> 7, "+1" -> 1
+func hunkLength(hunk_range string) int {
+	ranges := strings.Split(hunk_range, ",")
+	if len(ranges) < 2 {
+		return 1
+	}
+	length, err := strconv.Atoi(ranges[1])
+	if err != nil {
+		return 0
+	}
+	return length
+}
+
+// the file path of "--- a/foo.c" or "+++ b/foo.c" line ("/dev/null" is empty)
+func diffPath(path string) string {
+	// the timestamp of diff -u. ex.) foo.c\t2023-01-01 00:00:00
+	path = strings.Split(path, "\t")[0]
+	if strings.Compare(path, "/dev/null") == 0 {
+		return ""
+	}
+	if strings.HasPrefix(path, "a/") || strings.HasPrefix(path, "b/") {
+		return path[2:]
+	}
+	return path
+}
+
+// blobIndexes returns the blob ids before the patch of the files. ex.) "index 0123abc..4567def 100644"
+func blobIndexes(diff string) map[string]string {
+
+	blob_indexes := map[string]string{}
+	file_path := ""
+
+	for _, line := range strings.Split(diff, "\n") {
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			file_path = ""
+			if b_id := strings.LastIndex(line, " b/"); b_id != -1 {
+				file_path = line[b_id+3:]
+			}
+		case strings.HasPrefix(line, "index ") && strings.Compare(file_path, "") != 0:
+			blobs := strings.Split(strings.Fields(line)[1], "..")
+			if len(blobs) == 2 {
+				blob_indexes[file_path] = blobs[0]
+			}
+		}
+	}
+
+	return blob_indexes
+}
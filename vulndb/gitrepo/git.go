@@ -1,5 +1,58 @@
 package gitrepo
 
+import (
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
 type GitOperation interface {
+	// whether the patch url is recognised
+	Supported(git_url string) bool
 	GetFixedFiles(git_url string) (map[string]bool, error)
+	GetFixedFuncs(git_url string) (map[string]bool, error)
+}
+
+// ProviderSet dispatches the patch url to the first provider which recognises it.
+type ProviderSet struct {
+	Providers []GitOperation
+}
+
+// NewGitOperation returns the providers of GitHub, GitLab, cgit (git.kernel.org) and gitweb (sourceware.org).
+// if the mirror directory is set, every host is read from the local mirror and no request is sent.
+func NewGitOperation(mirror_dir string, github_token string) *ProviderSet {
+	if strings.Compare(mirror_dir, "") != 0 {
+		return &ProviderSet{Providers: []GitOperation{NewMirrorOperation(mirror_dir)}}
+	}
+	return &ProviderSet{Providers: []GitOperation{NewGithubOperation(github_token), NewGitlabOperation(), NewCgitOperation(), NewGitwebOperation()}}
+}
+
+func (ps ProviderSet) provider(git_url string) (GitOperation, error) {
+	for _, provider := range ps.Providers {
+		if provider.Supported(git_url) {
+			return provider, nil
+		}
+	}
+	return nil, xerrors.Errorf("unsupported patch url: %v\n", git_url)
+}
+
+func (ps ProviderSet) Supported(git_url string) bool {
+	_, err := ps.provider(git_url)
+	return err == nil
+}
+
+func (ps ProviderSet) GetFixedFiles(git_url string) (map[string]bool, error) {
+	provider, err := ps.provider(git_url)
+	if err != nil {
+		return map[string]bool{}, err
+	}
+	return provider.GetFixedFiles(git_url)
+}
+
+func (ps ProviderSet) GetFixedFuncs(git_url string) (map[string]bool, error) {
+	provider, err := ps.provider(git_url)
+	if err != nil {
+		return map[string]bool{}, err
+	}
+	return provider.GetFixedFuncs(git_url)
 }
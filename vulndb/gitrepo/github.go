@@ -3,20 +3,16 @@ package gitrepo
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"os"
-	"strconv"
 	"strings"
 
 	"github.com/google/go-github/v53/github" // with go modules enabled (GO111MODULE=on or outside GOPATH)
-	"github.com/yomaytk/go_ltrace/pkg/language/goscan"
-	uutil "github.com/yomaytk/go_ltrace/util"
 	gity "github.com/yomaytk/go_ltrace/vulndb/gitrepo/types"
 	"golang.org/x/oauth2"
 	"golang.org/x/xerrors"
 )
 
-var CACHE_FILE = "./cache"
-
 type LangDiffOperation interface{}
 
 type FileDiff struct {
@@ -41,9 +37,9 @@ type GithubOperation struct {
 	TokenSource oauth2.TokenSource
 }
 
-func NewGithubOperation() *GithubOperation {
+func NewGithubOperation(token string) *GithubOperation {
 	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: os.Getenv("GITHUB_ACCESS_TOKEN")},
+		&oauth2.Token{AccessToken: token},
 	)
 	return &GithubOperation{ts}
 }
@@ -55,254 +51,285 @@ func (ghop GithubOperation) NewGithubClient() (context.Context, *github.Client)
 	return ctx, client
 }
 
-func (ghop GithubOperation) getFixedLocation(file_diff *FileDiff) ([]DiffLines, error) {
-	diff_liness := []DiffLines{}
-	lines := strings.Split(file_diff.Content, "\n")
-	id := 0
-	if strings.HasPrefix(lines[id], "@@") {
-		// get hunk header info
-		tokens := strings.Fields(lines[id])
-		before_header := strings.Split(tokens[1], ",")
-		after_header := strings.Split(tokens[2], ",")
-
-		if !strings.HasPrefix(before_header[0], "-") {
-			return diff_liness, xerrors.Errorf("Bug: Strange git huk deletion header at getFixedLocation.\n")
-		}
+func (ghop GithubOperation) GetDiffFromCommit(git_url string) ([]FileDiff, error) {
+	file_diffs := []FileDiff{}
 
-		before_start_l, err := strconv.Atoi(before_header[0])
-		before_start_l *= -1
-		uutil.ErrFatal(err)
-		_, err = strconv.Atoi(before_header[1])
-		uutil.ErrFatal(err)
-
-		after_start_l, err := strconv.Atoi(after_header[0])
-		uutil.ErrFatal(err)
-		_, err = strconv.Atoi(before_header[1])
-		uutil.ErrFatal(err)
-
-		// start reading of deletion and addition
-		id++
-
-		deletion_start_l := -1
-		addition_start_l := -1
-		before_l := before_start_l - 1
-		after_l := after_start_l - 1
-
-		for id < len(lines) {
-			if strings.HasPrefix(lines[id], "-") {
-				// get deletions
-				if deletion_start_l != -1 {
-					return diff_liness, xerrors.Errorf("Bug: get deletions error at getFixedLocation.\n")
-				}
-				before_l++
-				deletion_start_l = before_l
-				id++
-				for ; ; id++ {
-					if strings.HasPrefix(lines[id], "-") {
-						before_l++
-					} else {
-						break
-					}
-				}
-				diff_liness = append(diff_liness, DiffLines{Type: Deletion, Start: deletion_start_l, Length: before_l - deletion_start_l + 1})
-				deletion_start_l = -1
-			} else if strings.HasPrefix(lines[id], "+") {
-				// get additions
-				if addition_start_l != -1 {
-					return diff_liness, xerrors.Errorf("Bug: get additions error at getFixedLocation.\n")
-				}
-				after_l++
-				addition_start_l = after_l
-				id++
-				for ; ; id++ {
-					if strings.HasPrefix(lines[id], "+") {
-						after_l++
-					} else {
-						break
-					}
-				}
-				diff_liness = append(diff_liness, DiffLines{Type: Addition, Start: addition_start_l, Length: after_l - addition_start_l})
-				addition_start_l = -1
-			} else {
-				id++
-				before_l++
-				after_l++
-			}
-		}
-	} else {
-		return diff_liness, xerrors.Errorf("Bug: Strange github hunk header at getFixedLocatin.\n")
+	github_url, err := ParseGithubURL(git_url)
+	if err != nil {
+		return file_diffs, err
+	}
+	if github_url.Type != GithubCommit {
+		return file_diffs, xerrors.Errorf("Bug: Strange github url at GetDiffFromCommit. '%v'\n", git_url)
 	}
-	return diff_liness, nil
-}
 
-func (ghop GithubOperation) GetDiffFromCommit(git_url string) ([]FileDiff, error) {
-	file_diffs := []FileDiff{}
+	// initialize authorization info
+	ctx, client := ghop.NewGithubClient()
+
+	repo_commit, _, err := client.Repositories.GetCommit(ctx, github_url.Owner, github_url.Repo, github_url.Ref, &github.ListOptions{PerPage: 100})
+	if err != nil {
+		return file_diffs, xerrors.Errorf("cannot get the commit %v: %w", git_url, err)
+	}
 
-	tokens := strings.Split(git_url, "/")
-	if strings.Compare(tokens[len(tokens)-2], "commit") == 0 {
+	for _, file := range repo_commit.Files {
+		file_diffs = append(file_diffs, FileDiff{FilePath: file.GetFilename(), Content: file.GetPatch()})
+	}
 
-		// initialize authorization info
-		ctx, client := ghop.NewGithubClient()
+	return file_diffs, nil
+}
 
-		owner := tokens[len(tokens)-4]
-		repo := tokens[len(tokens)-3]
-		commit_sha := tokens[len(tokens)-1]
+func (ghop GithubOperation) GetDiffFromPR(git_url string) ([]FileDiff, error) {
+	file_diffs := []FileDiff{}
 
-		repo_commit, _, err := client.Repositories.GetCommit(ctx, owner, repo, commit_sha, nil)
-		uutil.ErrFatal(err)
+	github_url, err := ParseGithubURL(git_url)
+	if err != nil {
+		return file_diffs, err
+	}
+	if github_url.Type != GithubPR {
+		return file_diffs, xerrors.Errorf("Bug: Strange github url at GetDiffFromPR. '%v'\n", git_url)
+	}
 
-		for _, file := range repo_commit.Files {
-			file_path := *file.Filename
-			file_diffs = append(file_diffs, FileDiff{FilePath: file_path, Content: file.GetPatch()})
-		}
+	// initialize authorization info
+	ctx, client := ghop.NewGithubClient()
 
-		return file_diffs, nil
-	} else {
-		return file_diffs, xerrors.Errorf("Bug: Strange github url at GetDiffFromCommit. '%v'\n", git_url)
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		files, res, err := client.PullRequests.ListFiles(ctx, github_url.Owner, github_url.Repo, github_url.PRNumber, opts)
+		if err != nil {
+			return file_diffs, xerrors.Errorf("cannot get the files of %v: %w", git_url, err)
+		}
+		for _, file := range files {
+			file_diffs = append(file_diffs, FileDiff{FilePath: file.GetFilename(), Content: file.GetPatch()})
+		}
+		if res.NextPage == 0 {
+			break
+		}
+		opts.Page = res.NextPage
 	}
+
+	return file_diffs, nil
 }
 
-func (ghop GithubOperation) GetDiffFromPR(git_url string) ([]FileDiff, error) {
+func (ghop GithubOperation) GetDiffFromCompare(git_url string) ([]FileDiff, error) {
 	file_diffs := []FileDiff{}
 
-	if strings.Contains(git_url, "/commits/") {
-		git_url = strings.Split(git_url, "/commits/")[0]
+	github_url, err := ParseGithubURL(git_url)
+	if err != nil {
+		return file_diffs, err
+	}
+	if github_url.Type != GithubCompare {
+		return file_diffs, xerrors.Errorf("Bug: Strange github url at GetDiffFromCompare. '%v'\n", git_url)
 	}
 
-	tokens := strings.Split(git_url, "/")
-	if strings.Compare(tokens[len(tokens)-2], "pull") == 0 {
+	// initialize authorization info
+	ctx, client := ghop.NewGithubClient()
 
-		// initialize authorization info
-		ctx, client := ghop.NewGithubClient()
+	base, head := github_url.CompareRange()
+	comparison, _, err := client.Repositories.CompareCommits(ctx, github_url.Owner, github_url.Repo, base, head, &github.ListOptions{PerPage: 100})
+	if err != nil {
+		return file_diffs, xerrors.Errorf("cannot compare %v: %w", git_url, err)
+	}
+
+	for _, file := range comparison.Files {
+		file_diffs = append(file_diffs, FileDiff{FilePath: file.GetFilename(), Content: file.GetPatch()})
+	}
 
-		owner := tokens[len(tokens)-4]
-		repo := tokens[len(tokens)-3]
-		pull_num, err := strconv.Atoi(tokens[len(tokens)-1])
-		uutil.ErrFatal(err)
+	return file_diffs, nil
+}
 
-		files, _, err := client.PullRequests.ListFiles(ctx, owner, repo, pull_num, nil)
-		uutil.ErrFatal(err)
+// GetDiff gets the file diffs of commit, PR or compare url.
+func (ghop GithubOperation) GetDiff(git_url string) ([]FileDiff, error) {
 
-		for _, file := range files {
-			file_path := *file.Filename
-			file_diffs = append(file_diffs, FileDiff{FilePath: file_path, Content: file.GetPatch()})
-		}
+	github_url, err := ParseGithubURL(git_url)
+	if err != nil {
+		return []FileDiff{}, err
+	}
 
-		return file_diffs, nil
-	} else {
-		return file_diffs, xerrors.Errorf("Bug: Strange github url at GetFixedFilesFromPullRequest. '%v'\n", git_url)
+	switch {
+	case github_url.Type == GithubCommit:
+		return ghop.GetDiffFromCommit(git_url)
+	case github_url.Type == GithubPR && strings.Compare(github_url.Ref, "") != 0:
+		// the commit in PR (/pull/<num>/commits/<sha>) is diffed against its parent
+		return ghop.GetDiffFromCommit(github_url.commitURL())
+	case github_url.Type == GithubPR:
+		return ghop.GetDiffFromPR(git_url)
+	default:
+		return ghop.GetDiffFromCompare(git_url)
 	}
 }
 
-func (ghop GithubOperation) GetPrePRFuncLocation(git_url string, file_diffs []FileDiff) (map[string][]gity.FuncLocation, error) {
+// get the function locations of the files at the ref
+func (ghop GithubOperation) getFuncLocations(github_url GithubURL, ref string, file_diffs []FileDiff) (map[string][]gity.FuncLocation, error) {
+
 	file_func_locations := map[string][]gity.FuncLocation{}
 
-	if strings.Contains(git_url, "/commits/") {
-		git_url = strings.Split(git_url, "/commits/")[0]
-	}
+	// one client is shared by the files
+	ctx, client := ghop.NewGithubClient()
 
-	tokens := strings.Split(git_url, "/")
-	if strings.Compare(tokens[len(tokens)-2], "pull") == 0 {
+	for _, file_diff := range file_diffs {
+		// get the file content before target commit (use the parent of target commit)
+		file_path := file_diff.FilePath
+		file_content, _, res, err := client.Repositories.GetContents(ctx, github_url.Owner, github_url.Repo, file_path, &github.RepositoryContentGetOptions{Ref: ref})
+		// the file added by the patch doesn't exist at the ref
+		if res != nil && res.StatusCode == http.StatusNotFound {
+			continue
+		}
+		if err != nil {
+			return file_func_locations, xerrors.Errorf("cannot get %v at %v: %w", file_path, ref, err)
+		}
+		if file_content == nil {
+			continue
+		}
+		content, err := file_content.GetContent()
+		if err != nil {
+			return file_func_locations, err
+		}
 
-		// initialize authorization info
-		ctx, client := ghop.NewGithubClient()
+		// get funclocatins of target file path
+		func_locations, err := getFuncLocation(file_path, content)
+		if err != nil {
+			return file_func_locations, err
+		}
 
-		owner := tokens[len(tokens)-4]
-		repo := tokens[len(tokens)-3]
-		pull_num, err := strconv.Atoi(tokens[len(tokens)-1])
-		uutil.ErrFatal(err)
+		file_func_locations[file_path] = func_locations
+	}
 
-		commits, _, err := client.PullRequests.ListCommits(ctx, owner, repo, pull_num, nil)
-		uutil.ErrFatal(err)
+	return file_func_locations, nil
+}
 
-		if commits == nil || len(commits) <= 0 {
-			return file_func_locations, xerrors.Errorf("Bug: this PR doesn't have commits at GetPrePRFuncLocation.\n")
+// the parent commit of the commit
+func parentSHA(parents []*github.Commit) (string, error) {
+	if len(parents) > 1 {
+		fmt.Fprintf(os.Stderr, "WARNING: target commit has %v parents.\n", len(parents))
+		for i := 0; i < len(parents); i++ {
+			fmt.Fprintf(os.Stderr, "Parent_%v: %v\n", i, parents[i].GetSHA())
 		}
+	} else if len(parents) == 0 {
+		return "", xerrors.Errorf("Bug: the commit don't has the parents commit.\n")
+	}
+	return parents[0].GetSHA(), nil
+}
 
-		// parents of the first commit of this PR
-		pre_commits := commits[0].Parents
-
-		if len(pre_commits) > 1 {
-			fmt.Printf("WARNING: target commit has %v parents. \n", len(pre_commits))
-			parents := pre_commits
-			for i := 0; i < len(pre_commits); i++ {
-				fmt.Printf("Parent_%v: %v\n", i, parents[i].GetSHA())
-			}
-		} else if len(pre_commits) == 0 {
-			return map[string][]gity.FuncLocation{}, xerrors.Errorf("Bug: the commit don't has the parents commit at GetPrePRFuncLocation.\n")
-		}
+func (ghop GithubOperation) GetPrePRFuncLocation(git_url string, file_diffs []FileDiff) (map[string][]gity.FuncLocation, error) {
 
-		pre_commit_sha := *pre_commits[0].SHA
+	github_url, err := ParseGithubURL(git_url)
+	if err != nil {
+		return map[string][]gity.FuncLocation{}, err
+	}
+	if github_url.Type != GithubPR {
+		return map[string][]gity.FuncLocation{}, xerrors.Errorf("Bug: Strange github url at GetPrePRFuncLocation. '%v'\n", git_url)
+	}
 
-		for _, file_diff := range file_diffs {
-			// get the file content before target commit (use the parent of target commit)
-			file_path := file_diff.FilePath
-			ctx2, client2 := ghop.NewGithubClient()
-			file_content, _, _, err := client2.Repositories.GetContents(ctx2, owner, repo, file_path, &github.RepositoryContentGetOptions{Ref: pre_commit_sha})
-			uutil.ErrFatal(err)
-			content, err := file_content.GetContent()
-			uutil.ErrFatal(err)
+	// initialize authorization info
+	ctx, client := ghop.NewGithubClient()
 
-			// get funclocatins of target file path
-			func_locations, err := goscan.GetFuncLocation(content)
-			uutil.ErrFatal(err)
+	commits, _, err := client.PullRequests.ListCommits(ctx, github_url.Owner, github_url.Repo, github_url.PRNumber, nil)
+	if err != nil {
+		return map[string][]gity.FuncLocation{}, xerrors.Errorf("cannot get the commits of %v: %w", git_url, err)
+	}
+	if len(commits) == 0 {
+		return map[string][]gity.FuncLocation{}, xerrors.Errorf("Bug: this PR doesn't have commits at GetPrePRFuncLocation.\n")
+	}
 
-			file_func_locations[file_path] = func_locations
-		}
-		return file_func_locations, nil
-	} else {
-		return file_func_locations, xerrors.Errorf("Bug: Strange github url at GetFixedFilesFromPullRequest. '%v'\n", git_url)
+	// parents of the first commit of this PR
+	pre_commit_sha, err := parentSHA(commits[0].Parents)
+	if err != nil {
+		return map[string][]gity.FuncLocation{}, err
 	}
+
+	return ghop.getFuncLocations(github_url, pre_commit_sha, file_diffs)
 }
 
 func (ghop GithubOperation) GetPreCommitFuncLocation(git_url string, file_diffs []FileDiff) (map[string][]gity.FuncLocation, error) {
 
-	file_func_locations := map[string][]gity.FuncLocation{}
-	tokens := strings.Split(git_url, "/")
+	github_url, err := ParseGithubURL(git_url)
+	if err != nil {
+		return map[string][]gity.FuncLocation{}, err
+	}
+	if github_url.Type != GithubCommit {
+		return map[string][]gity.FuncLocation{}, xerrors.Errorf("Bug: Strange github url at GetPreCommitFuncLocation. '%v'\n", git_url)
+	}
 
 	// initialize authorization info
 	ctx, client := ghop.NewGithubClient()
 
-	// get the commit info
-	owner := tokens[len(tokens)-4]
-	repo := tokens[len(tokens)-3]
-	commit_sha := tokens[len(tokens)-1]
-
 	// get the target commit
-	repo_commit, _, err := client.Repositories.GetCommit(ctx, owner, repo, commit_sha, nil)
-	uutil.ErrFatal(err)
-
-	if len(repo_commit.Parents) > 1 {
-		fmt.Printf("WARNING: target commit has %v parents.\n", len(repo_commit.Parents))
-		parents := repo_commit.Parents
-		for i := 0; i < len(repo_commit.Parents); i++ {
-			fmt.Printf("Parent_%v: %v\n", i, parents[i].GetSHA())
-		}
-	} else if len(repo_commit.Parents) == 0 {
-		return map[string][]gity.FuncLocation{}, xerrors.Errorf("Bug: commit don't has the parents commit at GerPreCommitFuncLocation.\n")
+	repo_commit, _, err := client.Repositories.GetCommit(ctx, github_url.Owner, github_url.Repo, github_url.Ref, nil)
+	if err != nil {
+		return map[string][]gity.FuncLocation{}, xerrors.Errorf("cannot get the commit %v: %w", git_url, err)
 	}
 
-	pre_commit_sha := repo_commit.Parents[0].GetSHA()
+	pre_commit_sha, err := parentSHA(repo_commit.Parents)
+	if err != nil {
+		return map[string][]gity.FuncLocation{}, err
+	}
 
-	for _, file_diff := range file_diffs {
-		// get the file content before target commit (use the parent of target commit)
-		file_path := file_diff.FilePath
-		ctx2, client2 := ghop.NewGithubClient()
-		file_content, _, _, err := client2.Repositories.GetContents(ctx2, owner, repo, file_path, &github.RepositoryContentGetOptions{Ref: pre_commit_sha})
-		uutil.ErrFatal(err)
-		content, err := file_content.GetContent()
-		uutil.ErrFatal(err)
+	return ghop.getFuncLocations(github_url, pre_commit_sha, file_diffs)
+}
 
-		// get funclocatins of target file path
-		func_locations, err := goscan.GetFuncLocation(content)
-		uutil.ErrFatal(err)
+func (ghop GithubOperation) GetPreCompareFuncLocation(git_url string, file_diffs []FileDiff) (map[string][]gity.FuncLocation, error) {
 
-		file_func_locations[file_path] = func_locations
+	github_url, err := ParseGithubURL(git_url)
+	if err != nil {
+		return map[string][]gity.FuncLocation{}, err
+	}
+	if github_url.Type != GithubCompare {
+		return map[string][]gity.FuncLocation{}, xerrors.Errorf("Bug: Strange github url at GetPreCompareFuncLocation. '%v'\n", git_url)
 	}
 
-	return file_func_locations, nil
+	// the base of the compare range is the code before the fix
+	base, _ := github_url.CompareRange()
+	return ghop.getFuncLocations(github_url, base, file_diffs)
 }
 
+// GetFixedFiles returns the source files touched by the commit, PR or compare url.
 func (ghop GithubOperation) GetFixedFiles(git_url string) (map[string]bool, error) {
-	return map[string]bool{}, xerrors.Errorf("strange github url: %v\n", git_url)
+
+	fixed_files := map[string]bool{}
+
+	file_diffs, err := ghop.GetDiff(git_url)
+	if err != nil {
+		return fixed_files, err
+	}
+
+	for _, file_diff := range file_diffs {
+		fixed_files[file_diff.FilePath] = true
+	}
+
+	return fixed_files, nil
+}
+
+func (ghop GithubOperation) GetFixedFuncs(git_url string) (map[string]bool, error) {
+
+	github_url, err := ParseGithubURL(git_url)
+	if err != nil {
+		return map[string]bool{}, err
+	}
+
+	file_diffs, err := ghop.GetDiff(git_url)
+	if err != nil {
+		return map[string]bool{}, err
+	}
+	file_diffs = scannableFileDiffs(file_diffs)
+
+	var file_func_locations map[string][]gity.FuncLocation
+	switch {
+	case github_url.Type == GithubCommit:
+		file_func_locations, err = ghop.GetPreCommitFuncLocation(git_url, file_diffs)
+	case github_url.Type == GithubPR && strings.Compare(github_url.Ref, "") != 0:
+		file_func_locations, err = ghop.GetPreCommitFuncLocation(github_url.commitURL(), file_diffs)
+	case github_url.Type == GithubPR:
+		file_func_locations, err = ghop.GetPrePRFuncLocation(git_url, file_diffs)
+	default:
+		file_func_locations, err = ghop.GetPreCompareFuncLocation(git_url, file_diffs)
+	}
+	if err != nil {
+		return map[string]bool{}, err
+	}
+
+	return getFixedFuncs(file_diffs, file_func_locations)
+}
+
+func (ghop GithubOperation) Supported(git_url string) bool {
+	_, err := ParseGithubURL(git_url)
+	return err == nil
 }
@@ -2,12 +2,12 @@ package gitrepo
 
 import (
 	"fmt"
+	"os"
 	"reflect"
 	"strings"
 	"testing"
 
 	log "github.com/yomaytk/go_ltrace/log"
-	uutil "github.com/yomaytk/go_ltrace/util"
 	gity "github.com/yomaytk/go_ltrace/vulndb/gitrepo/types"
 )
 
@@ -19,10 +19,10 @@ var (
 func TestCommitDiff(t *testing.T) {
 
 	// initialize logger
-	log.InitLogger()
+	log.InitLogger("")
 	defer log.Logger.Sync()
 
-	ghop := NewGithubOperation()
+	ghop := NewGithubOperation(os.Getenv("GITHUB_ACCESS_TOKEN"))
 
 	ans_file_diffs := []FileDiff{
 		{FilePath: "configuration/configuration.go", Content: ""},
@@ -34,7 +34,9 @@ func TestCommitDiff(t *testing.T) {
 	}
 
 	file_diffs, err := ghop.GetDiffFromCommit(SampleCommitURL)
-	uutil.ErrFatal(err)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	for i := 0; i < len(file_diffs); i++ {
 		t.Run("FileDiff.FilePath Test", func(t *testing.T) {
@@ -49,7 +51,9 @@ func TestCommitDiff(t *testing.T) {
 	}
 
 	file_func_locations, err := ghop.GetPreCommitFuncLocation(SampleCommitURL, file_diffs)
-	uutil.ErrFatal(err)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	for path, ans_func_locations := range ans_file_func_locations {
 		t.Run(fmt.Sprintf("FileFuncLocation '%v' Test Start", path), func(t *testing.T) {
@@ -0,0 +1,276 @@
+package gitrepo
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// the GitLab instances referred by Ubuntu CVE Tracker. the other hosts whose name contains "gitlab" are also GitLab.
+var gitlab_hosts = map[string]bool{"gitlab.com": true, "gitlab.gnome.org": true, "salsa.debian.org": true,
+	"gitlab.freedesktop.org": true, "invent.kde.org": true, "code.videolan.org": true, "gitlab.xiph.org": true}
+
+// the GitLab commit or merge request. ex.) https://gitlab.gnome.org/GNOME/libxml2/-/commit/<sha>,
+// https://gitlab.com/gnutls/gnutls/-/merge_requests/1234, https://gitlab.com/owner/repo/commit/<sha>.patch
+type GitlabHost struct{}
+
+type gitlabTarget struct {
+	Project string
+	// "commit" or "merge_requests"
+	Kind string
+	ID   string
+}
+
+func parseGitlabURL(u *url.URL) (gitlabTarget, bool) {
+
+	host := strings.ToLower(u.Hostname())
+	if !gitlab_hosts[host] && !strings.Contains(host, "gitlab") {
+		return gitlabTarget{}, false
+	}
+
+	path := strings.Trim(trimPatchSuffix(u.Path), "/")
+	for _, marker := range []string{"/-/commit/", "/-/merge_requests/", "/commit/", "/merge_requests/"} {
+		marker_id := strings.Index(path, marker)
+		if marker_id == -1 {
+			continue
+		}
+		project := path[:marker_id]
+		// ex.) <sha>, <num>/diffs
+		id := strings.Split(path[marker_id+len(marker):], "/")[0]
+		if strings.Compare(project, "") == 0 || strings.Compare(id, "") == 0 {
+			return gitlabTarget{}, false
+		}
+		return gitlabTarget{Project: project, Kind: strings.Trim(strings.TrimPrefix(marker, "/-"), "/"), ID: id}, true
+	}
+
+	return gitlabTarget{}, false
+}
+
+func (GitlabHost) Supported(u *url.URL) bool {
+	_, ok := parseGitlabURL(u)
+	return ok
+}
+
+func (GitlabHost) PatchURL(u *url.URL) (string, error) {
+	target, ok := parseGitlabURL(u)
+	if !ok {
+		return "", xerrors.Errorf("strange gitlab url: %v\n", u)
+	}
+	return origin(u) + "/" + target.Project + "/-/" + target.Kind + "/" + target.ID + ".diff", nil
+}
+
+// the parent of the commit or the base of the merge request by GitLab API
+func (GitlabHost) BaseRevision(hop HTTPOperation, u *url.URL) (string, error) {
+
+	target, ok := parseGitlabURL(u)
+	if !ok {
+		return "", xerrors.Errorf("strange gitlab url: %v\n", u)
+	}
+
+	api_url := origin(u) + "/api/v4/projects/" + url.PathEscape(target.Project)
+	if strings.Compare(target.Kind, "commit") == 0 {
+		api_url += "/repository/commits/" + target.ID
+	} else {
+		api_url += "/merge_requests/" + target.ID
+	}
+
+	body, found, err := hop.get(api_url)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", xerrors.Errorf("%v is not found.\n", api_url)
+	}
+
+	var info struct {
+		ParentIDs []string `json:"parent_ids"`
+		DiffRefs  struct {
+			BaseSHA string `json:"base_sha"`
+		} `json:"diff_refs"`
+	}
+	if err := json.Unmarshal([]byte(body), &info); err != nil {
+		return "", xerrors.Errorf("cannot parse %v: %w", api_url, err)
+	}
+
+	if strings.Compare(target.Kind, "commit") == 0 {
+		if len(info.ParentIDs) == 0 {
+			return "", xerrors.Errorf("Bug: the commit don't has the parents commit. %v\n", u)
+		}
+		return info.ParentIDs[0], nil
+	}
+	if strings.Compare(info.DiffRefs.BaseSHA, "") == 0 {
+		return "", xerrors.Errorf("the merge request %v doesn't have the base.\n", u)
+	}
+	return info.DiffRefs.BaseSHA, nil
+}
+
+func (GitlabHost) FileURL(u *url.URL, base string, file_path string, patch string) (string, error) {
+	target, ok := parseGitlabURL(u)
+	if !ok {
+		return "", xerrors.Errorf("strange gitlab url: %v\n", u)
+	}
+	return origin(u) + "/" + target.Project + "/-/raw/" + base + "/" + escapePath(file_path), nil
+}
+
+// the merge request is mirrored as refs/merge-requests/<num>/head
+func (GitlabHost) MirrorLocation(u *url.URL) (MirrorLocation, error) {
+	target, ok := parseGitlabURL(u)
+	if !ok {
+		return MirrorLocation{}, xerrors.Errorf("strange gitlab url: %v\n", u)
+	}
+	if strings.Compare(target.Kind, "commit") == 0 {
+		return MirrorLocation{Repository: target.Project, Commit: target.ID}, nil
+	}
+	return MirrorLocation{Repository: target.Project, MergeRef: "refs/merge-requests/" + target.ID}, nil
+}
+
+// the cgit commit. ex.) https://git.kernel.org/pub/scm/linux/kernel/git/torvalds/linux.git/commit/?id=<sha>,
+// https://git.kernel.org/linus/<sha>, https://git.savannah.gnu.org/cgit/grep.git/commit/?id=<sha>
+type CgitHost struct{}
+
+// the repository path and the commit id
+func parseCgitURL(u *url.URL) (string, string, bool) {
+
+	host := strings.ToLower(u.Hostname())
+	path := strings.TrimRight(u.Path, "/")
+
+	// the short url of the mainline kernel
+	if strings.Compare(host, "git.kernel.org") == 0 && strings.HasPrefix(path, "/linus/") {
+		return "/pub/scm/linux/kernel/git/torvalds/linux.git", strings.TrimPrefix(path, "/linus/"), true
+	}
+
+	if strings.Compare(host, "git.kernel.org") != 0 && !strings.Contains(path, "/cgit") {
+		return "", "", false
+	}
+	// ex.) /<repo>/commit/, /<repo>/commit/<file path>
+	elements := strings.Split(path, "/")
+	for page_id := len(elements) - 1; page_id > 0; page_id-- {
+		switch elements[page_id] {
+		case "commit", "patch", "diff", "rawdiff":
+		default:
+			continue
+		}
+		id := u.Query().Get("id")
+		if strings.Compare(id, "") == 0 {
+			return "", "", false
+		}
+		return strings.Join(elements[:page_id], "/"), id, true
+	}
+
+	return "", "", false
+}
+
+func (CgitHost) Supported(u *url.URL) bool {
+	_, _, ok := parseCgitURL(u)
+	return ok
+}
+
+func (CgitHost) PatchURL(u *url.URL) (string, error) {
+	repo_path, id, ok := parseCgitURL(u)
+	if !ok {
+		return "", xerrors.Errorf("strange cgit url: %v\n", u)
+	}
+	return origin(u) + repo_path + "/patch/?id=" + url.QueryEscape(id), nil
+}
+
+// cgit resolves the revision expression
+func (CgitHost) BaseRevision(hop HTTPOperation, u *url.URL) (string, error) {
+	_, id, ok := parseCgitURL(u)
+	if !ok {
+		return "", xerrors.Errorf("strange cgit url: %v\n", u)
+	}
+	return id + "^", nil
+}
+
+func (CgitHost) FileURL(u *url.URL, base string, file_path string, patch string) (string, error) {
+	repo_path, _, ok := parseCgitURL(u)
+	if !ok {
+		return "", xerrors.Errorf("strange cgit url: %v\n", u)
+	}
+	return origin(u) + repo_path + "/plain/" + escapePath(file_path) + "?id=" + url.QueryEscape(base), nil
+}
+
+func (CgitHost) MirrorLocation(u *url.URL) (MirrorLocation, error) {
+	repo_path, id, ok := parseCgitURL(u)
+	if !ok {
+		return MirrorLocation{}, xerrors.Errorf("strange cgit url: %v\n", u)
+	}
+	return MirrorLocation{Repository: strings.Trim(repo_path, "/"), Commit: id}, nil
+}
+
+// the gitweb commit. ex.) https://sourceware.org/git/?p=glibc.git;a=commit;h=<sha>,
+// https://sourceware.org/git/gitweb.cgi?p=binutils-gdb.git;h=<sha>
+type GitwebHost struct{}
+
+// gitweb separates the parameters by ';'
+func gitwebParams(u *url.URL) map[string]string {
+	params := map[string]string{}
+	for _, param := range strings.FieldsFunc(u.RawQuery, func(r rune) bool { return r == ';' || r == '&' }) {
+		key_value := strings.SplitN(param, "=", 2)
+		if len(key_value) != 2 {
+			continue
+		}
+		if value, err := url.QueryUnescape(key_value[1]); err == nil {
+			params[key_value[0]] = value
+		}
+	}
+	return params
+}
+
+func (GitwebHost) Supported(u *url.URL) bool {
+	params := gitwebParams(u)
+	switch params["a"] {
+	case "", "commit", "commitdiff", "patch", "commitdiff_plain":
+	default:
+		return false
+	}
+	return strings.HasSuffix(params["p"], ".git") && strings.Compare(params["h"], "") != 0
+}
+
+func (GitwebHost) PatchURL(u *url.URL) (string, error) {
+	params := gitwebParams(u)
+	return origin(u) + u.Path + "?p=" + url.QueryEscape(params["p"]) + ";a=patch;h=" + url.QueryEscape(params["h"]), nil
+}
+
+// gitweb doesn't accept the revision expression, so the file is got by the blob id in the patch
+func (GitwebHost) BaseRevision(hop HTTPOperation, u *url.URL) (string, error) {
+	return "", nil
+}
+
+func (GitwebHost) FileURL(u *url.URL, base string, file_path string, patch string) (string, error) {
+	blob, ok := blobIndexes(patch)[file_path]
+	if !ok {
+		return "", xerrors.Errorf("the blob of %v is not found in the patch.\n", file_path)
+	}
+	// the file added by the patch
+	if strings.Trim(blob, "0") == "" {
+		return "", nil
+	}
+	params := gitwebParams(u)
+	return origin(u) + u.Path + "?p=" + url.QueryEscape(params["p"]) + ";a=blob_plain;h=" + blob, nil
+}
+
+func (GitwebHost) MirrorLocation(u *url.URL) (MirrorLocation, error) {
+	params := gitwebParams(u)
+	return MirrorLocation{Repository: params["p"], Commit: params["h"]}, nil
+}
+
+// escape every element of the file path
+func escapePath(file_path string) string {
+	elements := strings.Split(file_path, "/")
+	for id, element := range elements {
+		elements[id] = url.PathEscape(element)
+	}
+	return strings.Join(elements, "/")
+}
+
+// the scheme and the host of the url. ex.) https://gitlab.com
+func origin(u *url.URL) string {
+	scheme := u.Scheme
+	if strings.Compare(scheme, "") == 0 {
+		scheme = "https"
+	}
+	return scheme + "://" + u.Host
+}
@@ -0,0 +1,111 @@
+package gitrepo
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestPatchURL(t *testing.T) {
+	tests := []struct {
+		host      PatchHost
+		git_url   string
+		patch_url string
+	}{
+		{GitlabHost{}, "https://gitlab.gnome.org/GNOME/libxml2/-/commit/0123abcd", "https://gitlab.gnome.org/GNOME/libxml2/-/commit/0123abcd.diff"},
+		{GitlabHost{}, "https://gitlab.com/gnutls/gnutls/-/merge_requests/1234/diffs", "https://gitlab.com/gnutls/gnutls/-/merge_requests/1234.diff"},
+		{GitlabHost{}, "https://salsa.debian.org/debian/foo/commit/0123abcd.patch", "https://salsa.debian.org/debian/foo/-/commit/0123abcd.diff"},
+		{CgitHost{}, "https://git.kernel.org/pub/scm/linux/kernel/git/torvalds/linux.git/commit/?id=0123abcd", "https://git.kernel.org/pub/scm/linux/kernel/git/torvalds/linux.git/patch/?id=0123abcd"},
+		{CgitHost{}, "https://git.kernel.org/linus/0123abcd", "https://git.kernel.org/pub/scm/linux/kernel/git/torvalds/linux.git/patch/?id=0123abcd"},
+		{CgitHost{}, "https://git.savannah.gnu.org/cgit/grep.git/commit/?h=master&id=0123abcd", "https://git.savannah.gnu.org/cgit/grep.git/patch/?id=0123abcd"},
+		{GitwebHost{}, "https://sourceware.org/git/?p=glibc.git;a=commit;h=0123abcd", "https://sourceware.org/git/?p=glibc.git;a=patch;h=0123abcd"},
+		{GitwebHost{}, "https://sourceware.org/git/gitweb.cgi?p=binutils-gdb.git;h=0123abcd", "https://sourceware.org/git/gitweb.cgi?p=binutils-gdb.git;a=patch;h=0123abcd"},
+	}
+	for _, test := range tests {
+		u, _ := url.Parse(test.git_url)
+		if !test.host.Supported(u) {
+			t.Errorf("%v must be supported by %T", test.git_url, test.host)
+			continue
+		}
+		patch_url, err := test.host.PatchURL(u)
+		if err != nil || patch_url != test.patch_url {
+			t.Errorf("%v: got %v (%v), expected %v", test.git_url, patch_url, err, test.patch_url)
+		}
+	}
+
+	// every url is recognised by only one provider
+	ps := NewGitOperation("", "")
+	for _, test := range tests {
+		supported := 0
+		for _, provider := range ps.Providers {
+			if provider.Supported(test.git_url) {
+				supported++
+			}
+		}
+		if supported != 1 {
+			t.Errorf("%v is supported by %v providers", test.git_url, supported)
+		}
+	}
+	if ps.Supported("https://bugs.launchpad.net/ubuntu/+source/glibc/+bug/1") {
+		t.Errorf("the bug tracker must not be supported")
+	}
+}
+
+const gitweb_patch = `From 0123abcd Mon Sep 17 00:00:00 2001
+Subject: [PATCH] fix
+
+diff --git a/parse.c b/parse.c
+index 1111111..2222222 100644
+--- a/parse.c
++++ b/parse.c
+@@ -3,4 +3,6 @@
+ int parse(const char *s)
+ {
++    if (s == NULL)
++        return -1;
+     return strlen(s);
+ }
+diff --git a/new.c b/new.c
+new file mode 100644
+index 0000000..3333333
+--- /dev/null
++++ b/new.c
+@@ -0,0 +1 @@
++int added(void) { return 0; }
+`
+
+func TestGitwebOperation(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.RawQuery {
+		case "p=glibc.git;a=patch;h=0123abcd":
+			w.Write([]byte(gitweb_patch))
+		case "p=glibc.git;a=blob_plain;h=1111111":
+			w.Write([]byte(before_source))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	hop := NewGitwebOperation()
+	git_url := server.URL + "/git/?p=glibc.git;a=commit;h=0123abcd"
+
+	fixed_files, err := hop.GetFixedFiles(git_url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fixed_files, map[string]bool{"parse.c": true, "new.c": true}) {
+		t.Errorf("unexpected fixed files %v", fixed_files)
+	}
+
+	fixed_funcs, err := hop.GetFixedFuncs(git_url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fixed_funcs, map[string]bool{"parse": true}) {
+		t.Errorf("unexpected fixed functions %v", fixed_funcs)
+	}
+}
@@ -0,0 +1,179 @@
+package gitrepo
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	gity "github.com/yomaytk/go_ltrace/vulndb/gitrepo/types"
+	"golang.org/x/xerrors"
+)
+
+const (
+	HTTP_TIMEOUT = 60 * time.Second
+	// the max size of the patch and the source file
+	HTTP_MAX_BODY = 64 * 1024 * 1024
+)
+
+// PatchHost recognises the patch url scheme of the git hosting service.
+type PatchHost interface {
+	Supported(u *url.URL) bool
+	// the url of the raw unified diff
+	PatchURL(u *url.URL) (string, error)
+	// the revision before the patch
+	BaseRevision(hop HTTPOperation, u *url.URL) (string, error)
+	// the url of the file at the base revision ("" if the file doesn't exist before the patch)
+	FileURL(u *url.URL, base string, file_path string, patch string) (string, error)
+	// the patch in the local mirror of the repository
+	MirrorLocation(u *url.URL) (MirrorLocation, error)
+}
+
+// HTTPOperation fetches the raw patch and the files before the patch from the web interface of the host.
+type HTTPOperation struct {
+	Host   PatchHost
+	Client *http.Client
+}
+
+func NewHTTPOperation(host PatchHost) *HTTPOperation {
+	return &HTTPOperation{Host: host, Client: &http.Client{Timeout: HTTP_TIMEOUT}}
+}
+
+func NewGitlabOperation() *HTTPOperation {
+	return NewHTTPOperation(GitlabHost{})
+}
+
+func NewCgitOperation() *HTTPOperation {
+	return NewHTTPOperation(CgitHost{})
+}
+
+func NewGitwebOperation() *HTTPOperation {
+	return NewHTTPOperation(GitwebHost{})
+}
+
+func (hop HTTPOperation) Supported(git_url string) bool {
+	u, err := url.Parse(strings.TrimSpace(git_url))
+	return err == nil && hop.Host.Supported(u)
+}
+
+// get the body of the url. false if the url is not found.
+func (hop HTTPOperation) get(target string) (string, bool, error) {
+
+	res, err := hop.Client.Get(target)
+	if err != nil {
+		return "", false, xerrors.Errorf("cannot get %v: %w", target, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return "", false, nil
+	}
+	if res.StatusCode != http.StatusOK {
+		return "", false, xerrors.Errorf("cannot get %v: %v\n", target, res.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, HTTP_MAX_BODY))
+	if err != nil {
+		return "", false, xerrors.Errorf("cannot read %v: %w", target, err)
+	}
+
+	return string(body), true, nil
+}
+
+// get the raw patch of the url
+func (hop HTTPOperation) getPatch(git_url string) (*url.URL, string, error) {
+
+	u, err := url.Parse(strings.TrimSpace(git_url))
+	if err != nil || !hop.Host.Supported(u) {
+		return nil, "", xerrors.Errorf("unsupported patch url: %v\n", git_url)
+	}
+	patch_url, err := hop.Host.PatchURL(u)
+	if err != nil {
+		return nil, "", err
+	}
+	patch, found, err := hop.get(patch_url)
+	if err != nil {
+		return nil, "", err
+	}
+	if !found {
+		return nil, "", xerrors.Errorf("the patch %v is not found.\n", patch_url)
+	}
+
+	return u, patch, nil
+}
+
+func (hop HTTPOperation) GetDiff(git_url string) ([]FileDiff, error) {
+	_, patch, err := hop.getPatch(git_url)
+	if err != nil {
+		return []FileDiff{}, err
+	}
+	return SplitUnifiedDiff(patch), nil
+}
+
+func (hop HTTPOperation) GetFixedFiles(git_url string) (map[string]bool, error) {
+
+	fixed_files := map[string]bool{}
+
+	file_diffs, err := hop.GetDiff(git_url)
+	if err != nil {
+		return fixed_files, err
+	}
+
+	for _, file_diff := range file_diffs {
+		fixed_files[file_diff.FilePath] = true
+	}
+
+	return fixed_files, nil
+}
+
+func (hop HTTPOperation) GetFixedFuncs(git_url string) (map[string]bool, error) {
+
+	u, patch, err := hop.getPatch(git_url)
+	if err != nil {
+		return map[string]bool{}, err
+	}
+	file_diffs := scannableFileDiffs(SplitUnifiedDiff(patch))
+	if len(file_diffs) == 0 {
+		return map[string]bool{}, nil
+	}
+
+	base, err := hop.Host.BaseRevision(hop, u)
+	if err != nil {
+		return map[string]bool{}, err
+	}
+
+	// get the function locations of the files before the patch
+	file_func_locations := map[string][]gity.FuncLocation{}
+	for _, file_diff := range file_diffs {
+		file_url, err := hop.Host.FileURL(u, base, file_diff.FilePath, patch)
+		if err != nil {
+			return map[string]bool{}, err
+		}
+		// the file added by the patch
+		if strings.Compare(file_url, "") == 0 {
+			continue
+		}
+		content, found, err := hop.get(file_url)
+		if err != nil {
+			return map[string]bool{}, err
+		}
+		if !found {
+			continue
+		}
+		func_locations, err := getFuncLocation(file_diff.FilePath, content)
+		if err != nil {
+			return map[string]bool{}, err
+		}
+		file_func_locations[file_diff.FilePath] = func_locations
+	}
+
+	return getFixedFuncs(file_diffs, file_func_locations)
+}
+
+// the path of the url without .patch and .diff suffix
+func trimPatchSuffix(path string) string {
+	path = strings.TrimRight(path, "/")
+	path = strings.TrimSuffix(path, ".patch")
+	return strings.TrimSuffix(path, ".diff")
+}
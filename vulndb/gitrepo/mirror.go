@@ -0,0 +1,341 @@
+package gitrepo
+
+import (
+	"bytes"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	gity "github.com/yomaytk/go_ltrace/vulndb/gitrepo/types"
+	"golang.org/x/xerrors"
+)
+
+const (
+	CMD_GIT = "git"
+	// the object name of the empty tree (the parent of the root commit)
+	EMPTY_TREE = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+)
+
+// MirrorOperation reads the patches from the local mirror of the upstream repositories (git clone --mirror)
+// instead of the web interface of the host (GitHub, GitLab, cgit and gitweb), so that it works offline.
+// the repository is searched by the repository path of the host in the mirror directory.
+// ex.) <MirrorDir>/github.com/owner/repo.git, <MirrorDir>/owner/repo.git, <MirrorDir>/owner/repo,
+// <MirrorDir>/git.kernel.org/pub/scm/linux/kernel/git/torvalds/linux.git, <MirrorDir>/sourceware.org/glibc.git
+type MirrorOperation struct {
+	MirrorDir string
+}
+
+// MirrorLocation is the patch in the mirror of the repository.
+type MirrorLocation struct {
+	// the repository path of the host. ex.) owner/repo, GNOME/libxml2, glibc.git
+	Repository string
+	// the commit of the patch ("" for the pull request or the merge request)
+	Commit string
+	// the ref of the pull request or the merge request. ex.) refs/pull/12, refs/merge-requests/34
+	MergeRef string
+}
+
+// the hosts other than GitHub whose patch url is read from the mirror
+var mirror_hosts = []PatchHost{GitlabHost{}, CgitHost{}, GitwebHost{}}
+
+func NewMirrorOperation(mirror_dir string) *MirrorOperation {
+	return &MirrorOperation{MirrorDir: mirror_dir}
+}
+
+// the revisions of the patch. the patch is the diff from Base to Head.
+type mirrorRevision struct {
+	GitDir string
+	Base   string
+	Head   string
+}
+
+// find the mirror of the repository
+func (mop MirrorOperation) repository(host string, repo_path string) (string, error) {
+	repo_path = strings.TrimSuffix(strings.Trim(repo_path, "/"), ".git")
+	candidates := []string{
+		filepath.Join(mop.MirrorDir, host, repo_path+".git"),
+		filepath.Join(mop.MirrorDir, host, repo_path),
+		filepath.Join(mop.MirrorDir, repo_path+".git"),
+		filepath.Join(mop.MirrorDir, repo_path),
+	}
+	for _, candidate := range candidates {
+		if fi, err := os.Stat(candidate); err == nil && fi.IsDir() {
+			return candidate, nil
+		}
+	}
+	return "", xerrors.Errorf("%v is not mirrored in %v.\n", repo_path, mop.MirrorDir)
+}
+
+// execute git plumbing command in the repository
+func (mop MirrorOperation) git(git_dir string, args ...string) (string, error) {
+	cmd := exec.Command(CMD_GIT, append([]string{"--git-dir=" + git_dir}, args...)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", xerrors.Errorf("git %v failed: %v: %w", strings.Join(args, " "), strings.TrimSpace(stderr.String()), err)
+	}
+	return stdout.String(), nil
+}
+
+// resolve the revision to the commit sha
+func (mop MirrorOperation) revParse(git_dir string, rev string) (string, error) {
+	out, err := mop.git(git_dir, "rev-parse", "--verify", "--quiet", rev+"^{commit}")
+	if err != nil {
+		return "", xerrors.Errorf("%v is not found in %v: %w", rev, git_dir, err)
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// the first parent of the commit (the empty tree for the root commit)
+func (mop MirrorOperation) parent(git_dir string, sha string) (string, error) {
+	out, err := mop.git(git_dir, "rev-list", "--parents", "-n", "1", sha)
+	if err != nil {
+		return "", err
+	}
+	shas := strings.Fields(out)
+	if len(shas) < 2 {
+		return EMPTY_TREE, nil
+	}
+	return shas[1], nil
+}
+
+// the branch point of PR (or the merge request of GitLab). the merge-base of the default branch is the head of the merged PR itself, so
+// the first parent of refs/pull/<num>/merge (the base branch when the PR is tested) is used if it exists,
+// and otherwise the newest commit on the first-parent history of the default branch which PR contains.
+func (mop MirrorOperation) prBase(git_dir string, pr_ref string, head string) (string, error) {
+
+	if merge, err := mop.revParse(git_dir, pr_ref+"/merge"); err == nil {
+		base, err := mop.parent(git_dir, merge)
+		if err != nil {
+			return "", err
+		}
+		out, err := mop.git(git_dir, "merge-base", base, head)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(out), nil
+	}
+
+	out, err := mop.git(git_dir, "rev-list", head)
+	if err != nil {
+		return "", err
+	}
+	pr_commits := map[string]bool{}
+	for _, sha := range strings.Fields(out) {
+		pr_commits[sha] = true
+	}
+	out, err = mop.git(git_dir, "rev-list", "--first-parent", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	for _, sha := range strings.Fields(out) {
+		// the head is on the first-parent history if PR is merged by fast-forward
+		if pr_commits[sha] && strings.Compare(sha, head) != 0 {
+			return sha, nil
+		}
+	}
+
+	return "", xerrors.Errorf("the branch point of %v is not found in %v.\n", pr_ref, git_dir)
+}
+
+// resolve the patch url to the revisions in the mirror
+func (mop MirrorOperation) resolve(git_url string) (mirrorRevision, error) {
+
+	if github_url, err := ParseGithubURL(git_url); err == nil {
+		return mop.resolveGithub(github_url)
+	}
+
+	u, err := url.Parse(strings.TrimSpace(git_url))
+	if err != nil {
+		return mirrorRevision{}, xerrors.Errorf("strange patch url '%v': %w", git_url, err)
+	}
+	for _, host := range mirror_hosts {
+		if !host.Supported(u) {
+			continue
+		}
+		location, err := host.MirrorLocation(u)
+		if err != nil {
+			return mirrorRevision{}, err
+		}
+		return mop.resolveLocation(strings.ToLower(u.Hostname()), location)
+	}
+
+	return mirrorRevision{}, xerrors.Errorf("unsupported patch url: %v\n", git_url)
+}
+
+func (mop MirrorOperation) resolveGithub(github_url GithubURL) (mirrorRevision, error) {
+
+	location := MirrorLocation{Repository: github_url.Owner + "/" + github_url.Repo}
+
+	switch github_url.Type {
+	case GithubCommit:
+		location.Commit = github_url.Ref
+	case GithubPR:
+		// the commit in PR (/pull/<num>/commits/<sha>) is diffed against its parent
+		location.Commit = github_url.Ref
+		// the mirror of GitHub has refs/pull/<num>/head
+		location.MergeRef = "refs/pull/" + strconv.Itoa(github_url.PRNumber)
+	case GithubCompare:
+		return mop.resolveCompare(github_url)
+	}
+
+	return mop.resolveLocation("github.com", location)
+}
+
+func (mop MirrorOperation) resolveLocation(host string, location MirrorLocation) (mirrorRevision, error) {
+
+	revision := mirrorRevision{}
+
+	git_dir, err := mop.repository(host, location.Repository)
+	if err != nil {
+		return revision, err
+	}
+	revision.GitDir = git_dir
+
+	if strings.Compare(location.Commit, "") != 0 {
+		if revision.Head, err = mop.revParse(git_dir, location.Commit); err != nil {
+			return revision, err
+		}
+		revision.Base, err = mop.parent(git_dir, revision.Head)
+		return revision, err
+	}
+
+	if revision.Head, err = mop.revParse(git_dir, location.MergeRef+"/head"); err != nil {
+		return revision, err
+	}
+	revision.Base, err = mop.prBase(git_dir, location.MergeRef, revision.Head)
+
+	return revision, err
+}
+
+func (mop MirrorOperation) resolveCompare(github_url GithubURL) (mirrorRevision, error) {
+
+	revision := mirrorRevision{}
+
+	git_dir, err := mop.repository("github.com", github_url.Owner+"/"+github_url.Repo)
+	if err != nil {
+		return revision, err
+	}
+	revision.GitDir = git_dir
+
+	base, head := github_url.CompareRange()
+	if revision.Head, err = mop.revParse(git_dir, head); err != nil {
+		return revision, err
+	}
+	if revision.Base, err = mop.revParse(git_dir, base); err != nil {
+		return revision, err
+	}
+	// "base...head" is the diff from the merge base like GitHub
+	if strings.Contains(github_url.Ref, "...") {
+		out, err := mop.git(git_dir, "merge-base", revision.Base, revision.Head)
+		if err != nil {
+			return revision, err
+		}
+		revision.Base = strings.TrimSpace(out)
+	}
+
+	return revision, nil
+}
+
+// GetDiff gets the file diffs of the patch url from the mirror.
+func (mop MirrorOperation) GetDiff(git_url string) ([]FileDiff, error) {
+
+	revision, err := mop.resolve(git_url)
+	if err != nil {
+		return []FileDiff{}, err
+	}
+
+	return mop.diff(revision)
+}
+
+func (mop MirrorOperation) diff(revision mirrorRevision) ([]FileDiff, error) {
+
+	out, err := mop.git(revision.GitDir, "diff-tree", "-p", "-r", "--no-color", "--no-renames", "--no-ext-diff", "--full-index", revision.Base, revision.Head)
+	if err != nil {
+		return []FileDiff{}, err
+	}
+
+	return SplitUnifiedDiff(out), nil
+}
+
+// the file content at the revision (false if the file doesn't exist)
+func (mop MirrorOperation) fileContent(git_dir string, rev string, file_path string) (string, bool, error) {
+	if _, err := mop.git(git_dir, "cat-file", "-e", rev+":"+file_path); err != nil {
+		return "", false, nil
+	}
+	out, err := mop.git(git_dir, "cat-file", "blob", rev+":"+file_path)
+	if err != nil {
+		return "", false, err
+	}
+	return out, true, nil
+}
+
+func (mop MirrorOperation) GetFixedFiles(git_url string) (map[string]bool, error) {
+
+	fixed_files := map[string]bool{}
+
+	file_diffs, err := mop.GetDiff(git_url)
+	if err != nil {
+		return fixed_files, err
+	}
+
+	for _, file_diff := range file_diffs {
+		fixed_files[file_diff.FilePath] = true
+	}
+
+	return fixed_files, nil
+}
+
+func (mop MirrorOperation) GetFixedFuncs(git_url string) (map[string]bool, error) {
+
+	revision, err := mop.resolve(git_url)
+	if err != nil {
+		return map[string]bool{}, err
+	}
+
+	file_diffs, err := mop.diff(revision)
+	if err != nil {
+		return map[string]bool{}, err
+	}
+	file_diffs = scannableFileDiffs(file_diffs)
+
+	// get the function locations of the files before the patch
+	file_func_locations := map[string][]gity.FuncLocation{}
+	for _, file_diff := range file_diffs {
+		content, ok, err := mop.fileContent(revision.GitDir, revision.Base, file_diff.FilePath)
+		if err != nil {
+			return map[string]bool{}, err
+		}
+		// the file added by the patch
+		if !ok {
+			continue
+		}
+		func_locations, err := getFuncLocation(file_diff.FilePath, content)
+		if err != nil {
+			return map[string]bool{}, err
+		}
+		file_func_locations[file_diff.FilePath] = func_locations
+	}
+
+	return getFixedFuncs(file_diffs, file_func_locations)
+}
+
+func (mop MirrorOperation) Supported(git_url string) bool {
+	if _, err := ParseGithubURL(git_url); err == nil {
+		return true
+	}
+	u, err := url.Parse(strings.TrimSpace(git_url))
+	if err != nil {
+		return false
+	}
+	for _, host := range mirror_hosts {
+		if host.Supported(u) {
+			return true
+		}
+	}
+	return false
+}
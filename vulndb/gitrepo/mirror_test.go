@@ -0,0 +1,270 @@
+package gitrepo
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const before_source = `#include <string.h>
+
+int parse(const char *s)
+{
+    return strlen(s);
+}
+
+int unused(void)
+{
+    return 0;
+}
+`
+
+const after_source = `#include <string.h>
+
+int parse(const char *s)
+{
+    if (s == NULL)
+        return -1;
+    return strlen(s);
+}
+
+int unused(void)
+{
+    return 0;
+}
+`
+
+func runGit(t *testing.T, dir string, args ...string) string {
+	cmd := exec.Command(CMD_GIT, args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v: %s", args, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func TestMirrorOperation(t *testing.T) {
+
+	if _, err := exec.LookPath(CMD_GIT); err != nil {
+		t.Skip("git is not installed.")
+	}
+
+	// build the upstream repository and its mirror
+	work_dir := t.TempDir()
+	mirror_dir := t.TempDir()
+	runGit(t, work_dir, "init", "-q")
+	os.WriteFile(filepath.Join(work_dir, "parse.c"), []byte(before_source), 0644)
+	runGit(t, work_dir, "add", ".")
+	runGit(t, work_dir, "commit", "-q", "-m", "initial")
+	os.WriteFile(filepath.Join(work_dir, "parse.c"), []byte(after_source), 0644)
+	os.WriteFile(filepath.Join(work_dir, "NEWS"), []byte("fix\n"), 0644)
+	runGit(t, work_dir, "add", ".")
+	runGit(t, work_dir, "commit", "-q", "-m", "fix")
+	sha := runGit(t, work_dir, "rev-parse", "HEAD")
+	runGit(t, mirror_dir, "clone", "-q", "--mirror", work_dir, filepath.Join(mirror_dir, "github.com", "owner", "repo.git"))
+
+	mop := NewMirrorOperation(mirror_dir)
+	commit_url := "https://github.com/owner/repo/commit/" + sha
+
+	fixed_files, err := mop.GetFixedFiles(commit_url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fixed_files, map[string]bool{"parse.c": true, "NEWS": true}) {
+		t.Errorf("unexpected fixed files %v", fixed_files)
+	}
+
+	fixed_funcs, err := mop.GetFixedFuncs(commit_url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fixed_funcs, map[string]bool{"parse": true}) {
+		t.Errorf("unexpected fixed functions %v", fixed_funcs)
+	}
+
+	if _, err := mop.GetFixedFiles("https://github.com/other/repo/commit/" + sha); err == nil {
+		t.Errorf("the repository which is not mirrored must fail")
+	}
+}
+
+func TestSplitUnifiedDiff(t *testing.T) {
+
+	diff := `From 0123 Mon Sep 17 00:00:00 2001
+Subject: [PATCH] fix
+
+---
+ a.c | 2 +-
+diff --git a/a.c b/a.c
+index 0123..4567 100644
+--- a/a.c
++++ b/a.c
+@@ -1,3 +1,3 @@
+ int a;
+--- removed line
++int b;
+ int c;
+diff --git a/new.h b/new.h
+new file mode 100644
+--- /dev/null
++++ b/new.h
+@@ -0,0 +1 @@
++#define NEW 1
+\ No newline at end of file
+diff --git a/logo.png b/logo.png
+Binary files a/logo.png and b/logo.png differ
+-- 
+2.39.5
+`
+	expected := []FileDiff{
+		{FilePath: "a.c", Content: "@@ -1,3 +1,3 @@\n int a;\n--- removed line\n+int b;\n int c;"},
+		{FilePath: "new.h", Content: "@@ -0,0 +1 @@\n+#define NEW 1\n\\ No newline at end of file"},
+		{FilePath: "logo.png", Content: ""},
+	}
+	if file_diffs := SplitUnifiedDiff(diff); !reflect.DeepEqual(file_diffs, expected) {
+		t.Errorf("got %q", file_diffs)
+	}
+}
+
+func commitFile(t *testing.T, dir string, file string, content string) string {
+	if err := os.WriteFile(filepath.Join(dir, file), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, dir, "add", file)
+	runGit(t, dir, "commit", "-q", "-m", file)
+	return runGit(t, dir, "rev-parse", "HEAD")
+}
+
+func TestMirrorOperationPR(t *testing.T) {
+
+	if _, err := exec.LookPath(CMD_GIT); err != nil {
+		t.Skip("git is not installed.")
+	}
+
+	// main: initial -- NEWS -- merge of PR #1 -- main.c
+	//         \                /
+	// PR #1:   parse.c --------
+	//
+	// PR #2 (not merged, refs/pull/2/merge exists): a.c -- b.c
+	work_dir := t.TempDir()
+	mirror_dir := t.TempDir()
+	runGit(t, work_dir, "init", "-q", "-b", "main")
+	commitFile(t, work_dir, "parse.c", before_source)
+	runGit(t, work_dir, "checkout", "-q", "-b", "pr1")
+	pr1_head := commitFile(t, work_dir, "parse.c", after_source)
+	runGit(t, work_dir, "checkout", "-q", "main")
+	commitFile(t, work_dir, "NEWS", "news\n")
+	runGit(t, work_dir, "merge", "-q", "--no-ff", "-m", "merge", "pr1")
+
+	runGit(t, work_dir, "checkout", "-q", "-b", "pr2")
+	pr2_first := commitFile(t, work_dir, "a.c", "int a;\n")
+	pr2_head := commitFile(t, work_dir, "b.c", "int b;\n")
+	runGit(t, work_dir, "checkout", "-q", "main")
+	runGit(t, work_dir, "checkout", "-q", "-b", "pr2_merge")
+	runGit(t, work_dir, "merge", "-q", "--no-ff", "-m", "merge", "pr2")
+	pr2_merge := runGit(t, work_dir, "rev-parse", "HEAD")
+	runGit(t, work_dir, "checkout", "-q", "main")
+	commitFile(t, work_dir, "main.c", "int main;\n")
+
+	git_dir := filepath.Join(mirror_dir, "github.com", "owner", "repo.git")
+	runGit(t, mirror_dir, "clone", "-q", "--mirror", work_dir, git_dir)
+	runGit(t, git_dir, "update-ref", "refs/pull/1/head", pr1_head)
+	runGit(t, git_dir, "update-ref", "refs/pull/2/head", pr2_head)
+	runGit(t, git_dir, "update-ref", "refs/pull/2/merge", pr2_merge)
+
+	mop := NewMirrorOperation(mirror_dir)
+	tests := []struct {
+		git_url     string
+		fixed_files map[string]bool
+	}{
+		// the merge-base of the merged PR and the default branch is the head of PR
+		{"https://github.com/owner/repo/pull/1", map[string]bool{"parse.c": true}},
+		{"https://github.com/owner/repo/pull/2/files", map[string]bool{"a.c": true, "b.c": true}},
+		// only the commit in PR
+		{"https://github.com/owner/repo/pull/2/commits/" + pr2_first, map[string]bool{"a.c": true}},
+	}
+	for _, test := range tests {
+		fixed_files, err := mop.GetFixedFiles(test.git_url)
+		if err != nil {
+			t.Errorf("%v: %v", test.git_url, err)
+			continue
+		}
+		if !reflect.DeepEqual(fixed_files, test.fixed_files) {
+			t.Errorf("%v: unexpected fixed files %v", test.git_url, fixed_files)
+		}
+	}
+
+	fixed_funcs, err := mop.GetFixedFuncs("https://github.com/owner/repo/pull/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fixed_funcs, map[string]bool{"parse": true}) {
+		t.Errorf("unexpected fixed functions %v", fixed_funcs)
+	}
+}
+
+func TestMirrorOperationHosts(t *testing.T) {
+
+	if _, err := exec.LookPath(CMD_GIT); err != nil {
+		t.Skip("git is not installed.")
+	}
+
+	// main: initial -- fix, and the merge request: initial -- a.c
+	work_dir := t.TempDir()
+	mirror_dir := t.TempDir()
+	runGit(t, work_dir, "init", "-q", "-b", "main")
+	commitFile(t, work_dir, "parse.c", before_source)
+	runGit(t, work_dir, "checkout", "-q", "-b", "mr")
+	mr_head := commitFile(t, work_dir, "a.c", "int a;\n")
+	runGit(t, work_dir, "checkout", "-q", "main")
+	sha := commitFile(t, work_dir, "parse.c", after_source)
+
+	for _, repo_path := range []string{"gitlab.gnome.org/GNOME/libfoo.git", "git.kernel.org/pub/scm/linux/kernel/git/torvalds/linux.git", "sourceware.org/glibc.git"} {
+		runGit(t, mirror_dir, "clone", "-q", "--mirror", work_dir, filepath.Join(mirror_dir, repo_path))
+	}
+	runGit(t, filepath.Join(mirror_dir, "gitlab.gnome.org/GNOME/libfoo.git"), "update-ref", "refs/merge-requests/7/head", mr_head)
+
+	// the providers over HTTP are not used with the mirror
+	git_operation := NewGitOperation(mirror_dir, "")
+	if len(git_operation.Providers) != 1 {
+		t.Errorf("unexpected providers %v", git_operation.Providers)
+	}
+
+	tests := []struct {
+		git_url     string
+		fixed_funcs map[string]bool
+	}{
+		{"https://gitlab.gnome.org/GNOME/libfoo/-/commit/" + sha, map[string]bool{"parse": true}},
+		{"https://gitlab.gnome.org/GNOME/libfoo/-/merge_requests/7", map[string]bool{}},
+		{"https://git.kernel.org/linus/" + sha, map[string]bool{"parse": true}},
+		{"https://git.kernel.org/pub/scm/linux/kernel/git/torvalds/linux.git/commit/?id=" + sha, map[string]bool{"parse": true}},
+		{"https://sourceware.org/git/?p=glibc.git;a=commit;h=" + sha, map[string]bool{"parse": true}},
+	}
+	for _, test := range tests {
+		if !git_operation.Supported(test.git_url) {
+			t.Errorf("%v is not supported", test.git_url)
+			continue
+		}
+		fixed_funcs, err := git_operation.GetFixedFuncs(test.git_url)
+		if err != nil {
+			t.Errorf("%v: %v", test.git_url, err)
+			continue
+		}
+		if !reflect.DeepEqual(fixed_funcs, test.fixed_funcs) {
+			t.Errorf("%v: unexpected fixed functions %v", test.git_url, fixed_funcs)
+		}
+	}
+
+	fixed_files, err := git_operation.GetFixedFiles("https://gitlab.gnome.org/GNOME/libfoo/-/merge_requests/7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fixed_files, map[string]bool{"a.c": true}) {
+		t.Errorf("unexpected fixed files %v", fixed_files)
+	}
+}
@@ -0,0 +1,120 @@
+package gitrepo
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+type GithubURLType uint8
+
+const (
+	GithubCommit GithubURLType = iota
+	GithubPR
+	GithubCompare
+)
+
+// the patch location parsed from github url
+type GithubURL struct {
+	Type  GithubURLType
+	Owner string
+	Repo  string
+	// commit sha (GithubCommit), the head commit sha in PR (GithubPR, optional) or "base...head" (GithubCompare)
+	Ref      string
+	PRNumber int
+}
+
+// ParseGithubURL parses the github url of the patch. the fragment, the query, the "/files" suffix and
+// the ".patch"/".diff" suffix are ignored.
+// ex.) https://github.com/owner/repo/commit/<sha>.patch, https://github.com/owner/repo/pull/12/files#diff-xxx,
+// https://github.com/owner/repo/pull/12/commits/<sha>, https://github.com/owner/repo/compare/v1.0...v1.1
+func ParseGithubURL(git_url string) (GithubURL, error) {
+
+	github_url := GithubURL{}
+
+	u, err := url.Parse(strings.TrimSpace(git_url))
+	if err != nil {
+		return github_url, xerrors.Errorf("strange github url '%v': %w", git_url, err)
+	}
+	if strings.Compare(strings.TrimPrefix(u.Host, "www."), "github.com") != 0 {
+		return github_url, xerrors.Errorf("not github url: %v\n", git_url)
+	}
+
+	path := strings.Trim(u.Path, "/")
+	path = strings.TrimSuffix(path, ".patch")
+	path = strings.TrimSuffix(path, ".diff")
+	tokens := strings.Split(path, "/")
+	if len(tokens) < 4 || strings.Compare(tokens[3], "") == 0 {
+		return github_url, xerrors.Errorf("strange github url: %v\n", git_url)
+	}
+	github_url.Owner = tokens[0]
+	github_url.Repo = strings.TrimSuffix(tokens[1], ".git")
+
+	switch tokens[2] {
+	case "commit":
+		github_url.Type = GithubCommit
+		github_url.Ref = tokens[3]
+	case "pull":
+		github_url.Type = GithubPR
+		pull_num, err := strconv.Atoi(tokens[3])
+		if err != nil {
+			return github_url, xerrors.Errorf("strange PR number in github url: %v\n", git_url)
+		}
+		github_url.PRNumber = pull_num
+		// the commit in PR. ex.) /pull/12/commits/<sha>
+		if len(tokens) >= 6 && strings.Compare(tokens[4], "commits") == 0 {
+			github_url.Ref = tokens[5]
+		}
+	case "compare":
+		github_url.Type = GithubCompare
+		// the ref may contain slash. ex.) release/1.0...release/1.1
+		github_url.Ref = strings.Join(tokens[3:], "/")
+		if !strings.Contains(github_url.Ref, "..") {
+			return github_url, xerrors.Errorf("strange compare range in github url: %v\n", git_url)
+		}
+	default:
+		return github_url, xerrors.Errorf("unsupported github url: %v\n", git_url)
+	}
+
+	return github_url, nil
+}
+
+// the commit url of the commit in PR. ex.) /pull/12/commits/<sha> -> /commit/<sha>
+func (github_url GithubURL) commitURL() string {
+	return "https://github.com/" + github_url.Owner + "/" + github_url.Repo + "/commit/" + github_url.Ref
+}
+
+func (url_type GithubURLType) String() string {
+	switch url_type {
+	case GithubCommit:
+		return "commit"
+	case GithubPR:
+		return "pull"
+	case GithubCompare:
+		return "compare"
+	}
+	return ""
+}
+
+// the base and head of the compare range. ex.) "v1.0...v1.1" -> "v1.0", "v1.1"
+func (github_url GithubURL) CompareRange() (string, string) {
+	sep := "..."
+	if !strings.Contains(github_url.Ref, sep) {
+		sep = ".."
+	}
+	refs := strings.SplitN(github_url.Ref, sep, 2)
+	return refs[0], refs[1]
+}
+
+// the normalized url
+func (github_url GithubURL) String() string {
+	base := "https://github.com/" + github_url.Owner + "/" + github_url.Repo + "/"
+	switch github_url.Type {
+	case GithubPR:
+		return base + "pull/" + strconv.Itoa(github_url.PRNumber)
+	default:
+		return base + github_url.Type.String() + "/" + github_url.Ref
+	}
+}
@@ -0,0 +1,44 @@
+package gitrepo
+
+import "testing"
+
+func TestParseGithubURL(t *testing.T) {
+	tests := []struct {
+		git_url    string
+		expected   GithubURL
+		normalized string
+	}{
+		{"https://github.com/openssl/openssl/commit/0123abcd", GithubURL{Type: GithubCommit, Owner: "openssl", Repo: "openssl", Ref: "0123abcd"}, "https://github.com/openssl/openssl/commit/0123abcd"},
+		{"https://github.com/openssl/openssl/commit/0123abcd.patch", GithubURL{Type: GithubCommit, Owner: "openssl", Repo: "openssl", Ref: "0123abcd"}, "https://github.com/openssl/openssl/commit/0123abcd"},
+		{"https://github.com/openssl/openssl/commit/0123abcd#diff-0a1b", GithubURL{Type: GithubCommit, Owner: "openssl", Repo: "openssl", Ref: "0123abcd"}, "https://github.com/openssl/openssl/commit/0123abcd"},
+		{"https://github.com/hashicorp/vault/pull/19495/files", GithubURL{Type: GithubPR, Owner: "hashicorp", Repo: "vault", PRNumber: 19495}, "https://github.com/hashicorp/vault/pull/19495"},
+		{"https://github.com/hashicorp/vault/pull/19495.diff", GithubURL{Type: GithubPR, Owner: "hashicorp", Repo: "vault", PRNumber: 19495}, "https://github.com/hashicorp/vault/pull/19495"},
+		{"https://github.com/hashicorp/vault/pull/19495/commits/89abcdef", GithubURL{Type: GithubPR, Owner: "hashicorp", Repo: "vault", PRNumber: 19495, Ref: "89abcdef"}, "https://github.com/hashicorp/vault/pull/19495"},
+		{"https://github.com/madler/zlib/compare/v1.2.12...v1.2.13", GithubURL{Type: GithubCompare, Owner: "madler", Repo: "zlib", Ref: "v1.2.12...v1.2.13"}, "https://github.com/madler/zlib/compare/v1.2.12...v1.2.13"},
+		{"https://github.com/madler/zlib/compare/release/1.0...release/1.1.patch", GithubURL{Type: GithubCompare, Owner: "madler", Repo: "zlib", Ref: "release/1.0...release/1.1"}, "https://github.com/madler/zlib/compare/release/1.0...release/1.1"},
+	}
+	for _, test := range tests {
+		github_url, err := ParseGithubURL(test.git_url)
+		if err != nil {
+			t.Errorf("%v: %v", test.git_url, err)
+			continue
+		}
+		if github_url != test.expected {
+			t.Errorf("%v: got %+v, expected %+v", test.git_url, github_url, test.expected)
+		}
+		if github_url.String() != test.normalized {
+			t.Errorf("%v: normalized to %v, expected %v", test.git_url, github_url.String(), test.normalized)
+		}
+	}
+
+	base, head := GithubURL{Type: GithubCompare, Ref: "v1.2.12..v1.2.13"}.CompareRange()
+	if base != "v1.2.12" || head != "v1.2.13" {
+		t.Errorf("CompareRange: got %v, %v", base, head)
+	}
+
+	for _, invalid := range []string{"https://gitlab.com/a/b/commit/0123", "https://github.com/a/b", "https://github.com/a/b/issues/1", "https://github.com/a/b/pull/x", "https://github.com/a/b/compare/v1"} {
+		if _, err := ParseGithubURL(invalid); err == nil {
+			t.Errorf("ParseGithubURL(%v) must fail", invalid)
+		}
+	}
+}
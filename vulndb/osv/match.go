@@ -0,0 +1,144 @@
+package osv
+
+import (
+	"sort"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// the event of the range with its version
+type rangeEvent struct {
+	// introduced, fixed or last_affected
+	kind    string
+	version string
+}
+
+// the events sorted by the version. "0" of introduced is the lowest.
+func sortedEvents(events []Event, compare compareFunc) ([]rangeEvent, error) {
+
+	range_events := []rangeEvent{}
+	for _, event := range events {
+		switch {
+		case strings.Compare(event.Introduced, "") != 0:
+			range_events = append(range_events, rangeEvent{"introduced", event.Introduced})
+		case strings.Compare(event.Fixed, "") != 0:
+			range_events = append(range_events, rangeEvent{"fixed", event.Fixed})
+		case strings.Compare(event.LastAffected, "") != 0:
+			range_events = append(range_events, rangeEvent{"last_affected", event.LastAffected})
+		}
+		// limit is used only by the GIT range
+	}
+
+	var compare_err error
+	sort.SliceStable(range_events, func(i, j int) bool {
+		a, b := range_events[i].version, range_events[j].version
+		if strings.Compare(a, "0") == 0 || strings.Compare(b, "0") == 0 {
+			return strings.Compare(a, "0") == 0 && strings.Compare(b, "0") != 0
+		}
+		c, err := compare(a, b)
+		if err != nil {
+			compare_err = err
+		}
+		return c < 0
+	})
+	if compare_err != nil {
+		return nil, compare_err
+	}
+
+	return range_events, nil
+}
+
+// evaluateRange returns whether the version is in the range, and the fixed version of the range.
+// the fixed version is the next fix if the version is affected, or the last fix ("" if it is not fixed).
+func evaluateRange(affected_range Range, version string, compare compareFunc) (bool, string, error) {
+
+	range_events, err := sortedEvents(affected_range.Events, compare)
+	if err != nil {
+		return false, "", err
+	}
+
+	affected := false
+	fixed := ""
+	for _, event := range range_events {
+		c := -1
+		if strings.Compare(event.version, "0") != 0 {
+			if c, err = compare(event.version, version); err != nil {
+				return false, "", err
+			}
+		}
+		// the events above the version
+		if c > 0 || c == 0 && strings.Compare(event.kind, "last_affected") == 0 {
+			if affected && strings.Compare(event.kind, "fixed") == 0 {
+				return true, event.version, nil
+			}
+			if affected && strings.Compare(event.kind, "last_affected") == 0 {
+				return true, "", nil
+			}
+			continue
+		}
+		switch event.kind {
+		case "introduced":
+			affected = true
+		case "fixed":
+			affected = false
+			fixed = event.version
+		case "last_affected":
+			affected = false
+		}
+	}
+	if affected {
+		return true, "", nil
+	}
+
+	return false, fixed, nil
+}
+
+// evaluate returns whether the installed version is affected, the fixed version of the range and the reason.
+// the GIT range is skipped because the commit of the installed version is unknown.
+func (affected Affected) evaluate(version string) (bool, string, string, error) {
+
+	for _, affected_version := range affected.Versions {
+		if strings.Compare(affected_version, version) == 0 {
+			return true, "", "the affected version " + version + " is installed", nil
+		}
+	}
+
+	fixed := ""
+	for _, affected_range := range affected.Ranges {
+		var compare compareFunc
+		switch affected_range.Type {
+		case RANGE_ECOSYSTEM:
+			ecosystem_compare, err := versionOrder(affected.Package.Ecosystem)
+			if err != nil {
+				return false, "", "", err
+			}
+			compare = ecosystem_compare
+		case RANGE_SEMVER:
+			compare = compareSemver
+		case RANGE_GIT:
+			continue
+		default:
+			return false, "", "", xerrors.Errorf("unknown range type '%v'\n", affected_range.Type)
+		}
+
+		in_range, range_fixed, err := evaluateRange(affected_range, version, compare)
+		if err != nil {
+			return false, "", "", xerrors.Errorf("cannot compare the versions: %w", err)
+		}
+		if in_range {
+			if strings.Compare(range_fixed, "") == 0 {
+				return true, "", "no fix is released (installed " + version + ")", nil
+			}
+			return true, range_fixed, "fixed in " + range_fixed + " but installed " + version, nil
+		}
+		if strings.Compare(range_fixed, "") != 0 {
+			fixed = range_fixed
+		}
+	}
+
+	if strings.Compare(fixed, "") != 0 {
+		return false, fixed, "fixed in " + fixed + " (installed " + version + ")", nil
+	}
+	return false, "", "not in the affected versions", nil
+}
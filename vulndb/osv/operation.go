@@ -0,0 +1,222 @@
+package osv
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	log "github.com/yomaytk/go_ltrace/log"
+	ttypes "github.com/yomaytk/go_ltrace/types"
+	types "github.com/yomaytk/go_ltrace/vulndb"
+	git "github.com/yomaytk/go_ltrace/vulndb/gitrepo"
+)
+
+// the status of the package in the OSV record
+const (
+	STATUS_AFFECTED     = "affected"
+	STATUS_FIXED        = "fixed"
+	STATUS_NOT_AFFECTED = "not-affected"
+)
+
+// OSVOperation evaluates the OSV records of the language packages (PackageDetail.Ecosystem is set).
+type OSVOperation struct {
+	DB *Database
+	// the ecosystem of the dpkg packages (ex. Debian:12). "" is that the dpkg packages are not evaluated.
+	DistroEcosystem string
+	GitOperation    git.GitOperation
+}
+
+func NewOSVOperation(db *Database, distro_ecosystem string, git_operation git.GitOperation) *OSVOperation {
+	return &OSVOperation{DB: db, DistroEcosystem: distro_ecosystem, GitOperation: git_operation}
+}
+
+// GetCVEs returns the findings evaluated by the installed versions. the used files cannot be compared with the
+// fixed files of the language package, which are the sources rather than the built libraries.
+func (oop *OSVOperation) GetCVEs(src_bin_map map[ttypes.PackageDetail][]string) ([]types.Finding, []types.Failure, error) {
+	findings, failures := oop.GetOSVFindings(src_bin_map)
+	return findings, failures, nil
+}
+
+// GetReachableCVEs returns the findings filtered by the called functions as well as the installed versions.
+func (oop *OSVOperation) GetReachableCVEs(src_bin_map map[ttypes.PackageDetail][]string, lib_funcs_map map[string][]string, lib_exports_map map[string][]string) ([]types.Finding, []types.Failure, error) {
+
+	findings, failures := oop.GetOSVFindings(src_bin_map)
+
+	fmt.Fprintln(os.Stderr, "[+] GetOSVReachability Start.")
+
+	for i, finding := range findings {
+		if !finding.Kept() {
+			continue
+		}
+		call_funcs := map[string]bool{}
+		for _, target_file := range src_bin_map[finding.Package] {
+			for _, call_func := range lib_funcs_map[target_file] {
+				call_funcs[call_func] = true
+			}
+		}
+
+		// get the fixed functions of patch
+		fixed_funcs := map[string]bool{}
+		specified := len(finding.PatchURLs) > 0
+		for _, diff_url := range finding.PatchURLs {
+			if !oop.GitOperation.Supported(diff_url) {
+				specified = false
+				continue
+			}
+			new_fixed_funcs, err := oop.GitOperation.GetFixedFuncs(diff_url)
+			if err != nil {
+				log.Logger.Infoln("cannot get fixed functions:", err)
+				failures = append(failures, types.NewFailure(finding.Package.Sourcep, finding.CVE.Candidate, err))
+				specified = false
+				continue
+			}
+			for new_fixed_func := range new_fixed_funcs {
+				fixed_funcs[new_fixed_func] = true
+			}
+		}
+		if !specified || len(fixed_funcs) == 0 {
+			findings[i].Reason += "; the fixed functions cannot be specified"
+			continue
+		}
+		// the fix of only the internal functions may be reached by any exported function
+		fixed_funcs = types.ExportedFixedFuncs(fixed_funcs, src_bin_map[finding.Package], lib_exports_map)
+		if len(fixed_funcs) == 0 {
+			findings[i].Reason += "; the fixed functions cannot be specified (no fixed function is exported)"
+			continue
+		}
+		called_func := ""
+		for fixed_func := range fixed_funcs {
+			if call_funcs[fixed_func] {
+				called_func = fixed_func
+				break
+			}
+		}
+		if strings.Compare(called_func, "") == 0 {
+			findings[i].Verdict = types.VERDICT_FILTERED
+			findings[i].Justification = types.JUSTIFICATION_NOT_REACHABLE
+			findings[i].Reason += "; no fixed function is called"
+		} else {
+			findings[i].Reason += "; the fixed function is called (" + called_func + ")"
+		}
+	}
+
+	fmt.Fprintln(os.Stderr, "[-] GetOSVReachability End.")
+
+	return findings, failures, nil
+}
+
+// GetOSVFindings evaluates the affected ranges of the records for every package.
+// the records of the same vulnerability (ex. GHSA-xxxx and PYSEC-xxxx of the same CVE) are evaluated once.
+func (oop *OSVOperation) GetOSVFindings(src_bin_map map[ttypes.PackageDetail][]string) ([]types.Finding, []types.Failure) {
+
+	fmt.Fprintln(os.Stderr, "[+] GetOSVFindings Start.")
+
+	findings := []types.Finding{}
+	failures := []types.Failure{}
+
+	for package_detail := range src_bin_map {
+		// the dpkg package is matched by the source package
+		ecosystem, version := package_detail.Ecosystem, package_detail.Version
+		if strings.Compare(ecosystem, "") == 0 {
+			if strings.Compare(oop.DistroEcosystem, "") == 0 {
+				continue
+			}
+			ecosystem = oop.DistroEcosystem
+			if strings.Compare(package_detail.SourceVersion, "") != 0 {
+				version = package_detail.SourceVersion
+			}
+		}
+
+		seen := map[string]bool{}
+		for _, vulnerability := range oop.DB.Vulnerabilities(ecosystem, package_detail.Sourcep) {
+			if seen[vulnerability.ID] {
+				continue
+			}
+			seen[vulnerability.ID] = true
+			for _, alias := range vulnerability.Aliases {
+				seen[alias] = true
+			}
+
+			finding, err := vulnerability.evaluate(package_detail, ecosystem, version)
+			if err != nil {
+				log.Logger.Infow("cannot evaluate", "id", vulnerability.ID, "package", package_detail.Sourcep, "error", err)
+				failures = append(failures, types.NewFailure(package_detail.Sourcep, vulnerability.ID, err))
+				continue
+			}
+			findings = append(findings, finding)
+		}
+	}
+
+	fmt.Fprintln(os.Stderr, "[-] GetOSVFindings End.")
+
+	return findings, failures
+}
+
+// the CVE id of the record (the OSV id if it has no CVE alias)
+func (vulnerability *Vulnerability) cveID() string {
+	if strings.HasPrefix(vulnerability.ID, "CVE-") {
+		return vulnerability.ID
+	}
+	for _, alias := range vulnerability.Aliases {
+		if strings.HasPrefix(alias, "CVE-") {
+			return alias
+		}
+	}
+	return vulnerability.ID
+}
+
+// evaluate the affected entries of the package. the package is affected if any entry is affected.
+func (vulnerability *Vulnerability) evaluate(package_detail ttypes.PackageDetail, ecosystem string, version string) (types.Finding, error) {
+
+	description := vulnerability.Summary
+	if strings.Compare(description, "") == 0 {
+		description = vulnerability.Details
+	}
+	finding := types.Finding{
+		CVE:       types.CVE{Candidate: vulnerability.cveID(), Description: description, Priority: vulnerability.priority(), CVSS: vulnerability.cvss()},
+		Package:   package_detail,
+		PatchURLs: vulnerability.patchURLs(),
+	}
+
+	name := normalizeName(baseEcosystem(ecosystem), package_detail.Sourcep)
+	evaluated := false
+	fixed, reason := "", ""
+	for _, affected := range vulnerability.Affected {
+		if !ecosystemMatches(affected.Package.Ecosystem, ecosystem) || strings.Compare(normalizeName(baseEcosystem(ecosystem), affected.Package.Name), name) != 0 {
+			continue
+		}
+		evaluated = true
+		affected_version, affected_fixed, affected_reason, err := affected.evaluate(version)
+		if err != nil {
+			return finding, err
+		}
+		if affected_version {
+			finding.Status = STATUS_AFFECTED
+			finding.Verdict = types.VERDICT_KEPT
+			finding.Reason = affected_reason
+			return finding, nil
+		}
+		if strings.Compare(affected_fixed, "") != 0 || strings.Compare(reason, "") == 0 {
+			fixed, reason = affected_fixed, affected_reason
+		}
+	}
+
+	finding.Verdict = types.VERDICT_FILTERED
+	switch {
+	case !evaluated:
+		// the record is of another release. ex.) Debian:11 for Debian:12
+		finding.Status = STATUS_NOT_AFFECTED
+		finding.Justification = types.JUSTIFICATION_NOT_TRACKED
+		finding.Reason = "not tracked for " + ecosystem
+	case strings.Compare(fixed, "") != 0:
+		finding.Status = STATUS_FIXED + " (" + fixed + ")"
+		finding.Justification = types.JUSTIFICATION_FIXED
+		finding.Reason = reason
+	default:
+		finding.Status = STATUS_NOT_AFFECTED
+		finding.Justification = types.JUSTIFICATION_NOT_PRESENT
+		finding.Reason = reason
+	}
+
+	return finding, nil
+}
@@ -0,0 +1,281 @@
+// Package osv loads the OSV records (https://ossf.github.io/osv-schema/) from the local directory or the zip dump,
+// and evaluates the affected ranges of the installed packages by the version ordering of the ecosystem.
+package osv
+
+import (
+	"archive/zip"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+
+	types "github.com/yomaytk/go_ltrace/vulndb"
+	"golang.org/x/xerrors"
+)
+
+// the type of the affected range
+const (
+	RANGE_ECOSYSTEM = "ECOSYSTEM"
+	RANGE_SEMVER    = "SEMVER"
+	// the commits of the repository, which cannot be compared with the installed version
+	RANGE_GIT = "GIT"
+)
+
+// the reference type of the patch
+const REFERENCE_FIX = "FIX"
+
+type Vulnerability struct {
+	ID        string   `json:"id"`
+	Modified  string   `json:"modified"`
+	Withdrawn string   `json:"withdrawn"`
+	Aliases   []string `json:"aliases"`
+	Summary   string   `json:"summary"`
+	Details   string   `json:"details"`
+	// ex.) {"type": "CVSS_V3", "score": "CVSS:3.1/AV:N/..."}, {"type": "Ubuntu", "score": "medium"}
+	Severity         []Severity       `json:"severity"`
+	Affected         []Affected       `json:"affected"`
+	References       []Reference      `json:"references"`
+	DatabaseSpecific DatabaseSpecific `json:"database_specific"`
+}
+
+type Severity struct {
+	Type  string `json:"type"`
+	Score string `json:"score"`
+}
+
+type Reference struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+// the severity of GitHub Security Advisory. ex.) HIGH, MODERATE
+type DatabaseSpecific struct {
+	Severity string `json:"severity"`
+}
+
+type Affected struct {
+	Package  Package  `json:"package"`
+	Ranges   []Range  `json:"ranges"`
+	Versions []string `json:"versions"`
+}
+
+type Package struct {
+	// ex.) PyPI, Go, npm, Debian:12, Ubuntu:22.04:LTS
+	Ecosystem string `json:"ecosystem"`
+	Name      string `json:"name"`
+	Purl      string `json:"purl"`
+}
+
+type Range struct {
+	Type   string  `json:"type"`
+	Repo   string  `json:"repo"`
+	Events []Event `json:"events"`
+}
+
+// only one of the versions is set. "0" of Introduced is the lowest version.
+type Event struct {
+	Introduced   string `json:"introduced"`
+	Fixed        string `json:"fixed"`
+	LastAffected string `json:"last_affected"`
+	Limit        string `json:"limit"`
+}
+
+// Database is the OSV records indexed by the ecosystem and the package
+type Database struct {
+	// key: base ecosystem, normalized package name
+	vulnerabilities map[string]map[string][]*Vulnerability
+	// the number of the records
+	Count int
+}
+
+func newDatabase() *Database {
+	return &Database{vulnerabilities: map[string]map[string][]*Vulnerability{}}
+}
+
+// Load reads the OSV records (*.json) in the directory, the zip dump or the directory of the zip dumps.
+// ex.) the zip dump of the ecosystem: https://osv-vulnerabilities.storage.googleapis.com/PyPI/all.zip
+// the broken records are skipped and returned as the failures.
+func Load(path string) (*Database, []types.Failure, error) {
+
+	db := newDatabase()
+	failures := []types.Failure{}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("cannot find the OSV records: %w", err)
+	}
+	if !fi.IsDir() {
+		if err := db.loadZip(path, &failures); err != nil {
+			return nil, nil, err
+		}
+		return db, failures, nil
+	}
+
+	err = filepath.WalkDir(path, func(file_path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return nil
+		case strings.HasSuffix(file_path, ".zip"):
+			return db.loadZip(file_path, &failures)
+		case strings.HasSuffix(file_path, ".json"):
+			f, err := os.Open(file_path)
+			if err != nil {
+				failures = append(failures, types.NewFailure("", filepath.Base(file_path), err))
+				return nil
+			}
+			defer f.Close()
+			if err := db.add(f); err != nil {
+				failures = append(failures, types.NewFailure("", filepath.Base(file_path), err))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, xerrors.Errorf("cannot read the OSV records in %v: %w", path, err)
+	}
+
+	return db, failures, nil
+}
+
+func (db *Database) loadZip(zip_path string, failures *[]types.Failure) error {
+
+	r, err := zip.OpenReader(zip_path)
+	if err != nil {
+		return xerrors.Errorf("cannot open %v: %w", zip_path, err)
+	}
+	defer r.Close()
+
+	for _, file := range r.File {
+		if !strings.HasSuffix(file.Name, ".json") {
+			continue
+		}
+		f, err := file.Open()
+		if err != nil {
+			*failures = append(*failures, types.NewFailure("", file.Name, err))
+			continue
+		}
+		if err := db.add(f); err != nil {
+			*failures = append(*failures, types.NewFailure("", file.Name, err))
+		}
+		f.Close()
+	}
+
+	return nil
+}
+
+// add the record to the index of every affected package. the withdrawn record is ignored.
+func (db *Database) add(r io.Reader) error {
+
+	json := jsoniter.ConfigCompatibleWithStandardLibrary
+	var vulnerability Vulnerability
+	if err := json.NewDecoder(r).Decode(&vulnerability); err != nil {
+		return xerrors.Errorf("cannot decode the OSV record: %w", err)
+	}
+	if strings.Compare(vulnerability.ID, "") == 0 {
+		return xerrors.Errorf("the OSV record has no id.\n")
+	}
+	if strings.Compare(vulnerability.Withdrawn, "") != 0 {
+		return nil
+	}
+
+	added := map[string]bool{}
+	for _, affected := range vulnerability.Affected {
+		ecosystem := baseEcosystem(affected.Package.Ecosystem)
+		name := normalizeName(ecosystem, affected.Package.Name)
+		if added[ecosystem+" "+name] {
+			continue
+		}
+		added[ecosystem+" "+name] = true
+		if _, ok := db.vulnerabilities[ecosystem]; !ok {
+			db.vulnerabilities[ecosystem] = map[string][]*Vulnerability{}
+		}
+		db.vulnerabilities[ecosystem][name] = append(db.vulnerabilities[ecosystem][name], &vulnerability)
+	}
+	db.Count++
+
+	return nil
+}
+
+// Vulnerabilities returns the records of the package sorted by the id
+func (db *Database) Vulnerabilities(ecosystem string, name string) []*Vulnerability {
+	ecosystem = baseEcosystem(ecosystem)
+	vulnerabilities := append([]*Vulnerability{}, db.vulnerabilities[ecosystem][normalizeName(ecosystem, name)]...)
+	sort.Slice(vulnerabilities, func(i, j int) bool {
+		return strings.Compare(vulnerabilities[i].ID, vulnerabilities[j].ID) < 0
+	})
+	return vulnerabilities
+}
+
+var pypi_separator_re = regexp.MustCompile(`[-_.]+`)
+
+// the package name of PyPI is case insensitive and '-', '_' and '.' are the same (PEP 503). ex.) Pillow_SIMD -> pillow-simd
+func normalizeName(ecosystem string, name string) string {
+	if strings.Compare(ecosystem, ECOSYSTEM_PYPI) == 0 {
+		return pypi_separator_re.ReplaceAllString(strings.ToLower(name), "-")
+	}
+	return name
+}
+
+// the release of the ecosystem matches the installed one. the release is not compared if it is omitted.
+// ex.) Ubuntu:22.04:LTS and Ubuntu:Pro:22.04:LTS match Ubuntu:22.04
+func ecosystemMatches(ecosystem string, installed string) bool {
+	if strings.Compare(baseEcosystem(ecosystem), baseEcosystem(installed)) != 0 {
+		return false
+	}
+	release := func(ecosystem string) string {
+		parts := []string{}
+		for _, part := range strings.Split(ecosystem, ":")[1:] {
+			if strings.Compare(part, "LTS") != 0 && strings.Compare(part, "Pro") != 0 {
+				parts = append(parts, part)
+			}
+		}
+		return strings.Join(parts, ":")
+	}
+	installed_release := release(installed)
+	return strings.Compare(installed_release, "") == 0 || strings.Compare(release(ecosystem), installed_release) == 0
+}
+
+// the Ubuntu priority of the record. ex.) GHSA MODERATE -> medium
+func (vulnerability *Vulnerability) priority() string {
+	for _, severity := range vulnerability.Severity {
+		if strings.Compare(severity.Type, ECOSYSTEM_UBUNTU) == 0 {
+			return strings.ToLower(severity.Score)
+		}
+	}
+	switch severity := strings.ToLower(vulnerability.DatabaseSpecific.Severity); severity {
+	case "moderate":
+		return "medium"
+	case "critical", "high", "medium", "low":
+		return severity
+	}
+	return "untriaged"
+}
+
+// the CVSS vector of the record ("" if it is not scored)
+func (vulnerability *Vulnerability) cvss() string {
+	for _, severity := range vulnerability.Severity {
+		if strings.HasPrefix(severity.Type, "CVSS_") {
+			return severity.Score
+		}
+	}
+	return ""
+}
+
+// the urls of the fix commits
+func (vulnerability *Vulnerability) patchURLs() []string {
+	urls := []string{}
+	for _, reference := range vulnerability.References {
+		if strings.Compare(reference.Type, REFERENCE_FIX) == 0 {
+			urls = append(urls, reference.URL)
+		}
+	}
+	return urls
+}
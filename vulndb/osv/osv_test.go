@@ -0,0 +1,289 @@
+package osv
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	log "github.com/yomaytk/go_ltrace/log"
+	ttypes "github.com/yomaytk/go_ltrace/types"
+	types "github.com/yomaytk/go_ltrace/vulndb"
+	git "github.com/yomaytk/go_ltrace/vulndb/gitrepo"
+)
+
+const SAMPLE_GHSA = `{
+  "id": "GHSA-h5c8-rqwp-cp95",
+  "modified": "2023-11-08T04:12:38Z",
+  "aliases": ["CVE-2023-47641", "PYSEC-2023-250"],
+  "summary": "aiohttp has inconsistent interpretation of Content-Length vs. Transfer-Encoding",
+  "affected": [{"package": {"ecosystem": "PyPI", "name": "aiohttp"},
+    "ranges": [{"type": "ECOSYSTEM", "events": [{"introduced": "0"}, {"fixed": "3.8.0"}]}]}],
+  "references": [{"type": "FIX", "url": "https://github.com/aio-libs/aiohttp/commit/f016f0680e4ace6742b03a70cb0382ce86abe371"},
+    {"type": "WEB", "url": "https://github.com/aio-libs/aiohttp/security/advisories/GHSA-xx4v-prfh-6cgc"}],
+  "database_specific": {"severity": "MODERATE"}
+}`
+
+// the same vulnerability as GHSA-h5c8-rqwp-cp95
+const SAMPLE_PYSEC = `{
+  "id": "PYSEC-2023-250",
+  "aliases": ["CVE-2023-47641", "GHSA-h5c8-rqwp-cp95"],
+  "affected": [{"package": {"ecosystem": "PyPI", "name": "aiohttp"},
+    "ranges": [{"type": "ECOSYSTEM", "events": [{"introduced": "0"}, {"fixed": "3.8.0"}]}]}]
+}`
+
+const SAMPLE_GHSA_NO_CVE = `{
+  "id": "GHSA-q3qx-c6g2-7pw2",
+  "summary": "aiohttp's ClientSession is vulnerable to CRLF injection via version",
+  "affected": [{"package": {"ecosystem": "PyPI", "name": "AIOHTTP"},
+    "ranges": [{"type": "ECOSYSTEM", "events": [{"introduced": "3.9.0"}, {"last_affected": "3.9.1"}]}]}]
+}`
+
+const SAMPLE_WITHDRAWN = `{"id": "GHSA-xxxx-xxxx-xxxx", "withdrawn": "2023-01-01T00:00:00Z",
+  "affected": [{"package": {"ecosystem": "PyPI", "name": "aiohttp"}, "versions": ["3.8.5"]}]}`
+
+const SAMPLE_DEBIAN = `{
+  "id": "DSA-5514-1",
+  "aliases": ["CVE-2023-4911"],
+  "affected": [{"package": {"ecosystem": "Debian:12", "name": "glibc"},
+    "ranges": [{"type": "ECOSYSTEM", "events": [{"introduced": "0"}, {"fixed": "2.36-9+deb12u3"}]}]},
+    {"package": {"ecosystem": "Debian:11", "name": "glibc"},
+    "ranges": [{"type": "ECOSYSTEM", "events": [{"introduced": "0"}, {"fixed": "2.31-13+deb11u7"}]}]}]
+}`
+
+const SAMPLE_GO = `{
+  "id": "GO-2023-2102",
+  "aliases": ["CVE-2023-39325", "GHSA-4374-p667-p6c8"],
+  "affected": [{"package": {"ecosystem": "Go", "name": "golang.org/x/net"},
+    "ranges": [{"type": "SEMVER", "events": [{"introduced": "0"}, {"fixed": "0.17.0"}]},
+      {"type": "GIT", "repo": "https://go.googlesource.com/net", "events": [{"introduced": "0"}, {"limit": "88194ad"}]}]}]
+}`
+
+func TestCompareVersions(t *testing.T) {
+
+	tests := []struct {
+		ecosystem string
+		a         string
+		b         string
+		expected  int
+	}{
+		{ECOSYSTEM_PYPI, "1.0.dev1", "1.0a1", -1},
+		{ECOSYSTEM_PYPI, "1.0a1", "1.0b2", -1},
+		{ECOSYSTEM_PYPI, "1.0rc1", "1.0", -1},
+		{ECOSYSTEM_PYPI, "1.0", "1.0.0", 0},
+		{ECOSYSTEM_PYPI, "1.0", "1.0.post1", -1},
+		{ECOSYSTEM_PYPI, "1.0-1", "1.0.post1", 0},
+		{ECOSYSTEM_PYPI, "1.0.post1.dev1", "1.0.post1", -1},
+		{ECOSYSTEM_PYPI, "2.0", "1!0.1", -1},
+		{ECOSYSTEM_PYPI, "1.10", "1.9", 1},
+		{ECOSYSTEM_PYPI, "1.0+ubuntu1", "1.0", 0},
+		{ECOSYSTEM_GO, "v1.2.3", "1.10.0", -1},
+		{ECOSYSTEM_GO, "1.10.0-rc.1", "1.10.0", -1},
+		{ECOSYSTEM_GO, "0.0.0-20231010170000-abcdef", "0.17.0", -1},
+		{ECOSYSTEM_NPM, "1.0.0-alpha.1", "1.0.0-alpha.beta", -1},
+		{ECOSYSTEM_NPM, "1.0.0+build.1", "1.0.0", 0},
+		{"Debian:12", "2.36-9+deb12u3", "2.36-9+deb12u13", -1},
+		{"Ubuntu:22.04:LTS", "1:1.0", "2.0", 1},
+	}
+	for _, test := range tests {
+		compare, err := versionOrder(test.ecosystem)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := compare(test.a, test.b)
+		if err != nil {
+			t.Errorf("compare(%v, %v) of %v: %v", test.a, test.b, test.ecosystem, err)
+			continue
+		}
+		if c < 0 && test.expected >= 0 || c > 0 && test.expected <= 0 || c == 0 && test.expected != 0 {
+			t.Errorf("compare(%v, %v) of %v = %v, expected %v", test.a, test.b, test.ecosystem, c, test.expected)
+		}
+	}
+
+	if _, err := versionOrder("Maven"); err == nil {
+		t.Errorf("the version ordering of Maven is accepted")
+	}
+	if _, err := comparePEP440("1.0", "not a version"); err == nil {
+		t.Errorf("the invalid PEP 440 version is accepted")
+	}
+}
+
+func TestEvaluateRange(t *testing.T) {
+
+	// affected: [1.0, 1.5), [2.0, 2.3], [3.0, ...)
+	affected_range := Range{Type: RANGE_ECOSYSTEM, Events: []Event{{Introduced: "2.0"}, {Fixed: "1.5"}, {Introduced: "1.0"},
+		{LastAffected: "2.3"}, {Introduced: "3.0"}}}
+	tests := []struct {
+		version  string
+		affected bool
+		fixed    string
+	}{
+		{"0.9", false, ""},
+		{"1.0", true, "1.5"},
+		{"1.4.9", true, "1.5"},
+		{"1.5", false, "1.5"},
+		{"2.3", true, ""},
+		{"2.4", false, "1.5"},
+		{"3.1", true, ""},
+	}
+	for _, test := range tests {
+		affected, fixed, err := evaluateRange(affected_range, test.version, comparePEP440)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if affected != test.affected || strings.Compare(fixed, test.fixed) != 0 {
+			t.Errorf("evaluateRange(%v) = %v, %v, expected %v, %v", test.version, affected, fixed, test.affected, test.fixed)
+		}
+	}
+
+	// introduced "0" is the lowest version even if it cannot be compared
+	if affected, _, err := evaluateRange(Range{Events: []Event{{Introduced: "0"}}}, "1.0", comparePEP440); err != nil || !affected {
+		t.Errorf("the version after introduced 0 is not affected: %v", err)
+	}
+}
+
+// write the records to the directory and the zip dump
+func writeRecords(t *testing.T, dir string, records map[string]string) {
+	for name, record := range records {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(record), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func writeZip(t *testing.T, zip_path string, records map[string]string) {
+	f, err := os.Create(zip_path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w := zip.NewWriter(f)
+	for name, record := range records {
+		entry, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := entry.Write([]byte(record)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+
+	dir := t.TempDir()
+	writeRecords(t, dir, map[string]string{"GHSA-h5c8-rqwp-cp95.json": SAMPLE_GHSA, "GHSA-xxxx-xxxx-xxxx.json": SAMPLE_WITHDRAWN,
+		"broken.json": "{", "README.md": "not a record"})
+	// the zip dump of the ecosystem in the directory
+	if err := os.MkdirAll(filepath.Join(dir, "Go"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeZip(t, filepath.Join(dir, "Go", "all.zip"), map[string]string{"GO-2023-2102.json": SAMPLE_GO})
+
+	db, failures, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.Count != 2 || len(failures) != 1 || strings.Compare(failures[0].CVE, "broken.json") != 0 {
+		t.Fatalf("count = %v, failures = %v", db.Count, failures)
+	}
+	// the withdrawn record is skipped
+	if vulnerabilities := db.Vulnerabilities(ECOSYSTEM_PYPI, "aiohttp"); len(vulnerabilities) != 1 {
+		t.Errorf("unexpected records of aiohttp: %v", vulnerabilities)
+	}
+	if vulnerabilities := db.Vulnerabilities(ECOSYSTEM_GO, "golang.org/x/net"); len(vulnerabilities) != 1 {
+		t.Errorf("unexpected records of golang.org/x/net: %v", vulnerabilities)
+	}
+
+	// the zip dump itself
+	zip_path := filepath.Join(t.TempDir(), "all.zip")
+	writeZip(t, zip_path, map[string]string{"DSA-5514-1.json": SAMPLE_DEBIAN})
+	db, _, err = Load(zip_path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vulnerabilities := db.Vulnerabilities("Debian:12", "glibc"); len(vulnerabilities) != 1 {
+		t.Errorf("unexpected records of glibc: %v", vulnerabilities)
+	}
+
+	if _, _, err := Load(filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("the missing path is accepted")
+	}
+}
+
+func TestGetCVEs(t *testing.T) {
+
+	log.InitLogger("")
+
+	dir := t.TempDir()
+	writeRecords(t, dir, map[string]string{"GHSA-h5c8-rqwp-cp95.json": SAMPLE_GHSA, "PYSEC-2023-250.json": SAMPLE_PYSEC,
+		"GHSA-q3qx-c6g2-7pw2.json": SAMPLE_GHSA_NO_CVE, "DSA-5514-1.json": SAMPLE_DEBIAN, "GO-2023-2102.json": SAMPLE_GO})
+	db, _, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the extension module of aiohttp loaded by python3
+	aiohttp := ttypes.PackageDetail{Binaryp: "aiohttp", Sourcep: "aiohttp", Version: "3.9.1", SourceVersion: "3.9.1", Ecosystem: ECOSYSTEM_PYPI}
+	x_net := ttypes.PackageDetail{Binaryp: "golang.org/x/net", Sourcep: "golang.org/x/net", Version: "v0.17.0", SourceVersion: "v0.17.0", Ecosystem: ECOSYSTEM_GO}
+	libc := ttypes.PackageDetail{Binaryp: "libc6", Sourcep: "glibc", Version: "2.36-9+deb12u1", SourceVersion: "2.36-9+deb12u1"}
+	src_bin_map := map[ttypes.PackageDetail][]string{aiohttp: {"/usr/lib/python3/dist-packages/aiohttp/_http_parser.cpython-311-x86_64-linux-gnu.so"},
+		x_net: {}, libc: {"/lib/x86_64-linux-gnu/libc.so.6"}}
+
+	findings, failures, err := NewOSVOperation(db, "", git.ProviderSet{}).GetCVEs(src_bin_map)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// PYSEC-2023-250 is the same as GHSA-h5c8-rqwp-cp95, and the dpkg package is not evaluated
+	if len(findings) != 3 || len(failures) != 0 {
+		t.Fatalf("findings = %+v, failures = %v", findings, failures)
+	}
+	expected := map[string]types.Finding{
+		"CVE-2023-47641":      {Status: "fixed (3.8.0)", Verdict: types.VERDICT_FILTERED, Justification: types.JUSTIFICATION_FIXED, Reason: "fixed in 3.8.0 (installed 3.9.1)"},
+		"GHSA-q3qx-c6g2-7pw2": {Status: STATUS_AFFECTED, Verdict: types.VERDICT_KEPT, Reason: "no fix is released (installed 3.9.1)"},
+		"CVE-2023-39325":      {Status: "fixed (0.17.0)", Verdict: types.VERDICT_FILTERED, Justification: types.JUSTIFICATION_FIXED, Reason: "fixed in 0.17.0 (installed v0.17.0)"},
+	}
+	for _, finding := range findings {
+		e, ok := expected[finding.CVE.Candidate]
+		if !ok || strings.Compare(finding.Status, e.Status) != 0 || strings.Compare(finding.Verdict, e.Verdict) != 0 ||
+			strings.Compare(finding.Justification, e.Justification) != 0 || strings.Compare(finding.Reason, e.Reason) != 0 {
+			t.Errorf("unexpected finding: %+v", finding)
+		}
+		if strings.Compare(finding.CVE.Candidate, "CVE-2023-47641") == 0 && (strings.Compare(finding.CVE.Priority, "medium") != 0 || len(finding.PatchURLs) != 1) {
+			t.Errorf("unexpected CVE: %+v, patches: %v", finding.CVE, finding.PatchURLs)
+		}
+	}
+
+	// the dpkg packages are evaluated by the ecosystem of the distro
+	findings, _, err = NewOSVOperation(db, "Debian:12", git.ProviderSet{}).GetCVEs(map[ttypes.PackageDetail][]string{libc: {}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 1 || !findings[0].Kept() || strings.Compare(findings[0].Reason, "fixed in 2.36-9+deb12u3 but installed 2.36-9+deb12u1") != 0 {
+		t.Errorf("unexpected findings: %+v", findings)
+	}
+	findings, _, err = NewOSVOperation(db, "Debian:13", git.ProviderSet{}).GetCVEs(map[ttypes.PackageDetail][]string{libc: {}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 1 || strings.Compare(findings[0].Justification, types.JUSTIFICATION_NOT_TRACKED) != 0 {
+		t.Errorf("unexpected findings: %+v", findings)
+	}
+
+	// the fixed functions of the kept vulnerability cannot be fetched without the providers
+	findings, _, err = NewOSVOperation(db, "", git.ProviderSet{}).GetReachableCVEs(map[ttypes.PackageDetail][]string{aiohttp: {}}, map[string][]string{}, map[string][]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, finding := range findings {
+		if finding.Kept() && !strings.HasSuffix(finding.Reason, "the fixed functions cannot be specified") {
+			t.Errorf("unexpected finding: %+v", finding)
+		}
+	}
+}
+
+var _ types.Source = (*OSVOperation)(nil)
@@ -0,0 +1,240 @@
+package osv
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/yomaytk/go_ltrace/pkg/debversion"
+	"golang.org/x/xerrors"
+)
+
+// the ecosystem of OSV (the release after ':' is omitted). ex.) Debian:12 -> Debian
+const (
+	ECOSYSTEM_UBUNTU = "Ubuntu"
+	ECOSYSTEM_DEBIAN = "Debian"
+	ECOSYSTEM_GO     = "Go"
+	ECOSYSTEM_PYPI   = "PyPI"
+	ECOSYSTEM_NPM    = "npm"
+)
+
+// the comparison of two versions (negative if a < b, 0 if a == b, positive if a > b)
+type compareFunc func(a string, b string) (int, error)
+
+// the version ordering of the ecosystem
+func versionOrder(ecosystem string) (compareFunc, error) {
+	switch baseEcosystem(ecosystem) {
+	case ECOSYSTEM_UBUNTU, ECOSYSTEM_DEBIAN:
+		return debversion.Compare, nil
+	case ECOSYSTEM_GO, ECOSYSTEM_NPM:
+		return compareSemver, nil
+	case ECOSYSTEM_PYPI:
+		return comparePEP440, nil
+	default:
+		return nil, xerrors.Errorf("the version ordering of %v is not supported.\n", ecosystem)
+	}
+}
+
+// the ecosystem without the release. ex.) Ubuntu:22.04:LTS -> Ubuntu
+func baseEcosystem(ecosystem string) string {
+	return strings.SplitN(ecosystem, ":", 2)[0]
+}
+
+// compare the numeric identifiers without the overflow. ex.) "10" > "9"
+func compareNumber(a string, b string) int {
+	a = strings.TrimLeft(a, "0")
+	b = strings.TrimLeft(b, "0")
+	if len(a) != len(b) {
+		return len(a) - len(b)
+	}
+	return strings.Compare(a, b)
+}
+
+func numeric(s string) bool {
+	if strings.Compare(s, "") == 0 {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// compareSemver compares the versions of Semantic Versioning 2.0.0. the leading 'v' of Go is allowed,
+// and the build metadata is ignored. ex.) v1.2.3 < 1.10.0-rc.1 < 1.10.0
+func compareSemver(a string, b string) (int, error) {
+
+	parse := func(version string) ([]string, []string, error) {
+		version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+		if build_id := strings.Index(version, "+"); build_id != -1 {
+			version = version[:build_id]
+		}
+		pre := []string{}
+		if pre_id := strings.Index(version, "-"); pre_id != -1 {
+			pre = strings.Split(version[pre_id+1:], ".")
+			version = version[:pre_id]
+		}
+		core := strings.Split(version, ".")
+		if len(core) > 3 {
+			return nil, nil, xerrors.Errorf("invalid semantic version: %v\n", version)
+		}
+		for _, c := range core {
+			if !numeric(c) {
+				return nil, nil, xerrors.Errorf("invalid semantic version: %v\n", version)
+			}
+		}
+		// 1.2 is 1.2.0
+		for len(core) < 3 {
+			core = append(core, "0")
+		}
+		return core, pre, nil
+	}
+
+	a_core, a_pre, err := parse(a)
+	if err != nil {
+		return 0, err
+	}
+	b_core, b_pre, err := parse(b)
+	if err != nil {
+		return 0, err
+	}
+	for i := range a_core {
+		if c := compareNumber(a_core[i], b_core[i]); c != 0 {
+			return c, nil
+		}
+	}
+
+	// the version without the pre-release is higher
+	if len(a_pre) == 0 || len(b_pre) == 0 {
+		return len(b_pre) - len(a_pre), nil
+	}
+	for i := 0; i < len(a_pre) && i < len(b_pre); i++ {
+		a_numeric, b_numeric := numeric(a_pre[i]), numeric(b_pre[i])
+		switch {
+		case a_numeric && b_numeric:
+			if c := compareNumber(a_pre[i], b_pre[i]); c != 0 {
+				return c, nil
+			}
+		// the numeric identifier is lower than the alphanumeric one
+		case a_numeric:
+			return -1, nil
+		case b_numeric:
+			return 1, nil
+		default:
+			if c := strings.Compare(a_pre[i], b_pre[i]); c != 0 {
+				return c, nil
+			}
+		}
+	}
+	return len(a_pre) - len(b_pre), nil
+}
+
+var pep440_re = regexp.MustCompile(`^v?(?:(\d+)!)?(\d+(?:\.\d+)*)` +
+	`(?:[-_.]?(a|b|c|rc|alpha|beta|pre|preview)[-_.]?(\d*))?` +
+	`(?:-(\d+)|[-_.]?(post|rev|r)[-_.]?(\d*))?` +
+	`(?:[-_.]?(dev)[-_.]?(\d*))?` +
+	`(?:\+[a-z0-9]+(?:[-_.][a-z0-9]+)*)?$`)
+
+// the phase of the pre-release of PEP 440
+var pep440_phases = map[string]int{"a": 0, "alpha": 0, "b": 1, "beta": 1, "c": 2, "rc": 2, "pre": 2, "preview": 2}
+
+// the version of PEP 440 as the comparable key
+type pep440Version struct {
+	epoch   string
+	release []string
+	// -1 for the dev release without the pre-release, 3 for the final release
+	phase int
+	pre   string
+	// "" if it is not the post-release
+	post string
+	dev  string
+	// the version without .devN is higher
+	final bool
+}
+
+func parsePEP440(version string) (pep440Version, error) {
+
+	m := pep440_re.FindStringSubmatch(strings.ToLower(strings.TrimSpace(version)))
+	if m == nil {
+		return pep440Version{}, xerrors.Errorf("invalid PEP 440 version: %v\n", version)
+	}
+	v := pep440Version{epoch: m[1], release: strings.Split(m[2], "."), phase: 3, final: strings.Compare(m[8], "") == 0}
+	if strings.Compare(m[3], "") != 0 {
+		v.phase = pep440_phases[m[3]]
+		v.pre = m[4]
+	}
+	// the implicit post-release (1.0-1) or the explicit one (1.0.post1, 1.0.post is 1.0.post0)
+	if strings.Compare(m[5], "") != 0 {
+		v.post = m[5]
+	} else if strings.Compare(m[6], "") != 0 {
+		v.post = "0" + m[7]
+	}
+	v.dev = m[9]
+	// 1.0.dev1 is lower than 1.0a1
+	if !v.final && strings.Compare(m[3], "") == 0 && strings.Compare(v.post, "") == 0 {
+		v.phase = -1
+	}
+	return v, nil
+}
+
+// comparePEP440 compares the versions of PEP 440. the local version is ignored.
+// ex.) 1.0.dev1 < 1.0a1 < 1.0rc1 < 1.0 < 1.0.post1 < 1!0.1
+func comparePEP440(a string, b string) (int, error) {
+
+	v_a, err := parsePEP440(a)
+	if err != nil {
+		return 0, err
+	}
+	v_b, err := parsePEP440(b)
+	if err != nil {
+		return 0, err
+	}
+
+	if c := compareNumber(v_a.epoch, v_b.epoch); c != 0 {
+		return c, nil
+	}
+	// the missing release segment is zero. ex.) 1.0 == 1.0.0
+	for i := 0; i < len(v_a.release) || i < len(v_b.release); i++ {
+		a_part, b_part := "0", "0"
+		if i < len(v_a.release) {
+			a_part = v_a.release[i]
+		}
+		if i < len(v_b.release) {
+			b_part = v_b.release[i]
+		}
+		if c := compareNumber(a_part, b_part); c != 0 {
+			return c, nil
+		}
+	}
+	if v_a.phase != v_b.phase {
+		return v_a.phase - v_b.phase, nil
+	}
+	if c := compareNumber(v_a.pre, v_b.pre); c != 0 {
+		return c, nil
+	}
+	// the version without the post-release is lower
+	if c := comparePart(v_a.post, v_b.post, -1); c != 0 {
+		return c, nil
+	}
+	if v_a.final != v_b.final {
+		if v_a.final {
+			return 1, nil
+		}
+		return -1, nil
+	}
+	return compareNumber(v_a.dev, v_b.dev), nil
+}
+
+// compare the optional numbers. missing is the result when only a is missing.
+func comparePart(a string, b string, missing int) int {
+	switch {
+	case strings.Compare(a, "") == 0 && strings.Compare(b, "") == 0:
+		return 0
+	case strings.Compare(a, "") == 0:
+		return missing
+	case strings.Compare(b, "") == 0:
+		return -missing
+	}
+	return compareNumber(a, b)
+}
@@ -1,5 +1,11 @@
 package types
 
+import (
+	"strings"
+
+	ttypes "github.com/yomaytk/go_ltrace/types"
+)
+
 type Severity uint8
 
 const (
@@ -20,3 +26,74 @@ type CVE struct {
 	Priority    string `json:"priority"`
 	CVSS        string `json:"cvss"`
 }
+
+// the verdict of the CVE for the target
+const (
+	VERDICT_KEPT     = "kept"
+	VERDICT_FILTERED = "filtered"
+)
+
+// the justification why the CVE is filtered
+const (
+	// the fixed version is installed
+	JUSTIFICATION_FIXED = "fixed"
+	// the package is not affected (ex. DNE, not-affected of the tracker)
+	JUSTIFICATION_NOT_PRESENT = "not_present"
+	// the CVE is not tracked for the release, so whether the package is affected is unknown
+	JUSTIFICATION_NOT_TRACKED = "not_tracked"
+	// the fixed functions are not called by the target
+	JUSTIFICATION_NOT_REACHABLE = "not_reachable"
+)
+
+// Finding is the CVE of the installed package with the status in the distribution and the reason why it is kept or filtered.
+type Finding struct {
+	CVE     CVE                  `json:"cve"`
+	Package ttypes.PackageDetail `json:"package"`
+	Status  string               `json:"status"`
+	Verdict string               `json:"verdict"`
+	Reason  string               `json:"reason"`
+	// the justification of the filtered CVE ("" if the CVE is kept)
+	Justification string   `json:"justification,omitempty"`
+	PatchURLs     []string `json:"patch_urls"`
+}
+
+func (finding Finding) Kept() bool {
+	return strings.Compare(finding.Verdict, VERDICT_KEPT) == 0
+}
+
+// Failure is the package or the CVE which cannot be evaluated. the scan goes on without it.
+type Failure struct {
+	// the source package
+	Package string `json:"package"`
+	// "" if the whole package cannot be evaluated
+	CVE   string `json:"cve,omitempty"`
+	Error string `json:"error"`
+}
+
+func NewFailure(package_name string, cve_id string, err error) Failure {
+	return Failure{Package: package_name, CVE: cve_id, Error: strings.TrimSpace(err.Error())}
+}
+
+// Source is the vulnerability source of the distro. ex.) Ubuntu CVE Tracker, Debian Security Tracker
+type Source interface {
+	// GetCVEs evaluates the CVEs of the source packages by the used shared libraries
+	GetCVEs(src_bin_map map[ttypes.PackageDetail][]string) ([]Finding, []Failure, error)
+	// GetReachableCVEs evaluates the CVEs of the source packages by the called functions.
+	// lib_exports_map is the functions exported by every library (key: library path).
+	GetReachableCVEs(src_bin_map map[ttypes.PackageDetail][]string, lib_funcs_map map[string][]string, lib_exports_map map[string][]string) ([]Finding, []Failure, error)
+}
+
+// ExportedFixedFuncs returns the fixed functions exported by the libraries. the called functions are only the
+// exported functions called across the library boundary, so the fixed static or internal functions cannot be
+// compared with them.
+func ExportedFixedFuncs(fixed_funcs map[string]bool, target_files []string, lib_exports_map map[string][]string) map[string]bool {
+	exported_fixed_funcs := map[string]bool{}
+	for _, target_file := range target_files {
+		for _, exported_func := range lib_exports_map[target_file] {
+			if fixed_funcs[exported_func] {
+				exported_fixed_funcs[exported_func] = true
+			}
+		}
+	}
+	return exported_fixed_funcs
+}
@@ -0,0 +1,66 @@
+package ubuntu
+
+import (
+	"strings"
+
+	"github.com/yomaytk/go_ltrace/pkg/debversion"
+	ttypes "github.com/yomaytk/go_ltrace/types"
+)
+
+// the status of the package in Ubuntu CVE Tracker
+const (
+	STATUS_DNE          = "DNE"
+	STATUS_NOT_AFFECTED = "not-affected"
+	STATUS_RELEASED     = "released"
+	STATUS_PENDING      = "pending"
+	STATUS_NEEDED       = "needed"
+	STATUS_NEEDS_TRIAGE = "needs-triage"
+	STATUS_DEFERRED     = "deferred"
+	STATUS_IGNORED      = "ignored"
+	STATUS_ACTIVE       = "active"
+)
+
+// the fixed version written in SubInfo. ex.) "(2.35-0ubuntu3.1)"
+func (spd SpecificPatchData) FixedVersion() string {
+	sub_info := strings.TrimSpace(spd.SubInfo)
+	if !strings.HasPrefix(sub_info, "(") || !strings.HasSuffix(sub_info, ")") {
+		return ""
+	}
+	return strings.TrimSpace(sub_info[1 : len(sub_info)-1])
+}
+
+// Evaluate returns whether the installed package is affected and the reason.
+// the version written in Ubuntu CVE Tracker is the source package version.
+func (spd SpecificPatchData) Evaluate(package_detail ttypes.PackageDetail) (bool, string) {
+
+	installed_version := package_detail.SourceVersion
+	if strings.Compare(installed_version, "") == 0 {
+		installed_version = package_detail.Version
+	}
+
+	switch spd.Affected {
+	case STATUS_DNE, STATUS_NOT_AFFECTED:
+		return false, spd.Affected
+	case STATUS_RELEASED, STATUS_PENDING:
+		fixed_version := spd.FixedVersion()
+		// the fixed version is unknown
+		if strings.Compare(fixed_version, "") == 0 || strings.Compare(installed_version, "") == 0 {
+			return true, spd.Affected + " without the comparable version"
+		}
+		ret, err := debversion.Compare(installed_version, fixed_version)
+		if err != nil {
+			return true, "cannot compare the versions: " + err.Error()
+		}
+		if ret >= 0 {
+			return false, "fixed in " + fixed_version + " (installed " + installed_version + ")"
+		}
+		return true, "fixed in " + fixed_version + " but installed " + installed_version
+	case STATUS_NEEDED, STATUS_NEEDS_TRIAGE, STATUS_DEFERRED, STATUS_ACTIVE:
+		return true, spd.Affected
+	case STATUS_IGNORED:
+		// the fix will not be provided (ex. end of life)
+		return true, strings.TrimSpace(spd.Affected + " " + spd.SubInfo)
+	default:
+		return true, "unknown status '" + spd.Affected + "'"
+	}
+}
@@ -0,0 +1,31 @@
+package ubuntu
+
+import (
+	"testing"
+
+	ttypes "github.com/yomaytk/go_ltrace/types"
+)
+
+func TestEvaluate(t *testing.T) {
+	package_detail := ttypes.PackageDetail{Binaryp: "libc6", Sourcep: "glibc", Version: "2.35-0ubuntu3.1", SourceVersion: "2.35-0ubuntu3.1"}
+	tests := []struct {
+		spd      SpecificPatchData
+		affected bool
+	}{
+		{SpecificPatchData{Affected: "released", SubInfo: "(2.35-0ubuntu3.1)"}, false},
+		{SpecificPatchData{Affected: "released", SubInfo: "(2.35-0ubuntu3)"}, false},
+		{SpecificPatchData{Affected: "released", SubInfo: "(2.35-0ubuntu3.6)"}, true},
+		{SpecificPatchData{Affected: "released", SubInfo: ""}, true},
+		{SpecificPatchData{Affected: "pending", SubInfo: "(2.35-0ubuntu3.2)"}, true},
+		{SpecificPatchData{Affected: "needed", SubInfo: ""}, true},
+		{SpecificPatchData{Affected: "deferred", SubInfo: "(2023-01-01)"}, true},
+		{SpecificPatchData{Affected: "ignored", SubInfo: "(end of life)"}, true},
+		{SpecificPatchData{Affected: "not-affected", SubInfo: "(code not present)"}, false},
+		{SpecificPatchData{Affected: "DNE", SubInfo: ""}, false},
+	}
+	for _, test := range tests {
+		if affected, reason := test.spd.Evaluate(package_detail); affected != test.affected {
+			t.Errorf("%+v: affected = %v (%v), expected %v", test.spd, affected, reason, test.affected)
+		}
+	}
+}
@@ -3,15 +3,18 @@ package ubuntu
 import (
 	"fmt"
 	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"reflect"
 	"regexp"
 	"strings"
+	"time"
 
 	jsoniter "github.com/json-iterator/go"
 
 	log "github.com/yomaytk/go_ltrace/log"
 	ttypes "github.com/yomaytk/go_ltrace/types"
-	uutil "github.com/yomaytk/go_ltrace/util"
 	types "github.com/yomaytk/go_ltrace/vulndb"
 	git "github.com/yomaytk/go_ltrace/vulndb/gitrepo"
 	"go.etcd.io/bbolt"
@@ -19,8 +22,11 @@ import (
 )
 
 const (
-	UBUNTU_SRC_PATH   = "vulnsrc/ubuntu/ubuntu-cve-tracker/active/"
-	VULNDB            = "./cache/VulnDB"
+	// the distro of the database, which is shown in the hint of 'db build -distro'
+	DISTRO             = "ubuntu"
+	UBUNTU_TRACKER_URL = "https://git.launchpad.net/ubuntu-cve-tracker"
+	// the directory of the active CVEs in ubuntu-cve-tracker
+	UBUNTU_ACTIVE_DIR = "active"
 	CVE_TABLE         = "UbuntuCVE"
 	CVE_PACKAGE_TABLE = "CVEForPackage"
 )
@@ -85,31 +91,61 @@ type UbuntuOperation struct {
 	*QueryOperation
 }
 
-func NewUbuntuOperation(author_name string, os_version string) *UbuntuOperation {
-	return &UbuntuOperation{OsVersion: os_version, DBOperation: NewDBOperation(author_name), QueryOperation: NewQueryOperation(os_version)}
+func NewUbuntuOperation(os_version string, db_path string, tracker_path string, git_operation git.GitOperation) *UbuntuOperation {
+	return &UbuntuOperation{OsVersion: os_version, DBOperation: NewDBOperation(db_path, tracker_path), QueryOperation: NewQueryOperation(os_version, db_path, git_operation)}
 }
 
-func (uop *UbuntuOperation) GetCVEs(src_bin_map map[ttypes.PackageDetail][]string) (map[string][]UbuntuCVE, error) {
-	src_cves_map := uop.QueryOperation.GetTargetCVEs(src_bin_map)
-	exploitable_cves, err := uop.QueryOperation.GetCVEExploitability(src_bin_map, src_cves_map)
-	uutil.ErrFatal(err)
-	return exploitable_cves, nil
+type QueryOperation struct {
+	Distro       string
+	OsVersion    string
+	DBPath       string
+	GitOperation git.GitOperation
 }
 
-type QueryOperation struct {
-	OsVersion       string
-	GithubOperation *git.GithubOperation
+func NewQueryOperation(os_version string, db_path string, git_operation git.GitOperation) *QueryOperation {
+	return &QueryOperation{Distro: DISTRO, OsVersion: os_version, DBPath: db_path, GitOperation: git_operation}
+}
+
+// GetCVEs returns the findings and the packages or CVEs which cannot be evaluated.
+func (qop *QueryOperation) GetCVEs(src_bin_map map[ttypes.PackageDetail][]string) ([]types.Finding, []types.Failure, error) {
+	src_cves_map, failures, err := qop.GetTargetCVEs(src_bin_map)
+	if err != nil {
+		return nil, nil, err
+	}
+	findings, err := qop.GetCVEExploitability(src_bin_map, src_cves_map)
+	if err != nil {
+		return nil, nil, err
+	}
+	return findings, failures, nil
 }
 
-func NewQueryOperation(os_version string) *QueryOperation {
-	return &QueryOperation{OsVersion: os_version, GithubOperation: git.NewGithubOperation()}
+// GetReachableCVEs returns the findings filtered by the called functions and the packages or CVEs which cannot be evaluated.
+func (qop *QueryOperation) GetReachableCVEs(src_bin_map map[ttypes.PackageDetail][]string, lib_funcs_map map[string][]string, lib_exports_map map[string][]string) ([]types.Finding, []types.Failure, error) {
+	src_cves_map, failures, err := qop.GetTargetCVEs(src_bin_map)
+	if err != nil {
+		return nil, nil, err
+	}
+	findings, patch_failures, err := qop.GetCVEReachability(src_bin_map, src_cves_map, lib_funcs_map, lib_exports_map)
+	if err != nil {
+		return nil, nil, err
+	}
+	return findings, append(failures, patch_failures...), nil
 }
 
-func (qop *QueryOperation) GetTargetCVEs(src_bin_map map[ttypes.PackageDetail][]string) map[ttypes.PackageDetail][]UbuntuCVE {
+// GetTargetCVEs gets the CVEs of the source packages from VulnDB.
+// the broken records are returned as the failures, and only the failure of VulnDB itself is the error.
+func (qop *QueryOperation) GetTargetCVEs(src_bin_map map[ttypes.PackageDetail][]string) (map[ttypes.PackageDetail][]UbuntuCVE, []types.Failure, error) {
 
 	src_cves_map := map[ttypes.PackageDetail][]UbuntuCVE{}
-	db, err := bbolt.Open(VULNDB, 0600, nil)
-	uutil.ErrFatal(err)
+	failures := []types.Failure{}
+	if _, err := os.Stat(qop.DBPath); err != nil {
+		return src_cves_map, failures, xerrors.Errorf("cannot find %v (run 'db build -distro %v'): %w", qop.DBPath, qop.Distro, err)
+	}
+	db, err := bbolt.Open(qop.DBPath, 0600, &bbolt.Options{ReadOnly: true, Timeout: time.Second})
+	if err != nil {
+		return src_cves_map, failures, xerrors.Errorf("cannot open %v: %w", qop.DBPath, err)
+	}
+	defer db.Close()
 	json := jsoniter.ConfigCompatibleWithStandardLibrary
 
 	// get target CVEs for every source package
@@ -129,14 +165,18 @@ func (qop *QueryOperation) GetTargetCVEs(src_bin_map map[ttypes.PackageDetail][]
 				log.Logger.Infoln("%v don't have vulnelability.\n", key.Sourcep)
 				continue
 			}
-			err := json.Unmarshal(data, &cveids)
-			uutil.ErrFatal(err)
+			if err := json.Unmarshal(data, &cveids); err != nil {
+				failures = append(failures, types.NewFailure(key.Sourcep, "", xerrors.Errorf("cannot decode the CVE ids: %w", err)))
+				continue
+			}
 			src_and_cveids[key] = cveids
 		}
 
 		return nil
 	})
-	uutil.ErrFatal(err)
+	if err != nil {
+		return src_cves_map, failures, err
+	}
 
 	// get target cves
 	for src, cveids := range src_and_cveids {
@@ -144,7 +184,7 @@ func (qop *QueryOperation) GetTargetCVEs(src_bin_map map[ttypes.PackageDetail][]
 
 			b := tx.Bucket([]byte(CVE_TABLE))
 			if b == nil {
-				return xerrors.Errorf("Cannot find %v. second \n", CVE_PACKAGE_TABLE)
+				return xerrors.Errorf("Cannot find %v.\n", CVE_TABLE)
 			}
 
 			cves := []UbuntuCVE{}
@@ -152,35 +192,112 @@ func (qop *QueryOperation) GetTargetCVEs(src_bin_map map[ttypes.PackageDetail][]
 			for _, cveid := range cveids {
 				var cve UbuntuCVE
 				data := b.Get([]byte(cveid))
-				err := json.Unmarshal(data, &cve)
-				uutil.ErrFatal(err)
+				if data == nil {
+					failures = append(failures, types.NewFailure(src.Sourcep, cveid, xerrors.Errorf("%v is not found in %v.\n", cveid, CVE_TABLE)))
+					continue
+				}
+				if err := json.Unmarshal(data, &cve); err != nil {
+					failures = append(failures, types.NewFailure(src.Sourcep, cveid, xerrors.Errorf("cannot decode the CVE: %w", err)))
+					continue
+				}
 				cves = append(cves, cve)
 			}
 			src_cves_map[src] = cves
 
 			return nil
 		})
-		uutil.ErrFatal(err)
+		if err != nil {
+			return src_cves_map, failures, err
+		}
 	}
 
-	return src_cves_map
+	return src_cves_map, failures, nil
 }
 
-func (qop *QueryOperation) GetCVEExploitability(src_bin_map map[ttypes.PackageDetail][]string, src_cves_map map[ttypes.PackageDetail][]UbuntuCVE) (map[string][]UbuntuCVE, error) {
+// GetCVEExploitability returns every CVE of the target packages with the verdict and the reason.
+// the fixed files of the patch are the sources (ex. crypto/x509.c) and cannot be compared with the used
+// shared libraries, so the CVE affecting the installed version is kept without fetching the patch.
+func (qop *QueryOperation) GetCVEExploitability(src_bin_map map[ttypes.PackageDetail][]string, src_cves_map map[ttypes.PackageDetail][]UbuntuCVE) ([]types.Finding, error) {
+
+	fmt.Fprintln(os.Stderr, "[+] GetCVEExploitability Start.")
+
+	findings := []types.Finding{}
+
+	for package_detail, cves := range src_cves_map {
+
+		// ignore ESM support in current design
+		ubuntu_version := NewUbuntuVersion(qop.OsVersion, "")
+
+		for _, cve := range cves {
+			target_patches, finding := qop.getTargetPatches(cve, package_detail, ubuntu_version)
+			// if patch is not public, we consider this cve is affected
+			if finding.Kept() && len(target_patches.DiffURLs) == 0 {
+				finding.Reason += "; the patch is not public"
+			}
+			findings = append(findings, finding)
+		}
+	}
 
-	fmt.Println("[+] GetCVEExploitability Start.")
+	fmt.Fprintln(os.Stderr, "[-] GetCVEExploitability End.")
 
-	// key: sourcep, value: ubuntu_cves
-	exploitable_cves := map[string][]UbuntuCVE{}
+	return findings, nil
+}
 
-	// key: sourcep, value: shared_libraries
+// get the patches of the source package and the finding whether the installed package is affected
+func (qop *QueryOperation) getTargetPatches(cve UbuntuCVE, package_detail ttypes.PackageDetail, ubuntu_version UbuntuVersion) (PatchData, types.Finding) {
+	target_patches := cve.Patches[package_detail.Sourcep]
+	finding := types.Finding{CVE: cve.CVE, Package: package_detail, PatchURLs: target_patches.DiffURLs}
+	// the patch for target OsVersion doesn't exist.
+	specific_patch_data, ok := target_patches.SpecificPatchDatas[ubuntu_version]
+	if !ok {
+		finding.Verdict = types.VERDICT_FILTERED
+		finding.Justification = types.JUSTIFICATION_NOT_TRACKED
+		finding.Reason = "not tracked for " + qop.OsVersion
+		return target_patches, finding
+	}
+	finding.Status = strings.TrimSpace(specific_patch_data.Affected + " " + specific_patch_data.SubInfo)
+	affected, reason := specific_patch_data.Evaluate(package_detail)
+	if !affected {
+		log.Logger.Infow("not affected", "cve", cve.Candidate, "source", package_detail.Sourcep, "reason", reason)
+		finding.Verdict = types.VERDICT_FILTERED
+		finding.Justification = types.JUSTIFICATION_FIXED
+		switch specific_patch_data.Affected {
+		case STATUS_DNE, STATUS_NOT_AFFECTED:
+			finding.Justification = types.JUSTIFICATION_NOT_PRESENT
+		}
+	} else {
+		finding.Verdict = types.VERDICT_KEPT
+	}
+	finding.Reason = reason
+	return target_patches, finding
+}
+
+// GetCVEReachability keeps the CVEs whose upstream fix touches the functions called by the target.
+// the CVE is also kept if the fixed functions cannot be specified (the patch is not public, unsupported URL,
+// no fixed function is exported, etc.).
+// the CVE whose patch cannot be fetched or parsed is returned as the failure too.
+func (qop *QueryOperation) GetCVEReachability(src_bin_map map[ttypes.PackageDetail][]string, src_cves_map map[ttypes.PackageDetail][]UbuntuCVE, lib_funcs_map map[string][]string, lib_exports_map map[string][]string) ([]types.Finding, []types.Failure, error) {
+
+	fmt.Fprintln(os.Stderr, "[+] GetCVEReachability Start.")
+
+	findings := []types.Finding{}
+	failures := []types.Failure{}
+
+	// key: sourcep, value: called functions
+	src_funcs_map := map[string]map[string]bool{}
+	// key: sourcep, value: used libraries
 	src_files_map := map[string][]string{}
 	for package_detail, target_files := range src_bin_map {
-		if files, ok := src_files_map[package_detail.Sourcep]; ok {
-			files = append(files, target_files...)
-			src_files_map[package_detail.Sourcep] = files
-		} else {
-			src_files_map[package_detail.Sourcep] = target_files
+		src_files_map[package_detail.Sourcep] = append(src_files_map[package_detail.Sourcep], target_files...)
+		call_funcs, ok := src_funcs_map[package_detail.Sourcep]
+		if !ok {
+			call_funcs = map[string]bool{}
+			src_funcs_map[package_detail.Sourcep] = call_funcs
+		}
+		for _, target_file := range target_files {
+			for _, call_func := range lib_funcs_map[target_file] {
+				call_funcs[call_func] = true
+			}
 		}
 	}
 
@@ -189,153 +306,286 @@ func (qop *QueryOperation) GetCVEExploitability(src_bin_map map[ttypes.PackageDe
 		sourcep := package_detail.Sourcep
 		// ignore ESM support in current design
 		ubuntu_version := NewUbuntuVersion(qop.OsVersion, "")
+		call_funcs := src_funcs_map[sourcep]
 
 		for _, cve := range cves {
-			target_patches := cve.Patches[sourcep]
-			// the patch for target OsVersion doesn't exist.
-			var specific_patch_data SpecificPatchData
-			if value, ok := target_patches.SpecificPatchDatas[ubuntu_version]; ok {
-				specific_patch_data = value
-			} else {
+			target_patches, finding := qop.getTargetPatches(cve, package_detail, ubuntu_version)
+			if !finding.Kept() {
+				findings = append(findings, finding)
 				continue
 			}
-			affected := specific_patch_data.Affected
-			// this cve is not affected
-			if strings.Compare(affected, "DNE") == 0 || strings.Compare(affected, "not-affected") == 0 {
+
+			// get the fixed functions of patch
+			fixed_funcs := map[string]bool{}
+			specified := len(target_patches.DiffURLs) > 0
+			for _, diff_url := range target_patches.DiffURLs {
+				if !qop.GitOperation.Supported(diff_url) {
+					specified = false
+					continue
+				}
+				new_fixed_funcs, err := qop.GitOperation.GetFixedFuncs(diff_url)
+				if err != nil {
+					log.Logger.Infoln("cannot get fixed functions:", err)
+					failures = append(failures, types.NewFailure(sourcep, cve.Candidate, err))
+					specified = false
+					continue
+				}
+				for new_fixed_func := range new_fixed_funcs {
+					fixed_funcs[new_fixed_func] = true
+				}
+			}
+			log.Logger.Infow("fixed_funcs", "source", sourcep, "cve", cve.Candidate, "fixed_funcs", fixed_funcs)
+
+			// compare the called functions to fixed functions
+			if !specified || len(fixed_funcs) == 0 {
+				finding.Reason += "; the fixed functions cannot be specified"
+				findings = append(findings, finding)
 				continue
 			}
-			// if patch is not public, we consider this cve is affected
-			if len(target_patches.DiffURLs) == 0 {
-				if ex_cves, ok := exploitable_cves[sourcep]; ok {
-					ex_cves = append(ex_cves, cve)
-					exploitable_cves[sourcep] = ex_cves
-				} else {
-					exploitable_cves[sourcep] = []UbuntuCVE{cve}
-				}
+			// the fix of only the internal functions may be reached by any exported function
+			fixed_funcs = types.ExportedFixedFuncs(fixed_funcs, src_files_map[sourcep], lib_exports_map)
+			if len(fixed_funcs) == 0 {
+				finding.Reason += "; the fixed functions cannot be specified (no fixed function is exported)"
+				findings = append(findings, finding)
 				continue
 			}
-			// get the fixed files of patch
-			fixed_files := map[string]bool{}
-			for _, diff_url := range target_patches.DiffURLs {
-				if strings.Contains(diff_url, "github.com") {
-					new_fixed_files, err := qop.GithubOperation.GetFixedFiles(diff_url)
-					for new_fixed_file, _ := range new_fixed_files {
-						fixed_files[new_fixed_file] = true
-					}
-					uutil.ErrFatal(err)
-					log.Logger.Infoln("source: %v", sourcep)
-					log.Logger.Infow("fixed_files", fixed_files)
+			called_func := ""
+			for fixed_func := range fixed_funcs {
+				if call_funcs[fixed_func] {
+					called_func = fixed_func
+					break
 				}
 			}
-			// compare the used files to fixed files
-			used_files := src_files_map[sourcep]
-			for _, used_file := range used_files {
-				for fixed_file, _ := range fixed_files {
-					// used file is fixed
-					if strings.Contains(used_file, fixed_file) {
-						if cves, ok := exploitable_cves[sourcep]; ok {
-							cves = append(cves, cve)
-							exploitable_cves[sourcep] = cves
-						} else {
-							exploitable_cves[sourcep] = []UbuntuCVE{cve}
-						}
-						break
-					}
-				}
+			if strings.Compare(called_func, "") == 0 {
+				finding.Verdict = types.VERDICT_FILTERED
+				finding.Justification = types.JUSTIFICATION_NOT_REACHABLE
+				finding.Reason += "; no fixed function is called"
+			} else {
+				finding.Reason += "; the fixed function is called (" + called_func + ")"
 			}
+			findings = append(findings, finding)
 		}
 	}
 
-	fmt.Println("[+] GetCVEExploitability End.")
+	fmt.Fprintln(os.Stderr, "[-] GetCVEReachability End.")
 
-	return exploitable_cves, nil
+	return findings, failures, nil
 }
 
 type DBOperation struct {
 	CVEsForPackage map[string][]string `json:"packages_for_query"`
 	UbuntuCVEs     []UbuntuCVE         `json:"ubuntu_cves"`
+	DBPath         string              `json:"-"`
+	// the checkout of ubuntu-cve-tracker
+	TrackerPath string `json:"-"`
+	Distro      string `json:"-"`
 }
 
-func NewDBOperation(author_name string) *DBOperation {
-	return &DBOperation{CVEsForPackage: map[string][]string{}, UbuntuCVEs: []UbuntuCVE{}}
+func NewDBOperation(db_path string, tracker_path string) *DBOperation {
+	return &DBOperation{CVEsForPackage: map[string][]string{}, UbuntuCVEs: []UbuntuCVE{}, DBPath: db_path, TrackerPath: tracker_path, Distro: DISTRO}
 }
 
-func (uop *DBOperation) CollectCVEs() {
+// CollectCVEs parses the CVE files of ubuntu-cve-tracker. the broken CVE files are skipped and returned as the failures.
+func (uop *DBOperation) CollectCVEs() ([]types.Failure, error) {
 
-	fmt.Println("[+] Collect Ubuntu CVEs Start.")
-	files, err := ioutil.ReadDir(UBUNTU_SRC_PATH)
-	uutil.ErrFatal(err)
+	fmt.Fprintln(os.Stderr, "[+] Collect Ubuntu CVEs Start.")
+	src_path := filepath.Join(uop.TrackerPath, UBUNTU_ACTIVE_DIR)
+	files, err := ioutil.ReadDir(src_path)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot read ubuntu-cve-tracker (run 'db update'): %w", err)
+	}
 	ucp := CVEParser{}
+	failures := []types.Failure{}
 
 	for _, file := range files {
 		if strings.HasPrefix(file.Name(), "CVE") {
-			data, err := ioutil.ReadFile(UBUNTU_SRC_PATH + file.Name())
-			uutil.ErrFatal(err)
-			err2 := ucp.Parse(string(data), uop)
-			uutil.ErrFatal(err2)
+			data, err := ioutil.ReadFile(filepath.Join(src_path, file.Name()))
+			if err != nil {
+				failures = append(failures, types.NewFailure("", file.Name(), err))
+				continue
+			}
+			if err := ucp.Parse(string(data), uop); err != nil {
+				failures = append(failures, types.NewFailure("", file.Name(), err))
+			}
 		}
 	}
 
-	fmt.Println("[-] Collect Ubuntu CVEs End.")
+	fmt.Fprintln(os.Stderr, "[-] Collect Ubuntu CVEs End.")
+
+	return failures, nil
 }
 
-func (uop *DBOperation) NewDB() {
+// NewDB builds VulnDB from ubuntu-cve-tracker and returns the CVE files which cannot be parsed.
+func (uop *DBOperation) NewDB() ([]types.Failure, error) {
 
-	fmt.Println("[+] Ubuntu NewDB Start.")
-	json := jsoniter.ConfigCompatibleWithStandardLibrary
+	fmt.Fprintln(os.Stderr, "[+] Ubuntu NewDB Start.")
 
 	// collect CVE information from ubuntu-cve-tracker
-	uop.CollectCVEs()
+	failures, err := uop.CollectCVEs()
+	if err != nil {
+		return nil, err
+	}
+	if err := uop.Save(); err != nil {
+		return failures, err
+	}
+
+	fmt.Fprintln(os.Stderr, "[-] Ubuntu NewDB End.")
+
+	return failures, nil
+}
+
+// Save writes the collected CVEs and the CVE ids for every package to VulnDB.
+func (uop *DBOperation) Save() error {
 
-	db, err := bbolt.Open(VULNDB, 0600, nil)
-	uutil.ErrFatal(err)
+	json := jsoniter.ConfigCompatibleWithStandardLibrary
+
+	if err := os.MkdirAll(filepath.Dir(uop.DBPath), 0755); err != nil {
+		return xerrors.Errorf("cannot create the directory of %v: %w", uop.DBPath, err)
+	}
+	db, err := bbolt.Open(uop.DBPath, 0600, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		return xerrors.Errorf("cannot open %v: %w", uop.DBPath, err)
+	}
 	defer db.Close()
 
 	// save all Ubuntu CVE
 	err = db.Update(func(tx *bbolt.Tx) error {
 		b, err := tx.CreateBucketIfNotExists([]byte(CVE_TABLE))
-		uutil.ErrFatal(err)
+		if err != nil {
+			return err
+		}
 
 		for _, ubuntu_cve := range uop.UbuntuCVEs {
 
 			// key and value
 			key := ubuntu_cve.Candidate
 			bytes, err := json.Marshal(ubuntu_cve)
-			uutil.ErrFatal(err)
+			if err != nil {
+				return xerrors.Errorf("cannot encode %v: %w", key, err)
+			}
 
 			// save
-			err = b.Put([]byte(key), bytes)
-			uutil.ErrFatal(err)
+			if err := b.Put([]byte(key), bytes); err != nil {
+				return err
+			}
 		}
 
 		return nil
 	})
+	if err != nil {
+		return xerrors.Errorf("cannot save %v: %w", CVE_TABLE, err)
+	}
 
 	// save CVE ids for every package
 	err = db.Update(func(tx *bbolt.Tx) error {
 		b, err := tx.CreateBucketIfNotExists([]byte(CVE_PACKAGE_TABLE))
-		uutil.ErrFatal(err)
+		if err != nil {
+			return err
+		}
 
 		for key, value := range uop.CVEsForPackage {
 
 			// value
 			bytes, err := json.Marshal(value)
-			uutil.ErrFatal(err)
+			if err != nil {
+				return xerrors.Errorf("cannot encode the CVE ids of %v: %w", key, err)
+			}
 
 			// save
-			err = b.Put([]byte(key), bytes)
-			uutil.ErrFatal(err)
+			if err := b.Put([]byte(key), bytes); err != nil {
+				return err
+			}
 		}
 
 		return nil
 	})
+	if err != nil {
+		return xerrors.Errorf("cannot save %v: %w", CVE_PACKAGE_TABLE, err)
+	}
+
+	return nil
+}
+
+// UpdateSource clones ubuntu-cve-tracker or pulls the latest commits of it.
+func (uop *DBOperation) UpdateSource() error {
+	return UpdateCheckout(UBUNTU_TRACKER_URL, uop.TrackerPath)
+}
+
+// UpdateCheckout clones the repository to the path or pulls the latest commits of it.
+func UpdateCheckout(repository_url string, path string) error {
+
+	var cmd *exec.Cmd
+	if _, err := os.Stat(filepath.Join(path, ".git")); err == nil {
+		cmd = exec.Command("git", "-C", path, "pull", "--ff-only")
+	} else {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return xerrors.Errorf("cannot create the directory of %v: %w", path, err)
+		}
+		cmd = exec.Command("git", "clone", "--depth", "1", repository_url, path)
+	}
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return xerrors.Errorf("cannot update %v: %w", path, err)
+	}
 
-	fmt.Println("[-] Ubuntu NewDB End.")
+	return nil
+}
+
+type DBInfo struct {
+	Path       string
+	Size       int64
+	ModTime    time.Time
+	CVEs       int
+	Packages   int
+	TrackerRev string
+}
+
+// GetDBInfo gets the size and the number of the records of VulnDB.
+func (uop *DBOperation) GetDBInfo() (DBInfo, error) {
+
+	info := DBInfo{Path: uop.DBPath}
+
+	fi, err := os.Stat(uop.DBPath)
+	if err != nil {
+		return info, xerrors.Errorf("cannot find %v (run 'db build -distro %v'): %w", uop.DBPath, uop.Distro, err)
+	}
+	info.Size = fi.Size()
+	info.ModTime = fi.ModTime()
+
+	db, err := bbolt.Open(uop.DBPath, 0600, &bbolt.Options{ReadOnly: true, Timeout: time.Second})
+	if err != nil {
+		return info, xerrors.Errorf("cannot open %v: %w", uop.DBPath, err)
+	}
+	defer db.Close()
+
+	err = db.View(func(tx *bbolt.Tx) error {
+		if b := tx.Bucket([]byte(CVE_TABLE)); b != nil {
+			info.CVEs = b.Stats().KeyN
+		}
+		if b := tx.Bucket([]byte(CVE_PACKAGE_TABLE)); b != nil {
+			info.Packages = b.Stats().KeyN
+		}
+		return nil
+	})
+	if err != nil {
+		return info, err
+	}
+
+	// the revision of ubuntu-cve-tracker (not found if the source is removed)
+	if out, err := exec.Command("git", "-C", uop.TrackerPath, "rev-parse", "HEAD").Output(); err == nil {
+		info.TrackerRev = strings.TrimSpace(string(out))
+	}
+
+	return info, nil
 }
 
 func (ucp CVEParser) GetOneItemOnMetaData(lines []string, id *int) (string, string, error) {
 	content := ""
 	colon_id := strings.Index(lines[*id], ":")
+	if colon_id == -1 {
+		return "", "", xerrors.Errorf("Bug: GetOneItemOnMetaData 'item:' is expected. line: %v\n", lines[*id])
+	}
 	target_item := lines[*id][:colon_id]
 
 	if !meta_data_item_map[target_item] {
@@ -343,13 +593,11 @@ func (ucp CVEParser) GetOneItemOnMetaData(lines []string, id *int) (string, stri
 	}
 
 	// include content in the same line of target_item
-	if colon_id < len(lines[*id]) {
-		content += lines[*id][colon_id:]
-	}
+	content += strings.TrimSpace(lines[*id][colon_id+1:])
 
 	*id++
 
-	for {
+	for *id < len(lines) {
 		first_colon_id := strings.Index(lines[*id], ":")
 		if first_colon_id != -1 {
 			ss := lines[*id][:first_colon_id]
@@ -357,7 +605,10 @@ func (ucp CVEParser) GetOneItemOnMetaData(lines []string, id *int) (string, stri
 				break
 			}
 		}
-		content += "\n" + lines[*id]
+		if strings.Compare(content, "") != 0 {
+			content += "\n"
+		}
+		content += lines[*id]
 		*id++
 	}
 
@@ -374,6 +625,9 @@ func (ucp CVEParser) Parse(s string, uop *DBOperation) error {
 	ubuntu_cve_elems := reflect.ValueOf(&ubuntu_cve).Elem()
 	line_id := 0
 	for {
+		if line_id >= len(lines) {
+			return xerrors.Errorf("the CVSS item is not found.\n")
+		}
 		// for CVE-2020-5504
 		if strings.Compare(lines[line_id], "") == 0 {
 			line_id++
@@ -383,7 +637,9 @@ func (ucp CVEParser) Parse(s string, uop *DBOperation) error {
 
 		// get the content for target_item
 		target_item, content, err := ucp.GetOneItemOnMetaData(lines, &line_id)
-		uutil.ErrFatal(err)
+		if err != nil {
+			return err
+		}
 
 		// convert target item for UbuntuCVE field name ex.) Discovered-by -> DiscoveredBy
 		target_item_words := strings.Split(target_item, "-")
@@ -444,6 +700,9 @@ func (ucp CVEParser) Parse(s string, uop *DBOperation) error {
 				strings.Compare(tokens[0], "distro:") == 0 || strings.Compare(tokens[0], "debian:") == 0 ||
 				strings.Compare(tokens[0], "android:") == 0 || strings.Compare(tokens[0], "ubuntu:") == 0 ||
 				strings.Compare(tokens[0], "redhat:") == 0 || strings.Compare(tokens[0], "usptream:") == 0 {
+				if len(tokens) < 2 {
+					return xerrors.Errorf("the patch URL is empty at '%v'\n", lines[lid])
+				}
 				upstream_url := tokens[1]
 				patch_data.DiffURLs = append(patch_data.DiffURLs, upstream_url)
 				continue
@@ -509,18 +768,14 @@ func (ucp CVEParser) Parse(s string, uop *DBOperation) error {
 			patch_data.SpecificPatchDatas[ubuntu_version] = specific_patch_data
 		}
 
-		// update CVEsForPackage
-		if cve_refs, ok := uop.CVEsForPackage[package_name]; ok {
-			cve_refs = append(cve_refs, ubuntu_cve.Candidate)
-			uop.CVEsForPackage[package_name] = cve_refs
-		} else {
-			uop.CVEsForPackage[package_name] = []string{ubuntu_cve.Candidate}
-		}
-
 		// append patch data of the package for CVE
 		ubuntu_cve.Patches[package_name] = patch_data
 	}
-	// update UbuntuCVEs
+
+	// update CVEsForPackage and UbuntuCVEs after the whole file is parsed
+	for package_name := range ubuntu_cve.Patches {
+		uop.CVEsForPackage[package_name] = append(uop.CVEsForPackage[package_name], ubuntu_cve.Candidate)
+	}
 	uop.UbuntuCVEs = append(uop.UbuntuCVEs, ubuntu_cve)
 
 	return nil
@@ -0,0 +1,232 @@
+package ubuntu
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	jsoniter "github.com/json-iterator/go"
+	log "github.com/yomaytk/go_ltrace/log"
+	ttypes "github.com/yomaytk/go_ltrace/types"
+	types "github.com/yomaytk/go_ltrace/vulndb"
+	"go.etcd.io/bbolt"
+)
+
+const SAMPLE_CVE = `Candidate: CVE-2023-0001
+PublicDate: 2023-01-01
+References:
+ https://www.cve.org/CVERecord?id=CVE-2023-0001
+Description:
+ sample vulnerability
+Ubuntu-Description:
+Notes:
+Mitigation:
+Bugs:
+Priority: medium
+Discovered-by:
+Assigned-to:
+CVSS:
+
+Patches_glibc:
+ upstream: https://github.com/bminor/glibc/commit/0123456789abcdef
+jammy_glibc: released (2.35-0ubuntu3.2)
+`
+
+func TestParse(t *testing.T) {
+
+	log.InitLogger("")
+
+	dop := NewDBOperation("", "")
+	if err := (CVEParser{}).Parse(SAMPLE_CVE, dop); err != nil {
+		t.Fatal(err)
+	}
+	if len(dop.UbuntuCVEs) != 1 {
+		t.Fatalf("cves = %v", dop.UbuntuCVEs)
+	}
+	cve := dop.UbuntuCVEs[0]
+	tests := []struct {
+		item    string
+		content string
+		answer  string
+	}{
+		{"Candidate", cve.Candidate, "CVE-2023-0001"},
+		{"PublicDate", cve.PublicDate, "2023-01-01"},
+		{"Priority", cve.Priority, "medium"},
+		{"Description", cve.Description, " sample vulnerability"},
+		{"Notes", cve.Notes, ""},
+	}
+	for _, test := range tests {
+		if strings.Compare(test.content, test.answer) != 0 {
+			t.Errorf("%v: got %q, want %q", test.item, test.content, test.answer)
+		}
+	}
+}
+
+func TestCollectCVEs(t *testing.T) {
+
+	log.InitLogger("")
+
+	tracker_path := t.TempDir()
+	active_dir := filepath.Join(tracker_path, UBUNTU_ACTIVE_DIR)
+	if err := os.MkdirAll(active_dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"CVE-2023-0001": SAMPLE_CVE,
+		"CVE-2023-0002": "Candidate: CVE-2023-0002\nbroken\n",
+		"CVE-2023-0003": strings.Replace(SAMPLE_CVE, "jammy_glibc:", "unknown_glibc:", 1),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(active_dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dop := NewDBOperation(filepath.Join(t.TempDir(), "VulnDB"), tracker_path)
+	failures, err := dop.NewDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the broken files are skipped without the records of them
+	if len(failures) != 2 || len(dop.UbuntuCVEs) != 1 {
+		t.Fatalf("failures = %v, cves = %v", failures, len(dop.UbuntuCVEs))
+	}
+	if cveids := dop.CVEsForPackage["glibc"]; len(cveids) != 1 || strings.Compare(cveids[0], dop.UbuntuCVEs[0].Candidate) != 0 {
+		t.Errorf("unexpected CVE ids: %v", cveids)
+	}
+
+	if _, err := NewDBOperation(dop.DBPath, t.TempDir()).CollectCVEs(); err == nil {
+		t.Errorf("the missing tracker is accepted")
+	}
+}
+
+func TestGetTargetCVEs(t *testing.T) {
+
+	log.InitLogger("")
+	json := jsoniter.ConfigCompatibleWithStandardLibrary
+
+	// VulnDB whose records are partially broken
+	db_path := filepath.Join(t.TempDir(), "VulnDB")
+	db, err := bbolt.Open(db_path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		cve_b, err := tx.CreateBucketIfNotExists([]byte(CVE_TABLE))
+		if err != nil {
+			return err
+		}
+		package_b, err := tx.CreateBucketIfNotExists([]byte(CVE_PACKAGE_TABLE))
+		if err != nil {
+			return err
+		}
+		// the record parsed from the tracker
+		dop := NewDBOperation("", "")
+		if err := (CVEParser{}).Parse(SAMPLE_CVE, dop); err != nil {
+			return err
+		}
+		data, err := json.Marshal(dop.UbuntuCVEs[0])
+		if err != nil {
+			return err
+		}
+		cve_b.Put([]byte("CVE-2023-0001"), data)
+		cve_b.Put([]byte("CVE-2023-0002"), []byte("{broken"))
+		package_b.Put([]byte("glibc"), []byte(`["CVE-2023-0001","CVE-2023-0002","CVE-2023-0003"]`))
+		package_b.Put([]byte("openssl"), []byte("broken"))
+		return nil
+	})
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	glibc := ttypes.PackageDetail{Binaryp: "libc6", Sourcep: "glibc"}
+	openssl := ttypes.PackageDetail{Binaryp: "libssl3", Sourcep: "openssl"}
+	src_cves_map, failures, err := NewQueryOperation("jammy", db_path, nil).GetTargetCVEs(map[ttypes.PackageDetail][]string{glibc: {}, openssl: {}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cves := src_cves_map[glibc]; len(cves) != 1 || strings.Compare(cves[0].Candidate, "CVE-2023-0001") != 0 {
+		t.Errorf("unexpected CVEs: %v", cves)
+	}
+	if len(failures) != 3 {
+		t.Errorf("unexpected failures: %v", failures)
+	}
+
+	// VulnDB itself is missing
+	if _, _, err := NewQueryOperation("jammy", filepath.Join(t.TempDir(), "VulnDB"), nil).GetTargetCVEs(map[ttypes.PackageDetail][]string{}); err == nil {
+		t.Errorf("the missing VulnDB is accepted")
+	}
+}
+
+// the provider which returns the fixed functions of every patch url
+type fixedFuncsProvider map[string][]string
+
+func (provider fixedFuncsProvider) Supported(git_url string) bool {
+	_, ok := provider[git_url]
+	return ok
+}
+
+func (provider fixedFuncsProvider) GetFixedFiles(git_url string) (map[string]bool, error) {
+	return map[string]bool{}, nil
+}
+
+func (provider fixedFuncsProvider) GetFixedFuncs(git_url string) (map[string]bool, error) {
+	fixed_funcs := map[string]bool{}
+	for _, fixed_func := range provider[git_url] {
+		fixed_funcs[fixed_func] = true
+	}
+	return fixed_funcs, nil
+}
+
+func TestGetCVEReachability(t *testing.T) {
+
+	log.InitLogger("")
+
+	const (
+		static_url   = "https://github.com/openssl/openssl/commit/0001"
+		exported_url = "https://github.com/openssl/openssl/commit/0002"
+		libssl       = "/usr/lib/x86_64-linux-gnu/libssl.so.3"
+	)
+	provider := fixedFuncsProvider{
+		// the patch touches only the static helper of SSL_read
+		static_url:   {"ssl3_read_internal"},
+		exported_url: {"ssl3_read_internal", "SSL_write"},
+	}
+	newCVE := func(cve_id string, diff_url string) UbuntuCVE {
+		cve := UbuntuCVE{Patches: map[string]PatchData{}}
+		cve.Candidate = cve_id
+		cve.Patches["openssl"] = PatchData{DiffURLs: []string{diff_url},
+			SpecificPatchDatas: map[UbuntuVersion]SpecificPatchData{NewUbuntuVersion("jammy", ""): {Affected: STATUS_NEEDED}}}
+		return cve
+	}
+
+	openssl := ttypes.PackageDetail{Binaryp: "libssl3", Sourcep: "openssl", Version: "3.0.2-0ubuntu1.10", SourceVersion: "3.0.2-0ubuntu1.10"}
+	src_bin_map := map[ttypes.PackageDetail][]string{openssl: {libssl}}
+	src_cves_map := map[ttypes.PackageDetail][]UbuntuCVE{openssl: {newCVE("CVE-2023-0001", static_url), newCVE("CVE-2023-0002", exported_url)}}
+	lib_funcs_map := map[string][]string{libssl: {"SSL_read"}}
+	lib_exports_map := map[string][]string{libssl: {"SSL_read", "SSL_write"}}
+
+	findings, failures, err := NewQueryOperation("jammy", "", provider).GetCVEReachability(src_bin_map, src_cves_map, lib_funcs_map, lib_exports_map)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 2 || len(failures) != 0 {
+		t.Fatalf("findings = %v, failures = %v", findings, failures)
+	}
+	for _, finding := range findings {
+		switch finding.CVE.Candidate {
+		case "CVE-2023-0001":
+			// the static function is reached by any exported function, so the CVE is kept
+			if !finding.Kept() || !strings.Contains(finding.Reason, "the fixed functions cannot be specified") {
+				t.Errorf("unexpected finding: %+v", finding)
+			}
+		case "CVE-2023-0002":
+			// SSL_write is exported but not called
+			if finding.Kept() || strings.Compare(finding.Justification, types.JUSTIFICATION_NOT_REACHABLE) != 0 {
+				t.Errorf("unexpected finding: %+v", finding)
+			}
+		}
+	}
+}